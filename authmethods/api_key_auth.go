@@ -1,26 +1,19 @@
 package authmethods
 
 import (
-	"bytes"
-	"crypto/tls"
 	"encoding/json"
-	"fmt"
 	"github.com/ARGOeu/argo-api-authn/bindings"
 	"github.com/ARGOeu/argo-api-authn/config"
 	"github.com/ARGOeu/argo-api-authn/servicetypes"
 	"github.com/ARGOeu/argo-api-authn/stores"
 	"github.com/ARGOeu/argo-api-authn/utils"
-	LOGGER "github.com/sirupsen/logrus"
 	"io"
-	"net/http"
-	"strconv"
-	"strings"
-	"time"
 )
 
 type ApiKeyAuthMethod struct {
 	BasicAuthMethod
-	AccessKey string `json:"access_key" required:"true"`
+	AccessKey     string `json:"access_key" required:"true" secret:"true"`
+	NextAccessKey string `json:"next_access_key,omitempty" secret:"true"`
 }
 
 // TempApiKeyAuthMethod represents the fields that are allowed to be modified
@@ -33,12 +26,27 @@ func NewApiKeyAuthMethod() AuthMethod {
 	return new(ApiKeyAuthMethod)
 }
 
-func (m *ApiKeyAuthMethod) Validate(store stores.Store) error {
+// Host returns the host of the service type that the auth method is registered for
+func (m *ApiKeyAuthMethod) Host() string {
+	return m.BasicAuthMethod.Host
+}
+
+// ServiceUUID returns the uuid of the service type that the auth method is registered for
+func (m *ApiKeyAuthMethod) ServiceUUID() string {
+	return m.BasicAuthMethod.ServiceUUID
+}
+
+// Type returns the type of the auth method
+func (m *ApiKeyAuthMethod) Type() string {
+	return m.BasicAuthMethod.Type
+}
+
+func (m *ApiKeyAuthMethod) Validate(store stores.Store, cfg config.Config) error {
 
 	var err error
 
 	// check if the embedded struct is valid
-	if err = m.BasicAuthMethod.Validate(store); err != nil {
+	if err = m.BasicAuthMethod.Validate(store, cfg); err != nil {
 		return err
 	}
 
@@ -78,15 +86,24 @@ func (m *ApiKeyAuthMethod) Update(r io.ReadCloser) (AuthMethod, error) {
 		return updatedAM, err
 	}
 
+	// a masked access key that has been sent back keeps the existing one
+	tempAM.AccessKey = unmaskSecret(tempAM.AccessKey, m.AccessKey)
+
 	// close the reader
 	if err = r.Close(); err != nil {
 		err := utils.APIGenericInternalError(err.Error())
 		return updatedAM, err
 	}
 
-	// fill the updated auth method with the already existing data
-	if err := utils.CopyFields(*m, updatedAM); err != nil {
-		err = utils.APIGenericInternalError(err.Error())
+	// fill the updated auth method with a deep copy of the already existing data,
+	// so the maps and slices of the existing auth method won't be modified by the update
+	if authMBytes, err = json.Marshal(*m); err != nil {
+		err := utils.APIGenericInternalError(err.Error())
+		return updatedAM, err
+	}
+
+	if err = json.Unmarshal(authMBytes, updatedAM); err != nil {
+		err := utils.APIGenericInternalError(err.Error())
 		return updatedAM, err
 	}
 
@@ -108,85 +125,6 @@ func (m *ApiKeyAuthMethod) Update(r io.ReadCloser) (AuthMethod, error) {
 }
 
 func (m *ApiKeyAuthMethod) RetrieveAuthResource(binding bindings.Binding, serviceType servicetypes.ServiceType, cfg *config.Config) (map[string]interface{}, error) {
-
-	var externalResp map[string]interface{}
-	var err error
-	var ok bool
-	var resp *http.Response
-	var authResource interface{}
-	var retrievalField string
-	var path string
-
-	if retrievalField, ok = cfg.ServiceTypesRetrievalFields[serviceType.Type]; !ok {
-		err = utils.APIGenericInternalError("Backend error")
-		LOGGER.Errorf("The retrieval field for type: %v was not found in the config retrieval fields: %v", serviceType.Type, cfg.ServiceTypesRetrievalFields)
-		return externalResp, err
-	}
-
-	if path, ok = cfg.ServiceTypesPaths[serviceType.Type]; !ok {
-		err = utils.APIGenericInternalError("Backend error")
-		LOGGER.Errorf("The path for type: %v was not found in the config retrieval fields: %v", serviceType.Type, cfg.ServiceTypesPaths)
-		return externalResp, err
-	}
-
-	// build the path that identifies the resource we are going to request
-	resourcePath := fmt.Sprintf("https://%v:%v%v", m.Host, strconv.Itoa(m.Port), path)
-	resourcePath = strings.Replace(resourcePath, "{{identifier}}", binding.UniqueKey, 1)
-	resourcePath = strings.Replace(resourcePath, "{{access_key}}", m.AccessKey, 1)
-
-	// build the client and execute the request
-	transCfg := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: !cfg.VerifySSL},
-	}
-
-	client := &http.Client{Transport: transCfg, Timeout: time.Duration(30 * time.Second)}
-
-	if resp, err = client.Get(resourcePath); err != nil {
-		err = utils.APIGenericInternalError(err.Error())
-		return externalResp, err
-	}
-
-	// evaluate the response
-	if resp.StatusCode >= 400 {
-		// convert the entire response body into a string and include into a genericAPIError
-		buf := bytes.Buffer{}
-		buf.ReadFrom(resp.Body)
-		err = utils.APIGenericInternalError(buf.String())
-		return externalResp, err
-	}
-
-	// get the response from the service type
-	if err = json.NewDecoder(resp.Body).Decode(&externalResp); err != nil {
-		err = utils.APIGenericInternalError(err.Error())
-		return externalResp, err
-	}
-
-	defer resp.Body.Close()
-
-	// check if the retrieval field that we need is present in the response
-	if authResource, ok = externalResp[retrievalField]; !ok {
-		err = utils.APIGenericInternalError(fmt.Sprintf("The specified retrieval field: `%v` was not found in the response body of the service type", retrievalField))
-		return externalResp, err
-	}
-
-	// if everything went ok, return the appropriate response field
-	return map[string]interface{}{"token": authResource}, err
-
-}
-
-func ApiKeyAuthFinder(serviceUUID string, host string, store stores.Store) ([]stores.QAuthMethod, error) {
-
-	var err error
-	var qAms []stores.QAuthMethod
-	var qApiAms []stores.QApiKeyAuthMethod
-
-	if qApiAms, err = store.QueryApiKeyAuthMethods(serviceUUID, host); err != nil {
-		return qAms, err
-	}
-
-	for _, apim := range qApiAms {
-		qAms = append(qAms, &apim)
-	}
-
-	return qAms, err
+	// the access key is part of the request template's path
+	return RetrieveFromUpstream(m, binding, serviceType, cfg, nil)
 }
@@ -1,6 +1,7 @@
 package authmethods
 
 import (
+	"github.com/ARGOeu/argo-api-authn/config"
 	"github.com/ARGOeu/argo-api-authn/stores"
 	"github.com/stretchr/testify/suite"
 	"testing"
@@ -27,38 +28,26 @@ func (suite *ApiKeyAuthMethodTestSuite) TestValidate() {
 	apk1.BasicAuthMethod = ba1
 	// normal case
 	apk1.AccessKey = "access_key"
-	err1 := apk1.Validate(mockstore)
+	err1 := apk1.Validate(mockstore, config.Config{})
 
 	// empty access_key
 	apk1 = ApiKeyAuthMethod{}
 	ba1 = BasicAuthMethod{ServiceUUID: "uuid1", Host: "host1", Port: 9000, Type: "api-key"}
 	apk1.BasicAuthMethod = ba1
-	err2 := apk1.Validate(mockstore)
+	err2 := apk1.Validate(mockstore, config.Config{})
 
 	suite.Nil(err1)
 	suite.Equal("auth method object contains empty fields. empty value for field: access_key", err2.Error())
 }
 
-func (suite *ApiKeyAuthMethodTestSuite) TestApiKeyAuthFinder() {
+func (suite *ApiKeyAuthMethodTestSuite) TestRegistration() {
 
-	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
-	mockstore.SetUp()
-
-	var expectedQams []stores.QAuthMethod
-
-	// normal case
-	amb1 := stores.QBasicAuthMethod{ServiceUUID: "uuid1", Host: "host1", Port: 9000, UUID: "am_uuid_1", CreatedOn: "", Type: "api-key"}
-	am1 := &stores.QApiKeyAuthMethod{AccessKey: "access_key"}
-	am1.QBasicAuthMethod = amb1
-	expectedQams = append(expectedQams, am1)
-
-	qAms, err1 := ApiKeyAuthFinder("uuid1", "host1", mockstore)
-
-	// nothing found
-	qAms2, err2 := ApiKeyAuthFinder("unknown_uuid", "host", mockstore)
+	// the auth method and its query model are created through the registry
+	am, err1 := NewAuthMethodFactory().Create("api-key")
+	qam, err2 := (&stores.QAuthMethodFactory{}).Create("api-key")
 
-	suite.Equal(expectedQams, qAms)
-	suite.Equal(0, len(qAms2))
+	suite.Equal(&ApiKeyAuthMethod{}, am)
+	suite.Equal(&stores.QApiKeyAuthMethod{}, qam)
 
 	suite.Nil(err1)
 	suite.Nil(err2)
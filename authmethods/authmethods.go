@@ -6,35 +6,38 @@ import (
 	"github.com/ARGOeu/argo-api-authn/config"
 	"github.com/ARGOeu/argo-api-authn/servicetypes"
 	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/ARGOeu/argo-api-authn/tokencache"
 	"github.com/ARGOeu/argo-api-authn/utils"
 	"github.com/satori/go.uuid"
 	LOGGER "github.com/sirupsen/logrus"
 	"io"
+	"sort"
+	"time"
 )
 
 type AuthMethodInit func() AuthMethod
 
-var AuthMethodsTypes = map[string]AuthMethodInit{
-	"api-key": NewApiKeyAuthMethod,
-	"headers": NewHeadersAuthMethod,
-}
-
-// A function type that refers to all the query functions for all the respective tuh method types
-type QueryAuthMethodFinder func(serviceUUID string, host string, store stores.Store) ([]stores.QAuthMethod, error)
-
-var QueryAuthMethodFinders = map[string]QueryAuthMethodFinder{
-	"api-key": ApiKeyAuthFinder,
-	"headers": HeadersAuthFinder,
-}
+// AuthMethodsTypes holds the registered auth method types, see Register
+var AuthMethodsTypes = map[string]AuthMethodInit{}
 
 type AuthMethod interface {
-	Validate(store stores.Store) error
+	// Basic gives access to the fields that are common to all the auth methods
+	Basic() *BasicAuthMethod
+	// Host, ServiceUUID and Type identify the auth method, along with its name
+	Host() string
+	ServiceUUID() string
+	Type() string
+	Validate(store stores.Store, cfg config.Config) error
 	Update(r io.ReadCloser) (AuthMethod, error)
 	RetrieveAuthResource(binding bindings.Binding, serviceType servicetypes.ServiceType, cfg *config.Config) (map[string]interface{}, error)
 }
 
 type AuthMethodsList struct {
 	AuthMethods []AuthMethod `json:"auth_methods"`
+	// NextPageToken is the token of the next page of a paginated listing, it is empty on the last page
+	NextPageToken string `json:"nextPageToken,omitempty"`
+	// TotalSize is the number of all the auth methods that the listing matches
+	TotalSize int `json:"totalSize"`
 }
 
 // AuthMethodConvertToQueryModel converts an auth method to a query auth method
@@ -78,6 +81,13 @@ func QueryModelConvertToAuthMethod(fromQam stores.QAuthMethod, toType string) (A
 		return authMethod, err
 	}
 
+	// the secrets of the query auth method might be encrypted
+	if fromQam, err = stores.DecryptSecrets(fromQam); err != nil {
+		LOGGER.Errorf("Could not decrypt the secrets of an auth method. %v", err.Error())
+		err = utils.APIGenericInternalError("Could not decrypt the secrets of the auth method")
+		return authMethod, err
+	}
+
 	// convert the query auth method to bytes
 	if qAuthMethodBytes, err = json.Marshal(fromQam); err != nil {
 		err = utils.APIGenericInternalError(err.Error())
@@ -94,61 +104,91 @@ func QueryModelConvertToAuthMethod(fromQam stores.QAuthMethod, toType string) (A
 
 }
 
-// AuthMethodFinder uses the appropriate finder to search for a specific type of auth methods
-func AuthMethodFinder(serviceUUID string, host string, authMethodType string, store stores.Store) (AuthMethod, error) {
+// AuthMethodsFinder finds all the auth methods of any type for the given service type and host,
+// ordered by their priority
+func AuthMethodsFinder(serviceUUID string, host string, store stores.Store) ([]AuthMethod, error) {
 
 	var err error
-	var qAuthMs []stores.QAuthMethod
 	var am AuthMethod
-	var ok bool
-	var finderFunc QueryAuthMethodFinder
+	var qams []stores.QAuthMethod
+	var ams = []AuthMethod{}
 
-	// access the appropriate finder based on the auth method type
-	if finderFunc, ok = QueryAuthMethodFinders[authMethodType]; !ok {
-		err = utils.APIGenericInternalError("Type is supported but not found")
-		LOGGER.Errorf("Type: %v was used to retrieve from AuthMethodsRetrievalFields, but was not found inside the source code(QueryAuthMethodFinders) of despite being supported", authMethodType)
-		return am, err
+	if qams, err = store.QueryAuthMethods("", serviceUUID, host); err != nil {
+		return ams, err
 	}
 
-	// execute the finder function
-	if qAuthMs, err = finderFunc(serviceUUID, host, store); err != nil {
-		return am, err
+	for _, qam := range qams {
+
+		if am, err = QueryModelConvertToAuthMethod(qam, qam.Basic().Type); err != nil {
+			return ams, err
+		}
+
+		ams = append(ams, am)
 	}
 
-	if len(qAuthMs) == 0 {
-		err := utils.APIErrNotFound("Auth method")
-		return am, err
+	// auth methods with the same priority are ordered by their type, so they are always returned in the same order
+	sort.SliceStable(ams, func(i, j int) bool {
+		if ams[i].Basic().Priority != ams[j].Basic().Priority {
+			return ams[i].Basic().Priority < ams[j].Basic().Priority
+		}
+		return ams[i].Type() < ams[j].Type()
+	})
+
+	return ams, err
+}
+
+// FindHostAuthMethod finds the auth method with the given name for the given service type and host.
+// An empty name refers to the host's unnamed auth method, or to its only auth method if it has just one
+func FindHostAuthMethod(serviceUUID string, host string, name string, store stores.Store) (AuthMethod, error) {
+
+	var err error
+	var ams []AuthMethod
+
+	if ams, err = AuthMethodsFinder(serviceUUID, host, store); err != nil {
+		return nil, err
 	}
 
-	if len(qAuthMs) > 1 {
-		err := utils.APIGenericInternalError("More than 1 auth methods found for the given service type and host")
-		return am, err
+	for _, am := range ams {
+		if am.Basic().Name == name {
+			return am, nil
+		}
 	}
 
-	// convert the query model to an auth method
-	if am, err = QueryModelConvertToAuthMethod(qAuthMs[0], authMethodType); err != nil {
-		return am, err
+	if name == "" && len(ams) == 1 {
+		return ams[0], nil
 	}
 
-	return am, err
+	if name == "" && len(ams) > 1 {
+		err = utils.APIErrAuthMethodNameRequired()
+		return nil, err
+	}
 
+	err = utils.APIErrNotFound("Auth method")
+	return nil, err
 }
 
-// AuthMethodAlreadyExists checks where or not any type of auth method already exists for the given host and service type
-func AuthMethodAlreadyExists(serviceUUID string, host string, authMethodType string, store stores.Store) error {
+// AuthMethodAlreadyExists checks whether or not an auth method of any type with the given name already exists
+// for the given host and service type. Names are unique per host, the unnamed auth method included
+func AuthMethodAlreadyExists(serviceUUID string, host string, name string, store stores.Store) error {
 
 	var err error
+	var ams []AuthMethod
 
-	_, err = AuthMethodFinder(serviceUUID, host, authMethodType, store)
-
-	// if the err is nil, it means it found an already existing auth method
-	if err == nil {
-		err = utils.APIErrConflict("Auth method", "host", host)
+	if ams, err = AuthMethodsFinder(serviceUUID, host, store); err != nil {
 		return err
 	}
 
-	// if there is any other error, treat it as a normal error
-	if err.Error() != "Auth method was not found" {
+	for _, am := range ams {
+		if am.Basic().Name != name {
+			continue
+		}
+
+		if name == "" {
+			err = utils.APIErrConflict("Auth method", "host", host)
+			return err
+		}
+
+		err = utils.APIErrConflict("Auth method", "name", name)
 		return err
 	}
 
@@ -156,43 +196,25 @@ func AuthMethodAlreadyExists(serviceUUID string, host string, authMethodType str
 }
 
 // AuthMethodCreate inserts the given auth method to the datastore after performing some checks and enriching its contents
-func AuthMethodCreate(am AuthMethod, store stores.Store, typeOfAuthMethod string) error {
+func AuthMethodCreate(am AuthMethod, store stores.Store, typeOfAuthMethod string, cfg config.Config) error {
 
 	var err error
 	var qAuthM stores.QAuthMethod
 
-	var isu interface{}
-	var ih interface{}
-
 	// validate the auth method
-	if err = am.Validate(store); err != nil {
-		return err
-	}
-
-	if isu, err = utils.GetFieldValueByName(am, "ServiceUUID"); err != nil {
-		err = utils.APIGenericInternalError(err.Error())
+	if err = am.Validate(store, cfg); err != nil {
 		return err
 	}
 
-	if ih, err = utils.GetFieldValueByName(am, "Host"); err != nil {
-		err = utils.APIGenericInternalError(err.Error())
-		return err
-	}
-
-	// check if an auth method already exists
-	if err = AuthMethodAlreadyExists(isu.(string), ih.(string), typeOfAuthMethod, store); err != nil {
-		return err
-	}
+	basic := am.Basic()
 
-	if err = utils.SetFieldValueByName(am, "UUID", uuid.NewV4().String()); err != nil {
-		err = utils.APIGenericInternalError(err.Error())
+	// check if an auth method with the same name already exists
+	if err = AuthMethodAlreadyExists(basic.ServiceUUID, basic.Host, basic.Name, store); err != nil {
 		return err
 	}
 
-	if err = utils.SetFieldValueByName(am, "CreatedOn", utils.ZuluTimeNow()); err != nil {
-		err = utils.APIGenericInternalError(err.Error())
-		return err
-	}
+	basic.UUID = uuid.NewV4().String()
+	basic.CreatedOn = utils.ZuluTimeNow()
 
 	if qAuthM, err = AuthMethodConvertToQueryModel(am, typeOfAuthMethod); err != nil {
 		return err
@@ -214,26 +236,54 @@ func AuthMethodFindAll(store stores.Store) (AuthMethodsList, error) {
 
 	var amList = AuthMethodsList{AuthMethods: []AuthMethod{}}
 
-	// loop through all the finders and aggregate their results
-	for amType, finderFunc := range QueryAuthMethodFinders {
-		if qams, err = finderFunc("", "", store); err != nil {
+	// query the auth methods of all the registered types
+	if qams, err = store.QueryAuthMethods("", "", ""); err != nil {
+		return amList, err
+	}
+
+	// if there is no error convert the query auth methods to auth methods
+	for _, qam := range qams {
+
+		// convert the query model to an auth method
+		if am, err = QueryModelConvertToAuthMethod(qam, qam.Basic().Type); err != nil {
 			return amList, err
 		}
+		// if there is no error, append the converted auth method to the slice
+		amList.AuthMethods = append(amList.AuthMethods, am)
+	}
 
-		// if there is no error convert the query auth methods to auth methods
-		for _, qam := range qams {
+	amList.TotalSize = len(amList.AuthMethods)
 
-			// convert the query model to an auth method
-			if am, err = QueryModelConvertToAuthMethod(qam, amType); err != nil {
-				return amList, err
-			}
-			// if there is no error, append the converted auth method to the slice
-			amList.AuthMethods = append(amList.AuthMethods, am)
+	return amList, err
+
+}
+
+// AuthMethodList returns a page of the auth methods that match the filter, in the order of the options
+func AuthMethodList(filter stores.AuthMethodFilter, opts stores.ListOptions, store stores.Store) (AuthMethodsList, error) {
+
+	var err error
+	var am AuthMethod
+	var qPage stores.QAuthMethodsPage
+
+	var amList = AuthMethodsList{AuthMethods: []AuthMethod{}}
+
+	if qPage, err = store.ListAuthMethods(filter, opts); err != nil {
+		return amList, err
+	}
+
+	for _, qam := range qPage.AuthMethods {
+
+		if am, err = QueryModelConvertToAuthMethod(qam, qam.Basic().Type); err != nil {
+			return amList, err
 		}
+
+		amList.AuthMethods = append(amList.AuthMethods, am)
 	}
 
-	return amList, err
+	amList.NextPageToken = qPage.NextPageToken
+	amList.TotalSize = qPage.TotalSize
 
+	return amList, err
 }
 
 // AuthMethodDelete deletes the given auth method from the data store
@@ -241,15 +291,9 @@ func AuthMethodDelete(am AuthMethod, store stores.Store) error {
 
 	var err error
 	var qam stores.QAuthMethod
-	var iType interface{}
-
-	// grab the type of the provided auth method
-	if iType, err = utils.GetFieldValueByName(am, "Type"); err != nil {
-		return err
-	}
 
 	// convert the auth method to its respective query model
-	if qam, err = AuthMethodConvertToQueryModel(am, iType.(string)); err != nil {
+	if qam, err = AuthMethodConvertToQueryModel(am, am.Type()); err != nil {
 		return err
 	}
 
@@ -258,26 +302,24 @@ func AuthMethodDelete(am AuthMethod, store stores.Store) error {
 		return err
 	}
 
+	// release the pooled client of the deleted auth method
+	if am.Basic().UUID != "" {
+		UpstreamClients.Invalidate(am.Basic().UUID)
+	}
+
+	// drop the auth resources that were retrieved through the deleted auth method
+	tokencache.Tokens.InvalidateHost(am.ServiceUUID(), am.Host())
+
 	return err
 }
 
 // AuthMethodUpdate updates the given method with a reader's data
-func AuthMethodUpdate(am AuthMethod, r io.ReadCloser, store stores.Store) (AuthMethod, error) {
+func AuthMethodUpdate(am AuthMethod, r io.ReadCloser, store stores.Store, cfg config.Config) (AuthMethod, error) {
 
 	var err error
 	var updatedAm AuthMethod
 	var qOriginalAm stores.QAuthMethod
 	var qUpdatedAm stores.QAuthMethod
-	var iType interface{}
-	var iSuuidUpdated interface{}
-	var iSuuidOriginal interface{}
-	var iHostUpdated interface{}
-	var iHostOriginal interface{}
-
-	// grab the type of the provided auth method
-	if iType, err = utils.GetFieldValueByName(am, "Type"); err != nil {
-		return updatedAm, err
-	}
 
 	// update the given auth method
 	if updatedAm, err = am.Update(r); err != nil {
@@ -285,43 +327,28 @@ func AuthMethodUpdate(am AuthMethod, r io.ReadCloser, store stores.Store) (AuthM
 	}
 
 	// validate the updated auth method
-	if err = updatedAm.Validate(store); err != nil {
+	if err = updatedAm.Validate(store, cfg); err != nil {
 		return updatedAm, err
 	}
 
-	// if serviceUUID and host have been modified , check if there is an auth method already present
-	if iSuuidOriginal, err = utils.GetFieldValueByName(am, "ServiceUUID"); err != nil {
-		err = utils.APIGenericInternalError(err.Error())
-		return updatedAm, err
-	}
-
-	if iSuuidUpdated, err = utils.GetFieldValueByName(updatedAm, "ServiceUUID"); err != nil {
-		err = utils.APIGenericInternalError(err.Error())
-		return updatedAm, err
-	}
-
-	if iHostOriginal, err = utils.GetFieldValueByName(am, "Host"); err != nil {
-		err = utils.APIGenericInternalError(err.Error())
-		return updatedAm, err
-	}
-
-	if iHostUpdated, err = utils.GetFieldValueByName(updatedAm, "Host"); err != nil {
-		err = utils.APIGenericInternalError(err.Error())
-		return updatedAm, err
-	}
+	original := am.Basic()
+	updated := updatedAm.Basic()
 
-	if iSuuidUpdated != iSuuidOriginal || iHostUpdated != iHostOriginal {
-		if err = AuthMethodAlreadyExists(iSuuidUpdated.(string), iHostUpdated.(string), iType.(string), store); err != nil {
+	// if serviceUUID, host or name have been modified, check if there is an auth method with the same name already present
+	if updated.ServiceUUID != original.ServiceUUID || updated.Host != original.Host || updated.Name != original.Name {
+		if err = AuthMethodAlreadyExists(updated.ServiceUUID, updated.Host, updated.Name, store); err != nil {
 			return updatedAm, err
 		}
 	}
 
+	updated.Revision = original.Revision + 1
+
 	// convert the given and updated auth methods to their respective query models
-	if qOriginalAm, err = AuthMethodConvertToQueryModel(am, iType.(string)); err != nil {
+	if qOriginalAm, err = AuthMethodConvertToQueryModel(am, original.Type); err != nil {
 		return updatedAm, err
 	}
 
-	if qUpdatedAm, err = AuthMethodConvertToQueryModel(updatedAm, iType.(string)); err != nil {
+	if qUpdatedAm, err = AuthMethodConvertToQueryModel(updatedAm, original.Type); err != nil {
 		return updatedAm, err
 	}
 
@@ -330,6 +357,78 @@ func AuthMethodUpdate(am AuthMethod, r io.ReadCloser, store stores.Store) (AuthM
 		return updatedAm, err
 	}
 
+	// the pooled client of the auth method has to be rebuilt using the updated host and client options
+	if original.UUID != "" {
+		UpstreamClients.Invalidate(original.UUID)
+	}
+
+	// drop the auth resources that were retrieved through the auth method before it was updated
+	tokencache.Tokens.InvalidateHost(original.ServiceUUID, original.Host)
+
 	return updatedAm, err
 
 }
+
+// RetrieveAuthResource retrieves the binding's auth resource through the auth methods of the binding's host.
+// A binding that names an auth method only uses that one, otherwise the host's auth methods are tried
+// in order of priority, falling back to the next one only while the service type is unavailable.
+// When a cache ttl has been declared for the service type's name, the result is cached per binding
+// and concurrent requests for the same binding share a single retrieval.
+// If the service type rejects an auth method's current secret, its next secret is tried and promoted on success
+func RetrieveAuthResource(binding bindings.Binding, serviceType servicetypes.ServiceType, store stores.Store, cfg *config.Config) (map[string]interface{}, error) {
+
+	ttl := time.Duration(cfg.ServiceTypesTokenCacheTTLs[serviceType.Name]) * time.Second
+	entry := tokencache.Entry{BindingUUID: binding.UUID, ServiceUUID: serviceType.UUID, Host: binding.Host}
+
+	return tokencache.Tokens.Get(entry, ttl, func() (map[string]interface{}, error) {
+
+		var err error
+		var res map[string]interface{}
+		var authm AuthMethod
+		var ams []AuthMethod
+
+		if binding.AuthMethod != "" {
+			if authm, err = FindHostAuthMethod(serviceType.UUID, binding.Host, binding.AuthMethod, store); err != nil {
+				return map[string]interface{}{}, err
+			}
+			ams = []AuthMethod{authm}
+		} else if ams, err = AuthMethodsFinder(serviceType.UUID, binding.Host, store); err != nil {
+			return map[string]interface{}{}, err
+		}
+
+		if len(ams) == 0 {
+			err = utils.APIErrNotFound("Auth method")
+			return map[string]interface{}{}, err
+		}
+
+		retrieve := func(am AuthMethod) (map[string]interface{}, error) {
+			return am.RetrieveAuthResource(binding, serviceType, cfg)
+		}
+
+		for idx, am := range ams {
+
+			if res, err = retrieve(am); err == nil {
+				return res, err
+			}
+
+			// when the service type rejects the current secret, try the next one, if it has been staged
+			if rejectedCredentials(err) {
+				if promotedRes, ok := promoteSecret(am, retrieve, store); ok {
+					return promotedRes, nil
+				}
+			}
+
+			// any other answer of the service type, e.g. an unknown user, is definitive and shouldn't be hidden by a lower priority auth method
+			if !upstreamUnavailable(err) {
+				return res, err
+			}
+
+			if idx < len(ams)-1 {
+				LOGGER.Warnf("Auth method %v of host %v failed, falling back to the next one. %v", am.Basic().Name, binding.Host, err.Error())
+			}
+		}
+
+		// the error of the last auth method that was tried is returned
+		return res, err
+	})
+}
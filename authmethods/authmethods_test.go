@@ -2,11 +2,22 @@ package authmethods
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"github.com/ARGOeu/argo-api-authn/bindings"
+	"github.com/ARGOeu/argo-api-authn/config"
+	"github.com/ARGOeu/argo-api-authn/servicetypes"
 	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/ARGOeu/argo-api-authn/tokencache"
+	"github.com/ARGOeu/argo-api-authn/utils"
 	"github.com/stretchr/testify/suite"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -24,14 +35,31 @@ func ConvertAuthMethodToReadCloser(am AuthMethod) io.ReadCloser {
 
 }
 
+func (suite *AuthMethodsTestSuite) TestAuthMethodAccessors() {
+
+	am1 := &ApiKeyAuthMethod{AccessKey: "access_key"}
+	am1.BasicAuthMethod = BasicAuthMethod{ServiceUUID: "uuid1", Host: "host1", Port: 9000, Type: "api-key"}
+
+	am2 := &HeadersAuthMethod{Headers: map[string]string{"x-api-key": "key"}}
+	am2.BasicAuthMethod = BasicAuthMethod{ServiceUUID: "uuid2", Host: "host3", Port: 9000, Type: "headers"}
+
+	for _, am := range []AuthMethod{am1, am2} {
+		suite.Equal(am.Basic().ServiceUUID, am.ServiceUUID())
+		suite.Equal(am.Basic().Host, am.Host())
+		suite.Equal(am.Basic().Type, am.Type())
+	}
+
+	suite.Equal("host3", am2.Host())
+}
+
 func (suite *AuthMethodsTestSuite) TestAuthMethodConvertToQueryModel() {
 
 	// normal case, convert an api key auth method to its respective query model
 	ba1 := BasicAuthMethod{ServiceUUID: "uuid1", Host: "host2", Port: 9000}
-	apk1 := &ApiKeyAuthMethod{ba1, "access_key"}
+	apk1 := &ApiKeyAuthMethod{BasicAuthMethod: ba1, AccessKey: "access_key"}
 
 	qba1 := stores.QBasicAuthMethod{ServiceUUID: "uuid1", Host: "host2", Port: 9000}
-	qapk1 := &stores.QApiKeyAuthMethod{qba1, "access_key"}
+	qapk1 := &stores.QApiKeyAuthMethod{QBasicAuthMethod: qba1, AccessKey: "access_key"}
 
 	qam, err := AuthMethodConvertToQueryModel(apk1, "api-key")
 
@@ -45,10 +73,10 @@ func (suite *AuthMethodsTestSuite) TestQueryModelConvertToAuthMethod() {
 
 	// normal case, convert an query model to an api key auth method
 	ba1 := BasicAuthMethod{ServiceUUID: "uuid1", Host: "host2", Port: 9000}
-	apk1 := &ApiKeyAuthMethod{ba1, "access_key"}
+	apk1 := &ApiKeyAuthMethod{BasicAuthMethod: ba1, AccessKey: "access_key"}
 
 	qba1 := stores.QBasicAuthMethod{ServiceUUID: "uuid1", Host: "host2", Port: 9000}
-	qapk1 := &stores.QApiKeyAuthMethod{qba1, "access_key"}
+	qapk1 := &stores.QApiKeyAuthMethod{QBasicAuthMethod: qba1, AccessKey: "access_key"}
 
 	qam, err := QueryModelConvertToAuthMethod(qapk1, "api-key")
 
@@ -57,44 +85,19 @@ func (suite *AuthMethodsTestSuite) TestQueryModelConvertToAuthMethod() {
 	suite.Nil(err)
 }
 
-func (suite *AuthMethodsTestSuite) TestAuthMethodFinder() {
-
-	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
-	mockstore.SetUp()
-
-	// normal case
-	ba1 := BasicAuthMethod{ServiceUUID: "uuid1", Host: "host1", Port: 9000, UUID: "am_uuid_1", Type: "api-key"}
-	expectedApk1 := &ApiKeyAuthMethod{ba1, "access_key"}
-
-	apk1, err1 := AuthMethodFinder("uuid1", "host1", "api-key", mockstore)
-
-	// not found case
-	_, err2 := AuthMethodFinder("uuid_unknown", "unknown", "api-key", mockstore)
-
-	// more than 1 found
-	// append a temporary query auth method
-	amb1 := stores.QBasicAuthMethod{ServiceUUID: "uuid1", Host: "host1", Port: 9000, UUID: "am_uuid_1", CreatedOn: "", Type: "api-key"}
-	am1 := &stores.QApiKeyAuthMethod{AccessKey: "access_key"}
-	am1.QBasicAuthMethod = amb1
-	mockstore.AuthMethods = append(mockstore.AuthMethods, am1)
-	_, err3 := AuthMethodFinder("uuid1", "host1", "api-key", mockstore)
-	suite.Equal(expectedApk1, apk1)
-
-	suite.Nil(err1)
-	suite.Equal("Auth method was not found", err2.Error())
-	suite.Equal("Internal Error: More than 1 auth methods found for the given service type and host", err3.Error())
-
-}
-
 func (suite *AuthMethodsTestSuite) TestAuthMethodAlreadyExists() {
 
 	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
 	mockstore.SetUp()
 
-	// normal case
-	err1 := AuthMethodAlreadyExists("uuid1", "host1", "api-key", mockstore)
+	// normal case, the host already has an unnamed auth method
+	err1 := AuthMethodAlreadyExists("uuid1", "host1", "", mockstore)
+
+	// a named auth method can be added next to it
+	err2 := AuthMethodAlreadyExists("uuid1", "host1", "robots", mockstore)
 
 	suite.Equal("Auth method object with host: host1 already exists", err1.Error())
+	suite.Nil(err2)
 
 }
 
@@ -105,20 +108,20 @@ func (suite *AuthMethodsTestSuite) TestAuthMethodCreate() {
 
 	// normal case
 	ba1 := BasicAuthMethod{ServiceUUID: "uuid1", Host: "host2", Port: 9000, Type: "api-key"}
-	apk1 := &ApiKeyAuthMethod{ba1, "access_key"}
+	apk1 := &ApiKeyAuthMethod{BasicAuthMethod: ba1, AccessKey: "access_key"}
 
 	qamb1 := stores.QBasicAuthMethod{ServiceUUID: "uuid1", Host: "host2", Port: 9000, Type: "api-key"}
 	qam1 := &stores.QApiKeyAuthMethod{AccessKey: "access_key"}
 	qam1.QBasicAuthMethod = qamb1
 
-	err1 := AuthMethodCreate(apk1, mockstore, "api-key")
-	ll, _ := mockstore.QueryApiKeyAuthMethods("uuid1", "host2")
+	err1 := AuthMethodCreate(apk1, mockstore, "api-key", config.Config{})
+	ll, _ := mockstore.QueryAuthMethods("api-key", "uuid1", "host2")
 
-	suite.Equal(apk1.ServiceUUID, ll[0].ServiceUUID)
-	suite.Equal(apk1.Host, ll[0].Host)
-	suite.Equal(apk1.Port, ll[0].Port)
-	suite.NotEqual("", ll[0].UUID)      // check that uuid has been set
-	suite.NotEqual("", ll[0].CreatedOn) // check that created time has been set
+	suite.Equal(apk1.ServiceUUID(), ll[0].Basic().ServiceUUID)
+	suite.Equal(apk1.Host(), ll[0].Basic().Host)
+	suite.Equal(apk1.Port, ll[0].Basic().Port)
+	suite.NotEqual("", ll[0].Basic().UUID)      // check that uuid has been set
+	suite.NotEqual("", ll[0].Basic().CreatedOn) // check that created time has been set
 
 	suite.Nil(err1)
 
@@ -163,6 +166,40 @@ func (suite *AuthMethodsTestSuite) TestAuthMethodFIndAll() {
 	suite.Nil(err2)
 }
 
+func (suite *AuthMethodsTestSuite) TestAuthMethodList() {
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	apiKeyAm := &ApiKeyAuthMethod{AccessKey: "access_key"}
+	apiKeyAm.BasicAuthMethod = BasicAuthMethod{ServiceUUID: "uuid1", Host: "host1", Port: 9000, Type: "api-key", UUID: "am_uuid_1", CreatedOn: ""}
+
+	headersAm := &HeadersAuthMethod{Headers: map[string]string{"x-api-key": "key-1", "Accept": "application/json"}}
+	headersAm.BasicAuthMethod = BasicAuthMethod{ServiceUUID: "uuid2", Host: "host3", Port: 9000, Type: "headers", UUID: "am_uuid_2", CreatedOn: ""}
+
+	// the auth methods in reverse order of their hosts, one per page
+	amList1, err1 := AuthMethodList(stores.AuthMethodFilter{}, stores.ListOptions{PageSize: 1, OrderBy: "host", Descending: true}, mockstore)
+	amList2, err2 := AuthMethodList(stores.AuthMethodFilter{}, stores.ListOptions{PageSize: 1, OrderBy: "host", Descending: true, PageToken: amList1.NextPageToken}, mockstore)
+
+	// the auth methods of a type
+	amList3, err3 := AuthMethodList(stores.AuthMethodFilter{Type: "api-key"}, stores.ListOptions{}, mockstore)
+
+	// no auth methods match
+	amList4, err4 := AuthMethodList(stores.AuthMethodFilter{ServiceUUID: "uuid1", Host: "host3"}, stores.ListOptions{}, mockstore)
+
+	suite.Equal([]AuthMethod{headersAm}, amList1.AuthMethods)
+	suite.NotEqual("", amList1.NextPageToken)
+	suite.Equal(2, amList1.TotalSize)
+	suite.Equal(AuthMethodsList{AuthMethods: []AuthMethod{apiKeyAm}, TotalSize: 2}, amList2)
+	suite.Equal(AuthMethodsList{AuthMethods: []AuthMethod{apiKeyAm}, TotalSize: 1}, amList3)
+	suite.Equal(AuthMethodsList{AuthMethods: []AuthMethod{}}, amList4)
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Nil(err4)
+}
+
 func (suite *AuthMethodsTestSuite) TestAuthMethodDelete() {
 
 	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
@@ -194,69 +231,80 @@ func (suite *AuthMethodsTestSuite) TestAuthMethodUpdate() {
 	amU1 := &ApiKeyAuthMethod{AccessKey: "access_key"}
 	amU1.BasicAuthMethod = ambU1
 	r1 := ConvertAuthMethodToReadCloser(amU1)
-	a1, err1 := AuthMethodUpdate(am1, r1, mockstore)
+	a1, err1 := AuthMethodUpdate(am1, r1, mockstore, config.Config{})
 
-	// normal case - update fields that can't be updated
+	// normal case - update fields that can't be updated, the auth method hasn't been updated in this store
+	mockstore2 := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore2.SetUp()
 	ambU2 := BasicAuthMethod{ServiceUUID: "uuid1", Host: "host1", Port: 9000, Type: "some_api-key", UUID: "some_am_uuid_1", CreatedOn: "some_time"}
 	amU2 := &ApiKeyAuthMethod{AccessKey: "access_key"}
 	amU2.BasicAuthMethod = ambU2
 	r2 := ConvertAuthMethodToReadCloser(amU2)
-	a2, err2 := AuthMethodUpdate(am1, r2, mockstore)
+	a2, err2 := AuthMethodUpdate(am1, r2, mockstore2, config.Config{})
+
+	// the auth method has been modified since it was retrieved
+	r12 := ConvertAuthMethodToReadCloser(amU2)
+	_, err12 := AuthMethodUpdate(am1, r12, mockstore, config.Config{})
 
 	// unknown service uuid
 	ambU3 := BasicAuthMethod{ServiceUUID: "unknown", Host: "host1", Port: 9000, Type: "api-key", UUID: "am_uuid_1", CreatedOn: ""}
 	amU3 := &ApiKeyAuthMethod{AccessKey: "access_key"}
 	amU3.BasicAuthMethod = ambU3
 	r3 := ConvertAuthMethodToReadCloser(amU3)
-	a3, err3 := AuthMethodUpdate(am1, r3, mockstore)
+	a3, err3 := AuthMethodUpdate(am1, r3, mockstore, config.Config{})
 
 	// unknown host
 	ambU4 := BasicAuthMethod{ServiceUUID: "uuid1", Host: "unknown", Port: 9000, Type: "api-key", UUID: "am_uuid_1", CreatedOn: ""}
 	amU4 := &ApiKeyAuthMethod{AccessKey: "access_key"}
 	amU4.BasicAuthMethod = ambU4
 	r4 := ConvertAuthMethodToReadCloser(amU4)
-	a4, err4 := AuthMethodUpdate(am1, r4, mockstore)
+	a4, err4 := AuthMethodUpdate(am1, r4, mockstore, config.Config{})
 
 	// empty service uuid
 	ambU6 := BasicAuthMethod{ServiceUUID: "", Host: "host1", Port: 9000, Type: "api-key", UUID: "am_uuid_1", CreatedOn: ""}
 	amU6 := &ApiKeyAuthMethod{AccessKey: "access_key"}
 	amU6.BasicAuthMethod = ambU6
 	r6 := ConvertAuthMethodToReadCloser(amU6)
-	a6, err6 := AuthMethodUpdate(am1, r6, mockstore)
+	a6, err6 := AuthMethodUpdate(am1, r6, mockstore, config.Config{})
 
 	// empty host
 	ambU7 := BasicAuthMethod{ServiceUUID: "uuid1", Host: "", Port: 9000, Type: "api-key", UUID: "am_uuid_1", CreatedOn: ""}
 	amU7 := &ApiKeyAuthMethod{AccessKey: "access_key"}
 	amU7.BasicAuthMethod = ambU7
 	r7 := ConvertAuthMethodToReadCloser(amU7)
-	a7, err7 := AuthMethodUpdate(am1, r7, mockstore)
+	a7, err7 := AuthMethodUpdate(am1, r7, mockstore, config.Config{})
 
 	// empty port
 	ambU8 := BasicAuthMethod{ServiceUUID: "uuid1", Host: "host1", Port: 0, Type: "api-key", UUID: "am_uuid_1", CreatedOn: ""}
 	amU8 := &ApiKeyAuthMethod{AccessKey: "access_key"}
 	amU8.BasicAuthMethod = ambU8
 	r8 := ConvertAuthMethodToReadCloser(amU8)
-	a8, err8 := AuthMethodUpdate(am1, r8, mockstore)
+	a8, err8 := AuthMethodUpdate(am1, r8, mockstore, config.Config{})
 
 	// empty access key
 	ambU10 := BasicAuthMethod{ServiceUUID: "uuid1", Host: "host1", Port: 10000, Type: "api-key", UUID: "am_uuid_1", CreatedOn: ""}
 	amU10 := &ApiKeyAuthMethod{AccessKey: ""}
 	amU10.BasicAuthMethod = ambU10
 	r10 := ConvertAuthMethodToReadCloser(amU10)
-	a10, err10 := AuthMethodUpdate(am1, r10, mockstore)
+	a10, err10 := AuthMethodUpdate(am1, r10, mockstore, config.Config{})
 
 	// auth method for host and service already exists
 	amb2 := BasicAuthMethod{ServiceUUID: "uuid1", Host: "host1", Port: 9000, Type: "api-key", UUID: "am_uuid_1", CreatedOn: ""}
 	am2 := &ApiKeyAuthMethod{AccessKey: "access_key"}
 	am2.BasicAuthMethod = amb2
-	ambU11 := BasicAuthMethod{ServiceUUID: "uuid2", Host: "host4", Port: 11000, Type: "api-key", UUID: "am_uuid_1", CreatedOn: ""}
+	ambU11 := BasicAuthMethod{ServiceUUID: "uuid2", Host: "host3", Port: 11000, Type: "api-key", UUID: "am_uuid_1", CreatedOn: ""}
 	amU11 := &ApiKeyAuthMethod{AccessKey: "access_key"}
 	amU11.BasicAuthMethod = ambU11
 	r11 := ConvertAuthMethodToReadCloser(amU11)
-	a11, err11 := AuthMethodUpdate(am2, r11, mockstore)
+	a11, err11 := AuthMethodUpdate(am2, r11, mockstore, config.Config{})
+
+	// every update moves the auth method to its next revision
+	amU1.Revision = 1
+	expAm2 := *am1
+	expAm2.Revision = 1
 
 	suite.Equal(a1, amU1)
-	suite.Equal(a2, am1)
+	suite.Equal(a2, &expAm2)
 	suite.Equal(a3, amU3)
 	suite.Equal(a4, amU4)
 	suite.Equal(a6, amU6)
@@ -273,7 +321,203 @@ func (suite *AuthMethodsTestSuite) TestAuthMethodUpdate() {
 	suite.Equal("auth method object contains empty fields. empty value for field: host", err7.Error())
 	suite.Equal("auth method object contains empty fields. empty value for field: port", err8.Error())
 	suite.Equal("auth method object contains empty fields. empty value for field: access_key", err10.Error())
-	suite.Equal("Auth method object with host: host4 already exists", err11.Error())
+	suite.Equal("Auth method object with host: host3 already exists", err11.Error())
+	suite.Equal(utils.APIErrPreconditionFailed("Auth method"), err12)
+}
+
+func (suite *AuthMethodsTestSuite) TestAuthMethodEncryptedSecrets() {
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	stores.Secrets, _ = stores.ParseKeyring("v1:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32))))
+	defer func() { stores.Secrets = nil }()
+
+	amb1 := BasicAuthMethod{ServiceUUID: "uuid1", Host: "host2", Port: 9000, Type: "api-key"}
+	am1 := &ApiKeyAuthMethod{AccessKey: "access_key_2"}
+	am1.BasicAuthMethod = amb1
+	err1 := AuthMethodCreate(am1, mockstore, "api-key", config.Config{})
+
+	// the stored secret is encrypted
+	qAms, _ := mockstore.QueryAuthMethods("api-key", "uuid1", "host2")
+
+	// the found auth method holds the decrypted secret
+	am2, err2 := FindHostAuthMethod("uuid1", "host2", "", mockstore)
+
+	// the auth method can be updated and deleted using its decrypted form
+	r3 := ConvertAuthMethodToReadCloser(&ApiKeyAuthMethod{AccessKey: "access_key_3", BasicAuthMethod: BasicAuthMethod{ServiceUUID: "uuid1", Host: "host2", Port: 9000}})
+	am3, err3 := AuthMethodUpdate(am2, r3, mockstore, config.Config{})
+	am4, _ := FindHostAuthMethod("uuid1", "host2", "", mockstore)
+	err5 := AuthMethodDelete(am4, mockstore)
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Nil(err5)
+	suite.True(stores.IsEncrypted(qAms[0].(*stores.QApiKeyAuthMethod).AccessKey))
+	suite.Equal("access_key_2", am2.(*ApiKeyAuthMethod).AccessKey)
+	suite.Equal("access_key_3", am3.(*ApiKeyAuthMethod).AccessKey)
+	suite.Equal("access_key_3", am4.(*ApiKeyAuthMethod).AccessKey)
+	suite.Equal(2, len(mockstore.AuthMethods))
+}
+
+func (suite *AuthMethodsTestSuite) TestFindHostAuthMethod() {
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	// a named headers auth method next to the unnamed api key auth method of host1
+	qam1 := &stores.QHeadersAuthMethod{Headers: map[string]string{"x-api-key": "key-1"}}
+	qam1.QBasicAuthMethod = stores.QBasicAuthMethod{ServiceUUID: "uuid1", Host: "host1", Port: 9000, Type: "headers", UUID: "am_uuid_3", Name: "robots", Priority: -1}
+
+	// two named auth methods for host2
+	qam2 := &stores.QApiKeyAuthMethod{AccessKey: "access_key"}
+	qam2.QBasicAuthMethod = stores.QBasicAuthMethod{ServiceUUID: "uuid1", Host: "host2", Port: 9000, Type: "api-key", UUID: "am_uuid_4", Name: "users"}
+	qam3 := &stores.QHeadersAuthMethod{Headers: map[string]string{"x-api-key": "key-1"}}
+	qam3.QBasicAuthMethod = stores.QBasicAuthMethod{ServiceUUID: "uuid1", Host: "host2", Port: 9000, Type: "headers", UUID: "am_uuid_5", Name: "robots"}
+
+	mockstore.AuthMethods = append(mockstore.AuthMethods, qam1, qam2, qam3)
+
+	// auth methods are ordered by priority
+	ams, err1 := AuthMethodsFinder("uuid1", "host1", mockstore)
+
+	// the unnamed auth method is found without a name
+	am2, err2 := FindHostAuthMethod("uuid1", "host1", "", mockstore)
+	am3, err3 := FindHostAuthMethod("uuid1", "host1", "robots", mockstore)
+	_, err4 := FindHostAuthMethod("uuid1", "host1", "unknown", mockstore)
+
+	// a name is required when the host has more than one named auth methods
+	_, err5 := FindHostAuthMethod("uuid1", "host2", "", mockstore)
+
+	// the host doesn't have any auth method
+	_, err6 := FindHostAuthMethod("uuid2", "host4", "", mockstore)
+
+	// names are unique per host
+	err7 := AuthMethodAlreadyExists("uuid1", "host2", "robots", mockstore)
+	err8 := AuthMethodAlreadyExists("uuid1", "host2", "", mockstore)
+
+	suite.Nil(err1)
+	suite.Equal(2, len(ams))
+	suite.Equal("am_uuid_3", ams[0].(*HeadersAuthMethod).UUID)
+	suite.Equal("am_uuid_1", ams[1].(*ApiKeyAuthMethod).UUID)
+	suite.Nil(err2)
+	suite.Equal("am_uuid_1", am2.(*ApiKeyAuthMethod).UUID)
+	suite.Nil(err3)
+	suite.Equal("am_uuid_3", am3.(*HeadersAuthMethod).UUID)
+	suite.Equal("Auth method was not found", err4.Error())
+	suite.Equal(422, err5.(*utils.APIError).Code)
+	suite.Equal("Auth method was not found", err6.Error())
+	suite.Equal("Auth method object with name: robots already exists", err7.Error())
+	suite.Nil(err8)
+}
+
+func (suite *AuthMethodsTestSuite) TestRetrieveAuthResourceFallback() {
+
+	// only serves the robots' header, the users' requests get the given status
+	usersStatus := 503
+	robotsRequests := 0
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-api-key") != "robots-key" {
+			w.WriteHeader(usersStatus)
+			return
+		}
+		robotsRequests++
+		w.WriteHeader(200)
+		w.Write([]byte(`{"token": "some-value"}`))
+	}))
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+	port, _ := strconv.Atoi(tsURL.Port())
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	Circuits = NewCircuitBreakerRegistry()
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	qam1 := &stores.QApiKeyAuthMethod{AccessKey: "access_key"}
+	qam1.QBasicAuthMethod = stores.QBasicAuthMethod{ServiceUUID: "uuid1", Host: tsURL.Hostname(), Port: port, Type: "api-key", UUID: "am_uuid_3", Name: "users"}
+	qam2 := &stores.QHeadersAuthMethod{Headers: map[string]string{"x-api-key": "robots-key"}}
+	qam2.QBasicAuthMethod = stores.QBasicAuthMethod{ServiceUUID: "uuid1", Host: tsURL.Hostname(), Port: port, Type: "headers", UUID: "am_uuid_4", Name: "robots", Priority: 1}
+	mockstore.AuthMethods = append(mockstore.AuthMethods, qam1, qam2)
+
+	serviceType := servicetypes.ServiceType{Name: "s1", UUID: "uuid1", Type: "ams", AuthMethod: "api-key"}
+
+	// the first auth method's service type is unavailable, so the next one is used
+	b1 := bindings.Binding{Name: "b1", ServiceUUID: "uuid1", Host: tsURL.Hostname(), UUID: "b_uuid1", UniqueKey: "unique_key_1"}
+	res1, err1 := RetrieveAuthResource(b1, serviceType, mockstore, cfg)
+
+	// the binding only uses the named auth method
+	b2 := bindings.Binding{Name: "b2", ServiceUUID: "uuid1", Host: tsURL.Hostname(), UUID: "b_uuid2", UniqueKey: "unique_key_2", AuthMethod: "users"}
+	_, err2 := RetrieveAuthResource(b2, serviceType, mockstore, cfg)
+
+	// the named auth method doesn't exist
+	b3 := bindings.Binding{Name: "b3", ServiceUUID: "uuid1", Host: tsURL.Hostname(), UUID: "b_uuid3", UniqueKey: "unique_key_3", AuthMethod: "unknown"}
+	_, err3 := RetrieveAuthResource(b3, serviceType, mockstore, cfg)
+
+	// the service type's answer, e.g. an unknown user, is definitive, the next auth method isn't tried
+	usersStatus = 404
+	b4 := bindings.Binding{Name: "b4", ServiceUUID: "uuid1", Host: tsURL.Hostname(), UUID: "b_uuid4", UniqueKey: "unique_key_4"}
+	_, err4 := RetrieveAuthResource(b4, serviceType, mockstore, cfg)
+
+	suite.Nil(err1)
+	suite.Equal(map[string]interface{}{"token": "some-value"}, res1)
+	suite.Equal(502, err2.(*utils.APIError).Code)
+	suite.Equal("Auth method was not found", err3.Error())
+	suite.Equal(404, err4.(*utils.APIError).UpstreamCode)
+	suite.Equal(1, robotsRequests)
+}
+
+func (suite *AuthMethodsTestSuite) TestRetrieveAuthResourceCache() {
+
+	requests := 0
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(200)
+		w.Write([]byte(`{"token": "some-value"}`))
+	}))
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+	port, _ := strconv.Atoi(tsURL.Port())
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+	cfg.ServiceTypesTokenCacheTTLs = map[string]int{"s1": 60}
+
+	Circuits = NewCircuitBreakerRegistry()
+	tokencache.Tokens = tokencache.New()
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	qam1 := &stores.QHeadersAuthMethod{Headers: map[string]string{"x-api-key": "key"}}
+	qam1.QBasicAuthMethod = stores.QBasicAuthMethod{ServiceUUID: "uuid1", Host: tsURL.Hostname(), Port: port, Type: "headers", UUID: "am_uuid_3"}
+	qam2 := &stores.QHeadersAuthMethod{Headers: map[string]string{"x-api-key": "key"}}
+	qam2.QBasicAuthMethod = stores.QBasicAuthMethod{ServiceUUID: "uuid2", Host: tsURL.Hostname(), Port: port, Type: "headers", UUID: "am_uuid_4"}
+	mockstore.AuthMethods = append(mockstore.AuthMethods, qam1, qam2)
+
+	// both service types share the same type, only the one named in the configuration is cached
+	st1 := servicetypes.ServiceType{Name: "s1", UUID: "uuid1", Type: "ams", AuthMethod: "headers"}
+	st2 := servicetypes.ServiceType{Name: "s2", UUID: "uuid2", Type: "ams", AuthMethod: "headers"}
+
+	b1 := bindings.Binding{Name: "b1", ServiceUUID: "uuid1", Host: tsURL.Hostname(), UUID: "b_uuid1", UniqueKey: "unique_key_1"}
+	b2 := bindings.Binding{Name: "b2", ServiceUUID: "uuid2", Host: tsURL.Hostname(), UUID: "b_uuid2", UniqueKey: "unique_key_2"}
+
+	for i := 0; i < 2; i++ {
+		_, err1 := RetrieveAuthResource(b1, st1, mockstore, cfg)
+		suite.Nil(err1)
+	}
+	suite.Equal(1, requests)
+
+	for i := 0; i < 2; i++ {
+		_, err2 := RetrieveAuthResource(b2, st2, mockstore, cfg)
+		suite.Nil(err2)
+	}
+	suite.Equal(3, requests)
 }
 
 func TestAuthMethodTestSuite(t *testing.T) {
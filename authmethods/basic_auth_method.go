@@ -1,28 +1,57 @@
 package authmethods
 
 import (
+	"fmt"
+	"github.com/ARGOeu/argo-api-authn/config"
 	"github.com/ARGOeu/argo-api-authn/servicetypes"
 	"github.com/ARGOeu/argo-api-authn/stores"
 	"github.com/ARGOeu/argo-api-authn/utils"
+	LOGGER "github.com/sirupsen/logrus"
+	"net/http"
 )
 
 type BasicAuthMethod struct {
-	ServiceUUID string `json:"service_uuid" required:"true"`
-	Port        int    `json:"port" required:"true"`
-	Host        string `json:"host" required:"true"`
-	Type        string `json:"type" required:"true"`
-	UUID        string `json:"uuid"`
-	CreatedOn   string `json:"created_on"`
+	ServiceUUID       string           `json:"service_uuid" required:"true"`
+	Port              int              `json:"port" required:"true"`
+	Host              string           `json:"host" required:"true"`
+	Type              string           `json:"type" required:"true"`
+	UUID              string           `json:"uuid"`
+	CreatedOn         string           `json:"created_on"`
+	RequestTemplate   *RequestTemplate `json:"request_template,omitempty"`
+	RetrievalField    string           `json:"retrieval_field,omitempty"`
+	ResponseMapping   ResponseMapping  `json:"response_mapping,omitempty"`
+	ClientOptions     *ClientOptions   `json:"client_options,omitempty"`
+	FallbackEndpoints []string         `json:"fallback_endpoints,omitempty"`
+	SecretStagedOn    string           `json:"secret_staged_on,omitempty"`
+	SecretPromotedOn  string           `json:"secret_promoted_on,omitempty"`
+	Name              string           `json:"name,omitempty"`
+	Priority          int              `json:"priority,omitempty"`
+	// Revision is incremented on every update of the auth method, it is also returned as the auth method's ETag
+	Revision int64 `json:"revision,omitempty"`
+	// trace is set when the auth method is tested, see AuthMethodTest
+	trace *RetrievalTrace
 }
 
 // TempBasicAuthMethod represents the fields that are allowed to be modified
 type TempBasicAuthMethod struct {
-	ServiceUUID string `json:"service_uuid" required:"true"`
-	Port        int    `json:"port" required:"true"`
-	Host        string `json:"host" required:"true"`
+	ServiceUUID       string           `json:"service_uuid" required:"true"`
+	Port              int              `json:"port" required:"true"`
+	Host              string           `json:"host" required:"true"`
+	RequestTemplate   *RequestTemplate `json:"request_template,omitempty"`
+	RetrievalField    string           `json:"retrieval_field,omitempty"`
+	ResponseMapping   ResponseMapping  `json:"response_mapping,omitempty"`
+	ClientOptions     *ClientOptions   `json:"client_options,omitempty"`
+	FallbackEndpoints []string         `json:"fallback_endpoints,omitempty"`
+	Name              string           `json:"name,omitempty"`
+	Priority          int              `json:"priority,omitempty"`
 }
 
-func (m *BasicAuthMethod) Validate(store stores.Store) error {
+// Basic returns the fields of an auth method that embeds BasicAuthMethod
+func (m *BasicAuthMethod) Basic() *BasicAuthMethod {
+	return m
+}
+
+func (m *BasicAuthMethod) Validate(store stores.Store, cfg config.Config) error {
 
 	var ok bool
 	var err error
@@ -39,11 +68,154 @@ func (m *BasicAuthMethod) Validate(store stores.Store) error {
 		return err
 	}
 
-	// check if the given host belongs to the given service type
-	if ok = serviceType.HasHost(m.Host); !ok {
+	// check if the given host belongs to the given service type, auth methods are kept under the host's canonical name
+	host, ok := serviceType.CanonicalHost(m.Host)
+	if !ok {
 		err = utils.APIErrNotFound("Host")
 		return err
 	}
+	m.Host = host
+
+	// check the auth method's own request template, if one has been provided
+	if m.RequestTemplate != nil {
+		if err = m.RequestTemplate.Validate(); err != nil {
+			return err
+		}
+	}
+
+	// check that the retrieval field is a valid json path
+	if m.RetrievalField != "" {
+		if _, err = utils.ParseJSONPath(m.RetrievalField); err != nil {
+			err = utils.APIErrInvalidFieldContent("retrieval_field", err.Error())
+			return err
+		}
+	}
+
+	if err = m.ResponseMapping.Validate(); err != nil {
+		return err
+	}
+
+	if m.ClientOptions != nil {
+		if err = m.ClientOptions.Validate(cfg); err != nil {
+			return err
+		}
+	}
+
+	// check that the fallback endpoints are valid host:port pairs
+	for _, fe := range m.FallbackEndpoints {
+		if _, err = parseEndpoint(fe); err != nil {
+			err = utils.APIErrInvalidFieldContent("fallback_endpoints", err.Error())
+			return err
+		}
+	}
 
 	return err
 }
+
+// requestTemplate returns the auth method's own request template,
+// or falls back to the path declared in the config for the service type's type
+func (m *BasicAuthMethod) requestTemplate(serviceType servicetypes.ServiceType, cfg *config.Config) (RequestTemplate, error) {
+
+	var err error
+	var ok bool
+	var path string
+
+	if m.RequestTemplate != nil {
+		return *m.RequestTemplate, err
+	}
+
+	if path, ok = cfg.ServiceTypesPaths[serviceType.Type]; !ok {
+		err = utils.APIGenericInternalError("Backend error")
+		LOGGER.Errorf("The path for type: %v was not found in the config retrieval fields: %v", serviceType.Type, cfg.ServiceTypesPaths)
+		return RequestTemplate{}, err
+	}
+
+	return RequestTemplate{Method: DefaultRequestMethod, Scheme: DefaultRequestScheme, Path: path}, err
+}
+
+// retrievalField returns the auth method's own retrieval field,
+// or falls back to the retrieval field declared in the config for the service type's type
+func (m *BasicAuthMethod) retrievalField(serviceType servicetypes.ServiceType, cfg *config.Config) (string, error) {
+
+	var err error
+	var ok bool
+	var retrievalField string
+
+	if m.RetrievalField != "" {
+		return m.RetrievalField, err
+	}
+
+	if retrievalField, ok = cfg.ServiceTypesRetrievalFields[serviceType.Type]; !ok {
+		err = utils.APIGenericInternalError("Backend error")
+		LOGGER.Errorf("The retrieval field for type: %v was not found in the config retrieval fields: %v", serviceType.Type, cfg.ServiceTypesRetrievalFields)
+		return retrievalField, err
+	}
+
+	return retrievalField, err
+}
+
+// responseMapping returns the auth method's own response mapping,
+// or maps the retrieval field to the default `token` field of the response
+func (m *BasicAuthMethod) responseMapping(serviceType servicetypes.ServiceType, cfg *config.Config) (ResponseMapping, error) {
+
+	var err error
+	var retrievalField string
+
+	if len(m.ResponseMapping) > 0 {
+		return m.ResponseMapping, err
+	}
+
+	if retrievalField, err = m.retrievalField(serviceType, cfg); err != nil {
+		return ResponseMapping{}, err
+	}
+
+	return ResponseMapping{{Name: DefaultResponseFieldName, Path: retrievalField}}, err
+}
+
+// upstream returns the pooled client that the auth method uses to reach its host,
+// along with the host and the fallback endpoints in the order they should be tried
+func (m *BasicAuthMethod) upstream(cfg *config.Config) (upstream, error) {
+
+	var err error
+	var opts ClientOptions
+	var client *http.Client
+
+	if m.ClientOptions != nil {
+		opts = *m.ClientOptions
+	}
+
+	if client, err = UpstreamClients.Client(m.clientKey(), opts, cfg); err != nil {
+		return upstream{}, err
+	}
+
+	up := upstream{
+		client:    client,
+		options:   opts,
+		endpoints: []upstreamEndpoint{{Host: m.Host, Port: m.Port}},
+		trace:     m.trace,
+	}
+
+	for _, fe := range m.FallbackEndpoints {
+		// fallback endpoints have been validated when the auth method was stored
+		if ue, err := parseEndpoint(fe); err == nil {
+			up.endpoints = append(up.endpoints, ue)
+		}
+	}
+
+	return up, err
+}
+
+// setTrace puts the auth method in dry run mode, recording its requests to the given trace
+func (m *BasicAuthMethod) setTrace(trace *RetrievalTrace) {
+	m.trace = trace
+}
+
+// clientKey returns the key that the auth method's client is registered under
+func (m *BasicAuthMethod) clientKey() string {
+
+	if m.UUID != "" {
+		return m.UUID
+	}
+
+	return fmt.Sprintf("%v:%v", m.Host, m.Port)
+}
@@ -1,6 +1,7 @@
 package authmethods
 
 import (
+	"github.com/ARGOeu/argo-api-authn/config"
 	"github.com/ARGOeu/argo-api-authn/stores"
 	"github.com/stretchr/testify/suite"
 	"testing"
@@ -17,27 +18,27 @@ func (suite *BasicAuthMethodTestSuite) TestValidate() {
 
 	// normal case
 	ba1 := BasicAuthMethod{ServiceUUID: "uuid1", Host: "host1", Port: 9000, Type: "api-key"}
-	err1 := ba1.Validate(mockstore)
+	err1 := ba1.Validate(mockstore, config.Config{})
 
 	// unknown service uuid
 	ba2 := BasicAuthMethod{ServiceUUID: "unknown", Host: "host1", Port: 9000, Type: "api-key"}
-	err2 := ba2.Validate(mockstore)
+	err2 := ba2.Validate(mockstore, config.Config{})
 
 	// unknown host
 	ba3 := BasicAuthMethod{ServiceUUID: "uuid1", Host: "unknown", Port: 9000, Type: "api-key"}
-	err3 := ba3.Validate(mockstore)
+	err3 := ba3.Validate(mockstore, config.Config{})
 
 	// missing service_uuid
 	ba6 := BasicAuthMethod{Host: "host1", Port: 9000, Type: "api-key"}
-	err6 := ba6.Validate(mockstore)
+	err6 := ba6.Validate(mockstore, config.Config{})
 
 	// missing host
 	ba7 := BasicAuthMethod{ServiceUUID: "uuid1", Port: 9000, Type: "api-key"}
-	err7 := ba7.Validate(mockstore)
+	err7 := ba7.Validate(mockstore, config.Config{})
 
 	// missing port
 	ba8 := BasicAuthMethod{ServiceUUID: "uuid1", Host: "host1", Type: "api-key"}
-	err8 := ba8.Validate(mockstore)
+	err8 := ba8.Validate(mockstore, config.Config{})
 
 	suite.Nil(err1)
 	suite.Equal("Service-type was not found", err2.Error())
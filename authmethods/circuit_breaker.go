@@ -0,0 +1,186 @@
+package authmethods
+
+import (
+	"github.com/ARGOeu/argo-api-authn/config"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCircuitFailureThreshold = 5
+	DefaultCircuitOpenTimeout      = 30
+)
+
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// CircuitState describes the circuit of an upstream host:port
+type CircuitState struct {
+	Endpoint            string `json:"endpoint"`
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	OpenedOn            string `json:"opened_on,omitempty"`
+	LastFailure         string `json:"last_failure,omitempty"`
+}
+
+type CircuitStatesList struct {
+	Circuits []CircuitState `json:"circuits"`
+}
+
+type circuit struct {
+	state               string
+	consecutiveFailures int
+	openedAt            time.Time
+	lastFailure         time.Time
+	// trialInFlight is set while the single request of a half-open circuit is being executed
+	trialInFlight bool
+}
+
+// CircuitBreakerRegistry keeps one circuit per upstream host:port.
+// A circuit opens after a number of consecutive failures and requests towards its endpoint fail fast,
+// once the open timeout has passed a single trial request is allowed that either closes or re-opens it
+type CircuitBreakerRegistry struct {
+	mutex    sync.Mutex
+	circuits map[string]*circuit
+}
+
+// Circuits is the registry used by all auth methods
+var Circuits = NewCircuitBreakerRegistry()
+
+func NewCircuitBreakerRegistry() *CircuitBreakerRegistry {
+	return &CircuitBreakerRegistry{circuits: make(map[string]*circuit)}
+}
+
+func circuitSettings(cfg *config.Config) (int, time.Duration) {
+
+	threshold := cfg.UpstreamCircuitBreaker.FailureThreshold
+	if threshold <= 0 {
+		threshold = DefaultCircuitFailureThreshold
+	}
+
+	openTimeout := cfg.UpstreamCircuitBreaker.OpenTimeout
+	if openTimeout <= 0 {
+		openTimeout = DefaultCircuitOpenTimeout
+	}
+
+	return threshold, time.Duration(openTimeout) * time.Second
+}
+
+// Allow checks whether or not a request towards the given endpoint should be executed
+func (r *CircuitBreakerRegistry) Allow(endpoint string, cfg *config.Config) bool {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	c, ok := r.circuits[endpoint]
+	if !ok {
+		return true
+	}
+
+	_, openTimeout := circuitSettings(cfg)
+
+	switch c.state {
+	case CircuitOpen:
+		if time.Since(c.openedAt) < openTimeout {
+			return false
+		}
+		c.state = CircuitHalfOpen
+		c.trialInFlight = true
+		return true
+	case CircuitHalfOpen:
+		if c.trialInFlight {
+			return false
+		}
+		c.trialInFlight = true
+		return true
+	}
+
+	return true
+}
+
+// Success records a successful request towards the given endpoint and closes its circuit
+func (r *CircuitBreakerRegistry) Success(endpoint string) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if c, ok := r.circuits[endpoint]; ok {
+		c.state = CircuitClosed
+		c.consecutiveFailures = 0
+		c.trialInFlight = false
+	}
+}
+
+// Release gives up the trial request of a half-open circuit without recording its outcome,
+// for requests that were allowed but never reached the endpoint
+func (r *CircuitBreakerRegistry) Release(endpoint string) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if c, ok := r.circuits[endpoint]; ok {
+		c.trialInFlight = false
+	}
+}
+
+// Failure records a failed request towards the given endpoint,
+// the circuit opens once the failure threshold has been reached or when a trial request fails
+func (r *CircuitBreakerRegistry) Failure(endpoint string, cfg *config.Config) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	c, ok := r.circuits[endpoint]
+	if !ok {
+		c = &circuit{state: CircuitClosed}
+		r.circuits[endpoint] = c
+	}
+
+	threshold, _ := circuitSettings(cfg)
+
+	now := time.Now()
+	c.consecutiveFailures++
+	c.lastFailure = now
+	c.trialInFlight = false
+
+	if c.state == CircuitHalfOpen || c.consecutiveFailures >= threshold {
+		c.state = CircuitOpen
+		c.openedAt = now
+	}
+}
+
+// States returns the state of every known circuit, ordered by endpoint
+func (r *CircuitBreakerRegistry) States() CircuitStatesList {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	states := CircuitStatesList{Circuits: []CircuitState{}}
+
+	for endpoint, c := range r.circuits {
+
+		cs := CircuitState{
+			Endpoint:            endpoint,
+			State:               c.state,
+			ConsecutiveFailures: c.consecutiveFailures,
+			LastFailure:         c.lastFailure.UTC().Format(utils.ZULU_FORM),
+		}
+
+		if c.state != CircuitClosed {
+			cs.OpenedOn = c.openedAt.UTC().Format(utils.ZULU_FORM)
+		}
+
+		states.Circuits = append(states.Circuits, cs)
+	}
+
+	sort.Slice(states.Circuits, func(i, j int) bool {
+		return states.Circuits[i].Endpoint < states.Circuits[j].Endpoint
+	})
+
+	return states
+}
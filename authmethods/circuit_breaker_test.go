@@ -0,0 +1,146 @@
+package authmethods
+
+import (
+	"github.com/ARGOeu/argo-api-authn/bindings"
+	"github.com/ARGOeu/argo-api-authn/config"
+	"github.com/ARGOeu/argo-api-authn/servicetypes"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"github.com/stretchr/testify/suite"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type CircuitBreakerTestSuite struct {
+	suite.Suite
+}
+
+func (suite *CircuitBreakerTestSuite) TestCircuitBreaker() {
+
+	cfg := &config.Config{UpstreamCircuitBreaker: config.CircuitBreaker{FailureThreshold: 2, OpenTimeout: 1}}
+	registry := NewCircuitBreakerRegistry()
+
+	// unknown endpoints are allowed
+	suite.True(registry.Allow("host1:9000", cfg))
+
+	// the circuit opens once the threshold has been reached
+	registry.Failure("host1:9000", cfg)
+	suite.True(registry.Allow("host1:9000", cfg))
+	registry.Failure("host1:9000", cfg)
+	suite.False(registry.Allow("host1:9000", cfg))
+	suite.Equal(CircuitOpen, registry.States().Circuits[0].State)
+	suite.NotEqual("", registry.States().Circuits[0].OpenedOn)
+
+	// a success resets the failures of another endpoint
+	registry.Failure("host2:9000", cfg)
+	registry.Success("host2:9000")
+	suite.Equal(CircuitState{Endpoint: "host2:9000", State: CircuitClosed, LastFailure: registry.States().Circuits[1].LastFailure}, registry.States().Circuits[1])
+
+	// after the open timeout a single trial request is allowed
+	registry.circuits["host1:9000"].openedAt = time.Now().Add(-2 * time.Second)
+	suite.True(registry.Allow("host1:9000", cfg))
+	suite.False(registry.Allow("host1:9000", cfg))
+	suite.Equal(CircuitHalfOpen, registry.States().Circuits[0].State)
+
+	// a released trial allows another one, without changing the state of the circuit
+	registry.Release("host1:9000")
+	suite.Equal(CircuitHalfOpen, registry.States().Circuits[0].State)
+	suite.True(registry.Allow("host1:9000", cfg))
+
+	// a failed trial re-opens the circuit
+	registry.Failure("host1:9000", cfg)
+	suite.False(registry.Allow("host1:9000", cfg))
+
+	// a successful trial closes it
+	registry.circuits["host1:9000"].openedAt = time.Now().Add(-2 * time.Second)
+	suite.True(registry.Allow("host1:9000", cfg))
+	registry.Success("host1:9000")
+	suite.True(registry.Allow("host1:9000", cfg))
+	suite.Equal(CircuitClosed, registry.States().Circuits[0].State)
+	suite.Equal(0, registry.States().Circuits[0].ConsecutiveFailures)
+}
+
+func (suite *CircuitBreakerTestSuite) TestRetrieveAuthResourceRetriesAndFailover() {
+
+	var calls int32
+
+	// fails the first request and serves the rest
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(503)
+			return
+		}
+		w.WriteHeader(200)
+		w.Write([]byte(`{"token": "some-value"}`))
+	}))
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+	port, _ := strconv.Atoi(tsURL.Port())
+
+	// an endpoint that refuses connections
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	downEndpoint := l.Addr().String()
+	l.Close()
+	downHost, downPortStr, _ := net.SplitHostPort(downEndpoint)
+	downPort, _ := strconv.Atoi(downPortStr)
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+	cfg.UpstreamCircuitBreaker = config.CircuitBreaker{FailureThreshold: 1, OpenTimeout: 60}
+
+	Circuits = NewCircuitBreakerRegistry()
+
+	binding := bindings.Binding{Name: "b1", UniqueKey: "unique_key_1"}
+	serviceType := servicetypes.ServiceType{Name: "s2", Type: "web-api"}
+	noRetries := 0
+
+	// the failed request is retried against the same endpoint
+	ham1 := &HeadersAuthMethod{Headers: map[string]string{"x-api-key": "key-1"}}
+	ham1.BasicAuthMethod = BasicAuthMethod{Host: tsURL.Hostname(), Port: port, Type: "headers", RetrievalField: "token"}
+	ham1.ClientOptions = &ClientOptions{RetryBackoff: 1}
+	res1, err1 := ham1.RetrieveAuthResource(binding, serviceType, cfg)
+
+	// the request fails over to the fallback endpoint when the host is down
+	ham2 := &HeadersAuthMethod{Headers: map[string]string{"x-api-key": "key-1"}}
+	ham2.BasicAuthMethod = BasicAuthMethod{Host: downHost, Port: downPort, Type: "headers", RetrievalField: "token", FallbackEndpoints: []string{tsURL.Host}}
+	ham2.ClientOptions = &ClientOptions{MaxRetries: &noRetries}
+	res2, err2 := ham2.RetrieveAuthResource(binding, serviceType, cfg)
+
+	// the circuit of the host is now open, so the request fails fast
+	ham3 := &HeadersAuthMethod{Headers: map[string]string{"x-api-key": "key-1"}}
+	ham3.BasicAuthMethod = BasicAuthMethod{Host: downHost, Port: downPort, Type: "headers", RetrievalField: "token"}
+	_, err3 := ham3.RetrieveAuthResource(binding, serviceType, cfg)
+
+	suite.Nil(err1)
+	suite.Equal(map[string]interface{}{"token": "some-value"}, res1)
+	suite.Equal(int32(3), atomic.LoadInt32(&calls))
+	suite.Nil(err2)
+	suite.Equal(map[string]interface{}{"token": "some-value"}, res2)
+	suite.Equal(503, err3.(*utils.APIError).Code)
+	suite.Equal("The service type is temporarily unavailable", err3.Error())
+	suite.Equal(CircuitOpen, Circuits.States().Circuits[0].State)
+}
+
+func (suite *CircuitBreakerTestSuite) TestParseEndpoint() {
+
+	e1, err1 := parseEndpoint("host1:9000")
+	_, err2 := parseEndpoint("host1")
+	_, err3 := parseEndpoint("host1:port")
+	_, err4 := parseEndpoint(":9000")
+
+	suite.Nil(err1)
+	suite.Equal(upstreamEndpoint{Host: "host1", Port: 9000}, e1)
+	suite.Equal("address host1: missing port in address", err2.Error())
+	suite.Equal("invalid port in endpoint: host1:port", err3.Error())
+	suite.Equal("missing host in endpoint: :9000", err4.Error())
+}
+
+func TestCircuitBreakerTestSuite(t *testing.T) {
+	suite.Run(t, new(CircuitBreakerTestSuite))
+}
@@ -0,0 +1,93 @@
+package authmethods
+
+import (
+	"github.com/ARGOeu/argo-api-authn/bindings"
+	"github.com/ARGOeu/argo-api-authn/config"
+	"github.com/ARGOeu/argo-api-authn/servicetypes"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// AuthMethodTestResult reports the outcome of a dry run of an auth method
+type AuthMethodTestResult struct {
+	Success             bool   `json:"success"`
+	Method              string `json:"method,omitempty"`
+	URL                 string `json:"url,omitempty"`
+	UpstreamStatus      int    `json:"upstream_status,omitempty"`
+	Attempts            int    `json:"attempts"`
+	DurationMs          int64  `json:"duration_ms"`
+	RetrievalFieldFound bool   `json:"retrieval_field_found"`
+	Error               string `json:"error,omitempty"`
+	CorrelationID       string `json:"correlation_id,omitempty"`
+}
+
+// tracer is implemented by the auth methods that can be tested in dry run mode
+type tracer interface {
+	setTrace(trace *RetrievalTrace)
+}
+
+// AuthMethodTest retrieves the binding's auth resource through the given auth method in dry run mode.
+// The auth resource is neither cached nor returned, the circuits of the auth method's endpoints are left untouched
+// and the secrets of the auth method are masked in the reported url
+func AuthMethodTest(am AuthMethod, binding bindings.Binding, serviceType servicetypes.ServiceType, cfg *config.Config) (AuthMethodTestResult, error) {
+
+	var result AuthMethodTestResult
+	var trace = &RetrievalTrace{}
+
+	t, ok := am.(tracer)
+	if !ok {
+		err := utils.APIErrUnsupportedContentNonVerbose("Dry runs of auth method type", am.Type())
+		return result, err
+	}
+
+	t.setTrace(trace)
+	defer t.setTrace(nil)
+
+	start := time.Now()
+	_, err := am.RetrieveAuthResource(binding, serviceType, cfg)
+	result.DurationMs = time.Since(start).Nanoseconds() / int64(time.Millisecond)
+
+	result.Success = err == nil
+	result.RetrievalFieldFound = trace.RetrievalFieldFound
+	result.Attempts = len(trace.Attempts)
+
+	if err != nil {
+		result.Error = err.Error()
+		if apiErr, ok := err.(*utils.APIError); ok {
+			result.CorrelationID = apiErr.CorrelationID
+		}
+	}
+
+	// report the last executed request, which is the one that determined the outcome
+	if len(trace.Attempts) > 0 {
+		last := trace.Attempts[len(trace.Attempts)-1]
+		result.Method = last.Method
+		result.URL = maskURLSecrets(last.URL, am)
+		result.UpstreamStatus = last.StatusCode
+	}
+
+	return result, nil
+}
+
+// maskURLSecrets masks all the occurrences of the auth method's secrets in the given url, in plain or escaped form
+func maskURLSecrets(rawURL string, am AuthMethod) string {
+
+	var secrets []string
+
+	_, _ = utils.TransformTaggedFields(am, "secret", func(s string) (string, error) {
+		if s != "" {
+			secrets = append(secrets, s)
+		}
+		return s, nil
+	})
+
+	for _, s := range secrets {
+		for _, form := range []string{s, url.QueryEscape(s), url.PathEscape(s)} {
+			rawURL = strings.Replace(rawURL, form, MaskSecret(s), -1)
+		}
+	}
+
+	return rawURL
+}
@@ -0,0 +1,92 @@
+package authmethods
+
+import (
+	"github.com/ARGOeu/argo-api-authn/bindings"
+	"github.com/ARGOeu/argo-api-authn/config"
+	"github.com/ARGOeu/argo-api-authn/servicetypes"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+type DryRunTestSuite struct {
+	suite.Suite
+}
+
+func (suite *DryRunTestSuite) TestAuthMethodTest() {
+
+	// serves a token only for the known unique key
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/users:byUUID/unique_key_1":
+			w.WriteHeader(200)
+			w.Write([]byte(`{"token": "some-value"}`))
+		case "/v1/users:byUUID/unique_key_2":
+			w.WriteHeader(200)
+			w.Write([]byte(`{"name": "some-value"}`))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+	port, _ := strconv.Atoi(tsURL.Port())
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+	cfg.UpstreamCircuitBreaker = config.CircuitBreaker{FailureThreshold: 1, OpenTimeout: 60}
+
+	Circuits = NewCircuitBreakerRegistry()
+
+	am := &ApiKeyAuthMethod{AccessKey: "secret/access+key"}
+	am.BasicAuthMethod = BasicAuthMethod{ServiceUUID: "uuid1", Host: tsURL.Hostname(), Port: port, Type: "api-key"}
+	serviceType := servicetypes.ServiceType{Name: "s1", UUID: "uuid1", Type: "ams", AuthMethod: "api-key"}
+
+	// normal case
+	r1, err1 := AuthMethodTest(am, bindings.Binding{UniqueKey: "unique_key_1"}, serviceType, cfg)
+
+	// the retrieval field is missing from the response
+	r2, err2 := AuthMethodTest(am, bindings.Binding{UniqueKey: "unique_key_2"}, serviceType, cfg)
+
+	// the service type rejects the request
+	r3, err3 := AuthMethodTest(am, bindings.Binding{UniqueKey: "unknown"}, serviceType, cfg)
+
+	suite.Nil(err1)
+	suite.True(r1.Success)
+	suite.True(r1.RetrievalFieldFound)
+	suite.Equal(200, r1.UpstreamStatus)
+	suite.Equal(1, r1.Attempts)
+	suite.Equal("GET", r1.Method)
+	suite.Equal("https://"+tsURL.Host+"/v1/users:byUUID/unique_key_1?key=****+key", r1.URL)
+
+	suite.Nil(err2)
+	suite.False(r2.Success)
+	suite.False(r2.RetrievalFieldFound)
+	suite.Equal(200, r2.UpstreamStatus)
+
+	suite.Nil(err3)
+	suite.False(r3.Success)
+	suite.Equal(404, r3.UpstreamStatus)
+	suite.Equal("User was not found on AMS", r3.Error)
+	suite.NotEqual("", r3.CorrelationID)
+
+	// dry runs leave the circuits untouched and the auth method out of dry run mode
+	suite.Equal(0, len(Circuits.States().Circuits))
+	suite.Nil(am.trace)
+}
+
+func (suite *DryRunTestSuite) TestMaskURLSecrets() {
+
+	am := &HeadersAuthMethod{Headers: map[string]string{"x-api-key": "some-long-key"}}
+
+	suite.Equal("https://host1:9000/path?key=****-key", maskURLSecrets("https://host1:9000/path?key=some-long-key", am))
+	suite.Equal("https://host1:9000/path", maskURLSecrets("https://host1:9000/path", am))
+}
+
+func TestDryRunTestSuite(t *testing.T) {
+	suite.Run(t, new(DryRunTestSuite))
+}
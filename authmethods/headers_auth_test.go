@@ -1,6 +1,7 @@
 package authmethods
 
 import (
+	"github.com/ARGOeu/argo-api-authn/config"
 	"github.com/ARGOeu/argo-api-authn/stores"
 	"github.com/stretchr/testify/suite"
 	"testing"
@@ -25,35 +26,24 @@ func (suite *HeadersAuthMethodTestSuite) TestValidate() {
 	// normal case
 	amb2 := BasicAuthMethod{ServiceUUID: "uuid2", Host: "host3", Port: 9000, Type: "headers", UUID: "am_uuid_2", CreatedOn: ""}
 	ham := HeadersAuthMethod{BasicAuthMethod: amb2, Headers: map[string]string{"x-api-key": "headers=key-1", "Accept": "application/json"}}
-	err1 := ham.Validate(mockstore)
+	err1 := ham.Validate(mockstore, config.Config{})
 
 	// empty headers
 	ham2 := HeadersAuthMethod{BasicAuthMethod: amb2}
-	err2 := ham2.Validate(mockstore)
+	err2 := ham2.Validate(mockstore, config.Config{})
 
 	suite.Nil(err1)
 	suite.Equal("auth method object contains empty fields. empty value for field: headers", err2.Error())
 }
 
-func (suite *HeadersAuthMethodTestSuite) TestHeadersAuthFinder() {
+func (suite *HeadersAuthMethodTestSuite) TestRegistration() {
 
-	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
-	mockstore.SetUp()
-
-	var expectedQams []stores.QAuthMethod
-
-	// normal case
-	amb2 := stores.QBasicAuthMethod{ServiceUUID: "uuid2", Host: "host3", Port: 9000, Type: "headers", UUID: "am_uuid_2", CreatedOn: ""}
-	ham := stores.QHeadersAuthMethod{QBasicAuthMethod: amb2, Headers: map[string]string{"x-api-key": "key-1", "Accept": "application/json"}}
-	expectedQams = append(expectedQams, &ham)
-
-	qAms, err1 := HeadersAuthFinder("uuid2", "host3", mockstore)
-
-	// nothing found
-	qAms2, err2 := HeadersAuthFinder("unknown_uuid", "host", mockstore)
+	// the auth method and its query model are created through the registry
+	am, err1 := NewAuthMethodFactory().Create("headers")
+	qam, err2 := (&stores.QAuthMethodFactory{}).Create("headers")
 
-	suite.Equal(expectedQams, qAms)
-	suite.Equal(0, len(qAms2))
+	suite.Equal(&HeadersAuthMethod{}, am)
+	suite.Equal(&stores.QHeadersAuthMethod{}, qam)
 
 	suite.Nil(err1)
 	suite.Nil(err2)
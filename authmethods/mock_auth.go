@@ -19,18 +19,37 @@ import (
 type ExternalServiceHandler func(w http.ResponseWriter, r *http.Request)
 
 type QMockAuthMethod struct {
-	RetrievalField string `json:"retrieval_field"`
+	stores.QBasicAuthMethod
 }
 
 type MockAuthMethod struct {
-	RetrievalField string `json:"retrieval_field"`
+	BasicAuthMethod
 }
 
 func NewMockAuthMethod() AuthMethod {
 	return new(MockAuthMethod)
 }
 
-func (m *MockAuthMethod) Validate(store stores.Store) error {
+func NewQMockAuthMethod() stores.QAuthMethod {
+	return new(QMockAuthMethod)
+}
+
+// Host returns the host of the service type that the auth method is registered for
+func (m *MockAuthMethod) Host() string {
+	return m.BasicAuthMethod.Host
+}
+
+// ServiceUUID returns the uuid of the service type that the auth method is registered for
+func (m *MockAuthMethod) ServiceUUID() string {
+	return m.BasicAuthMethod.ServiceUUID
+}
+
+// Type returns the type of the auth method
+func (m *MockAuthMethod) Type() string {
+	return m.BasicAuthMethod.Type
+}
+
+func (m *MockAuthMethod) Validate(store stores.Store, cfg config.Config) error {
 	return nil
 }
 
@@ -93,20 +112,6 @@ func (m *MockAuthMethod) RetrieveAuthResource(binding bindings.Binding, serviceT
 	return map[string]interface{}{"token": authResource}, err
 }
 
-// MockKeyAuthFinder returns a MockAuthMethod for testing purposes
-func MockKeyAuthFinder(serviceUUID string, host string, store stores.Store) ([]stores.QAuthMethod, error) {
-
-	var err error
-	var qAms []stores.QAuthMethod
-	var qMockAm *QMockAuthMethod
-
-	qMockAm = &QMockAuthMethod{RetrievalField: "token"}
-
-	qAms = append(qAms, qMockAm)
-
-	return qAms, err
-}
-
 // ExternalServiceHandlers contains mock handlers that represent various possible scenarios when executing requests to external services
 var ExternalServiceHandlers = map[string]ExternalServiceHandler{
 	"success":                   ExternalServiceHandlerSuccess,
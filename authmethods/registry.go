@@ -0,0 +1,43 @@
+package authmethods
+
+import (
+	"fmt"
+	"github.com/ARGOeu/argo-api-authn/stores"
+)
+
+// Definition describes an auth method type.
+// The auth method returned by New supplies the validation and the retrieval logic of the type,
+// while the query model returned by NewQueryModel is the form that the auth method is stored in.
+// Both of them have to embed BasicAuthMethod and stores.QBasicAuthMethod respectively,
+// auth methods are converted to and from their query models through their json representation
+type Definition struct {
+	New           AuthMethodInit
+	NewQueryModel stores.QAuthMethodInit
+}
+
+// Register makes an auth method type available under the given name.
+// It is meant to be called from the init function of the package that implements the auth method,
+// the type still has to be declared in the supported auth methods of the configuration in order to be used.
+// Register panics if the definition is incomplete or if the name has already been registered
+func Register(name string, def Definition) {
+
+	if def.New == nil || def.NewQueryModel == nil {
+		panic(fmt.Sprintf("authmethods: incomplete definition for auth method type %v", name))
+	}
+
+	if _, ok := AuthMethodsTypes[name]; ok {
+		panic(fmt.Sprintf("authmethods: Register called twice for auth method type %v", name))
+	}
+
+	if _, ok := stores.QAuthMethodsTypes[name]; ok {
+		panic(fmt.Sprintf("authmethods: the query model of auth method type %v has already been registered", name))
+	}
+
+	AuthMethodsTypes[name] = def.New
+	stores.RegisterQueryModel(name, def.NewQueryModel)
+}
+
+func init() {
+	Register("api-key", Definition{New: NewApiKeyAuthMethod, NewQueryModel: stores.NewQApiKeyAuthMethod})
+	Register("headers", Definition{New: NewHeadersAuthMethod, NewQueryModel: stores.NewQHeadersAuthMethod})
+}
@@ -0,0 +1,134 @@
+package authmethods
+
+import (
+	"github.com/ARGOeu/argo-api-authn/bindings"
+	"github.com/ARGOeu/argo-api-authn/config"
+	"github.com/ARGOeu/argo-api-authn/servicetypes"
+	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+type RegistryTestSuite struct {
+	suite.Suite
+}
+
+// qTokenAuthMethod and tokenAuthMethod represent an auth method type that is declared outside of the package
+type qTokenAuthMethod struct {
+	stores.QBasicAuthMethod `bson:",inline"`
+	Token                   string `json:"token" bson:"token" secret:"true"`
+}
+
+type tokenAuthMethod struct {
+	MockAuthMethod
+	Token string `json:"token"`
+}
+
+// bearerAuthMethod retrieves the auth resources through the exported retrieval path, sending its token as a bearer token
+type bearerAuthMethod struct {
+	MockAuthMethod
+	Token string `json:"token"`
+}
+
+func (m *bearerAuthMethod) RetrieveAuthResource(binding bindings.Binding, serviceType servicetypes.ServiceType, cfg *config.Config) (map[string]interface{}, error) {
+
+	decorate := func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+m.Token)
+		return nil
+	}
+
+	return RetrieveFromUpstream(m, binding, serviceType, cfg, decorate)
+}
+
+func (suite *RegistryTestSuite) TestRegister() {
+
+	Register("token", Definition{
+		New:           func() AuthMethod { return new(tokenAuthMethod) },
+		NewQueryModel: func() stores.QAuthMethod { return new(qTokenAuthMethod) },
+	})
+	defer func() {
+		delete(AuthMethodsTypes, "token")
+		delete(stores.QAuthMethodsTypes, "token")
+	}()
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	am1 := &tokenAuthMethod{Token: "some-token"}
+	am1.BasicAuthMethod = BasicAuthMethod{ServiceUUID: "uuid1", Host: "host2", Port: 9000, Type: "token"}
+
+	// the registered type goes through the generic store operations
+	err1 := AuthMethodCreate(am1, mockstore, "token", config.Config{})
+	am2, err2 := FindHostAuthMethod("uuid1", "host2", "", mockstore)
+	ams, err3 := AuthMethodsFinder("uuid1", "host2", mockstore)
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Equal("some-token", am2.(*tokenAuthMethod).Token)
+	suite.Equal(am1.UUID, am2.Basic().UUID)
+	suite.Equal(1, len(ams))
+
+	// registering a type twice or without its query model is not allowed
+	suite.Panics(func() {
+		Register("token", Definition{New: NewApiKeyAuthMethod, NewQueryModel: stores.NewQApiKeyAuthMethod})
+	})
+	suite.Panics(func() {
+		Register("incomplete", Definition{New: NewApiKeyAuthMethod})
+	})
+
+	// neither is registering a type whose query model has already been registered
+	stores.RegisterQueryModel("stored-only", stores.NewQApiKeyAuthMethod)
+	defer delete(stores.QAuthMethodsTypes, "stored-only")
+	suite.Panics(func() {
+		Register("stored-only", Definition{New: NewApiKeyAuthMethod, NewQueryModel: stores.NewQApiKeyAuthMethod})
+	})
+	_, registered := AuthMethodsTypes["stored-only"]
+	suite.False(registered)
+}
+
+func (suite *RegistryTestSuite) TestRetrieveFromUpstream() {
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer some-token" {
+			w.WriteHeader(401)
+			return
+		}
+		w.WriteHeader(200)
+		w.Write([]byte(`{"api_key": "some-value"}`))
+	}))
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+	port, _ := strconv.Atoi(tsURL.Port())
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	Circuits = NewCircuitBreakerRegistry()
+
+	binding := bindings.Binding{Name: "b1", AuthIdentifier: "test_dn_1", UniqueKey: "unique_key_1"}
+	serviceType := servicetypes.ServiceType{Name: "s2", Type: "web-api"}
+
+	// the request template, the upstream and the response mapping are the ones of the built-in auth methods
+	am1 := &bearerAuthMethod{Token: "some-token"}
+	am1.BasicAuthMethod = BasicAuthMethod{UUID: "am_bearer_1", Host: tsURL.Hostname(), Port: port, Type: "bearer"}
+	res1, err1 := am1.RetrieveAuthResource(binding, serviceType, cfg)
+
+	am2 := &bearerAuthMethod{Token: "wrong-token"}
+	am2.BasicAuthMethod = BasicAuthMethod{UUID: "am_bearer_2", Host: tsURL.Hostname(), Port: port, Type: "bearer"}
+	_, err2 := am2.RetrieveAuthResource(binding, serviceType, cfg)
+
+	suite.Nil(err1)
+	suite.Equal(map[string]interface{}{"token": "some-value"}, res1)
+	suite.Equal(DefaultUpstreamErrors["401"].Code, err2.(*utils.APIError).Code)
+}
+
+func TestRegistryTestSuite(t *testing.T) {
+	suite.Run(t, new(RegistryTestSuite))
+}
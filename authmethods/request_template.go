@@ -0,0 +1,192 @@
+package authmethods
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/ARGOeu/argo-api-authn/bindings"
+	"github.com/ARGOeu/argo-api-authn/servicetypes"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const (
+	DefaultRequestMethod = http.MethodGet
+	DefaultRequestScheme = "https"
+)
+
+// RequestTemplate describes the request that an auth method executes against its host in order to retrieve the auth resource.
+// Path, query values, header values and body are text/templates rendered over a RequestTemplateData
+type RequestTemplate struct {
+	Method  string            `json:"method,omitempty"`
+	Scheme  string            `json:"scheme,omitempty"`
+	Path    string            `json:"path" required:"true"`
+	Query   map[string]string `json:"query,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// RequestTemplateData holds the values that a request template can refer to
+type RequestTemplateData struct {
+	Binding     bindings.Binding
+	ServiceType servicetypes.ServiceType
+	AuthMethod  AuthMethod
+}
+
+// templateFuncs returns the functions available to a request template.
+// identifier and access_key keep the placeholders of the config's service_types_paths working
+func templateFuncs(data RequestTemplateData) template.FuncMap {
+	return template.FuncMap{
+		"identifier": func() string {
+			return data.Binding.UniqueKey
+		},
+		"access_key": func() string {
+			if am, ok := data.AuthMethod.(*ApiKeyAuthMethod); ok {
+				return am.AccessKey
+			}
+			return ""
+		},
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}
+}
+
+// Validate checks that the request template contains a path, a supported method and scheme
+// and that all of its templates can be parsed
+func (t *RequestTemplate) Validate() error {
+
+	var err error
+
+	// check if all required field have been provided
+	if err = utils.ValidateRequired(*t); err != nil {
+		err := utils.APIErrEmptyRequiredField("request_template", err.Error())
+		return err
+	}
+
+	switch strings.ToUpper(t.Method) {
+	case "", http.MethodGet, http.MethodPost, http.MethodPut:
+	default:
+		err = utils.APIErrUnsupportedContent("request_template.method", t.Method, fmt.Sprintf("Supported:%v", []string{http.MethodGet, http.MethodPost, http.MethodPut}))
+		return err
+	}
+
+	switch t.Scheme {
+	case "", "http", "https":
+	default:
+		err = utils.APIErrUnsupportedContent("request_template.scheme", t.Scheme, fmt.Sprintf("Supported:%v", []string{"http", "https"}))
+		return err
+	}
+
+	// use zero data to make sure that the templates parse, rendering happens at retrieval time
+	funcs := templateFuncs(RequestTemplateData{})
+
+	if _, err = template.New("path").Funcs(funcs).Parse(t.Path); err != nil {
+		return utils.APIErrInvalidFieldContent("request_template.path", err.Error())
+	}
+
+	if _, err = template.New("body").Funcs(funcs).Parse(t.Body); err != nil {
+		return utils.APIErrInvalidFieldContent("request_template.body", err.Error())
+	}
+
+	for k, v := range t.Query {
+		if _, err = template.New(k).Funcs(funcs).Parse(v); err != nil {
+			return utils.APIErrInvalidFieldContent("request_template.query", err.Error())
+		}
+	}
+
+	for k, v := range t.Headers {
+		if _, err = template.New(k).Funcs(funcs).Parse(v); err != nil {
+			return utils.APIErrInvalidFieldContent("request_template.headers", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// render executes a single template text over the given data
+func render(name string, text string, data RequestTemplateData) (string, error) {
+
+	var buf bytes.Buffer
+
+	tmpl, err := template.New(name).Funcs(templateFuncs(data)).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// BuildRequest renders the request template over the given data and creates the request towards the given host and port
+func (t *RequestTemplate) BuildRequest(host string, port int, data RequestTemplateData) (*http.Request, error) {
+
+	var err error
+	var req *http.Request
+	var path string
+	var body string
+	var resourceURL *url.URL
+
+	method := strings.ToUpper(t.Method)
+	if method == "" {
+		method = DefaultRequestMethod
+	}
+
+	scheme := t.Scheme
+	if scheme == "" {
+		scheme = DefaultRequestScheme
+	}
+
+	if path, err = render("path", t.Path, data); err != nil {
+		return req, utils.APIGenericInternalError(err.Error())
+	}
+
+	// the rendered path might already contain a query, e.g. paths coming from the config
+	if resourceURL, err = url.Parse(fmt.Sprintf("%v://%v:%v%v", scheme, host, strconv.Itoa(port), path)); err != nil {
+		return req, utils.APIGenericInternalError(err.Error())
+	}
+
+	query := resourceURL.Query()
+	for k, v := range t.Query {
+		var value string
+		if value, err = render(k, v, data); err != nil {
+			return req, utils.APIGenericInternalError(err.Error())
+		}
+		query.Set(k, value)
+	}
+	resourceURL.RawQuery = query.Encode()
+
+	if body, err = render("body", t.Body, data); err != nil {
+		return req, utils.APIGenericInternalError(err.Error())
+	}
+
+	if body != "" && !json.Valid([]byte(body)) {
+		return req, utils.APIGenericInternalError("The rendered request body is not valid JSON")
+	}
+
+	if req, err = http.NewRequest(method, resourceURL.String(), strings.NewReader(body)); err != nil {
+		return req, utils.APIGenericInternalError(err.Error())
+	}
+
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	for k, v := range t.Headers {
+		var value string
+		if value, err = render(k, v, data); err != nil {
+			return req, utils.APIGenericInternalError(err.Error())
+		}
+		req.Header.Set(k, value)
+	}
+
+	return req, err
+}
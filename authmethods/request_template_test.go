@@ -0,0 +1,151 @@
+package authmethods
+
+import (
+	"encoding/json"
+	"github.com/ARGOeu/argo-api-authn/bindings"
+	"github.com/ARGOeu/argo-api-authn/config"
+	"github.com/ARGOeu/argo-api-authn/servicetypes"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+type RequestTemplateTestSuite struct {
+	suite.Suite
+}
+
+func (suite *RequestTemplateTestSuite) TestValidate() {
+
+	// normal case
+	rt1 := RequestTemplate{Method: "post", Scheme: "https", Path: "/v2/users/{{.Binding.UniqueKey}}", Body: `{"key": {{json .AuthMethod.AccessKey}}}`}
+	err1 := rt1.Validate()
+
+	// empty path
+	rt2 := RequestTemplate{Method: "GET"}
+	err2 := rt2.Validate()
+
+	// unsupported method
+	rt3 := RequestTemplate{Method: "DELETE", Path: "/v1/users"}
+	err3 := rt3.Validate()
+
+	// unsupported scheme
+	rt4 := RequestTemplate{Scheme: "ftp", Path: "/v1/users"}
+	err4 := rt4.Validate()
+
+	// malformed template
+	rt5 := RequestTemplate{Path: "/v1/users/{{.Binding.UniqueKey"}
+	err5 := rt5.Validate()
+
+	suite.Nil(err1)
+	suite.Equal("request_template object contains empty fields. empty value for field: path", err2.Error())
+	suite.Equal("request_template.method: DELETE is not yet supported.Supported:[GET POST PUT]", err3.Error())
+	suite.Equal("request_template.scheme: ftp is not yet supported.Supported:[http https]", err4.Error())
+	suite.Contains(err5.Error(), "Field: request_template.path contains invalid data.")
+}
+
+func (suite *RequestTemplateTestSuite) TestBuildRequest() {
+
+	binding := bindings.Binding{Name: "b1", UniqueKey: "unique_key_1", AuthIdentifier: "test_dn_1"}
+	serviceType := servicetypes.ServiceType{Name: "s1", Type: "ams"}
+	am := &ApiKeyAuthMethod{AccessKey: "access_key"}
+	data := RequestTemplateData{Binding: binding, ServiceType: serviceType, AuthMethod: am}
+
+	// legacy config path
+	rt1 := RequestTemplate{Path: "/v1/users:byUUID/{{identifier}}?key={{access_key}}"}
+	req1, err1 := rt1.BuildRequest("host1", 9000, data)
+
+	// full template
+	rt2 := RequestTemplate{
+		Method:  "POST",
+		Scheme:  "http",
+		Path:    "/v2/{{.ServiceType.Name}}/users",
+		Query:   map[string]string{"export": "flat", "name": "{{.Binding.Name}}"},
+		Headers: map[string]string{"x-api-key": "{{.AuthMethod.AccessKey}}"},
+		Body:    `{"dn": {{json .Binding.AuthIdentifier}}}`,
+	}
+	req2, err2 := rt2.BuildRequest("host2", 8080, data)
+	body2, _ := ioutil.ReadAll(req2.Body)
+
+	// body that doesn't render to valid json
+	rt3 := RequestTemplate{Path: "/v1/users", Body: `{"dn": {{.Binding.AuthIdentifier}}}`}
+	_, err3 := rt3.BuildRequest("host1", 9000, data)
+
+	// template referring to an unknown field
+	rt4 := RequestTemplate{Path: "/v1/users/{{.Binding.Unknown}}"}
+	_, err4 := rt4.BuildRequest("host1", 9000, data)
+
+	suite.Equal("GET", req1.Method)
+	suite.Equal("https://host1:9000/v1/users:byUUID/unique_key_1?key=access_key", req1.URL.String())
+
+	suite.Equal("POST", req2.Method)
+	suite.Equal("http://host2:8080/v2/s1/users?export=flat&name=b1", req2.URL.String())
+	suite.Equal("access_key", req2.Header.Get("x-api-key"))
+	suite.Equal("application/json", req2.Header.Get("Content-Type"))
+	suite.Equal(`{"dn": "test_dn_1"}`, string(body2))
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Equal("Internal Error: The rendered request body is not valid JSON", err3.Error())
+	suite.NotNil(err4)
+}
+
+func (suite *RequestTemplateTestSuite) TestRetrieveAuthResourceWithTemplate() {
+
+	var reqPath string
+	var reqHeaders http.Header
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqPath = r.URL.RequestURI()
+		reqHeaders = r.Header
+		w.WriteHeader(200)
+		json.NewEncoder(w).Encode(map[string]string{"api_key": "some-value", "token": "other-value"})
+	}))
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+	port, _ := strconv.Atoi(tsURL.Port())
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	binding := bindings.Binding{Name: "b1", UniqueKey: "unique_key_1"}
+	serviceType := servicetypes.ServiceType{Name: "s1", Type: "custom"}
+
+	// api key auth method with its own template and retrieval field for a type not present in the config
+	apk := &ApiKeyAuthMethod{AccessKey: "access_key"}
+	apk.BasicAuthMethod = BasicAuthMethod{Host: tsURL.Hostname(), Port: port, Type: "api-key", RetrievalField: "api_key"}
+	apk.RequestTemplate = &RequestTemplate{Path: "/v3/users/{{.Binding.UniqueKey}}", Query: map[string]string{"key": "{{.AuthMethod.AccessKey}}"}}
+	res1, err1 := apk.RetrieveAuthResource(binding, serviceType, cfg)
+	path1 := reqPath
+
+	// headers auth method, template headers take precedence over the auth method's headers
+	ham := &HeadersAuthMethod{Headers: map[string]string{"x-api-key": "key-1", "Accept": "application/json"}}
+	ham.BasicAuthMethod = BasicAuthMethod{Host: tsURL.Hostname(), Port: port, Type: "headers"}
+	ham.RequestTemplate = &RequestTemplate{Path: "/v1/users/{{identifier}}", Headers: map[string]string{"Accept": "text/plain"}}
+	res2, err2 := ham.RetrieveAuthResource(binding, servicetypes.ServiceType{Type: "ams"}, cfg)
+
+	// no template and type not present in the config
+	apk2 := &ApiKeyAuthMethod{AccessKey: "access_key"}
+	apk2.BasicAuthMethod = BasicAuthMethod{Host: tsURL.Hostname(), Port: port, Type: "api-key", RetrievalField: "api_key"}
+	_, err3 := apk2.RetrieveAuthResource(binding, serviceType, cfg)
+
+	suite.Equal(map[string]interface{}{"token": "some-value"}, res1)
+	suite.Equal("/v3/users/unique_key_1?key=access_key", path1)
+
+	suite.Equal(map[string]interface{}{"token": "other-value"}, res2)
+	suite.Equal("/v1/users/unique_key_1", reqPath)
+	suite.Equal("key-1", reqHeaders.Get("x-api-key"))
+	suite.Equal("text/plain", reqHeaders.Get("Accept"))
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Equal("Internal Error: Backend error", err3.Error())
+}
+
+func TestRequestTemplateTestSuite(t *testing.T) {
+	suite.Run(t, new(RequestTemplateTestSuite))
+}
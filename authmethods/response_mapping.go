@@ -0,0 +1,133 @@
+package authmethods
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"strconv"
+)
+
+// the types that a response field's value can be converted to
+const (
+	ResponseFieldTypeRaw    = ""
+	ResponseFieldTypeString = "string"
+	ResponseFieldTypeInt    = "int"
+	ResponseFieldTypeFloat  = "float"
+	ResponseFieldTypeBool   = "bool"
+)
+
+// DefaultResponseFieldName is the name under which the retrieval field is returned when no response mapping is declared
+const DefaultResponseFieldName = "token"
+
+// ResponseField maps a value of the service type's response, located through a json path, to a field of the authn response
+type ResponseField struct {
+	Name string `json:"name" required:"true"`
+	Path string `json:"path" required:"true"`
+	Type string `json:"type,omitempty"`
+}
+
+// ResponseMapping is the collection of fields that form the authn response
+type ResponseMapping []ResponseField
+
+// Validate checks that every response field has a name, a valid json path and a supported type
+func (rm ResponseMapping) Validate() error {
+
+	var err error
+	var names = make(map[string]bool)
+
+	for _, rf := range rm {
+
+		// check if all required field have been provided
+		if err = utils.ValidateRequired(rf); err != nil {
+			err := utils.APIErrEmptyRequiredField("response_mapping", err.Error())
+			return err
+		}
+
+		if names[rf.Name] {
+			err = utils.APIErrInvalidFieldContent("response_mapping", fmt.Sprintf("Duplicate name: %v", rf.Name))
+			return err
+		}
+		names[rf.Name] = true
+
+		if _, err = utils.ParseJSONPath(rf.Path); err != nil {
+			err = utils.APIErrInvalidFieldContent("response_mapping", err.Error())
+			return err
+		}
+
+		switch rf.Type {
+		case ResponseFieldTypeRaw, ResponseFieldTypeString, ResponseFieldTypeInt, ResponseFieldTypeFloat, ResponseFieldTypeBool:
+		default:
+			err = utils.APIErrUnsupportedContent("response_mapping.type", rf.Type,
+				fmt.Sprintf("Supported:%v", []string{ResponseFieldTypeString, ResponseFieldTypeInt, ResponseFieldTypeFloat, ResponseFieldTypeBool}))
+			return err
+		}
+	}
+
+	return err
+}
+
+// Apply builds the authn response out of the decoded response of the service type
+func (rm ResponseMapping) Apply(doc interface{}) (map[string]interface{}, error) {
+
+	var err error
+	var value interface{}
+	var authResp = make(map[string]interface{})
+
+	for _, rf := range rm {
+
+		if value, err = utils.JSONPathLookup(doc, rf.Path); err != nil {
+			err = utils.APIErrBadGateway(fmt.Sprintf("The retrieval field could not be resolved in the response body of the service type: %v", err.Error()))
+			return authResp, err
+		}
+
+		if value, err = coerce(value, rf.Type); err != nil {
+			err = utils.APIErrBadGateway(fmt.Sprintf("The retrieval field: `%v` could not be converted to %v. %v", rf.Path, rf.Type, err.Error()))
+			return authResp, err
+		}
+
+		authResp[rf.Name] = value
+	}
+
+	return authResp, err
+}
+
+// coerce converts a value decoded with json.Decoder.UseNumber() to the given type
+func coerce(value interface{}, toType string) (interface{}, error) {
+
+	switch toType {
+	case ResponseFieldTypeRaw:
+		return value, nil
+	case ResponseFieldTypeString:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case json.Number:
+			return v.String(), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+	case ResponseFieldTypeInt:
+		switch v := value.(type) {
+		case json.Number:
+			return v.Int64()
+		case string:
+			return strconv.ParseInt(v, 10, 64)
+		}
+	case ResponseFieldTypeFloat:
+		switch v := value.(type) {
+		case json.Number:
+			return v.Float64()
+		case string:
+			return strconv.ParseFloat(v, 64)
+		}
+	case ResponseFieldTypeBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			return strconv.ParseBool(v)
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported conversion from %T", value)
+}
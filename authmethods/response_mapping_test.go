@@ -0,0 +1,127 @@
+package authmethods
+
+import (
+	"encoding/json"
+	"github.com/ARGOeu/argo-api-authn/bindings"
+	"github.com/ARGOeu/argo-api-authn/config"
+	"github.com/ARGOeu/argo-api-authn/servicetypes"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type ResponseMappingTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ResponseMappingTestSuite) TestValidate() {
+
+	// normal case
+	rm1 := ResponseMapping{{Name: "token", Path: "data[0].api_key"}, {Name: "id", Path: "$.data[0].id", Type: "int"}}
+	err1 := rm1.Validate()
+
+	// empty path
+	rm2 := ResponseMapping{{Name: "token"}}
+	err2 := rm2.Validate()
+
+	// duplicate name
+	rm3 := ResponseMapping{{Name: "token", Path: "token"}, {Name: "token", Path: "api_key"}}
+	err3 := rm3.Validate()
+
+	// invalid path
+	rm4 := ResponseMapping{{Name: "token", Path: "data[x]"}}
+	err4 := rm4.Validate()
+
+	// unsupported type
+	rm5 := ResponseMapping{{Name: "token", Path: "token", Type: "date"}}
+	err5 := rm5.Validate()
+
+	suite.Nil(err1)
+	suite.Equal("response_mapping object contains empty fields. empty value for field: path", err2.Error())
+	suite.Equal("Field: response_mapping contains invalid data. Duplicate name: token", err3.Error())
+	suite.Equal("Field: response_mapping contains invalid data. invalid array index: x in json path expression: data[x]", err4.Error())
+	suite.Equal("response_mapping.type: date is not yet supported.Supported:[string int float bool]", err5.Error())
+}
+
+func (suite *ResponseMappingTestSuite) TestApply() {
+
+	var doc interface{}
+	decoder := json.NewDecoder(strings.NewReader(`{"data": [{"api_key": "k1", "id": 12, "admin": "true", "roles": ["admin"]}]}`))
+	decoder.UseNumber()
+	decoder.Decode(&doc)
+
+	// normal case with type coercion
+	rm1 := ResponseMapping{
+		{Name: "token", Path: "data[0].api_key"},
+		{Name: "id", Path: "data[0].id", Type: "int"},
+		{Name: "id_str", Path: "data[0].id", Type: "string"},
+		{Name: "admin", Path: "data[0].admin", Type: "bool"},
+		{Name: "roles", Path: "data[0].roles"},
+	}
+	res1, err1 := rm1.Apply(doc)
+
+	// path that doesn't resolve
+	rm2 := ResponseMapping{{Name: "token", Path: "data[1].api_key"}}
+	_, err2 := rm2.Apply(doc)
+
+	// value that can't be converted
+	rm3 := ResponseMapping{{Name: "token", Path: "data[0].api_key", Type: "int"}}
+	_, err3 := rm3.Apply(doc)
+
+	suite.Equal(map[string]interface{}{"token": "k1", "id": int64(12), "id_str": "12", "admin": true, "roles": []interface{}{"admin"}}, res1)
+
+	suite.Nil(err1)
+	suite.Equal(502, err2.(*utils.APIError).Code)
+	suite.Equal("Bad Gateway: The retrieval field could not be resolved in the response body of the service type: `data[1].api_key` does not resolve, index 1 is out of range", err2.Error())
+	suite.Contains(err3.Error(), "Bad Gateway: The retrieval field: `data[0].api_key` could not be converted to int.")
+}
+
+func (suite *ResponseMappingTestSuite) TestRetrieveAuthResourceWithResponseMapping() {
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		w.Write([]byte(`{"data": [{"api_key": "some-value", "username": "user1", "roles": ["admin"]}]}`))
+	}))
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+	port, _ := strconv.Atoi(tsURL.Port())
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	binding := bindings.Binding{Name: "b1", UniqueKey: "unique_key_1"}
+	serviceType := servicetypes.ServiceType{Name: "s2", Type: "web-api"}
+
+	// nested retrieval field
+	ham1 := &HeadersAuthMethod{Headers: map[string]string{"x-api-key": "key-1"}}
+	ham1.BasicAuthMethod = BasicAuthMethod{Host: tsURL.Hostname(), Port: port, Type: "headers", RetrievalField: "data[0].api_key"}
+	res1, err1 := ham1.RetrieveAuthResource(binding, serviceType, cfg)
+
+	// response mapping
+	ham2 := &HeadersAuthMethod{Headers: map[string]string{"x-api-key": "key-1"}}
+	ham2.BasicAuthMethod = BasicAuthMethod{Host: tsURL.Hostname(), Port: port, Type: "headers"}
+	ham2.ResponseMapping = ResponseMapping{{Name: "token", Path: "data[0].api_key"}, {Name: "username", Path: "data[0].username"}, {Name: "roles", Path: "data[0].roles"}}
+	res2, err2 := ham2.RetrieveAuthResource(binding, serviceType, cfg)
+
+	// the retrieval field of the config is not present in the response
+	ham3 := &HeadersAuthMethod{Headers: map[string]string{"x-api-key": "key-1"}}
+	ham3.BasicAuthMethod = BasicAuthMethod{Host: tsURL.Hostname(), Port: port, Type: "headers"}
+	_, err3 := ham3.RetrieveAuthResource(binding, serviceType, cfg)
+
+	suite.Equal(map[string]interface{}{"token": "some-value"}, res1)
+	suite.Equal(map[string]interface{}{"token": "some-value", "username": "user1", "roles": []interface{}{"admin"}}, res2)
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Equal("Bad Gateway: The retrieval field could not be resolved in the response body of the service type: `api_key` does not resolve, key `api_key` is missing", err3.Error())
+}
+
+func TestResponseMappingTestSuite(t *testing.T) {
+	suite.Run(t, new(ResponseMappingTestSuite))
+}
@@ -0,0 +1,288 @@
+package authmethods
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ARGOeu/argo-api-authn/bindings"
+	"github.com/ARGOeu/argo-api-authn/config"
+	"github.com/ARGOeu/argo-api-authn/servicetypes"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// upstream holds everything needed to execute the requests of an auth method
+type upstream struct {
+	client  *http.Client
+	options ClientOptions
+	// endpoints are tried in order, the first one is always the auth method's host and port
+	endpoints []upstreamEndpoint
+	// trace is only set in dry run mode, where the requests are recorded and the circuits are left untouched
+	trace *RetrievalTrace
+}
+
+// RetrievalTrace records the requests that were executed while retrieving an auth resource in dry run mode
+type RetrievalTrace struct {
+	Attempts            []RetrievalAttempt
+	RetrievalFieldFound bool
+}
+
+// RetrievalAttempt is a single request towards a service type
+type RetrievalAttempt struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Duration   time.Duration
+	Err        error
+}
+
+// allow checks whether or not the endpoint's circuit allows a request, dry runs are always allowed
+func (up upstream) allow(endpoint upstreamEndpoint, cfg *config.Config) bool {
+	return up.trace != nil || Circuits.Allow(endpoint.String(), cfg)
+}
+
+// success records a request that was served by the endpoint, dry runs are not recorded
+func (up upstream) success(endpoint upstreamEndpoint) {
+	if up.trace == nil {
+		Circuits.Success(endpoint.String())
+	}
+}
+
+// failure records a request that the endpoint failed to serve, dry runs are not recorded
+func (up upstream) failure(endpoint upstreamEndpoint, cfg *config.Config) {
+	if up.trace == nil {
+		Circuits.Failure(endpoint.String(), cfg)
+	}
+}
+
+// release gives up a request that was allowed but never reached the endpoint, dry runs are not recorded
+func (up upstream) release(endpoint upstreamEndpoint) {
+	if up.trace == nil {
+		Circuits.Release(endpoint.String())
+	}
+}
+
+type upstreamEndpoint struct {
+	Host string
+	Port int
+}
+
+func (e upstreamEndpoint) String() string {
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+// parseEndpoint parses a host:port pair
+func parseEndpoint(endpoint string) (upstreamEndpoint, error) {
+
+	host, portStr, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return upstreamEndpoint{}, err
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return upstreamEndpoint{}, fmt.Errorf("invalid port in endpoint: %v", endpoint)
+	}
+
+	if host == "" {
+		return upstreamEndpoint{}, fmt.Errorf("missing host in endpoint: %v", endpoint)
+	}
+
+	return upstreamEndpoint{Host: host, Port: port}, nil
+}
+
+// requestBuilder builds the request of an auth method against the given host and port
+type requestBuilder func(host string, port int) (*http.Request, error)
+
+// RequestDecorator adds the credentials of an auth method to a request that has been built out of its request template
+type RequestDecorator func(req *http.Request) error
+
+// RetrieveFromUpstream retrieves the auth resource of the binding from the host of the given auth method, the way all the auth methods do.
+// The request is built out of the auth method's request template and passed to decorate, when one is given,
+// it is then retried and failed over to the fallback endpoints, its failures are translated according to the service type
+// and its response is mapped to the auth resource. Auth method types that live in other packages call it from their RetrieveAuthResource
+func RetrieveFromUpstream(am AuthMethod, binding bindings.Binding, serviceType servicetypes.ServiceType, cfg *config.Config, decorate RequestDecorator) (map[string]interface{}, error) {
+
+	var err error
+	var respMapping ResponseMapping
+	var reqTemplate RequestTemplate
+	var up upstream
+
+	basic := am.Basic()
+
+	if respMapping, err = basic.responseMapping(serviceType, cfg); err != nil {
+		return map[string]interface{}{}, err
+	}
+
+	if reqTemplate, err = basic.requestTemplate(serviceType, cfg); err != nil {
+		return map[string]interface{}{}, err
+	}
+
+	// build the request that identifies the resource we are going to request, for each endpoint that is tried
+	data := RequestTemplateData{Binding: binding, ServiceType: serviceType, AuthMethod: am}
+	build := func(host string, port int) (*http.Request, error) {
+
+		req, err := reqTemplate.BuildRequest(host, port, data)
+		if err != nil || decorate == nil {
+			return req, err
+		}
+
+		return req, decorate(req)
+	}
+
+	if up, err = basic.upstream(cfg); err != nil {
+		return map[string]interface{}{}, err
+	}
+
+	return retrieveAuthResource(up, build, respMapping, serviceType, cfg)
+}
+
+// isIdempotent checks whether or not a request can be safely repeated
+func isIdempotent(req *http.Request) bool {
+	return req.Method == http.MethodGet || req.Method == http.MethodHead
+}
+
+// execute sends the request built for the given endpoint, idempotent requests are retried
+// with a jittered backoff as long as they fail with a connection error or a 5xx response.
+// It also reports whether or not the request was idempotent
+func (up upstream) execute(build requestBuilder, endpoint upstreamEndpoint) (*http.Response, bool, error) {
+
+	var err error
+	var req *http.Request
+	var resp *http.Response
+
+	for attempt := 0; ; attempt++ {
+
+		if attempt > 0 {
+			time.Sleep(up.options.retryDelay(attempt))
+		}
+
+		if req, err = build(endpoint.Host, endpoint.Port); err != nil {
+			return nil, false, err
+		}
+
+		start := time.Now()
+		resp, err = up.client.Do(req)
+
+		if up.trace != nil {
+			attempt := RetrievalAttempt{Method: req.Method, URL: req.URL.String(), Duration: time.Since(start), Err: err}
+			if err == nil {
+				attempt.StatusCode = resp.StatusCode
+			}
+			up.trace.Attempts = append(up.trace.Attempts, attempt)
+		}
+
+		if !isIdempotent(req) || attempt >= up.options.maxRetries() {
+			return resp, isIdempotent(req), err
+		}
+
+		if err == nil && resp.StatusCode < 500 {
+			return resp, true, err
+		}
+
+		// discard the failed response before retrying so its connection can be reused
+		if err == nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, MaxLoggedUpstreamBody))
+			resp.Body.Close()
+		}
+	}
+}
+
+// retrieveAuthResource executes the auth method's request against its endpoints
+// and builds the auth resource out of the response using the given response mapping.
+// Endpoints whose circuit is open are skipped and idempotent requests fail over to the next endpoint
+func retrieveAuthResource(up upstream, build requestBuilder, respMapping ResponseMapping, serviceType servicetypes.ServiceType, cfg *config.Config) (map[string]interface{}, error) {
+
+	var externalResp interface{}
+	var err error
+	var apiErr *utils.APIError
+	var resp *http.Response
+	var idempotent bool
+	var openCircuits []string
+
+	for _, endpoint := range up.endpoints {
+
+		// errors while building the request are not related to the endpoint,
+		// so the request is built before the endpoint's circuit is consulted
+		if _, err = build(endpoint.Host, endpoint.Port); err != nil {
+			return map[string]interface{}{}, err
+		}
+
+		if !up.allow(endpoint, cfg) {
+			openCircuits = append(openCircuits, endpoint.String())
+			continue
+		}
+
+		if resp, idempotent, err = up.execute(build, endpoint); err != nil {
+
+			// errors while building the request are not related to the endpoint, its trial request, if any, is given up
+			if errors.As(err, &apiErr) {
+				up.release(endpoint)
+				return map[string]interface{}{}, err
+			}
+
+			up.failure(endpoint, cfg)
+			err = translateUpstreamError(serviceType.Type, 0, nil, err, cfg)
+
+			// requests that are not idempotent might have reached the endpoint, so they are not repeated elsewhere
+			if !idempotent {
+				return map[string]interface{}{}, err
+			}
+
+			continue
+		}
+
+		// the endpoint is considered down only when it fails to serve the request,
+		// any other response, even an error, is the definitive answer of the service type
+		if resp.StatusCode >= 500 {
+			up.failure(endpoint, cfg)
+		} else {
+			up.success(endpoint)
+		}
+
+		// evaluate the response
+		if resp.StatusCode >= 400 {
+			// only keep the start of the body, it is logged and never returned to the user
+			body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, MaxLoggedUpstreamBody+1))
+			resp.Body.Close()
+			err = translateUpstreamError(serviceType.Type, resp.StatusCode, body, nil, cfg)
+
+			if resp.StatusCode >= 500 && idempotent {
+				continue
+			}
+
+			return map[string]interface{}{}, err
+		}
+
+		defer resp.Body.Close()
+
+		// get the response from the service type, keep numbers intact so they can be converted later on
+		decoder := json.NewDecoder(resp.Body)
+		decoder.UseNumber()
+		if err = decoder.Decode(&externalResp); err != nil {
+			err = utils.APIErrBadGateway(fmt.Sprintf("The response body of the service type is not valid JSON. %v", err.Error()))
+			return map[string]interface{}{}, err
+		}
+
+		// if everything went ok, return the mapped response fields
+		authResp, err := respMapping.Apply(externalResp)
+
+		if up.trace != nil {
+			up.trace.RetrievalFieldFound = err == nil
+		}
+
+		return authResp, err
+	}
+
+	// none of the endpoints was reached since all of their circuits are open
+	if err == nil {
+		err = circuitOpenError(serviceType.Type, openCircuits, cfg)
+	}
+
+	return map[string]interface{}{}, err
+}
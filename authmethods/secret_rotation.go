@@ -0,0 +1,275 @@
+package authmethods
+
+import (
+	"encoding/json"
+	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/ARGOeu/argo-api-authn/tokencache"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	LOGGER "github.com/sirupsen/logrus"
+	"io"
+)
+
+// SecretRotator is implemented by the auth methods that can hold a next secret next to the current one.
+// The next secret is tried when the service type rejects the current one, and replaces it once it has been accepted
+type SecretRotator interface {
+	// StageSecret returns a copy of the auth method with the reader's secret staged as the next one
+	StageSecret(r io.ReadCloser) (AuthMethod, error)
+	// HasNextSecret checks whether or not a next secret has been staged
+	HasNextSecret() bool
+	// PromoteSecret returns a copy of the auth method where the next secret has replaced the current one
+	PromoteSecret() AuthMethod
+	// SecretStatus reports the secrets of the auth method
+	SecretStatus() SecretStatus
+}
+
+// SecretStatus reports the secrets of an auth method, secrets are always masked.
+// The current secret is the one in use, a next secret replaces it once the service type has accepted it
+type SecretStatus struct {
+	Current          interface{} `json:"current"`
+	Next             interface{} `json:"next,omitempty"`
+	SecretStagedOn   string      `json:"secret_staged_on,omitempty"`
+	SecretPromotedOn string      `json:"secret_promoted_on,omitempty"`
+}
+
+// maskSecretsMap masks all the values of a map of secrets
+func maskSecretsMap(secrets map[string]string) map[string]string {
+
+	if len(secrets) == 0 {
+		return nil
+	}
+
+	masked := make(map[string]string)
+	for k, v := range secrets {
+		masked[k] = MaskSecret(v)
+	}
+
+	return masked
+}
+
+// decodeStagedSecret fills the given struct with the reader's data
+func decodeStagedSecret(r io.ReadCloser, staged interface{}) error {
+
+	var err error
+
+	if err = json.NewDecoder(r).Decode(staged); err != nil {
+		err := utils.APIErrBadRequest(err.Error())
+		return err
+	}
+
+	if err = r.Close(); err != nil {
+		err := utils.APIGenericInternalError(err.Error())
+		return err
+	}
+
+	return err
+}
+
+// rejectedCredentials checks whether or not an error was caused by the service type rejecting the auth method's credentials
+func rejectedCredentials(err error) bool {
+
+	apiErr, ok := err.(*utils.APIError)
+
+	return ok && apiErr.UpstreamCode == 401
+}
+
+// authMethodReplace stores the updated auth method in place of the given one and drops the resources cached through it
+func authMethodReplace(am AuthMethod, updatedAm AuthMethod, store stores.Store) error {
+
+	var err error
+	var qOriginalAm stores.QAuthMethod
+	var qUpdatedAm stores.QAuthMethod
+
+	updatedAm.Basic().Revision = am.Basic().Revision + 1
+
+	if qOriginalAm, err = AuthMethodConvertToQueryModel(am, am.Type()); err != nil {
+		return err
+	}
+
+	if qUpdatedAm, err = AuthMethodConvertToQueryModel(updatedAm, am.Type()); err != nil {
+		return err
+	}
+
+	if _, err = store.UpdateAuthMethod(qOriginalAm, qUpdatedAm); err != nil {
+		return err
+	}
+
+	tokencache.Tokens.InvalidateHost(am.ServiceUUID(), am.Host())
+
+	return err
+}
+
+// AuthMethodStageSecret stages the reader's secret as the next secret of the given auth method
+func AuthMethodStageSecret(am AuthMethod, r io.ReadCloser, store stores.Store) (AuthMethod, error) {
+
+	var err error
+	var ok bool
+	var rotator SecretRotator
+	var stagedAm AuthMethod
+
+	if rotator, ok = am.(SecretRotator); !ok {
+		err = utils.APIErrUnsupportedContentNonVerbose("Secret rotation of auth method type", am.Type())
+		return stagedAm, err
+	}
+
+	if stagedAm, err = rotator.StageSecret(r); err != nil {
+		return stagedAm, err
+	}
+
+	if err = authMethodReplace(am, stagedAm, store); err != nil {
+		return stagedAm, err
+	}
+
+	return stagedAm, err
+}
+
+// AuthMethodSecretStatus reports the secrets of the given auth method
+func AuthMethodSecretStatus(am AuthMethod) (SecretStatus, error) {
+
+	rotator, ok := am.(SecretRotator)
+	if !ok {
+		err := utils.APIErrUnsupportedContentNonVerbose("Secret rotation of auth method type", am.Type())
+		return SecretStatus{}, err
+	}
+
+	return rotator.SecretStatus(), nil
+}
+
+// promoteSecret is used when the service type has rejected the current secret of the auth method.
+// If a next secret has been staged, the auth resource is retrieved using it and on success the next secret is promoted and stored
+func promoteSecret(am AuthMethod, retrieve func(AuthMethod) (map[string]interface{}, error), store stores.Store) (map[string]interface{}, bool) {
+
+	rotator, ok := am.(SecretRotator)
+	if !ok || !rotator.HasNextSecret() {
+		return nil, false
+	}
+
+	promotedAm := rotator.PromoteSecret()
+
+	res, err := retrieve(promotedAm)
+	if err != nil {
+		return nil, false
+	}
+
+	// the auth resource has already been retrieved, failing to store the promotion only means that it will be attempted again
+	if err = authMethodReplace(am, promotedAm, store); err != nil {
+		LOGGER.Errorf("Could not store the promoted secret of auth method %v. %v", am.Basic().UUID, err.Error())
+	} else {
+		LOGGER.Infof("The current secret of auth method %v was rejected, the next secret has been promoted", am.Basic().UUID)
+	}
+
+	return res, true
+}
+
+func (m *ApiKeyAuthMethod) StageSecret(r io.ReadCloser) (AuthMethod, error) {
+
+	var staged struct {
+		AccessKey string `json:"access_key" required:"true"`
+	}
+
+	if err := decodeStagedSecret(r, &staged); err != nil {
+		return nil, err
+	}
+
+	if err := utils.ValidateRequired(staged); err != nil {
+		err := utils.APIErrEmptyRequiredField("secret", err.Error())
+		return nil, err
+	}
+
+	stagedAm := *m
+	stagedAm.NextAccessKey = staged.AccessKey
+	stagedAm.SecretStagedOn = utils.ZuluTimeNow()
+
+	return &stagedAm, nil
+}
+
+func (m *ApiKeyAuthMethod) HasNextSecret() bool {
+	return m.NextAccessKey != ""
+}
+
+func (m *ApiKeyAuthMethod) PromoteSecret() AuthMethod {
+
+	promotedAm := *m
+	promotedAm.AccessKey = m.NextAccessKey
+	promotedAm.NextAccessKey = ""
+	promotedAm.SecretStagedOn = ""
+	promotedAm.SecretPromotedOn = utils.ZuluTimeNow()
+
+	return &promotedAm
+}
+
+func (m *ApiKeyAuthMethod) SecretStatus() SecretStatus {
+
+	status := SecretStatus{
+		Current:          MaskSecret(m.AccessKey),
+		SecretStagedOn:   m.SecretStagedOn,
+		SecretPromotedOn: m.SecretPromotedOn,
+	}
+
+	if m.HasNextSecret() {
+		status.Next = MaskSecret(m.NextAccessKey)
+	}
+
+	return status
+}
+
+func (m *HeadersAuthMethod) StageSecret(r io.ReadCloser) (AuthMethod, error) {
+
+	var staged struct {
+		Headers map[string]string `json:"headers"`
+	}
+
+	if err := decodeStagedSecret(r, &staged); err != nil {
+		return nil, err
+	}
+
+	if len(staged.Headers) == 0 {
+		err := utils.APIErrEmptyRequiredField("secret", utils.GenericEmptyRequiredField("headers").Error())
+		return nil, err
+	}
+
+	stagedAm := *m
+	stagedAm.NextHeaders = staged.Headers
+	stagedAm.SecretStagedOn = utils.ZuluTimeNow()
+
+	return &stagedAm, nil
+}
+
+func (m *HeadersAuthMethod) HasNextSecret() bool {
+	return len(m.NextHeaders) > 0
+}
+
+// PromoteSecret replaces the values of the current headers with the staged ones, headers that have not been staged are kept
+func (m *HeadersAuthMethod) PromoteSecret() AuthMethod {
+
+	promotedAm := *m
+	promotedAm.Headers = make(map[string]string)
+
+	for k, v := range m.Headers {
+		promotedAm.Headers[k] = v
+	}
+
+	for k, v := range m.NextHeaders {
+		promotedAm.Headers[k] = v
+	}
+
+	promotedAm.NextHeaders = nil
+	promotedAm.SecretStagedOn = ""
+	promotedAm.SecretPromotedOn = utils.ZuluTimeNow()
+
+	return &promotedAm
+}
+
+func (m *HeadersAuthMethod) SecretStatus() SecretStatus {
+
+	status := SecretStatus{
+		Current:          maskSecretsMap(m.Headers),
+		SecretStagedOn:   m.SecretStagedOn,
+		SecretPromotedOn: m.SecretPromotedOn,
+	}
+
+	if m.HasNextSecret() {
+		status.Next = maskSecretsMap(m.NextHeaders)
+	}
+
+	return status
+}
@@ -0,0 +1,145 @@
+package authmethods
+
+import (
+	"github.com/ARGOeu/argo-api-authn/bindings"
+	"github.com/ARGOeu/argo-api-authn/config"
+	"github.com/ARGOeu/argo-api-authn/servicetypes"
+	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+type SecretRotationTestSuite struct {
+	suite.Suite
+}
+
+func (suite *SecretRotationTestSuite) TestStageAndPromoteSecret() {
+
+	am1 := &ApiKeyAuthMethod{AccessKey: "access_key"}
+	am1.BasicAuthMethod = BasicAuthMethod{ServiceUUID: "uuid1", Host: "host1", Port: 9000, Type: "api-key", UUID: "am_uuid_1"}
+
+	am2 := &HeadersAuthMethod{Headers: map[string]string{"x-api-key": "some-long-key", "x-user": "user-name-1"}}
+	am2.BasicAuthMethod = BasicAuthMethod{ServiceUUID: "uuid2", Host: "host3", Port: 9000, Type: "headers", UUID: "am_uuid_2"}
+
+	// normal case
+	s1, err1 := am1.StageSecret(ioutil.NopCloser(strings.NewReader(`{"access_key": "next_access_key"}`)))
+	s2, err2 := am2.StageSecret(ioutil.NopCloser(strings.NewReader(`{"headers": {"x-api-key": "next-long-key"}}`)))
+
+	// empty secrets
+	_, err3 := am1.StageSecret(ioutil.NopCloser(strings.NewReader(`{}`)))
+	_, err4 := am2.StageSecret(ioutil.NopCloser(strings.NewReader(`{"headers": {}}`)))
+
+	// invalid json
+	_, err5 := am1.StageSecret(ioutil.NopCloser(strings.NewReader(`{"access_key": }`)))
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Equal("next_access_key", s1.(*ApiKeyAuthMethod).NextAccessKey)
+	suite.Equal("access_key", s1.(*ApiKeyAuthMethod).AccessKey)
+	suite.NotEqual("", s1.(*ApiKeyAuthMethod).SecretStagedOn)
+	suite.True(s1.(SecretRotator).HasNextSecret())
+	suite.False(am1.HasNextSecret())
+	suite.Equal("secret object contains empty fields. empty value for field: access_key", err3.Error())
+	suite.Equal("secret object contains empty fields. empty value for field: headers", err4.Error())
+	suite.Equal(400, err5.(*utils.APIError).Code)
+
+	// the status masks the secrets
+	suite.Equal(SecretStatus{
+		Current:        "****_key",
+		Next:           "****_key",
+		SecretStagedOn: s1.(*ApiKeyAuthMethod).SecretStagedOn,
+	}, s1.(SecretRotator).SecretStatus())
+
+	suite.Equal(SecretStatus{
+		Current:        map[string]string{"x-api-key": "****-key", "x-user": "****me-1"},
+		Next:           map[string]string{"x-api-key": "****-key"},
+		SecretStagedOn: s2.(*HeadersAuthMethod).SecretStagedOn,
+	}, s2.(SecretRotator).SecretStatus())
+
+	// promotion replaces the current secret, headers that have not been staged are kept
+	p1 := s1.(SecretRotator).PromoteSecret().(*ApiKeyAuthMethod)
+	p2 := s2.(SecretRotator).PromoteSecret().(*HeadersAuthMethod)
+
+	suite.Equal("next_access_key", p1.AccessKey)
+	suite.Equal("", p1.NextAccessKey)
+	suite.Equal("", p1.SecretStagedOn)
+	suite.NotEqual("", p1.SecretPromotedOn)
+	suite.Equal(map[string]string{"x-api-key": "next-long-key", "x-user": "user-name-1"}, p2.Headers)
+	suite.Nil(p2.NextHeaders)
+
+	// the staged auth method is not modified by the promotion
+	suite.Equal(map[string]string{"x-api-key": "some-long-key", "x-user": "user-name-1"}, s2.(*HeadersAuthMethod).Headers)
+}
+
+func (suite *SecretRotationTestSuite) TestRetrieveAuthResourcePromotesSecret() {
+
+	var calls int32
+
+	// only the next access key is accepted
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.URL.Query().Get("key") != "next_access_key" {
+			w.WriteHeader(401)
+			return
+		}
+		w.WriteHeader(200)
+		w.Write([]byte(`{"token": "some-value"}`))
+	}))
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+	port, _ := strconv.Atoi(tsURL.Port())
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	Circuits = NewCircuitBreakerRegistry()
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	qam := &stores.QApiKeyAuthMethod{AccessKey: "access_key"}
+	qam.QBasicAuthMethod = stores.QBasicAuthMethod{ServiceUUID: "uuid1", Host: tsURL.Hostname(), Port: port, Type: "api-key", UUID: "am_uuid_3"}
+	mockstore.InsertAuthMethod(qam)
+
+	binding := bindings.Binding{Name: "b1", ServiceUUID: "uuid1", Host: tsURL.Hostname(), UUID: "b_uuid1", UniqueKey: "unique_key_1"}
+	serviceType := servicetypes.ServiceType{Name: "s1", UUID: "uuid1", Type: "ams", AuthMethod: "api-key"}
+
+	// without a next secret the rejection is returned
+	_, err1 := RetrieveAuthResource(binding, serviceType, mockstore, cfg)
+
+	// stage the next secret
+	am, _ := FindHostAuthMethod("uuid1", tsURL.Hostname(), "", mockstore)
+	_, errS := AuthMethodStageSecret(am, ioutil.NopCloser(strings.NewReader(`{"access_key": "next_access_key"}`)), mockstore)
+
+	// the next secret is tried and promoted
+	res2, err2 := RetrieveAuthResource(binding, serviceType, mockstore, cfg)
+	promoted, _ := FindHostAuthMethod("uuid1", tsURL.Hostname(), "", mockstore)
+
+	// the promoted secret is used from now on
+	atomic.StoreInt32(&calls, 0)
+	res3, err3 := RetrieveAuthResource(binding, serviceType, mockstore, cfg)
+
+	suite.Equal(502, err1.(*utils.APIError).Code)
+	suite.Nil(errS)
+	suite.Nil(err2)
+	suite.Equal(map[string]interface{}{"token": "some-value"}, res2)
+	suite.Equal("next_access_key", promoted.(*ApiKeyAuthMethod).AccessKey)
+	suite.Equal("", promoted.(*ApiKeyAuthMethod).NextAccessKey)
+	suite.NotEqual("", promoted.(*ApiKeyAuthMethod).SecretPromotedOn)
+	suite.Nil(err3)
+	suite.Equal(map[string]interface{}{"token": "some-value"}, res3)
+	suite.Equal(int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestSecretRotationTestSuite(t *testing.T) {
+	suite.Run(t, new(SecretRotationTestSuite))
+}
@@ -0,0 +1,68 @@
+package authmethods
+
+import (
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"strings"
+)
+
+// MaskPrefix replaces the hidden part of a masked secret
+const MaskPrefix = "****"
+
+// maskVisibleChars is the amount of trailing characters that remain visible in a masked secret
+const maskVisibleChars = 4
+
+// MaskSecret hides all but the last characters of a secret, short secrets are completely hidden
+func MaskSecret(secret string) string {
+
+	if len(secret) <= 2*maskVisibleChars {
+		return MaskPrefix
+	}
+
+	return MaskPrefix + secret[len(secret)-maskVisibleChars:]
+}
+
+// unmaskSecret returns the existing secret when the given value is its masked form, otherwise the given value
+func unmaskSecret(value string, existing string) string {
+
+	if existing != "" && strings.HasPrefix(value, MaskPrefix) && value == MaskSecret(existing) {
+		return existing
+	}
+
+	return value
+}
+
+// MaskSecrets returns a copy of the auth method where the fields tagged with `secret:"true"` have been masked
+func MaskSecrets(am AuthMethod) (AuthMethod, error) {
+
+	masked, err := utils.TransformTaggedFields(am, "secret", func(s string) (string, error) {
+		// secrets that have not been set, e.g. a next secret that has not been staged, remain empty
+		if s == "" {
+			return s, nil
+		}
+		return MaskSecret(s), nil
+	})
+
+	if err != nil {
+		return am, utils.APIGenericInternalError(err.Error())
+	}
+
+	return masked.(AuthMethod), nil
+}
+
+// MaskSecretsList masks the secrets of all the auth methods of the list
+func MaskSecretsList(amList AuthMethodsList) (AuthMethodsList, error) {
+
+	masked := AuthMethodsList{AuthMethods: []AuthMethod{}, NextPageToken: amList.NextPageToken, TotalSize: amList.TotalSize}
+
+	for _, am := range amList.AuthMethods {
+
+		mam, err := MaskSecrets(am)
+		if err != nil {
+			return amList, err
+		}
+
+		masked.AuthMethods = append(masked.AuthMethods, mam)
+	}
+
+	return masked, nil
+}
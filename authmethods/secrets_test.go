@@ -0,0 +1,78 @@
+package authmethods
+
+import (
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+type SecretsTestSuite struct {
+	suite.Suite
+}
+
+func (suite *SecretsTestSuite) TestMaskSecret() {
+
+	suite.Equal("****_key", MaskSecret("access_key"))
+	suite.Equal("****", MaskSecret("key-1"))
+	suite.Equal("****", MaskSecret("12345678"))
+	suite.Equal("****", MaskSecret(""))
+}
+
+func (suite *SecretsTestSuite) TestMaskSecrets() {
+
+	am1 := &ApiKeyAuthMethod{AccessKey: "access_key"}
+	am1.BasicAuthMethod = BasicAuthMethod{ServiceUUID: "uuid1", Host: "host1", Port: 9000, Type: "api-key", UUID: "am_uuid_1"}
+
+	am2 := &HeadersAuthMethod{Headers: map[string]string{"x-api-key": "some-long-key"}}
+	am2.BasicAuthMethod = BasicAuthMethod{ServiceUUID: "uuid2", Host: "host3", Port: 9000, Type: "headers", UUID: "am_uuid_2"}
+
+	m1, err1 := MaskSecrets(am1)
+	m2, err2 := MaskSecrets(am2)
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Equal("****_key", m1.(*ApiKeyAuthMethod).AccessKey)
+	suite.Equal("host1", m1.(*ApiKeyAuthMethod).Host())
+	suite.Equal(map[string]string{"x-api-key": "****-key"}, m2.(*HeadersAuthMethod).Headers)
+
+	// the original auth methods are not modified
+	suite.Equal("access_key", am1.AccessKey)
+	suite.Equal("some-long-key", am2.Headers["x-api-key"])
+}
+
+func (suite *SecretsTestSuite) TestUpdateWithMaskedSecrets() {
+
+	am1 := &ApiKeyAuthMethod{AccessKey: "access_key"}
+	am1.BasicAuthMethod = BasicAuthMethod{ServiceUUID: "uuid1", Host: "host1", Port: 9000, Type: "api-key", UUID: "am_uuid_1"}
+
+	am2 := &HeadersAuthMethod{Headers: map[string]string{"x-api-key": "some-long-key", "x-user": "user-name-1"}}
+	am2.BasicAuthMethod = BasicAuthMethod{ServiceUUID: "uuid2", Host: "host3", Port: 9000, Type: "headers", UUID: "am_uuid_2"}
+
+	// the masked secret is sent back
+	m1, _ := MaskSecrets(am1)
+	u1, err1 := am1.Update(ConvertAuthMethodToReadCloser(m1))
+
+	// the secret is omitted
+	u2, err2 := am1.Update(ioutil.NopCloser(strings.NewReader(`{"port": 9001}`)))
+
+	// a new secret is provided
+	u3, err3 := am1.Update(ConvertAuthMethodToReadCloser(&ApiKeyAuthMethod{AccessKey: "new_access_key"}))
+
+	// one masked header and one changed header
+	u4, err4 := am2.Update(ConvertAuthMethodToReadCloser(&HeadersAuthMethod{Headers: map[string]string{"x-api-key": "****-key", "x-user": "user-name-2"}}))
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Nil(err4)
+	suite.Equal("access_key", u1.(*ApiKeyAuthMethod).AccessKey)
+	suite.Equal("access_key", u2.(*ApiKeyAuthMethod).AccessKey)
+	suite.Equal(9001, u2.(*ApiKeyAuthMethod).Port)
+	suite.Equal("new_access_key", u3.(*ApiKeyAuthMethod).AccessKey)
+	suite.Equal(map[string]string{"x-api-key": "some-long-key", "x-user": "user-name-2"}, u4.(*HeadersAuthMethod).Headers)
+}
+
+func TestSecretsTestSuite(t *testing.T) {
+	suite.Run(t, new(SecretsTestSuite))
+}
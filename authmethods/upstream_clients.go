@@ -0,0 +1,199 @@
+package authmethods
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"github.com/ARGOeu/argo-api-authn/config"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultUpstreamTimeout      = 30
+	DefaultUpstreamMaxIdleConns = 10
+	DefaultUpstreamIdleTimeout  = 90
+	DefaultUpstreamMaxRetries   = 2
+	DefaultUpstreamRetryBackoff = 100
+)
+
+// ClientOptions configures the http client that an auth method uses to reach its host
+type ClientOptions struct {
+	// Timeout of a request in seconds
+	Timeout int `json:"timeout,omitempty"`
+	// CABundle contains PEM encoded certificates that will be trusted when connecting to the host
+	CABundle string `json:"ca_bundle,omitempty"`
+	// ServerName overrides the name used for SNI and for verifying the host's certificate
+	ServerName   string `json:"server_name,omitempty"`
+	MaxIdleConns int    `json:"max_idle_conns,omitempty"`
+	HTTP2        bool   `json:"http2,omitempty"`
+	// MaxRetries is the amount of times an idempotent request is retried against the same endpoint
+	MaxRetries *int `json:"max_retries,omitempty"`
+	// RetryBackoff is the base delay between retries in milliseconds, it doubles and is jittered on every retry
+	RetryBackoff int `json:"retry_backoff,omitempty"`
+}
+
+// Validate checks the client options' values.
+// A ca bundle or a server name is only used to verify the host's certificate, so they can't be combined with a disabled verify_ssl
+func (o *ClientOptions) Validate(cfg config.Config) error {
+
+	if o.Timeout < 0 {
+		return utils.APIErrInvalidFieldContent("client_options.timeout", "It should be a positive number of seconds")
+	}
+
+	if o.MaxIdleConns < 0 {
+		return utils.APIErrInvalidFieldContent("client_options.max_idle_conns", "It should be a positive number")
+	}
+
+	if o.MaxRetries != nil && *o.MaxRetries < 0 {
+		return utils.APIErrInvalidFieldContent("client_options.max_retries", "It should be a positive number")
+	}
+
+	if o.RetryBackoff < 0 {
+		return utils.APIErrInvalidFieldContent("client_options.retry_backoff", "It should be a positive number of milliseconds")
+	}
+
+	if !cfg.VerifySSL && o.CABundle != "" {
+		return utils.APIErrInvalidFieldContent("client_options.ca_bundle", "It can't be used while verify_ssl is disabled")
+	}
+
+	if !cfg.VerifySSL && o.ServerName != "" {
+		return utils.APIErrInvalidFieldContent("client_options.server_name", "It can't be used while verify_ssl is disabled")
+	}
+
+	if o.CABundle != "" {
+		if ok := x509.NewCertPool().AppendCertsFromPEM([]byte(o.CABundle)); !ok {
+			return utils.APIErrInvalidFieldContent("client_options.ca_bundle", "No PEM encoded certificates could be parsed")
+		}
+	}
+
+	return nil
+}
+
+// newClient builds an http client based on the given options.
+// The options are validated when the auth method is stored, verify_ssl might have been disabled since then though,
+// in which case the host's certificate can't be verified the way the auth method requires
+func (o ClientOptions) newClient(cfg *config.Config) (*http.Client, error) {
+
+	if !cfg.VerifySSL && (o.CABundle != "" || o.ServerName != "") {
+		return nil, utils.APIGenericInternalError("The client options of the auth method require verify_ssl to be enabled")
+	}
+
+	timeout := o.Timeout
+	if timeout == 0 {
+		timeout = DefaultUpstreamTimeout
+	}
+
+	maxIdleConns := o.MaxIdleConns
+	if maxIdleConns == 0 {
+		maxIdleConns = DefaultUpstreamMaxIdleConns
+	}
+
+	tlsCfg := &tls.Config{
+		InsecureSkipVerify: !cfg.VerifySSL,
+		ServerName:         o.ServerName,
+	}
+
+	if o.CABundle != "" {
+		roots := x509.NewCertPool()
+		roots.AppendCertsFromPEM([]byte(o.CABundle))
+		tlsCfg.RootCAs = roots
+	}
+
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		TLSClientConfig:     tlsCfg,
+		MaxIdleConns:        maxIdleConns,
+		MaxIdleConnsPerHost: maxIdleConns,
+		IdleConnTimeout:     time.Duration(DefaultUpstreamIdleTimeout) * time.Second,
+		ForceAttemptHTTP2:   o.HTTP2,
+	}
+
+	return &http.Client{Transport: transport, Timeout: time.Duration(timeout) * time.Second}, nil
+}
+
+// maxRetries returns the amount of retries of an idempotent request
+func (o ClientOptions) maxRetries() int {
+
+	if o.MaxRetries == nil {
+		return DefaultUpstreamMaxRetries
+	}
+
+	return *o.MaxRetries
+}
+
+// retryDelay returns the jittered delay before the given retry, retries are counted from 1
+func (o ClientOptions) retryDelay(retry int) time.Duration {
+
+	backoff := o.RetryBackoff
+	if backoff == 0 {
+		backoff = DefaultUpstreamRetryBackoff
+	}
+
+	delay := time.Duration(backoff) * time.Millisecond << uint(retry-1)
+
+	// keep half of the delay and randomize the rest so retries of concurrent requests are spread out
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+type upstreamClient struct {
+	client      *http.Client
+	fingerprint string
+}
+
+// UpstreamClientRegistry holds one http client per auth method so connections towards its host are reused
+type UpstreamClientRegistry struct {
+	mutex   sync.Mutex
+	clients map[string]upstreamClient
+}
+
+// UpstreamClients is the registry used by all auth methods
+var UpstreamClients = NewUpstreamClientRegistry()
+
+func NewUpstreamClientRegistry() *UpstreamClientRegistry {
+	return &UpstreamClientRegistry{clients: make(map[string]upstreamClient)}
+}
+
+// Client returns the client registered under the given key,
+// a new client is built if none exists or if the options have changed since it was built
+func (r *UpstreamClientRegistry) Client(key string, opts ClientOptions, cfg *config.Config) (*http.Client, error) {
+
+	optsBytes, _ := json.Marshal(opts)
+	fingerprint := fmt.Sprintf("%s|%v", optsBytes, cfg.VerifySSL)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if uc, ok := r.clients[key]; ok {
+		if uc.fingerprint == fingerprint {
+			return uc.client, nil
+		}
+		uc.client.CloseIdleConnections()
+		delete(r.clients, key)
+	}
+
+	client, err := opts.newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	r.clients[key] = upstreamClient{client: client, fingerprint: fingerprint}
+
+	return client, nil
+}
+
+// Invalidate removes the client registered under the given key and closes its idle connections
+func (r *UpstreamClientRegistry) Invalidate(key string) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if uc, ok := r.clients[key]; ok {
+		uc.client.CloseIdleConnections()
+		delete(r.clients, key)
+	}
+}
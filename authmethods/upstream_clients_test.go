@@ -0,0 +1,146 @@
+package authmethods
+
+import (
+	"encoding/pem"
+	"github.com/ARGOeu/argo-api-authn/bindings"
+	"github.com/ARGOeu/argo-api-authn/config"
+	"github.com/ARGOeu/argo-api-authn/servicetypes"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+type UpstreamClientsTestSuite struct {
+	suite.Suite
+}
+
+func (suite *UpstreamClientsTestSuite) TestValidate() {
+
+	cfg := config.Config{VerifySSL: true}
+
+	// normal case
+	o1 := ClientOptions{Timeout: 10, MaxIdleConns: 5, ServerName: "host1", HTTP2: true}
+	err1 := o1.Validate(cfg)
+
+	// negative timeout
+	o2 := ClientOptions{Timeout: -1}
+	err2 := o2.Validate(cfg)
+
+	// negative max idle connections
+	o3 := ClientOptions{MaxIdleConns: -1}
+	err3 := o3.Validate(cfg)
+
+	// invalid ca bundle
+	o4 := ClientOptions{CABundle: "not a certificate"}
+	err4 := o4.Validate(cfg)
+
+	// the host's certificate is not verified, so neither a ca bundle nor a server name can be used
+	cfg.VerifySSL = false
+
+	o5 := ClientOptions{CABundle: "bundle"}
+	err5 := o5.Validate(cfg)
+
+	o6 := ClientOptions{ServerName: "host1"}
+	err6 := o6.Validate(cfg)
+
+	o7 := ClientOptions{Timeout: 10}
+	err7 := o7.Validate(cfg)
+
+	suite.Nil(err1)
+	suite.Equal("Field: client_options.timeout contains invalid data. It should be a positive number of seconds", err2.Error())
+	suite.Equal("Field: client_options.max_idle_conns contains invalid data. It should be a positive number", err3.Error())
+	suite.Equal("Field: client_options.ca_bundle contains invalid data. No PEM encoded certificates could be parsed", err4.Error())
+	suite.Equal("Field: client_options.ca_bundle contains invalid data. It can't be used while verify_ssl is disabled", err5.Error())
+	suite.Equal(422, err5.(*utils.APIError).Code)
+	suite.Equal("Field: client_options.server_name contains invalid data. It can't be used while verify_ssl is disabled", err6.Error())
+	suite.Nil(err7)
+}
+
+func (suite *UpstreamClientsTestSuite) TestClient() {
+
+	cfg := &config.Config{VerifySSL: true}
+	registry := NewUpstreamClientRegistry()
+
+	// the same client is returned as long as the options remain the same
+	c1, _ := registry.Client("am_uuid_1", ClientOptions{Timeout: 10}, cfg)
+	c2, _ := registry.Client("am_uuid_1", ClientOptions{Timeout: 10}, cfg)
+
+	// another auth method gets its own client
+	c3, _ := registry.Client("am_uuid_2", ClientOptions{Timeout: 10}, cfg)
+
+	// changed options rebuild the client
+	c4, _ := registry.Client("am_uuid_1", ClientOptions{Timeout: 20}, cfg)
+
+	// an invalidated client is rebuilt
+	registry.Invalidate("am_uuid_1")
+	c5, _ := registry.Client("am_uuid_1", ClientOptions{Timeout: 20}, cfg)
+
+	suite.True(c1 == c2)
+	suite.False(c1 == c3)
+	suite.False(c1 == c4)
+	suite.False(c4 == c5)
+	suite.Equal(float64(20), c5.Timeout.Seconds())
+	c6, _ := registry.Client("am_uuid_3", ClientOptions{}, cfg)
+	suite.Equal(float64(DefaultUpstreamTimeout), c6.Timeout.Seconds())
+}
+
+func (suite *UpstreamClientsTestSuite) TestClientVerifySSLDisabled() {
+
+	cfg := &config.Config{VerifySSL: false}
+	registry := NewUpstreamClientRegistry()
+
+	// verify_ssl has been disabled after the auth methods with a ca bundle or a server name were stored
+	_, err1 := registry.Client("am_uuid_1", ClientOptions{CABundle: "bundle"}, cfg)
+	_, err2 := registry.Client("am_uuid_2", ClientOptions{ServerName: "host1"}, cfg)
+	c3, err3 := registry.Client("am_uuid_3", ClientOptions{Timeout: 10}, cfg)
+
+	suite.Equal(utils.APIGenericInternalError("The client options of the auth method require verify_ssl to be enabled"), err1)
+	suite.Equal(utils.APIGenericInternalError("The client options of the auth method require verify_ssl to be enabled"), err2)
+	suite.Nil(err3)
+	suite.NotNil(c3)
+	suite.Equal(1, len(registry.clients))
+}
+
+func (suite *UpstreamClientsTestSuite) TestRetrieveAuthResourceWithCABundle() {
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		w.Write([]byte(`{"token": "some-value"}`))
+	}))
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+	port, _ := strconv.Atoi(tsURL.Port())
+
+	caBundle := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}))
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+	cfg.VerifySSL = true
+
+	binding := bindings.Binding{Name: "b1", UniqueKey: "unique_key_1"}
+	serviceType := servicetypes.ServiceType{Name: "s2", Type: "web-api"}
+
+	// the host's certificate is not trusted
+	ham1 := &HeadersAuthMethod{Headers: map[string]string{"x-api-key": "key-1"}}
+	ham1.BasicAuthMethod = BasicAuthMethod{UUID: "am_ca_1", Host: tsURL.Hostname(), Port: port, Type: "headers", RetrievalField: "token"}
+	_, err1 := ham1.RetrieveAuthResource(binding, serviceType, cfg)
+
+	// the host's certificate is trusted through the ca bundle, the test server's certificate is issued for example.com
+	ham2 := &HeadersAuthMethod{Headers: map[string]string{"x-api-key": "key-1"}}
+	ham2.BasicAuthMethod = BasicAuthMethod{UUID: "am_ca_2", Host: tsURL.Hostname(), Port: port, Type: "headers", RetrievalField: "token"}
+	ham2.ClientOptions = &ClientOptions{CABundle: caBundle, ServerName: "example.com"}
+	res2, err2 := ham2.RetrieveAuthResource(binding, serviceType, cfg)
+
+	suite.NotNil(err1)
+	suite.Nil(err2)
+	suite.Equal(map[string]interface{}{"token": "some-value"}, res2)
+}
+
+func TestUpstreamClientsTestSuite(t *testing.T) {
+	suite.Run(t, new(UpstreamClientsTestSuite))
+}
@@ -0,0 +1,138 @@
+package authmethods
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ARGOeu/argo-api-authn/config"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"github.com/satori/go.uuid"
+	LOGGER "github.com/sirupsen/logrus"
+	"net"
+	"strconv"
+)
+
+// MaxLoggedUpstreamBody is the maximum amount of bytes of an upstream error response that will be logged
+const MaxLoggedUpstreamBody = 1024
+
+const (
+	UpstreamErrorTimeout = "timeout"
+	UpstreamErrorDefault = "default"
+	// UpstreamErrorCircuitOpen is used when the circuits of all the endpoints of an auth method are open
+	UpstreamErrorCircuitOpen = "circuit_open"
+)
+
+// DefaultUpstreamErrors holds the translations used for the failures that have not been declared
+// for a service type's type through the config's service_types_upstream_errors
+var DefaultUpstreamErrors = map[string]config.UpstreamError{
+	"404":                    {Code: 404, Status: "NOT FOUND", Message: "User was not found on service"},
+	"401":                    {Code: 502, Status: "BAD GATEWAY", Message: "The auth method is misconfigured, the service type rejected its credentials"},
+	"403":                    {Code: 502, Status: "BAD GATEWAY", Message: "The auth method is misconfigured, the service type rejected its credentials"},
+	UpstreamErrorTimeout:     {Code: 504, Status: "GATEWAY TIMEOUT", Message: "The service type did not respond in time"},
+	UpstreamErrorDefault:     {Code: 502, Status: "BAD GATEWAY", Message: "The service type could not serve the request"},
+	UpstreamErrorCircuitOpen: {Code: 503, Status: "SERVICE UNAVAILABLE", Message: "The service type is temporarily unavailable"},
+}
+
+// upstreamErrorKeys returns the keys that a failure should be looked up under, ordered from the most specific to the most generic
+func upstreamErrorKeys(statusCode int, timeout bool) []string {
+
+	if timeout {
+		return []string{UpstreamErrorTimeout, UpstreamErrorDefault}
+	}
+
+	if statusCode == 0 {
+		return []string{UpstreamErrorDefault}
+	}
+
+	return []string{strconv.Itoa(statusCode), fmt.Sprintf("%vxx", statusCode/100), UpstreamErrorDefault}
+}
+
+// lookupUpstreamError finds the translation of a failure, first in the service type's declared translations and then in the defaults
+func lookupUpstreamError(serviceTypeType string, statusCode int, timeout bool, cfg *config.Config) config.UpstreamError {
+	return lookupUpstreamErrorByKeys(serviceTypeType, upstreamErrorKeys(statusCode, timeout), cfg)
+}
+
+// lookupUpstreamErrorByKeys returns the translation registered under the first matching key.
+// Any of the service type's declared translations, even a class or the default one, takes precedence over the built-in ones
+func lookupUpstreamErrorByKeys(serviceTypeType string, keys []string, cfg *config.Config) config.UpstreamError {
+
+	declared := cfg.ServiceTypesUpstreamErrors[serviceTypeType]
+
+	for _, key := range keys {
+		if ue, ok := declared[key]; ok {
+			return ue
+		}
+	}
+
+	for _, key := range keys {
+		if ue, ok := DefaultUpstreamErrors[key]; ok {
+			return ue
+		}
+	}
+
+	return DefaultUpstreamErrors[UpstreamErrorDefault]
+}
+
+// isTimeout checks whether or not the error of a request was caused by a timeout
+func isTimeout(err error) bool {
+
+	var netErr net.Error
+
+	if errors.As(err, &netErr) {
+		return netErr.Timeout()
+	}
+
+	return false
+}
+
+// truncateBody limits the upstream body to MaxLoggedUpstreamBody bytes
+func truncateBody(body []byte) string {
+
+	if len(body) > MaxLoggedUpstreamBody {
+		return string(body[:MaxLoggedUpstreamBody]) + "...(truncated)"
+	}
+
+	return string(body)
+}
+
+// translateUpstreamError converts a failed request towards a service type to an api error.
+// The upstream details are only logged, under a correlation id that is also included in the api error
+func translateUpstreamError(serviceTypeType string, statusCode int, body []byte, reqErr error, cfg *config.Config) error {
+
+	timeout := isTimeout(reqErr)
+	ue := lookupUpstreamError(serviceTypeType, statusCode, timeout, cfg)
+	correlationID := uuid.NewV4().String()
+
+	if reqErr != nil {
+		LOGGER.Errorf("Upstream request failed. Correlation id: %v, service type: %v, error: %v", correlationID, serviceTypeType, reqErr.Error())
+	} else {
+		LOGGER.Errorf("Upstream request failed. Correlation id: %v, service type: %v, status code: %v, body: %v", correlationID, serviceTypeType, statusCode, truncateBody(body))
+	}
+
+	return &utils.APIError{
+		Message:             ue.Message,
+		Code:                ue.Code,
+		Status:              ue.Status,
+		CorrelationID:       correlationID,
+		UpstreamCode:        statusCode,
+		UpstreamUnavailable: reqErr != nil || statusCode >= 500,
+	}
+}
+
+// circuitOpenError is returned when no request was executed since the circuits of all the auth method's endpoints are open
+func circuitOpenError(serviceTypeType string, endpoints []string, cfg *config.Config) error {
+
+	ue := lookupUpstreamErrorByKeys(serviceTypeType, []string{UpstreamErrorCircuitOpen, UpstreamErrorDefault}, cfg)
+	correlationID := uuid.NewV4().String()
+
+	LOGGER.Errorf("Upstream request was not executed. Correlation id: %v, service type: %v, open circuits: %v", correlationID, serviceTypeType, endpoints)
+
+	return &utils.APIError{Message: ue.Message, Code: ue.Code, Status: ue.Status, CorrelationID: correlationID, UpstreamUnavailable: true}
+}
+
+// upstreamUnavailable checks whether or not an error was caused by the service type not being able to serve the request
+func upstreamUnavailable(err error) bool {
+
+	apiErr, ok := err.(*utils.APIError)
+
+	return ok && apiErr.UpstreamUnavailable
+}
@@ -0,0 +1,129 @@
+package authmethods
+
+import (
+	"github.com/ARGOeu/argo-api-authn/bindings"
+	"github.com/ARGOeu/argo-api-authn/config"
+	"github.com/ARGOeu/argo-api-authn/servicetypes"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"github.com/stretchr/testify/suite"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type UpstreamErrorsTestSuite struct {
+	suite.Suite
+}
+
+type timeoutError struct{}
+
+func (e timeoutError) Error() string   { return "i/o timeout" }
+func (e timeoutError) Timeout() bool   { return true }
+func (e timeoutError) Temporary() bool { return true }
+
+func (suite *UpstreamErrorsTestSuite) TestLookupUpstreamError() {
+
+	cfg := &config.Config{
+		ServiceTypesUpstreamErrors: map[string]map[string]config.UpstreamError{
+			"ams": {
+				"404": {Code: 404, Status: "NOT FOUND", Message: "User was not found on AMS"},
+				"5xx": {Code: 503, Status: "SERVICE UNAVAILABLE", Message: "AMS is unavailable"},
+			},
+			"custom": {
+				"4xx": {Code: 502, Status: "BAD GATEWAY", Message: "The custom service rejected the request"},
+			},
+			"opaque": {
+				"default": {Code: 502, Status: "BAD GATEWAY", Message: "The opaque service failed"},
+			},
+		},
+	}
+
+	// declared for the type
+	suite.Equal(config.UpstreamError{Code: 404, Status: "NOT FOUND", Message: "User was not found on AMS"}, lookupUpstreamError("ams", 404, false, cfg))
+	// declared status class
+	suite.Equal(config.UpstreamError{Code: 503, Status: "SERVICE UNAVAILABLE", Message: "AMS is unavailable"}, lookupUpstreamError("ams", 500, false, cfg))
+	// a declared status class or default takes precedence over a built-in status code
+	suite.Equal(config.UpstreamError{Code: 502, Status: "BAD GATEWAY", Message: "The custom service rejected the request"}, lookupUpstreamError("custom", 404, false, cfg))
+	suite.Equal(config.UpstreamError{Code: 502, Status: "BAD GATEWAY", Message: "The opaque service failed"}, lookupUpstreamError("opaque", 404, false, cfg))
+	suite.Equal(config.UpstreamError{Code: 502, Status: "BAD GATEWAY", Message: "The opaque service failed"}, lookupUpstreamError("opaque", 0, true, cfg))
+	// defaults
+	suite.Equal(DefaultUpstreamErrors["404"], lookupUpstreamError("web-api", 404, false, cfg))
+	suite.Equal(DefaultUpstreamErrors[UpstreamErrorTimeout], lookupUpstreamError("custom", 0, true, cfg))
+	suite.Equal(DefaultUpstreamErrors["401"], lookupUpstreamError("ams", 401, false, cfg))
+	suite.Equal(DefaultUpstreamErrors["403"], lookupUpstreamError("ams", 403, false, cfg))
+	suite.Equal(DefaultUpstreamErrors[UpstreamErrorTimeout], lookupUpstreamError("ams", 0, true, cfg))
+	suite.Equal(DefaultUpstreamErrors[UpstreamErrorDefault], lookupUpstreamError("web-api", 500, false, cfg))
+	suite.Equal(DefaultUpstreamErrors[UpstreamErrorDefault], lookupUpstreamError("web-api", 0, false, cfg))
+}
+
+func (suite *UpstreamErrorsTestSuite) TestTranslateUpstreamError() {
+
+	cfg := &config.Config{}
+
+	// timeout
+	err1 := translateUpstreamError("ams", 0, nil, &url.Error{Op: "Get", URL: "https://host1", Err: timeoutError{}}, cfg)
+
+	// connection error
+	err2 := translateUpstreamError("ams", 0, nil, &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host"}}, cfg)
+
+	// large upstream body is never returned
+	err3 := translateUpstreamError("ams", 500, []byte(strings.Repeat("a", 2*MaxLoggedUpstreamBody)), nil, cfg)
+
+	suite.Equal(504, err1.(*utils.APIError).Code)
+	suite.Equal("GATEWAY TIMEOUT", err1.(*utils.APIError).Status)
+	suite.NotEqual("", err1.(*utils.APIError).CorrelationID)
+	suite.Equal(502, err2.(*utils.APIError).Code)
+	suite.Equal("The service type could not serve the request", err3.Error())
+	suite.Equal(MaxLoggedUpstreamBody+len("...(truncated)"), len(truncateBody([]byte(strings.Repeat("a", 2*MaxLoggedUpstreamBody)))))
+}
+
+func (suite *UpstreamErrorsTestSuite) TestRetrieveAuthResourceUpstreamErrors() {
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code, _ := strconv.Atoi(r.URL.Query().Get("code"))
+		w.WriteHeader(code)
+		w.Write([]byte(`{"error": {"code": 404, "message": "User doesn't exist", "status": "NOT_FOUND"}}`))
+	}))
+	defer ts.Close()
+
+	tsURL, _ := url.Parse(ts.URL)
+	port, _ := strconv.Atoi(tsURL.Port())
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	binding := bindings.Binding{Name: "b1", UniqueKey: "unique_key_1"}
+
+	tests := []struct {
+		upstreamCode int
+		serviceType  string
+		expCode      int
+		expMessage   string
+	}{
+		{404, "ams", 404, "User was not found on AMS"},
+		{404, "web-api", 404, "User was not found on service"},
+		{401, "ams", 502, "The auth method is misconfigured, the service type rejected its credentials"},
+		{403, "ams", 502, "The auth method is misconfigured, the service type rejected its credentials"},
+		{500, "ams", 502, "The service type could not serve the request"},
+	}
+
+	for _, t := range tests {
+		apk := &ApiKeyAuthMethod{AccessKey: "access_key"}
+		apk.BasicAuthMethod = BasicAuthMethod{Host: tsURL.Hostname(), Port: port, Type: "api-key", RetrievalField: "token"}
+		apk.RequestTemplate = &RequestTemplate{Path: "/v1/users", Query: map[string]string{"code": strconv.Itoa(t.upstreamCode)}}
+
+		_, err := apk.RetrieveAuthResource(binding, servicetypes.ServiceType{Type: t.serviceType}, cfg)
+
+		suite.Equal(t.expCode, err.(*utils.APIError).Code)
+		suite.Equal(t.expMessage, err.Error())
+		suite.NotEqual("", err.(*utils.APIError).CorrelationID)
+	}
+}
+
+func TestUpstreamErrorsTestSuite(t *testing.T) {
+	suite.Run(t, new(UpstreamErrorsTestSuite))
+}
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"github.com/ARGOeu/argo-api-authn/servicetypes"
 	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/ARGOeu/argo-api-authn/tokencache"
 	"github.com/ARGOeu/argo-api-authn/utils"
 	uuid2 "github.com/satori/go.uuid"
+	"time"
 )
 
 type Binding struct {
@@ -18,6 +20,19 @@ type Binding struct {
 	AuthType       string `json:"auth_type" required:"true"`
 	CreatedOn      string `json:"created_on,omitempty"`
 	LastAuth       string `json:"last_auth,omitempty"`
+	// AuthMethod is the name of the host's auth method that the binding uses, when empty all of them are tried by priority
+	AuthMethod string `json:"auth_method,omitempty"`
+	// Revision is incremented on every update of the binding, it is also returned as the binding's ETag
+	Revision int64 `json:"revision,omitempty"`
+	// AuthCount is the number of successful authentications through the binding, LastClientIP the address of the latest one
+	AuthCount    int64  `json:"auth_count,omitempty"`
+	LastClientIP string `json:"last_client_ip,omitempty"`
+	// Enabled is only set once the binding has been disabled or re-enabled, disabled bindings can't be used to authenticate
+	Enabled          *bool  `json:"enabled,omitempty"`
+	SuspensionReason string `json:"suspension_reason,omitempty"`
+	// NotBefore and NotAfter limit the period that the binding can be used to authenticate in, empty limits are ignored
+	NotBefore string `json:"not_before,omitempty"`
+	NotAfter  string `json:"not_after,omitempty"`
 }
 
 // TempUpdateBinding is a struct to be used as an intermediate node when updating a binding
@@ -29,10 +44,20 @@ type TempUpdateBinding struct {
 	AuthIdentifier string `json:"auth_identifier"`
 	AuthType       string `json:"auth_type"`
 	UniqueKey      string `json:"unique_key"`
+	AuthMethod     string `json:"auth_method"`
+	// Enabled suspends, or restores, the binding. The suspension reason is dropped once the binding is enabled
+	Enabled          *bool  `json:"enabled"`
+	SuspensionReason string `json:"suspension_reason"`
+	NotBefore        string `json:"not_before"`
+	NotAfter         string `json:"not_after"`
 }
 
 type BindingList struct {
 	Bindings []Binding `json:"bindings"`
+	// NextPageToken is the token of the next page of a paginated listing, it is empty on the last page
+	NextPageToken string `json:"nextPageToken,omitempty"`
+	// TotalSize is the number of all the bindings that the listing matches
+	TotalSize int `json:"totalSize"`
 }
 
 //CreateBinding creates a new binding after validating its context
@@ -59,7 +84,26 @@ func CreateBinding(binding Binding, store stores.Store) (Binding, error) {
 	// generate uuid
 	uuid := uuid2.NewV4().String()
 
-	if qBinding, err = store.InsertBinding(binding.Name, binding.ServiceUUID, binding.Host, uuid, binding.AuthIdentifier, binding.UniqueKey, binding.AuthType); err != nil {
+	// the access settings of the binding aren't part of the insert, they are stored along with it as a unit of work
+	err = store.RunInTransaction(func(tx stores.Store) error {
+
+		inserted, err := tx.InsertBinding(binding.Name, binding.ServiceUUID, binding.Host, uuid, binding.AuthIdentifier, binding.UniqueKey, binding.AuthType, binding.AuthMethod)
+		if err != nil || !binding.hasAccessSettings() {
+			qBinding = inserted
+			return err
+		}
+
+		restricted := inserted
+		restricted.Enabled = binding.Enabled
+		restricted.SuspensionReason = binding.SuspensionReason
+		restricted.NotBefore = binding.NotBefore
+		restricted.NotAfter = binding.NotAfter
+
+		qBinding, err = tx.UpdateBinding(inserted, restricted)
+		return err
+	})
+
+	if err != nil {
 		return binding, err
 	}
 
@@ -89,11 +133,13 @@ func (binding *Binding) Validate(store stores.Store) error {
 		return err
 	}
 
-	// check if the provided host is associated with the given service type
-	if ok = serviceType.HasHost(binding.Host); ok == false {
+	// check if the provided host is associated with the given service type, bindings are kept under the host's canonical name
+	host, ok := serviceType.CanonicalHost(binding.Host)
+	if ok == false {
 		err = utils.APIErrNotFound("Host")
 		return err
 	}
+	binding.Host = host
 
 	// check if the auth type of the bindings is supported by the service type it belongs to
 	if err = serviceType.SupportsAuthType(binding.AuthType); err != nil {
@@ -102,9 +148,38 @@ func (binding *Binding) Validate(store stores.Store) error {
 		return err
 	}
 
+	// suspension reasons are only kept for disabled bindings
+	if binding.IsEnabled() {
+		binding.SuspensionReason = ""
+	}
+
+	return binding.validatePeriod()
+}
+
+// validatePeriod checks that the limits of the period that the binding can be used in are times, and that it isn't empty
+func (binding *Binding) validatePeriod() error {
+
+	for field, value := range map[string]string{"not_before": binding.NotBefore, "not_after": binding.NotAfter} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse(utils.ZULU_FORM, value); err != nil {
+			return utils.APIErrInvalidFieldContent(field, fmt.Sprintf("It should be a time in the format of %v", utils.ZULU_FORM))
+		}
+	}
+
+	if binding.NotBefore != "" && binding.NotAfter != "" && binding.NotBefore >= binding.NotAfter {
+		return utils.APIErrInvalidFieldContent("not_after", "It should be later than not_before")
+	}
+
 	return nil
 }
 
+// hasAccessSettings checks whether or not the binding has been disabled or limited to a period
+func (binding *Binding) hasAccessSettings() bool {
+	return binding.Enabled != nil || binding.NotBefore != "" || binding.NotAfter != ""
+}
+
 // ExistsWithAuthID checks if a binding with the provided auth identifier already exists
 // under the given service type and host
 func ExistsWithAuthID(authID string, serviceUUID string, host string, authType string, store stores.Store) error {
@@ -199,10 +274,33 @@ func FindAllBindings(store stores.Store) (BindingList, error) {
 		bindings = append(bindings, *_binding)
 	}
 
-	return BindingList{Bindings: bindings}, err
+	return BindingList{Bindings: bindings, TotalSize: len(bindings)}, err
 
 }
 
+// ListBindings returns a page of the bindings that match the filter, in the order of the options
+func ListBindings(filter stores.BindingFilter, opts stores.ListOptions, store stores.Store) (BindingList, error) {
+
+	var err error
+	var qPage stores.QBindingsPage
+	var bindings = []Binding{}
+
+	if qPage, err = store.ListBindings(filter, opts); err != nil {
+		return BindingList{Bindings: bindings}, err
+	}
+
+	for _, qb := range qPage.Bindings {
+		_binding := &Binding{}
+		if err := utils.CopyFields(qb, _binding); err != nil {
+			err = utils.APIGenericInternalError(err.Error())
+			return BindingList{Bindings: []Binding{}}, err
+		}
+		bindings = append(bindings, *_binding)
+	}
+
+	return BindingList{Bindings: bindings, NextPageToken: qPage.NextPageToken, TotalSize: qPage.TotalSize}, err
+}
+
 //FindBindingsByServiceTypeAndHost returns all the bindings of a specific service type and host
 func FindBindingsByServiceTypeAndHost(serviceUUID string, host string, store stores.Store) (BindingList, error) {
 
@@ -223,7 +321,7 @@ func FindBindingsByServiceTypeAndHost(serviceUUID string, host string, store sto
 		bindings = append(bindings, *_binding)
 	}
 
-	return BindingList{Bindings: bindings}, err
+	return BindingList{Bindings: bindings, TotalSize: len(bindings)}, err
 }
 
 // FindBindingByUUIDAndName returns the binding associated with the provided uuid and/or name
@@ -233,6 +331,12 @@ func FindBindingByUUIDAndName(uuid, name string, store stores.Store) (Binding, e
 	var err error
 	var binding Binding
 
+	// without a uuid or a name the query would match every binding
+	if uuid == "" && name == "" {
+		err = utils.APIErrNotFound("Binding")
+		return Binding{}, err
+	}
+
 	if qBindings, err = store.QueryBindingsByUUIDAndName(uuid, name); err != nil {
 		return Binding{}, err
 	}
@@ -281,43 +385,110 @@ func UpdateBinding(original Binding, tempBind TempUpdateBinding, store stores.St
 		return updated, err
 	}
 
-	// if there is a new auth identifier provided, check whether or not it already exists
-	if original.AuthIdentifier != updated.AuthIdentifier {
-		// check if a binding with same authID already exists under the same service type and host
-		if err := ExistsWithAuthID(updated.AuthIdentifier, updated.ServiceUUID, updated.Host, updated.AuthType, store); err != nil {
-			return Binding{}, err
-		}
+	// convert the original binding to a QBinding
+	if err := utils.CopyFields(original, &qOriginalBinding); err != nil {
+		err = utils.APIGenericInternalError(err.Error())
+		return Binding{}, err
+	}
+
+	updated.Revision = original.Revision + 1
 
+	// convert the updated binding to a QBinding
+	if err := utils.CopyFields(updated, &qUpdatedBinding); err != nil {
+		err = utils.APIGenericInternalError(err.Error())
+		return Binding{}, err
 	}
 
-	// if there is a new name provided, check whether or not it already exists
-	if original.Name != updated.Name {
-		// check if a binding with same name already exists
-		if err := ExistsWithName(updated.Name, store); err != nil {
-			return Binding{}, err
+	// the uniqueness checks report the conflicts of the update, although it's the unique indexes of the store, not the unit of work,
+	// that keep a binding that moves to another host from colliding with one created there in the meantime,
+	// since the unit of work isn't isolated on every store
+	err = store.RunInTransaction(func(tx stores.Store) error {
+
+		// if there is a new auth identifier provided, or the binding moves to another service type, host or auth type,
+		// check whether or not a binding with the same auth identifier already exists there
+		if original.AuthIdentifier != updated.AuthIdentifier || original.ServiceUUID != updated.ServiceUUID ||
+			original.Host != updated.Host || original.AuthType != updated.AuthType {
+			if err := ExistsWithAuthID(updated.AuthIdentifier, updated.ServiceUUID, updated.Host, updated.AuthType, tx); err != nil {
+				return err
+			}
 		}
 
+		// if there is a new name provided, check whether or not it already exists
+		if original.Name != updated.Name {
+			if err := ExistsWithName(updated.Name, tx); err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.UpdateBinding(qOriginalBinding, qUpdatedBinding)
+		return err
+	})
+
+	if err != nil {
+		return Binding{}, err
 	}
 
-	// convert the original binding to a QBinding
+	// the cached auth resource might have been retrieved using the binding's old unique key
+	tokencache.Tokens.InvalidateBinding(original.UUID)
+
+	return updated, err
+}
+
+// IsEnabled checks whether or not the binding has been suspended
+func (binding *Binding) IsEnabled() bool {
+	return binding.Enabled == nil || *binding.Enabled
+}
+
+// CheckAccess checks whether or not the binding can be used to authenticate at the given time,
+// it has to be enabled and the time has to be within the period of the binding
+func (binding *Binding) CheckAccess(now time.Time) error {
+
+	if !binding.IsEnabled() {
+		return utils.APIErrBindingSuspended(binding.SuspensionReason)
+	}
+
+	t := now.UTC().Format(utils.ZULU_FORM)
+
+	if binding.NotBefore != "" && t < binding.NotBefore {
+		return utils.APIErrBindingNotYetValid(binding.NotBefore)
+	}
+
+	if binding.NotAfter != "" && t >= binding.NotAfter {
+		return utils.APIErrBindingExpired(binding.NotAfter)
+	}
+
+	return nil
+}
+
+// DisableBinding disables a binding, so that it can't be used to authenticate, keeping the reason it was disabled for
+func DisableBinding(original Binding, reason string, store stores.Store) (Binding, error) {
+
+	var qOriginalBinding stores.QBinding
+	var qUpdatedBinding stores.QBinding
+	var disabled = false
+
+	updated := original
+	updated.Enabled = &disabled
+	updated.SuspensionReason = reason
+	updated.Revision = original.Revision + 1
+
 	if err := utils.CopyFields(original, &qOriginalBinding); err != nil {
 		err = utils.APIGenericInternalError(err.Error())
 		return Binding{}, err
 	}
 
-	// convert the updated binding to a QBinding
 	if err := utils.CopyFields(updated, &qUpdatedBinding); err != nil {
 		err = utils.APIGenericInternalError(err.Error())
 		return Binding{}, err
 	}
 
-	// update the binding
-	if _, err = store.UpdateBinding(qOriginalBinding, qUpdatedBinding); err != nil {
-		err = &utils.APIError{Status: "INTERNAL SERVER ERROR", Code: 500, Message: err.Error()}
+	if _, err := store.UpdateBinding(qOriginalBinding, qUpdatedBinding); err != nil {
 		return Binding{}, err
 	}
 
-	return updated, err
+	tokencache.Tokens.InvalidateBinding(original.UUID)
+
+	return updated, nil
 }
 
 // DeleteBinding deletes the given binding from the store
@@ -336,6 +507,8 @@ func DeleteBinding(binding Binding, store stores.Store) error {
 		return err
 	}
 
+	tokencache.Tokens.InvalidateBinding(binding.UUID)
+
 	return err
 
 }
@@ -2,8 +2,10 @@ package bindings
 
 import (
 	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/ARGOeu/argo-api-authn/utils"
 	"github.com/stretchr/testify/suite"
 	"testing"
+	"time"
 )
 
 type BindingTestSuite struct {
@@ -80,6 +82,42 @@ func (suite *BindingTestSuite) TestCreateBinding() {
 
 }
 
+func (suite *BindingTestSuite) TestCreateBindingWithAuthMethod() {
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	// the binding keeps the name of the auth method it uses
+	b1 := Binding{Name: "bins", ServiceUUID: "uuid1", Host: "host1", AuthIdentifier: "dn_ins", UniqueKey: "key", AuthType: "x509", AuthMethod: "robots"}
+	res1, err1 := CreateBinding(b1, mockstore)
+	qb1, _ := mockstore.QueryBindingsByAuthID("dn_ins", "uuid1", "host1", "x509")
+
+	suite.Nil(err1)
+	suite.Equal("robots", res1.AuthMethod)
+	suite.Equal("robots", qb1[0].AuthMethod)
+}
+
+func (suite *BindingTestSuite) TestCreateBindingWithHostAlias() {
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+	mockstore.ServiceTypes[0].HostDetails = []stores.QHost{{Name: "host1", Enabled: true, Aliases: []string{"host1-lb"}}}
+
+	// the binding is kept under the canonical name of the host
+	b1 := Binding{Name: "bins", ServiceUUID: "uuid1", Host: "host1-lb", AuthIdentifier: "dn_ins", UniqueKey: "key", AuthType: "x509"}
+	res1, err1 := CreateBinding(b1, mockstore)
+	qb1, _ := mockstore.QueryBindingsByAuthID("dn_ins", "uuid1", "host1", "x509")
+
+	// the auth identifier already exists under the canonical host
+	b2 := Binding{Name: "bins2", ServiceUUID: "uuid1", Host: "host1-lb", AuthIdentifier: "test_dn_1", UniqueKey: "key", AuthType: "x509"}
+	_, err2 := CreateBinding(b2, mockstore)
+
+	suite.Nil(err1)
+	suite.Equal("host1", res1.Host)
+	suite.Equal(1, len(qb1))
+	suite.Equal("binding object with auth_identifier: test_dn_1 already exists", err2.Error())
+}
+
 func (suite *BindingTestSuite) TestFindBindingByDN() {
 
 	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
@@ -144,10 +182,14 @@ func (suite *BindingTestSuite) TestFindBindingByUUIDAndName() {
 	mockstore.Bindings = append(mockstore.Bindings, stores.QBinding{Name: "b1", ServiceUUID: "uuid1", Host: "host1", UUID: "b_uuid1", AuthIdentifier: "test_dn_1", UniqueKey: "unique_key_1"})
 	_, err3 := FindBindingByUUIDAndName("b_uuid1", "", mockstore)
 
+	// tests the case of neither a uuid nor a name
+	_, err4 := FindBindingByUUIDAndName("", "", mockstore)
+
 	suite.Nil(err1)
 	suite.Nil(err1_name)
 	suite.Equal("Binding was not found", err2.Error())
 	suite.Equal("Database Error: More than 1 Bindings found with the same UUID: b_uuid1", err3.Error())
+	suite.Equal("Binding was not found", err4.Error())
 
 }
 
@@ -163,6 +205,7 @@ func (suite *BindingTestSuite) TestFindAllBindings() {
 	binding3 := Binding{Name: "b3", ServiceUUID: "uuid1", Host: "host2", UUID: "b_uuid3", AuthIdentifier: "test_dn_3", UniqueKey: "unique_key_3", AuthType: "x509", CreatedOn: "2018-05-05T15:04:05Z", LastAuth: ""}
 	binding4 := Binding{Name: "b4", ServiceUUID: "uuid2", Host: "host3", UUID: "b_uuid4", AuthIdentifier: "test_dn_1", UniqueKey: "unique_key_1", AuthType: "x509", CreatedOn: "2018-05-05T15:04:05Z", LastAuth: ""}
 	expectedBL.Bindings = append(expectedBL.Bindings, binding1, binding2, binding3, binding4)
+	expectedBL.TotalSize = 4
 
 	bl, err := FindAllBindings(mockstore)
 
@@ -177,6 +220,39 @@ func (suite *BindingTestSuite) TestFindAllBindings() {
 	suite.Nil(err)
 }
 
+func (suite *BindingTestSuite) TestListBindings() {
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	binding1 := Binding{Name: "b1", ServiceUUID: "uuid1", Host: "host1", UUID: "b_uuid1", AuthIdentifier: "test_dn_1", UniqueKey: "unique_key_1", AuthType: "x509", CreatedOn: "2018-05-05T15:04:05Z", LastAuth: ""}
+	binding2 := Binding{Name: "b2", ServiceUUID: "uuid1", Host: "host1", UUID: "b_uuid2", AuthIdentifier: "test_dn_2", UniqueKey: "unique_key_2", AuthType: "x509", CreatedOn: "2018-05-05T15:04:05Z", LastAuth: ""}
+	binding4 := Binding{Name: "b4", ServiceUUID: "uuid2", Host: "host3", UUID: "b_uuid4", AuthIdentifier: "test_dn_1", UniqueKey: "unique_key_1", AuthType: "x509", CreatedOn: "2018-05-05T15:04:05Z", LastAuth: ""}
+
+	// the first page of the bindings of a service type and host
+	bl1, err1 := ListBindings(stores.BindingFilter{ServiceUUID: "uuid1", Host: "host1"}, stores.ListOptions{PageSize: 1}, mockstore)
+
+	// the next page
+	bl2, err2 := ListBindings(stores.BindingFilter{ServiceUUID: "uuid1", Host: "host1"}, stores.ListOptions{PageSize: 1, PageToken: bl1.NextPageToken}, mockstore)
+
+	// the bindings whose auth identifier contains the given value, in reverse order of their names
+	bl3, err3 := ListBindings(stores.BindingFilter{AuthIdentifier: "dn_1"}, stores.ListOptions{OrderBy: "name", Descending: true}, mockstore)
+
+	// invalid page token
+	_, err4 := ListBindings(stores.BindingFilter{}, stores.ListOptions{PageToken: "invalid"}, mockstore)
+
+	suite.Equal([]Binding{binding1}, bl1.Bindings)
+	suite.NotEqual("", bl1.NextPageToken)
+	suite.Equal(2, bl1.TotalSize)
+	suite.Equal(BindingList{Bindings: []Binding{binding2}, TotalSize: 2}, bl2)
+	suite.Equal(BindingList{Bindings: []Binding{binding4, binding1}, TotalSize: 2}, bl3)
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Equal("Parameter: pageToken contains invalid data. The page token doesn't belong to this listing", err4.Error())
+}
+
 func (suite *BindingTestSuite) TestFindBindingsByServiceTypeAndHost() {
 
 	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
@@ -187,6 +263,7 @@ func (suite *BindingTestSuite) TestFindBindingsByServiceTypeAndHost() {
 	binding1 := Binding{Name: "b1", ServiceUUID: "uuid1", Host: "host1", UUID: "b_uuid1", AuthIdentifier: "test_dn_1", UniqueKey: "unique_key_1", AuthType: "x509", CreatedOn: "2018-05-05T15:04:05Z", LastAuth: ""}
 	binding2 := Binding{Name: "b2", ServiceUUID: "uuid1", Host: "host1", UUID: "b_uuid2", AuthIdentifier: "test_dn_2", UniqueKey: "unique_key_2", AuthType: "x509", CreatedOn: "2018-05-05T15:04:05Z", LastAuth: ""}
 	expectedBL.Bindings = append(expectedBL.Bindings, binding1, binding2)
+	expectedBL.TotalSize = 2
 
 	b1, err1 := FindBindingsByServiceTypeAndHost("uuid1", "host1", mockstore)
 
@@ -257,6 +334,11 @@ func (suite *BindingTestSuite) TestUpdateBinding() {
 	b11 := TempUpdateBinding{Name: "b4", ServiceUUID: "uuid1", Host: "host1", AuthIdentifier: "test_dn_4", UniqueKey: "key", AuthType: "x509"}
 	_, err11 := UpdateBinding(b1, b11, mockstore)
 
+	// tests the case where the binding moves to a host that already has a binding with the same dn
+	bMove := Binding{Name: "b4", ServiceUUID: "uuid2", Host: "host3", UUID: "b_uuid4", AuthIdentifier: "test_dn_1", UniqueKey: "unique_key_1", AuthType: "x509"}
+	b12 := TempUpdateBinding{Name: "b4", ServiceUUID: "uuid1", Host: "host1", AuthIdentifier: "test_dn_1", UniqueKey: "unique_key_1", AuthType: "x509"}
+	_, err12 := UpdateBinding(bMove, b12, mockstore)
+
 	suite.Equal(b1_upd.Name, res1[0].Name)
 	suite.Equal(b1_upd.ServiceUUID, res1[0].ServiceUUID)
 	suite.Equal(b1_upd.Host, res1[0].Host)
@@ -273,7 +355,107 @@ func (suite *BindingTestSuite) TestUpdateBinding() {
 	suite.Equal("binding object with auth_identifier: test_dn_1 already exists", err9.Error())
 	suite.Equal("binding object contains empty fields. empty value for field: auth_type", err10.Error())
 	suite.Equal("binding object with name: b4 already exists", err11.Error())
+	suite.Equal("binding object with auth_identifier: test_dn_1 already exists", err12.Error())
+
+}
+
+func (suite *BindingTestSuite) TestCreateBindingWithAccessSettings() {
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	disabled := false
+
+	// the period and the suspension are stored along with the binding, the suspension reason is only kept for disabled bindings
+	b1 := Binding{Name: "b_period", ServiceUUID: "uuid1", Host: "host1", AuthIdentifier: "dn_period", UniqueKey: "key", AuthType: "x509",
+		NotBefore: "2019-01-01T00:00:00Z", NotAfter: "2019-02-01T00:00:00Z", SuspensionReason: "training"}
+	res1, err1 := CreateBinding(b1, mockstore)
+	q1, _ := mockstore.QueryBindingsByUUIDAndName(res1.UUID, "")
+
+	b2 := Binding{Name: "b_disabled", ServiceUUID: "uuid1", Host: "host1", AuthIdentifier: "dn_disabled", UniqueKey: "key", AuthType: "x509",
+		Enabled: &disabled, SuspensionReason: "compromised"}
+	res2, err2 := CreateBinding(b2, mockstore)
+
+	// an empty period
+	b3 := Binding{Name: "b_empty", ServiceUUID: "uuid1", Host: "host1", AuthIdentifier: "dn_empty", UniqueKey: "key", AuthType: "x509",
+		NotBefore: "2019-02-01T00:00:00Z", NotAfter: "2019-01-01T00:00:00Z"}
+	_, err3 := CreateBinding(b3, mockstore)
+
+	// a limit that isn't a time
+	b4 := Binding{Name: "b_invalid", ServiceUUID: "uuid1", Host: "host1", AuthIdentifier: "dn_invalid", UniqueKey: "key", AuthType: "x509",
+		NotBefore: "2019-01-01"}
+	_, err4 := CreateBinding(b4, mockstore)
+
+	suite.Nil(err1)
+	suite.Equal("2019-01-01T00:00:00Z", res1.NotBefore)
+	suite.Equal("2019-02-01T00:00:00Z", res1.NotAfter)
+	suite.Equal("", res1.SuspensionReason)
+	suite.Equal(int64(0), res1.Revision)
+	suite.Equal("2019-02-01T00:00:00Z", q1[0].NotAfter)
+
+	suite.Nil(err2)
+	suite.False(res2.IsEnabled())
+	suite.Equal("compromised", res2.SuspensionReason)
+
+	suite.Equal(utils.APIErrInvalidFieldContent("not_after", "It should be later than not_before"), err3)
+	suite.Equal(utils.APIErrInvalidFieldContent("not_before", "It should be a time in the format of 2006-01-02T15:04:05Z"), err4)
+}
+
+func (suite *BindingTestSuite) TestUpdateBindingAccessSettings() {
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	enabled := true
+	disabled := false
+
+	b1, _ := FindBindingByUUIDAndName("b_uuid1", "", mockstore)
+
+	// suspend the binding
+	tmp1 := TempUpdateBinding{Name: "b1", ServiceUUID: "uuid1", Host: "host1", AuthIdentifier: "test_dn_1", UniqueKey: "unique_key_1", AuthType: "x509",
+		Enabled: &disabled, SuspensionReason: "compromised"}
+	res1, err1 := UpdateBinding(b1, tmp1, mockstore)
+
+	// re-enable the binding and limit it to a period
+	tmp2 := TempUpdateBinding{Name: "b1", ServiceUUID: "uuid1", Host: "host1", AuthIdentifier: "test_dn_1", UniqueKey: "unique_key_1", AuthType: "x509",
+		Enabled: &enabled, SuspensionReason: "compromised", NotBefore: "2019-01-01T00:00:00Z", NotAfter: "2019-02-01T00:00:00Z"}
+	res2, err2 := UpdateBinding(res1, tmp2, mockstore)
+
+	// a limit that isn't a time
+	tmp3 := TempUpdateBinding{Name: "b1", ServiceUUID: "uuid1", Host: "host1", AuthIdentifier: "test_dn_1", UniqueKey: "unique_key_1", AuthType: "x509",
+		NotAfter: "tomorrow"}
+	_, err3 := UpdateBinding(res2, tmp3, mockstore)
+
+	suite.Nil(err1)
+	suite.False(res1.IsEnabled())
+	suite.Equal("compromised", res1.SuspensionReason)
+
+	suite.Nil(err2)
+	suite.True(res2.IsEnabled())
+	suite.Equal("", res2.SuspensionReason)
+	suite.Equal("2019-01-01T00:00:00Z", res2.NotBefore)
+	suite.Equal("2019-02-01T00:00:00Z", res2.NotAfter)
+
+	suite.Equal(utils.APIErrInvalidFieldContent("not_after", "It should be a time in the format of 2006-01-02T15:04:05Z"), err3)
+}
+
+func (suite *BindingTestSuite) TestCheckAccess() {
+
+	disabled := false
+	now := time.Date(2019, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	b1 := Binding{}
+	b2 := Binding{Enabled: &disabled, SuspensionReason: "compromised"}
+	b3 := Binding{NotBefore: "2019-01-01T00:00:00Z", NotAfter: "2019-02-01T00:00:00Z"}
+	b4 := Binding{NotBefore: "2019-02-01T00:00:00Z"}
+	b5 := Binding{NotAfter: "2019-01-15T00:00:00Z"}
 
+	suite.Nil(b1.CheckAccess(now))
+	suite.Equal(utils.APIErrBindingSuspended("compromised"), b2.CheckAccess(now))
+	suite.Nil(b3.CheckAccess(now))
+	suite.Equal(utils.APIErrBindingNotYetValid("2019-02-01T00:00:00Z"), b4.CheckAccess(now))
+	// the end of the period is excluded
+	suite.Equal(utils.APIErrBindingExpired("2019-01-15T00:00:00Z"), b5.CheckAccess(now))
 }
 
 func (suite *BindingTestSuite) TestDeleteBinding() {
@@ -288,6 +470,7 @@ func (suite *BindingTestSuite) TestDeleteBinding() {
 	expectedBL := BindingList{}
 	binding1 := Binding{Name: "b2", ServiceUUID: "uuid1", Host: "host1", UUID: "b_uuid2", AuthIdentifier: "test_dn_2", UniqueKey: "unique_key_2", AuthType: "x509", CreatedOn: "2018-05-05T15:04:05Z", LastAuth: ""}
 	expectedBL.Bindings = append(expectedBL.Bindings, binding1)
+	expectedBL.TotalSize = 1
 
 	bL1, _ := FindBindingsByServiceTypeAndHost("uuid1", "host1", mockstore)
 
@@ -0,0 +1,274 @@
+package bindings
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ARGOeu/argo-api-authn/config"
+	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	LOGGER "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultStaleAfter         = 180
+	DefaultCleanupGracePeriod = 30
+	DefaultCleanupInterval    = 24
+)
+
+// StaleBindingsGroup holds the stale bindings of a service type's host
+type StaleBindingsGroup struct {
+	ServiceType string    `json:"service_type"`
+	ServiceUUID string    `json:"service_uuid"`
+	Host        string    `json:"host"`
+	Bindings    []Binding `json:"bindings"`
+}
+
+// StaleBindingsReport holds the bindings that haven't been used since a point in time, grouped by service type and host
+type StaleBindingsReport struct {
+	UnusedSince string               `json:"unused_since"`
+	Groups      []StaleBindingsGroup `json:"groups"`
+	TotalSize   int                  `json:"totalSize"`
+}
+
+// CleanupReport holds the stale bindings that a cleanup acted on, or would act on when it is a dry run
+type CleanupReport struct {
+	Action string `json:"action"`
+	DryRun bool   `json:"dry_run"`
+	StaleBindingsReport
+}
+
+// StaleAfter returns the amount of days without authentications after which a binding is stale
+func StaleAfter(cfg *config.Config) int {
+
+	if cfg.BindingCleanup.StaleAfter <= 0 {
+		return DefaultStaleAfter
+	}
+
+	return cfg.BindingCleanup.StaleAfter
+}
+
+// CleanupUnusedSince returns the time before which the bindings that haven't been used are cleaned up,
+// which is the stale period along with the grace period before the given time
+func CleanupUnusedSince(cfg *config.Config, now time.Time) string {
+
+	gracePeriod := cfg.BindingCleanup.GracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = DefaultCleanupGracePeriod
+	}
+
+	return DaysBefore(now, StaleAfter(cfg)+gracePeriod)
+}
+
+// DaysBefore returns the time that is the given amount of days before now, in zulu format
+func DaysBefore(now time.Time, days int) string {
+	return now.UTC().AddDate(0, 0, -days).Format(utils.ZULU_FORM)
+}
+
+// findStaleBindings returns the bindings that haven't been used since the given time,
+// optionally limited to a service type and host
+func findStaleBindings(unusedSince string, serviceUUID string, host string, store stores.Store) ([]Binding, error) {
+
+	filter := stores.BindingFilter{ServiceUUID: serviceUUID, Host: host, UnusedSince: unusedSince}
+
+	list, err := ListBindings(filter, stores.ListOptions{}, store)
+	if err != nil {
+		return []Binding{}, err
+	}
+
+	return list.Bindings, nil
+}
+
+// groupStaleBindings groups the bindings by service type and host, the groups are sorted by the name of the service type and the host
+func groupStaleBindings(unusedSince string, bindings []Binding, store stores.Store) (StaleBindingsReport, error) {
+
+	var report = StaleBindingsReport{UnusedSince: unusedSince, Groups: []StaleBindingsGroup{}, TotalSize: len(bindings)}
+	var serviceTypes = make(map[string]string)
+	var groups = make(map[[2]string]int)
+
+	for _, binding := range bindings {
+
+		name, ok := serviceTypes[binding.ServiceUUID]
+		if !ok {
+			qServices, err := store.QueryServiceTypesByUUID(binding.ServiceUUID)
+			if err != nil {
+				return report, err
+			}
+			if len(qServices) > 0 {
+				name = qServices[0].Name
+			}
+			serviceTypes[binding.ServiceUUID] = name
+		}
+
+		key := [2]string{binding.ServiceUUID, binding.Host}
+
+		idx, ok := groups[key]
+		if !ok {
+			idx = len(report.Groups)
+			groups[key] = idx
+			report.Groups = append(report.Groups, StaleBindingsGroup{ServiceType: name, ServiceUUID: binding.ServiceUUID, Host: binding.Host})
+		}
+
+		report.Groups[idx].Bindings = append(report.Groups[idx].Bindings, binding)
+	}
+
+	sort.SliceStable(report.Groups, func(i, j int) bool {
+		if report.Groups[i].ServiceType != report.Groups[j].ServiceType {
+			return report.Groups[i].ServiceType < report.Groups[j].ServiceType
+		}
+		return report.Groups[i].Host < report.Groups[j].Host
+	})
+
+	return report, nil
+}
+
+// FindStaleBindings reports the bindings that haven't been used since the given time, optionally limited to a service type and host.
+// Bindings that have never been used are stale when they were created before that time
+func FindStaleBindings(unusedSince string, serviceUUID string, host string, store stores.Store) (StaleBindingsReport, error) {
+
+	bindings, err := findStaleBindings(unusedSince, serviceUUID, host, store)
+	if err != nil {
+		return StaleBindingsReport{}, err
+	}
+
+	return groupStaleBindings(unusedSince, bindings, store)
+}
+
+// CleanupStaleBindings disables, or deletes, the bindings that haven't been used since the given time.
+// Bindings that have already been disabled aren't disabled again, a dry run only reports the bindings it would act on.
+// Bindings that fail to be cleaned up are logged and left out of the report, so that they don't stop the cleanup of the rest
+func CleanupStaleBindings(unusedSince string, action string, dryRun bool, store stores.Store) (CleanupReport, error) {
+
+	var cleaned = []Binding{}
+
+	if action != config.BindingCleanupDisable && action != config.BindingCleanupDelete {
+		return CleanupReport{}, utils.APIErrUnsupportedContent("action", action, fmt.Sprintf("Supported:%v", []string{config.BindingCleanupDisable, config.BindingCleanupDelete}))
+	}
+
+	bindings, err := findStaleBindings(unusedSince, "", "", store)
+	if err != nil {
+		return CleanupReport{}, err
+	}
+
+	for _, binding := range bindings {
+
+		if action == config.BindingCleanupDisable && !binding.IsEnabled() {
+			continue
+		}
+
+		if !dryRun {
+			if err = cleanupBinding(binding, action, unusedSince, store); err != nil {
+				LOGGER.Errorf("Could not %v the stale binding %v. %v", action, binding.Name, err.Error())
+				continue
+			}
+		}
+
+		cleaned = append(cleaned, binding)
+	}
+
+	report, err := groupStaleBindings(unusedSince, cleaned, store)
+
+	return CleanupReport{Action: action, DryRun: dryRun, StaleBindingsReport: report}, err
+}
+
+func cleanupBinding(binding Binding, action string, unusedSince string, store stores.Store) error {
+
+	if action == config.BindingCleanupDelete {
+		return DeleteBinding(binding, store)
+	}
+
+	_, err := DisableBinding(binding, fmt.Sprintf("Not used since %v", unusedSince), store)
+
+	return err
+}
+
+// Cleaner runs the cleanup of the stale bindings periodically, according to the configured policy
+type Cleaner struct {
+	store    stores.Store
+	cfg      *config.Config
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+	now      func() time.Time
+}
+
+// NewCleaner creates the cleaner of the stale bindings, there is none when the configuration declares no cleanup action
+func NewCleaner(store stores.Store, cfg *config.Config) *Cleaner {
+
+	if cfg.BindingCleanup.Action == "" {
+		return nil
+	}
+
+	interval := cfg.BindingCleanup.Interval
+	if interval <= 0 {
+		interval = DefaultCleanupInterval
+	}
+
+	return &Cleaner{store: store, cfg: cfg, interval: time.Duration(interval) * time.Hour, now: time.Now}
+}
+
+// Run cleans up the bindings that have been stale for longer than the grace period
+func (c *Cleaner) Run() (CleanupReport, error) {
+
+	store := c.store.Clone()
+	defer store.Close()
+
+	report, err := CleanupStaleBindings(CleanupUnusedSince(c.cfg, c.now()), c.cfg.BindingCleanup.Action, c.cfg.BindingCleanup.DryRun, store)
+	if err != nil {
+		LOGGER.Errorf("Could not clean up the stale bindings. %v", err.Error())
+		return report, err
+	}
+
+	for _, group := range report.Groups {
+		for _, binding := range group.Bindings {
+			if report.DryRun {
+				LOGGER.Infof("Dry run: the stale binding %v of service type %v and host %v would be %vd", binding.Name, group.ServiceType, group.Host, report.Action)
+			} else {
+				LOGGER.Infof("The stale binding %v of service type %v and host %v has been %vd", binding.Name, group.ServiceType, group.Host, report.Action)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// Start runs the cleanup in the background, once when it starts and then every interval, until the cleaner is stopped
+func (c *Cleaner) Start() {
+
+	if c == nil {
+		return
+	}
+
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+
+	go func() {
+
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		defer close(c.done)
+
+		c.Run()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.Run()
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the started cleaner, waiting for a running cleanup to finish
+func (c *Cleaner) Stop() {
+
+	if c == nil || c.stop == nil {
+		return
+	}
+
+	close(c.stop)
+	<-c.done
+}
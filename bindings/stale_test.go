@@ -0,0 +1,152 @@
+package bindings
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ARGOeu/argo-api-authn/config"
+	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"github.com/stretchr/testify/suite"
+)
+
+type StaleBindingsTestSuite struct {
+	suite.Suite
+	mockstore *stores.Mockstore
+}
+
+// SetupTest uses the bindings of the mock store, b3 has never been used while the rest have been used at different times
+func (suite *StaleBindingsTestSuite) SetupTest() {
+
+	suite.mockstore = &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	suite.mockstore.SetUp()
+
+	suite.mockstore.Bindings[0].LastAuth = "2018-06-01T00:00:00Z"
+	suite.mockstore.Bindings[1].LastAuth = "2018-08-01T00:00:00Z"
+	suite.mockstore.Bindings[3].LastAuth = "2018-06-01T00:00:00Z"
+}
+
+func bindingNames(bindings []Binding) []string {
+
+	var names []string
+
+	for _, binding := range bindings {
+		names = append(names, binding.Name)
+	}
+
+	return names
+}
+
+func (suite *StaleBindingsTestSuite) TestFindStaleBindings() {
+
+	report1, err1 := FindStaleBindings("2018-07-01T00:00:00Z", "", "", suite.mockstore)
+	report2, err2 := FindStaleBindings("2018-07-01T00:00:00Z", "uuid1", "host1", suite.mockstore)
+	report3, err3 := FindStaleBindings("2018-01-01T00:00:00Z", "", "", suite.mockstore)
+
+	suite.Nil(err1)
+	suite.Equal("2018-07-01T00:00:00Z", report1.UnusedSince)
+	suite.Equal(3, report1.TotalSize)
+	suite.Equal(3, len(report1.Groups))
+	suite.Equal("s1", report1.Groups[0].ServiceType)
+	suite.Equal("host1", report1.Groups[0].Host)
+	suite.Equal([]string{"b1"}, bindingNames(report1.Groups[0].Bindings))
+	suite.Equal("s1", report1.Groups[1].ServiceType)
+	suite.Equal("host2", report1.Groups[1].Host)
+	suite.Equal([]string{"b3"}, bindingNames(report1.Groups[1].Bindings))
+	suite.Equal("s2", report1.Groups[2].ServiceType)
+	suite.Equal("uuid2", report1.Groups[2].ServiceUUID)
+	suite.Equal("host3", report1.Groups[2].Host)
+	suite.Equal([]string{"b4"}, bindingNames(report1.Groups[2].Bindings))
+
+	suite.Nil(err2)
+	suite.Equal(1, report2.TotalSize)
+	suite.Equal([]string{"b1"}, bindingNames(report2.Groups[0].Bindings))
+
+	suite.Nil(err3)
+	suite.Equal(0, report3.TotalSize)
+	suite.Equal([]StaleBindingsGroup{}, report3.Groups)
+}
+
+func (suite *StaleBindingsTestSuite) TestCleanupStaleBindingsDisable() {
+
+	// a dry run doesn't modify the bindings
+	report1, err1 := CleanupStaleBindings("2018-07-01T00:00:00Z", config.BindingCleanupDisable, true, suite.mockstore)
+	b1, _ := FindBindingByUUIDAndName("b_uuid1", "", suite.mockstore)
+
+	suite.Nil(err1)
+	suite.True(report1.DryRun)
+	suite.Equal(3, report1.TotalSize)
+	suite.True(b1.IsEnabled())
+
+	report2, err2 := CleanupStaleBindings("2018-07-01T00:00:00Z", config.BindingCleanupDisable, false, suite.mockstore)
+	b1, _ = FindBindingByUUIDAndName("b_uuid1", "", suite.mockstore)
+	b2, _ := FindBindingByUUIDAndName("b_uuid2", "", suite.mockstore)
+	b3, _ := FindBindingByUUIDAndName("b_uuid3", "", suite.mockstore)
+
+	suite.Nil(err2)
+	suite.Equal(config.BindingCleanupDisable, report2.Action)
+	suite.False(report2.DryRun)
+	suite.Equal(3, report2.TotalSize)
+	suite.False(b1.IsEnabled())
+	suite.Equal("Not used since 2018-07-01T00:00:00Z", b1.SuspensionReason)
+	suite.Equal(int64(1), b1.Revision)
+	suite.True(b2.IsEnabled())
+	suite.False(b3.IsEnabled())
+
+	// bindings that have already been disabled are left as they are
+	report3, err3 := CleanupStaleBindings("2018-07-01T00:00:00Z", config.BindingCleanupDisable, false, suite.mockstore)
+
+	suite.Nil(err3)
+	suite.Equal(0, report3.TotalSize)
+}
+
+func (suite *StaleBindingsTestSuite) TestCleanupStaleBindingsDelete() {
+
+	report, err1 := CleanupStaleBindings("2018-07-01T00:00:00Z", config.BindingCleanupDelete, false, suite.mockstore)
+	remaining, _ := FindAllBindings(suite.mockstore)
+
+	// unknown action
+	_, err2 := CleanupStaleBindings("2018-07-01T00:00:00Z", "archive", false, suite.mockstore)
+
+	suite.Nil(err1)
+	suite.Equal(3, report.TotalSize)
+	suite.Equal([]string{"b2"}, bindingNames(remaining.Bindings))
+	suite.Equal(utils.APIErrUnsupportedContent("action", "archive", "Supported:[disable delete]"), err2)
+}
+
+func (suite *StaleBindingsTestSuite) TestCleaner() {
+
+	// no cleaner runs without an action
+	suite.Nil(NewCleaner(suite.mockstore, &config.Config{}))
+
+	cfg := &config.Config{BindingCleanup: config.BindingCleanup{Action: config.BindingCleanupDisable, StaleAfter: 20, GracePeriod: 10}}
+
+	cleaner := NewCleaner(suite.mockstore, cfg)
+	cleaner.now = func() time.Time { return time.Date(2018, 7, 1, 0, 0, 0, 0, time.UTC) }
+
+	// the bindings that haven't been used for 30 days are cleaned up
+	report, err := cleaner.Run()
+	b1, _ := FindBindingByUUIDAndName("b_uuid1", "", suite.mockstore)
+	b3, _ := FindBindingByUUIDAndName("b_uuid3", "", suite.mockstore)
+
+	suite.Equal(time.Duration(DefaultCleanupInterval)*time.Hour, cleaner.interval)
+	suite.Nil(err)
+	suite.Equal("2018-06-01T00:00:00Z", report.UnusedSince)
+	suite.Equal(1, report.TotalSize)
+	suite.Equal([]string{"b3"}, bindingNames(report.Groups[0].Bindings))
+	suite.True(b1.IsEnabled())
+	suite.False(b3.IsEnabled())
+}
+
+func (suite *StaleBindingsTestSuite) TestCleanupUnusedSince() {
+
+	now := time.Date(2018, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	suite.Equal("2017-12-03T12:00:00Z", CleanupUnusedSince(&config.Config{}, now))
+	suite.Equal("2018-06-21T12:00:00Z", CleanupUnusedSince(&config.Config{BindingCleanup: config.BindingCleanup{StaleAfter: 5, GracePeriod: 5}}, now))
+	suite.Equal(DefaultStaleAfter, StaleAfter(&config.Config{}))
+}
+
+func TestStaleBindingsTestSuite(t *testing.T) {
+	suite.Run(t, new(StaleBindingsTestSuite))
+}
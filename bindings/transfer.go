@@ -0,0 +1,439 @@
+package bindings
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/ARGOeu/argo-api-authn/utils"
+)
+
+// The formats that bindings are imported and exported in
+const (
+	FormatJSONLines = "jsonl"
+	FormatCSV       = "csv"
+)
+
+// The ways that an import treats the rows of bindings that already exist
+const (
+	ImportUpsert = "upsert"
+	ImportSkip   = "skip"
+	ImportFail   = "fail"
+)
+
+// The actions that an import takes on its rows
+const (
+	ImportActionCreate = "create"
+	ImportActionUpdate = "update"
+	ImportActionSkip   = "skip"
+	ImportActionFail   = "fail"
+)
+
+// exportPageSize is the number of bindings that an export reads from the store at a time
+const exportPageSize = 500
+
+// maxImportLine is the size of the longest json line that an import accepts
+const maxImportLine = 1024 * 1024
+
+// CSVColumns are the columns of the csv format, in the order that exports write them.
+// Imports ignore the columns of the fields that are managed by the service, e.g. uuid and created_on
+var CSVColumns = []string{"name", "service_uuid", "host", "uuid", "auth_identifier", "unique_key", "auth_type", "auth_method",
+	"created_on", "last_auth", "revision", "auth_count", "last_client_ip", "enabled", "suspension_reason", "not_before", "not_after"}
+
+// ImportRow is the outcome of a row of an import, rows are counted from 1 without the csv header and the empty json lines
+type ImportRow struct {
+	Row    int    `json:"row"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ImportReport holds the outcome of every row of an import, or the outcome it would have when it is a dry run
+type ImportReport struct {
+	Mode    string      `json:"mode"`
+	DryRun  bool        `json:"dry_run"`
+	Created int         `json:"created"`
+	Updated int         `json:"updated"`
+	Skipped int         `json:"skipped"`
+	Failed  int         `json:"failed"`
+	Rows    []ImportRow `json:"rows"`
+}
+
+// importRecord is a parsed row of an import, err is set when the row couldn't be parsed
+type importRecord struct {
+	binding Binding
+	err     error
+}
+
+// importPlan is the action that an import takes on a row, existing is the binding that an update replaces
+type importPlan struct {
+	row      ImportRow
+	binding  Binding
+	existing Binding
+}
+
+func checkFormat(format string) error {
+
+	if format != FormatJSONLines && format != FormatCSV {
+		return utils.APIErrUnsupportedContent("format", format, fmt.Sprintf("Supported:%v", []string{FormatJSONLines, FormatCSV}))
+	}
+
+	return nil
+}
+
+// ImportBindings creates the bindings of the given json lines or csv, each row is validated on its own and rows that fail are reported.
+// Rows of bindings that already exist, by name, update them, are skipped or fail according to the mode.
+// In the fail mode any conflict, either with an existing binding or with another row, stops the whole import before anything is written.
+// A dry run only reports what the import would do
+func ImportBindings(r io.Reader, format string, mode string, dryRun bool, store stores.Store) (ImportReport, error) {
+
+	var err error
+	var records []importRecord
+	var conflict error
+
+	if err = checkFormat(format); err != nil {
+		return ImportReport{}, err
+	}
+
+	if mode != ImportUpsert && mode != ImportSkip && mode != ImportFail {
+		return ImportReport{}, utils.APIErrUnsupportedContent("mode", mode, fmt.Sprintf("Supported:%v", []string{ImportUpsert, ImportSkip, ImportFail}))
+	}
+
+	if format == FormatCSV {
+		records, err = readCSVBindings(r)
+	} else {
+		records, err = readJSONLinesBindings(r)
+	}
+
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	var plans = []importPlan{}
+	var names = make(map[string]bool)
+	var authIDs = make(map[[4]string]bool)
+
+	for i, record := range records {
+
+		plan := importPlan{row: ImportRow{Row: i + 1, Name: record.binding.Name}, binding: record.binding}
+
+		err = record.err
+		if err == nil {
+			plan.row.Action, plan.existing, err = planImportRow(&plan.binding, mode, names, authIDs, store)
+		}
+
+		if err != nil {
+			plan.row.Action = ImportActionFail
+			plan.row.Error = err.Error()
+			if apiErr, ok := err.(*utils.APIError); ok && apiErr.Code == 409 && conflict == nil {
+				conflict = err
+			}
+		}
+
+		plans = append(plans, plan)
+	}
+
+	if mode == ImportFail && conflict != nil && !dryRun {
+		return ImportReport{}, conflict
+	}
+
+	var report = ImportReport{Mode: mode, DryRun: dryRun, Rows: []ImportRow{}}
+
+	for _, plan := range plans {
+
+		if !dryRun {
+			if err = applyImportPlan(plan, store); err != nil {
+				plan.row.Action = ImportActionFail
+				plan.row.Error = err.Error()
+			}
+		}
+
+		switch plan.row.Action {
+		case ImportActionCreate:
+			report.Created++
+		case ImportActionUpdate:
+			report.Updated++
+		case ImportActionSkip:
+			report.Skipped++
+		case ImportActionFail:
+			report.Failed++
+		}
+
+		report.Rows = append(report.Rows, plan.row)
+	}
+
+	return report, nil
+}
+
+// planImportRow validates the binding of a row and decides whether it creates, updates or skips a binding.
+// The names and the auth identifiers of the rows that are kept track of, so that rows can't conflict with each other
+func planImportRow(binding *Binding, mode string, names map[string]bool, authIDs map[[4]string]bool, store stores.Store) (string, Binding, error) {
+
+	if err := binding.Validate(store); err != nil {
+		return ImportActionFail, Binding{}, err
+	}
+
+	authID := [4]string{binding.AuthIdentifier, binding.ServiceUUID, binding.Host, binding.AuthType}
+
+	if names[binding.Name] {
+		return ImportActionFail, Binding{}, utils.APIErrConflict("binding", "name", binding.Name)
+	}
+
+	if authIDs[authID] {
+		return ImportActionFail, Binding{}, utils.APIErrConflict("binding", "auth_identifier", binding.AuthIdentifier)
+	}
+
+	action := ImportActionCreate
+
+	existing, err := FindBindingByUUIDAndName("", binding.Name, store)
+	if err != nil && err.Error() != "Binding was not found" {
+		return ImportActionFail, Binding{}, err
+	}
+
+	if err == nil {
+		switch mode {
+		case ImportSkip:
+			return ImportActionSkip, existing, nil
+		case ImportFail:
+			return ImportActionFail, existing, utils.APIErrConflict("binding", "name", binding.Name)
+		}
+		action = ImportActionUpdate
+	}
+
+	// the auth identifier has to be free under the service type and host, unless it is the one the binding already has
+	if action == ImportActionCreate || existing.AuthIdentifier != binding.AuthIdentifier || existing.ServiceUUID != binding.ServiceUUID ||
+		existing.Host != binding.Host || existing.AuthType != binding.AuthType {
+		if err := ExistsWithAuthID(binding.AuthIdentifier, binding.ServiceUUID, binding.Host, binding.AuthType, store); err != nil {
+			return ImportActionFail, existing, err
+		}
+	}
+
+	names[binding.Name] = true
+	authIDs[authID] = true
+
+	return action, existing, nil
+}
+
+// applyImportPlan creates, or updates, the binding of a planned row
+func applyImportPlan(plan importPlan, store stores.Store) error {
+
+	var err error
+
+	switch plan.row.Action {
+	case ImportActionCreate:
+		_, err = CreateBinding(plan.binding, store)
+	case ImportActionUpdate:
+		var tempBinding TempUpdateBinding
+		if err = utils.CopyFields(plan.binding, &tempBinding); err != nil {
+			return utils.APIGenericInternalError(err.Error())
+		}
+		_, err = UpdateBinding(plan.existing, tempBinding, store)
+	}
+
+	return err
+}
+
+// readJSONLinesBindings parses a binding out of every line that isn't empty
+func readJSONLinesBindings(r io.Reader) ([]importRecord, error) {
+
+	var records = []importRecord{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLine)
+
+	for scanner.Scan() {
+
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var record importRecord
+		if err := json.Unmarshal(line, &record.binding); err != nil {
+			record.err = utils.APIErrBadRequest(err.Error())
+		}
+
+		records = append(records, record)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return []importRecord{}, utils.APIErrBadRequest(err.Error())
+	}
+
+	return records, nil
+}
+
+// readCSVBindings parses a binding out of every record after the header, the header names the columns of the records
+func readCSVBindings(r io.Reader) ([]importRecord, error) {
+
+	var records = []importRecord{}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return records, nil
+	}
+
+	if err != nil {
+		return records, utils.APIErrInvalidParameter("csv", err.Error())
+	}
+
+	for _, column := range header {
+		if !isCSVColumn(column) {
+			return records, utils.APIErrUnsupportedContent("column", column, fmt.Sprintf("Supported:%v", CSVColumns))
+		}
+	}
+
+	for {
+
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+
+		var record importRecord
+
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				return []importRecord{}, utils.APIErrInvalidParameter("csv", err.Error())
+			}
+			record.err = utils.APIErrInvalidParameter("csv", err.Error())
+		} else if len(fields) != len(header) {
+			record.err = utils.APIErrInvalidParameter("csv", fmt.Sprintf("The row has %v fields instead of %v", len(fields), len(header)))
+		} else {
+			record.binding, record.err = bindingFromCSV(header, fields)
+		}
+
+		records = append(records, record)
+	}
+}
+
+func isCSVColumn(column string) bool {
+
+	for _, c := range CSVColumns {
+		if c == column {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bindingFromCSV creates a binding out of the fields of a csv record, the columns of the managed fields are ignored
+func bindingFromCSV(header []string, fields []string) (Binding, error) {
+
+	var binding Binding
+
+	for i, column := range header {
+
+		value := fields[i]
+
+		switch column {
+		case "name":
+			binding.Name = value
+		case "service_uuid":
+			binding.ServiceUUID = value
+		case "host":
+			binding.Host = value
+		case "auth_identifier":
+			binding.AuthIdentifier = value
+		case "unique_key":
+			binding.UniqueKey = value
+		case "auth_type":
+			binding.AuthType = value
+		case "auth_method":
+			binding.AuthMethod = value
+		case "suspension_reason":
+			binding.SuspensionReason = value
+		case "not_before":
+			binding.NotBefore = value
+		case "not_after":
+			binding.NotAfter = value
+		case "enabled":
+			if value == "" {
+				continue
+			}
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return binding, utils.APIErrInvalidFieldContent("enabled", "It should be either true or false")
+			}
+			binding.Enabled = &enabled
+		}
+	}
+
+	return binding, nil
+}
+
+// bindingToCSV returns the fields of the binding in the order of the csv columns
+func bindingToCSV(binding Binding) []string {
+
+	var enabled string
+	if binding.Enabled != nil {
+		enabled = strconv.FormatBool(*binding.Enabled)
+	}
+
+	return []string{binding.Name, binding.ServiceUUID, binding.Host, binding.UUID, binding.AuthIdentifier, binding.UniqueKey,
+		binding.AuthType, binding.AuthMethod, binding.CreatedOn, binding.LastAuth, strconv.FormatInt(binding.Revision, 10),
+		strconv.FormatInt(binding.AuthCount, 10), binding.LastClientIP, enabled, binding.SuspensionReason, binding.NotBefore, binding.NotAfter}
+}
+
+// ExportBindings writes all the bindings in the given format, reading them from the store a page at a time so that
+// they are written while they are read. Nothing is written when the first page can't be read
+func ExportBindings(w io.Writer, format string, store stores.Store) error {
+
+	var opts = stores.ListOptions{PageSize: exportPageSize}
+	var csvWriter *csv.Writer
+
+	if err := checkFormat(format); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	encoder := json.NewEncoder(bw)
+
+	for {
+
+		list, err := ListBindings(stores.BindingFilter{}, opts, store)
+		if err != nil {
+			return err
+		}
+
+		if format == FormatCSV {
+			if csvWriter == nil {
+				csvWriter = csv.NewWriter(bw)
+				csvWriter.Write(CSVColumns)
+			}
+			for _, binding := range list.Bindings {
+				csvWriter.Write(bindingToCSV(binding))
+			}
+			csvWriter.Flush()
+			err = csvWriter.Error()
+		} else {
+			for _, binding := range list.Bindings {
+				if err = encoder.Encode(binding); err != nil {
+					break
+				}
+			}
+		}
+
+		if err == nil {
+			err = bw.Flush()
+		}
+
+		if err != nil {
+			return utils.APIGenericInternalError(err.Error())
+		}
+
+		if list.NextPageToken == "" {
+			return nil
+		}
+
+		opts.PageToken = list.NextPageToken
+	}
+}
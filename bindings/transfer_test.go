@@ -0,0 +1,167 @@
+package bindings
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"github.com/stretchr/testify/suite"
+)
+
+type TransferTestSuite struct {
+	suite.Suite
+	mockstore *stores.Mockstore
+}
+
+func (suite *TransferTestSuite) SetupTest() {
+
+	suite.mockstore = &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	suite.mockstore.SetUp()
+}
+
+// importLines holds a new binding, an update of b1, an invalid row, a binding that conflicts with b2 and an unparsable row
+const importLines = `{"name": "b5", "service_uuid": "uuid1", "host": "host1", "auth_identifier": "test_dn_5", "unique_key": "unique_key_5", "auth_type": "x509"}
+{"name": "b1", "service_uuid": "uuid1", "host": "host1", "auth_identifier": "test_dn_1", "unique_key": "unique_key_updated", "auth_type": "x509"}
+
+{"name": "b6", "service_uuid": "uuid1", "host": "unknown", "auth_identifier": "test_dn_6", "unique_key": "unique_key_6", "auth_type": "x509"}
+{"name": "b7", "service_uuid": "uuid1", "host": "host1", "auth_identifier": "test_dn_2", "unique_key": "unique_key_7", "auth_type": "x509"}
+{"name": "b8",
+`
+
+func (suite *TransferTestSuite) TestImportUpsert() {
+
+	report, err := ImportBindings(strings.NewReader(importLines), FormatJSONLines, ImportUpsert, false, suite.mockstore)
+	b1, _ := FindBindingByUUIDAndName("b_uuid1", "", suite.mockstore)
+	_, errB5 := FindBindingByUUIDAndName("", "b5", suite.mockstore)
+	_, errB7 := FindBindingByUUIDAndName("", "b7", suite.mockstore)
+
+	suite.Nil(err)
+	suite.Equal(ImportUpsert, report.Mode)
+	suite.Equal(1, report.Created)
+	suite.Equal(1, report.Updated)
+	suite.Equal(0, report.Skipped)
+	suite.Equal(3, report.Failed)
+	suite.Equal(ImportRow{Row: 1, Name: "b5", Action: ImportActionCreate}, report.Rows[0])
+	suite.Equal(ImportRow{Row: 2, Name: "b1", Action: ImportActionUpdate}, report.Rows[1])
+	suite.Equal(ImportRow{Row: 3, Name: "b6", Action: ImportActionFail, Error: "Host was not found"}, report.Rows[2])
+	suite.Equal(ImportRow{Row: 4, Name: "b7", Action: ImportActionFail, Error: "binding object with auth_identifier: test_dn_2 already exists"}, report.Rows[3])
+	suite.Equal(ImportActionFail, report.Rows[4].Action)
+	suite.Equal("unique_key_updated", b1.UniqueKey)
+	suite.Equal(int64(1), b1.Revision)
+	suite.Nil(errB5)
+	suite.NotNil(errB7)
+}
+
+func (suite *TransferTestSuite) TestImportSkip() {
+
+	report, err := ImportBindings(strings.NewReader(importLines), FormatJSONLines, ImportSkip, false, suite.mockstore)
+	b1, _ := FindBindingByUUIDAndName("b_uuid1", "", suite.mockstore)
+
+	suite.Nil(err)
+	suite.Equal(1, report.Created)
+	suite.Equal(0, report.Updated)
+	suite.Equal(1, report.Skipped)
+	suite.Equal(ImportActionSkip, report.Rows[1].Action)
+	suite.Equal("unique_key_1", b1.UniqueKey)
+}
+
+func (suite *TransferTestSuite) TestImportFail() {
+
+	// the dry run reports the conflicts
+	report, err1 := ImportBindings(strings.NewReader(importLines), FormatJSONLines, ImportFail, true, suite.mockstore)
+
+	// the import stops on the first conflict without writing anything
+	_, err2 := ImportBindings(strings.NewReader(importLines), FormatJSONLines, ImportFail, false, suite.mockstore)
+	_, errB5 := FindBindingByUUIDAndName("", "b5", suite.mockstore)
+
+	suite.Nil(err1)
+	suite.True(report.DryRun)
+	suite.Equal(1, report.Created)
+	suite.Equal(4, report.Failed)
+	suite.Equal(ImportRow{Row: 2, Name: "b1", Action: ImportActionFail, Error: "binding object with name: b1 already exists"}, report.Rows[1])
+	suite.Equal(utils.APIErrConflict("binding", "name", "b1"), err2)
+	suite.Equal(utils.APIErrNotFound("Binding"), errB5)
+}
+
+func (suite *TransferTestSuite) TestImportDryRun() {
+
+	report, err := ImportBindings(strings.NewReader(importLines), FormatJSONLines, ImportUpsert, true, suite.mockstore)
+	b1, _ := FindBindingByUUIDAndName("b_uuid1", "", suite.mockstore)
+	_, errB5 := FindBindingByUUIDAndName("", "b5", suite.mockstore)
+
+	suite.Nil(err)
+	suite.Equal(1, report.Created)
+	suite.Equal(1, report.Updated)
+	suite.Equal("unique_key_1", b1.UniqueKey)
+	suite.Equal(utils.APIErrNotFound("Binding"), errB5)
+}
+
+func (suite *TransferTestSuite) TestImportCSV() {
+
+	// rows can't conflict with each other, the columns of the managed fields are ignored
+	rows := `name,service_uuid,host,auth_identifier,unique_key,auth_type,enabled,not_after,uuid
+b5,uuid1,host1,test_dn_5,unique_key_5,x509,false,2019-01-01T00:00:00Z,ignored
+b5,uuid1,host2,test_dn_6,unique_key_6,x509,,,
+b6,uuid1,host1,test_dn_5,unique_key_6,x509,,,
+b7,uuid1,host1,test_dn_7,unique_key_7,x509,maybe,,
+b8,uuid1
+`
+	report, err1 := ImportBindings(strings.NewReader(rows), FormatCSV, ImportUpsert, false, suite.mockstore)
+	b5, _ := FindBindingByUUIDAndName("", "b5", suite.mockstore)
+
+	_, err2 := ImportBindings(strings.NewReader("name,password\n"), FormatCSV, ImportUpsert, false, suite.mockstore)
+	_, err3 := ImportBindings(strings.NewReader(rows), "xml", ImportUpsert, false, suite.mockstore)
+	_, err4 := ImportBindings(strings.NewReader(rows), FormatCSV, "replace", false, suite.mockstore)
+
+	suite.Nil(err1)
+	suite.Equal(1, report.Created)
+	suite.Equal(4, report.Failed)
+	suite.Equal("binding object with name: b5 already exists", report.Rows[1].Error)
+	suite.Equal("binding object with auth_identifier: test_dn_5 already exists", report.Rows[2].Error)
+	suite.Equal("Field: enabled contains invalid data. It should be either true or false", report.Rows[3].Error)
+	suite.Equal("Parameter: csv contains invalid data. The row has 2 fields instead of 9", report.Rows[4].Error)
+	suite.False(b5.IsEnabled())
+	suite.Equal("2019-01-01T00:00:00Z", b5.NotAfter)
+	suite.NotEqual("ignored", b5.UUID)
+
+	suite.Equal(utils.APIErrUnsupportedContent("column", "password", fmt.Sprintf("Supported:%v", CSVColumns)), err2)
+	suite.Equal(utils.APIErrUnsupportedContent("format", "xml", "Supported:[jsonl csv]"), err3)
+	suite.Equal(utils.APIErrUnsupportedContent("mode", "replace", "Supported:[upsert skip fail]"), err4)
+}
+
+func (suite *TransferTestSuite) TestExport() {
+
+	disabled := false
+	suite.mockstore.Bindings[1].Enabled = &disabled
+
+	var jsonl bytes.Buffer
+	var csvOut bytes.Buffer
+
+	err1 := ExportBindings(&jsonl, FormatJSONLines, suite.mockstore)
+	err2 := ExportBindings(&csvOut, FormatCSV, suite.mockstore)
+
+	lines := strings.Split(strings.TrimSpace(jsonl.String()), "\n")
+	rows := strings.Split(strings.TrimSpace(csvOut.String()), "\n")
+
+	suite.Nil(err1)
+	suite.Equal(4, len(lines))
+	suite.Equal(`{"name":"b1","service_uuid":"uuid1","host":"host1","uuid":"b_uuid1","auth_identifier":"test_dn_1","unique_key":"unique_key_1","auth_type":"x509","created_on":"2018-05-05T15:04:05Z"}`, lines[0])
+
+	suite.Nil(err2)
+	suite.Equal(5, len(rows))
+	suite.Equal(strings.Join(CSVColumns, ","), rows[0])
+	suite.Equal("b2,uuid1,host1,b_uuid2,test_dn_2,unique_key_2,x509,,2018-05-05T15:04:05Z,,0,0,,false,,,", rows[2])
+
+	// an export can be imported back
+	report, err3 := ImportBindings(&csvOut, FormatCSV, ImportSkip, true, suite.mockstore)
+
+	suite.Nil(err3)
+	suite.Equal(4, report.Skipped)
+}
+
+func TestTransferTestSuite(t *testing.T) {
+	suite.Run(t, new(TransferTestSuite))
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/ARGOeu/argo-api-authn/utils"
 	LOGGER "github.com/sirupsen/logrus"
 	lSyslog "github.com/sirupsen/logrus/hooks/syslog"
@@ -13,23 +14,89 @@ import (
 )
 
 type Config struct {
-	ServicePort                 int               `json:"service_port" required:"true"`
-	MongoHost                   string            `json:"mongo_host" required:"true"`
-	MongoDB                     string            `json:"mongo_db" required:"true"`
-	CertificateAuthorities      string            `json:"certificate_authorities" required:"true"`
-	Certificate                 string            `json:"certificate" required:"true"`
-	CertificateKey              string            `json:"certificate_key" required:"true"`
-	ServiceToken                string            `json:"service_token" required:"true"`
-	SupportedAuthTypes          []string          `json:"supported_auth_types" required:"true"`
-	SupportedAuthMethods        []string          `json:"supported_auth_methods" required:"true"`
-	SupportedServiceTypes       []string          `json:"supported_service_types" required:"true"`
-	VerifySSL                   bool              `json:"verify_ssl"`
-	TrustUnknownCAs             bool              `json:"trust_unknown_cas"`
-	VerifyCertificate           bool              `json:"verify_certificate"`
-	ServiceTypesPaths           map[string]string `json:"service_types_paths" required:"true"`
-	ServiceTypesRetrievalFields map[string]string `json:"service_types_retrieval_fields" required:"true"`
-	SyslogEnabled               bool              `json:"syslog_enabled"`
-	ClientCertHostVerification  bool              `json:"client_cert_host_verification"`
+	ServicePort                 int                                 `json:"service_port" required:"true"`
+	StoreBackend                string                              `json:"store_backend"`
+	MongoHost                   string                              `json:"mongo_host"`
+	MongoDB                     string                              `json:"mongo_db"`
+	EmbeddedStorePath           string                              `json:"embedded_store_path"`
+	PostgresDSN                 string                              `json:"postgres_dsn"`
+	CertificateAuthorities      string                              `json:"certificate_authorities" required:"true"`
+	Certificate                 string                              `json:"certificate" required:"true"`
+	CertificateKey              string                              `json:"certificate_key" required:"true"`
+	ServiceToken                string                              `json:"service_token" required:"true"`
+	SupportedAuthTypes          []string                            `json:"supported_auth_types" required:"true"`
+	SupportedAuthMethods        []string                            `json:"supported_auth_methods" required:"true"`
+	SupportedServiceTypes       []string                            `json:"supported_service_types" required:"true"`
+	VerifySSL                   bool                                `json:"verify_ssl"`
+	TrustUnknownCAs             bool                                `json:"trust_unknown_cas"`
+	VerifyCertificate           bool                                `json:"verify_certificate"`
+	ServiceTypesPaths           map[string]string                   `json:"service_types_paths" required:"true"`
+	ServiceTypesRetrievalFields map[string]string                   `json:"service_types_retrieval_fields" required:"true"`
+	SyslogEnabled               bool                                `json:"syslog_enabled"`
+	ClientCertHostVerification  bool                                `json:"client_cert_host_verification"`
+	ServiceTypesUpstreamErrors  map[string]map[string]UpstreamError `json:"service_types_upstream_errors"`
+	UpstreamCircuitBreaker      CircuitBreaker                      `json:"upstream_circuit_breaker"`
+	ServiceTypesTokenCacheTTLs  map[string]int                      `json:"service_types_token_cache_ttls"`
+	SecretsKeyFile              string                              `json:"secrets_key_file"`
+	SecretsRevealTokens         map[string]string                   `json:"secrets_reveal_tokens"`
+	BindingUsage                BindingUsage                        `json:"binding_usage"`
+	BindingCleanup              BindingCleanup                      `json:"binding_cleanup"`
+}
+
+const (
+	// StoreBackendMongo keeps the data in MongoDB, it is the default store backend
+	StoreBackendMongo = "mongo"
+	// StoreBackendEmbedded keeps the data in a single local file
+	StoreBackendEmbedded = "embedded"
+	// StoreBackendPostgres keeps the data in PostgreSQL
+	StoreBackendPostgres = "postgres"
+)
+
+const (
+	// BindingCleanupDisable disables the stale bindings, so they can't be used to authenticate until they are re-enabled
+	BindingCleanupDisable = "disable"
+	// BindingCleanupDelete deletes the stale bindings
+	BindingCleanupDelete = "delete"
+)
+
+// UpstreamError describes the error that a failed request towards a service type should be translated to.
+// The keys it is registered under are upstream status codes(e.g. `404`), status classes(e.g. `4xx`), `timeout` or `default`
+type UpstreamError struct {
+	Code    int    `json:"code"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// CircuitBreaker configures when requests towards an upstream host:port should fail fast
+type CircuitBreaker struct {
+	// FailureThreshold is the amount of consecutive failures that opens the circuit
+	FailureThreshold int `json:"failure_threshold"`
+	// OpenTimeout is the amount of seconds that the circuit stays open before a trial request is allowed
+	OpenTimeout int `json:"open_timeout"`
+}
+
+// BindingUsage configures how the successful authentications through the bindings are recorded
+type BindingUsage struct {
+	// Disabled stops recording the last_auth, auth_count and last_client_ip of the bindings
+	Disabled bool `json:"disabled"`
+	// FlushInterval is the amount of seconds between the writes of the pending authentications
+	FlushInterval int `json:"flush_interval"`
+	// BatchSize is the amount of bindings with pending authentications that triggers a write before the interval ends
+	BatchSize int `json:"batch_size"`
+}
+
+// BindingCleanup configures the job that acts on the bindings that haven't been used for a long time
+type BindingCleanup struct {
+	// Action is what happens to the stale bindings, either disable or delete, the job doesn't run without one
+	Action string `json:"action"`
+	// StaleAfter is the amount of days without authentications after which a binding is reported as stale
+	StaleAfter int `json:"stale_after"`
+	// GracePeriod is the amount of days that a binding stays stale before the job acts on it
+	GracePeriod int `json:"grace_period"`
+	// Interval is the amount of hours between the runs of the job
+	Interval int `json:"interval"`
+	// DryRun only logs the bindings that the job would act on
+	DryRun bool `json:"dry_run"`
 }
 
 // ConfigSetUp unmarshals a json file specified by the input parameter into the config object
@@ -53,6 +120,18 @@ func (cfg *Config) ConfigSetUp(path string) error {
 		}
 	}
 
+	if err = cfg.validateStoreBackend(); err != nil {
+		return err
+	}
+
+	if err = cfg.validateBindingCleanup(); err != nil {
+		return err
+	}
+
+	if err = cfg.validateSecretsRevealTokens(); err != nil {
+		return err
+	}
+
 	if err = utils.ValidateRequired(*cfg); err != nil {
 		return utils.StructGenericEmptyRequiredField("config", err.Error())
 	}
@@ -68,6 +147,70 @@ func (cfg *Config) ConfigSetUp(path string) error {
 	return nil
 }
 
+// validateStoreBackend checks that the fields the chosen store backend needs have been declared
+func (cfg *Config) validateStoreBackend() error {
+
+	var missing string
+
+	switch cfg.StoreBackend {
+	case "", StoreBackendMongo:
+		if cfg.MongoHost == "" {
+			missing = "mongo_host"
+		} else if cfg.MongoDB == "" {
+			missing = "mongo_db"
+		}
+	case StoreBackendEmbedded:
+		if cfg.EmbeddedStorePath == "" {
+			missing = "embedded_store_path"
+		}
+	case StoreBackendPostgres:
+		if cfg.PostgresDSN == "" {
+			missing = "postgres_dsn"
+		}
+	default:
+		return fmt.Errorf("config object contains an unsupported store_backend: %v. Supported:%v", cfg.StoreBackend, []string{StoreBackendMongo, StoreBackendEmbedded, StoreBackendPostgres})
+	}
+
+	if missing != "" {
+		return utils.StructGenericEmptyRequiredField("config", utils.GenericEmptyRequiredField(missing).Error())
+	}
+
+	return nil
+}
+
+// validateBindingCleanup checks that the cleanup of the stale bindings uses a supported action
+func (cfg *Config) validateBindingCleanup() error {
+
+	switch cfg.BindingCleanup.Action {
+	case "", BindingCleanupDisable, BindingCleanupDelete:
+		return nil
+	}
+
+	return fmt.Errorf("config object contains an unsupported binding_cleanup action: %v. Supported:%v", cfg.BindingCleanup.Action, []string{BindingCleanupDisable, BindingCleanupDelete})
+}
+
+// validateSecretsRevealTokens checks that every caller that may reveal the secrets of the auth methods is named,
+// so that the reveals can be audited, and has its own token, one that differs from the service_token
+func (cfg *Config) validateSecretsRevealTokens() error {
+
+	for caller, token := range cfg.SecretsRevealTokens {
+
+		if caller == "" {
+			return errors.New("config object contains a secrets_reveal_tokens token without the name of its caller")
+		}
+
+		if token == "" {
+			return fmt.Errorf("config object contains an empty secrets_reveal_tokens token for: %v", caller)
+		}
+
+		if token == cfg.ServiceToken {
+			return fmt.Errorf("config object contains a secrets_reveal_tokens token for: %v that is the same as the service_token", caller)
+		}
+	}
+
+	return nil
+}
+
 // ClintAuthPolicy determines, based on the given configuration what client authentication policy should the server follow
 func (cfg *Config) ClientAuthPolicy() tls.ClientAuthType {
 
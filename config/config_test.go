@@ -44,6 +44,11 @@ func (suite *ConfigTestSuite) TestConfigSetUp() {
 		},
 		SyslogEnabled:              true,
 		ClientCertHostVerification: true,
+		ServiceTypesUpstreamErrors: map[string]map[string]UpstreamError{
+			"ams": {
+				"404": {Code: 404, Status: "NOT FOUND", Message: "User was not found on AMS"},
+			},
+		},
 	}
 
 	//tests the case of a malformed json
@@ -68,6 +73,60 @@ func (suite *ConfigTestSuite) TestConfigSetUp() {
 
 }
 
+func (suite *ConfigTestSuite) TestValidateStoreBackend() {
+
+	// mongo is the default store backend
+	cfg1 := &Config{MongoHost: "test_mongo_host", MongoDB: "test_mongo_db"}
+	cfg2 := &Config{StoreBackend: StoreBackendMongo, MongoHost: "test_mongo_host"}
+
+	// the embedded store backend only needs its file
+	cfg3 := &Config{StoreBackend: StoreBackendEmbedded, EmbeddedStorePath: "/var/lib/argo-api-authn/authn.db"}
+	cfg4 := &Config{StoreBackend: StoreBackendEmbedded, MongoHost: "test_mongo_host", MongoDB: "test_mongo_db"}
+
+	// unknown store backend
+	cfg5 := &Config{StoreBackend: "unknown"}
+
+	// the postgres store backend needs its connection string
+	cfg6 := &Config{StoreBackend: StoreBackendPostgres, PostgresDSN: "postgres://authn@localhost/authn?sslmode=disable"}
+	cfg7 := &Config{StoreBackend: StoreBackendPostgres, MongoHost: "test_mongo_host", MongoDB: "test_mongo_db"}
+
+	suite.Nil(cfg1.validateStoreBackend())
+	suite.Equal("config object contains empty fields. empty value for field: mongo_db", cfg2.validateStoreBackend().Error())
+	suite.Nil(cfg3.validateStoreBackend())
+	suite.Equal("config object contains empty fields. empty value for field: embedded_store_path", cfg4.validateStoreBackend().Error())
+	suite.Equal("config object contains an unsupported store_backend: unknown. Supported:[mongo embedded postgres]", cfg5.validateStoreBackend().Error())
+	suite.Nil(cfg6.validateStoreBackend())
+	suite.Equal("config object contains empty fields. empty value for field: postgres_dsn", cfg7.validateStoreBackend().Error())
+}
+
+func (suite *ConfigTestSuite) TestValidateBindingCleanup() {
+
+	cfg1 := &Config{}
+	cfg2 := &Config{BindingCleanup: BindingCleanup{Action: BindingCleanupDisable}}
+	cfg3 := &Config{BindingCleanup: BindingCleanup{Action: BindingCleanupDelete, DryRun: true}}
+	cfg4 := &Config{BindingCleanup: BindingCleanup{Action: "archive"}}
+
+	suite.Nil(cfg1.validateBindingCleanup())
+	suite.Nil(cfg2.validateBindingCleanup())
+	suite.Nil(cfg3.validateBindingCleanup())
+	suite.Equal("config object contains an unsupported binding_cleanup action: archive. Supported:[disable delete]", cfg4.validateBindingCleanup().Error())
+}
+
+func (suite *ConfigTestSuite) TestValidateSecretsRevealTokens() {
+
+	cfg1 := &Config{ServiceToken: "token"}
+	cfg2 := &Config{ServiceToken: "token", SecretsRevealTokens: map[string]string{"operator": "reveal-token"}}
+	cfg3 := &Config{ServiceToken: "token", SecretsRevealTokens: map[string]string{"operator": ""}}
+	cfg4 := &Config{ServiceToken: "token", SecretsRevealTokens: map[string]string{"operator": "token"}}
+	cfg5 := &Config{ServiceToken: "token", SecretsRevealTokens: map[string]string{"": "reveal-token"}}
+
+	suite.Nil(cfg1.validateSecretsRevealTokens())
+	suite.Nil(cfg2.validateSecretsRevealTokens())
+	suite.Equal("config object contains an empty secrets_reveal_tokens token for: operator", cfg3.validateSecretsRevealTokens().Error())
+	suite.Equal("config object contains a secrets_reveal_tokens token for: operator that is the same as the service_token", cfg4.validateSecretsRevealTokens().Error())
+	suite.Equal("config object contains a secrets_reveal_tokens token without the name of its caller", cfg5.validateSecretsRevealTokens().Error())
+}
+
 func (suite *ConfigTestSuite) TestClientAuthPolicy() {
 
 	// trust unknown cas
@@ -1,13 +1,20 @@
 package handlers
 
 import (
+	"bytes"
+	"crypto/subtle"
 	"encoding/json"
+	"fmt"
 	"github.com/ARGOeu/argo-api-authn/authmethods"
+	"github.com/ARGOeu/argo-api-authn/bindings"
+	"github.com/ARGOeu/argo-api-authn/config"
 	"github.com/ARGOeu/argo-api-authn/servicetypes"
 	"github.com/ARGOeu/argo-api-authn/stores"
 	"github.com/ARGOeu/argo-api-authn/utils"
 	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
+	LOGGER "github.com/sirupsen/logrus"
+	"io/ioutil"
 	"net/http"
 )
 
@@ -16,10 +23,14 @@ func AuthMethodCreate(w http.ResponseWriter, r *http.Request) {
 	var err error
 	var authM authmethods.AuthMethod
 	var serviceType servicetypes.ServiceType
+	var reqBody []byte
+	var declared struct {
+		Type string `json:"type"`
+	}
 
 	//context references
 	store := context.Get(r, "stores").(stores.Store)
-	//cfg := context.Get(r, "config").(config.Config)
+	cfg := context.Get(r, "config").(config.Config)
 
 	// url vars
 	vars := mux.Vars(r)
@@ -30,39 +41,59 @@ func AuthMethodCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// use the auth method factory to create an auth method based on the declared field of the service type
-	if authM, err = authmethods.NewAuthMethodFactory().Create(serviceType.AuthMethod); err != nil {
+	if reqBody, err = ioutil.ReadAll(r.Body); err != nil {
+		err = utils.APIGenericInternalError(err.Error())
 		utils.RespondError(w, err)
 		return
 	}
 
-	// check the validity of the JSON and fill the auth method object
-	if err = json.NewDecoder(r.Body).Decode(&authM); err != nil {
+	// check the validity of the JSON and find out the declared type of the auth method
+	if err = json.NewDecoder(bytes.NewReader(reqBody)).Decode(&declared); err != nil {
 		err := utils.APIErrBadRequest(err.Error())
 		utils.RespondError(w, err)
 		return
 	}
 
-	// assign service uuid and auth method type after decoding the request so it cannot be overwritten
-	if err = utils.SetFieldValueByName(authM, "ServiceUUID", serviceType.UUID); err != nil {
-		err = utils.APIGenericInternalError(err.Error())
+	// auth methods are of the service type's auth method type, unless another supported type has been declared
+	amType := serviceType.AuthMethod
+	if declared.Type != "" {
+		if !supportsAuthMethod(cfg, declared.Type) {
+			err = utils.APIErrUnsupportedContent("type", declared.Type, fmt.Sprintf("Supported:%v", cfg.SupportedAuthMethods))
+			utils.RespondError(w, err)
+			return
+		}
+		amType = declared.Type
+	}
+
+	// use the auth method factory to create an auth method of the chosen type
+	if authM, err = authmethods.NewAuthMethodFactory().Create(amType); err != nil {
 		utils.RespondError(w, err)
 		return
 	}
 
-	if err = utils.SetFieldValueByName(authM, "Type", serviceType.AuthMethod); err != nil {
-		err = utils.APIGenericInternalError(err.Error())
+	// fill the auth method object
+	if err = json.NewDecoder(bytes.NewReader(reqBody)).Decode(&authM); err != nil {
+		err := utils.APIErrBadRequest(err.Error())
 		utils.RespondError(w, err)
 		return
 	}
 
+	// assign service uuid and auth method type after decoding the request so it cannot be overwritten
+	authM.Basic().ServiceUUID = serviceType.UUID
+	authM.Basic().Type = amType
+
 	// create it
-	if err = authmethods.AuthMethodCreate(authM, store, serviceType.AuthMethod); err != nil {
+	if err = authmethods.AuthMethodCreate(authM, store, amType, cfg); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// if everything went ok, return the newly created auth method with its secrets masked
+	if authM, err = authmethods.MaskSecrets(authM); err != nil {
 		utils.RespondError(w, err)
 		return
 	}
 
-	// if everything went ok, return the newly created auth method
 	utils.RespondOk(w, 201, authM)
 }
 
@@ -70,6 +101,8 @@ func AuthMethodListOne(w http.ResponseWriter, r *http.Request) {
 
 	var err error
 	var ok bool
+	var host string
+	var caller string
 	var serviceType servicetypes.ServiceType
 	var authm authmethods.AuthMethod
 
@@ -86,18 +119,43 @@ func AuthMethodListOne(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// check if the host is associated with the service type
-	if ok = serviceType.HasHost(vars["host"]); !ok {
+	if host, ok = serviceType.CanonicalHost(vars["host"]); !ok {
 		err = utils.APIErrNotFound("Host")
 		utils.RespondError(w, err)
 		return
 	}
 
-	if authm, err = authmethods.AuthMethodFinder(serviceType.UUID, vars["host"], serviceType.AuthMethod, store); err != nil {
+	if authm, err = authmethods.FindHostAuthMethod(serviceType.UUID, host, r.URL.Query().Get("name"), store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// only the callers that hold a reveal token may ask for the secrets in clear text
+	if caller, err = revealSecrets(r); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// the masked and the revealed auth method are tagged differently
+	tag := etag(authm.Basic().Revision)
+	if caller != "" {
+		tag = revealedETag(authm.Basic().Revision)
+	}
+
+	if notModified(w, r, tag) {
+		return
+	}
+
+	// secrets are masked, unless they have been explicitly requested
+	if caller != "" {
+		auditSecretsReveal(r, caller, []authmethods.AuthMethod{authm})
+	} else if authm, err = authmethods.MaskSecrets(authm); err != nil {
 		utils.RespondError(w, err)
 		return
 	}
 
 	// if everything went ok return the auth method
+	setETag(w, tag)
 	utils.RespondOk(w, 200, authm)
 
 }
@@ -105,12 +163,40 @@ func AuthMethodListOne(w http.ResponseWriter, r *http.Request) {
 func AuthMethodListAll(w http.ResponseWriter, r *http.Request) {
 
 	var err error
+	var caller string
+	var opts stores.ListOptions
 	var amList authmethods.AuthMethodsList
 
 	//context references
 	store := context.Get(r, "stores").(stores.Store)
 
-	if amList, err = authmethods.AuthMethodFindAll(store); err != nil {
+	filter := stores.AuthMethodFilter{Type: r.URL.Query().Get("type")}
+
+	if filter.ServiceUUID, filter.Host, err = serviceTypeParam(r, store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	if opts, err = listOptions(r); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// only the callers that hold a reveal token may ask for the secrets in clear text
+	if caller, err = revealSecrets(r); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	if amList, err = authmethods.AuthMethodList(filter, opts, store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// secrets are masked, unless they have been explicitly requested
+	if caller != "" {
+		auditSecretsReveal(r, caller, amList.AuthMethods)
+	} else if amList, err = authmethods.MaskSecretsList(amList); err != nil {
 		utils.RespondError(w, err)
 		return
 	}
@@ -125,6 +211,7 @@ func AuthMethodDeleteOne(w http.ResponseWriter, r *http.Request) {
 	var err error
 	var serviceType servicetypes.ServiceType
 	var ok bool
+	var host string
 	var authm authmethods.AuthMethod
 
 	//context references
@@ -140,14 +227,20 @@ func AuthMethodDeleteOne(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// check if the host is associated with the service type
-	if ok = serviceType.HasHost(vars["host"]); !ok {
+	if host, ok = serviceType.CanonicalHost(vars["host"]); !ok {
 		err = utils.APIErrNotFound("Host")
 		utils.RespondError(w, err)
 		return
 	}
 
 	// check if the auth method exists
-	if authm, err = authmethods.AuthMethodFinder(serviceType.UUID, vars["host"], serviceType.AuthMethod, store); err != nil {
+	if authm, err = authmethods.FindHostAuthMethod(serviceType.UUID, host, r.URL.Query().Get("name"), store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// the auth method might have been modified since the client retrieved it
+	if err = checkIfMatch(r, "Auth method", authm.Basic().Revision); err != nil {
 		utils.RespondError(w, err)
 		return
 	}
@@ -166,10 +259,12 @@ func AuthMethodUpdateOne(w http.ResponseWriter, r *http.Request) {
 	var err error
 	var serviceType servicetypes.ServiceType
 	var ok bool
+	var host string
 	var authm authmethods.AuthMethod
 
 	//context references
 	store := context.Get(r, "stores").(stores.Store)
+	cfg := context.Get(r, "config").(config.Config)
 
 	// url vars
 	vars := mux.Vars(r)
@@ -181,23 +276,263 @@ func AuthMethodUpdateOne(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// check if the host is associated with the service type
-	if ok = serviceType.HasHost(vars["host"]); !ok {
+	if host, ok = serviceType.CanonicalHost(vars["host"]); !ok {
 		err = utils.APIErrNotFound("Host")
 		utils.RespondError(w, err)
 		return
 	}
 
 	// check if the auth method exists
-	if authm, err = authmethods.AuthMethodFinder(serviceType.UUID, vars["host"], serviceType.AuthMethod, store); err != nil {
+	if authm, err = authmethods.FindHostAuthMethod(serviceType.UUID, host, r.URL.Query().Get("name"), store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// the auth method might have been modified since the client retrieved it
+	if err = checkIfMatch(r, "Auth method", authm.Basic().Revision); err != nil {
 		utils.RespondError(w, err)
 		return
 	}
 
-	if authm, err = authmethods.AuthMethodUpdate(authm, r.Body, store); err != nil {
+	if authm, err = authmethods.AuthMethodUpdate(authm, r.Body, store, cfg); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// secrets are masked, they can only be revealed through an audited listing
+	if authm, err = authmethods.MaskSecrets(authm); err != nil {
 		utils.RespondError(w, err)
 		return
 	}
 
 	// if everything went ok
+	setETag(w, etag(authm.Basic().Revision))
 	utils.RespondOk(w, 200, authm)
 }
+
+func AuthMethodStageSecret(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+	var serviceType servicetypes.ServiceType
+	var ok bool
+	var host string
+	var authm authmethods.AuthMethod
+	var status authmethods.SecretStatus
+
+	//context references
+	store := context.Get(r, "stores").(stores.Store)
+
+	// url vars
+	vars := mux.Vars(r)
+
+	// check if the service type exists
+	if serviceType, err = servicetypes.FindServiceTypeByName(vars["service-type"], store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// check if the host is associated with the service type
+	if host, ok = serviceType.CanonicalHost(vars["host"]); !ok {
+		err = utils.APIErrNotFound("Host")
+		utils.RespondError(w, err)
+		return
+	}
+
+	// check if the auth method exists
+	if authm, err = authmethods.FindHostAuthMethod(serviceType.UUID, host, r.URL.Query().Get("name"), store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// the auth method might have been modified since the client retrieved it
+	if err = checkIfMatch(r, "Auth method", authm.Basic().Revision); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	if authm, err = authmethods.AuthMethodStageSecret(authm, r.Body, store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	if status, err = authmethods.AuthMethodSecretStatus(authm); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// if everything went ok, return the status of the auth method's secrets
+	utils.RespondOk(w, 200, status)
+}
+
+func AuthMethodSecretStatus(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+	var serviceType servicetypes.ServiceType
+	var ok bool
+	var host string
+	var authm authmethods.AuthMethod
+	var status authmethods.SecretStatus
+
+	//context references
+	store := context.Get(r, "stores").(stores.Store)
+
+	// url vars
+	vars := mux.Vars(r)
+
+	// check if the service type exists
+	if serviceType, err = servicetypes.FindServiceTypeByName(vars["service-type"], store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// check if the host is associated with the service type
+	if host, ok = serviceType.CanonicalHost(vars["host"]); !ok {
+		err = utils.APIErrNotFound("Host")
+		utils.RespondError(w, err)
+		return
+	}
+
+	// check if the auth method exists
+	if authm, err = authmethods.FindHostAuthMethod(serviceType.UUID, host, r.URL.Query().Get("name"), store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	if status, err = authmethods.AuthMethodSecretStatus(authm); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// if everything went ok, return the status of the auth method's secrets
+	utils.RespondOk(w, 200, status)
+}
+
+// authMethodTestRequest identifies the binding that an auth method is tested with,
+// either by the name of an existing binding or by a raw unique key
+type authMethodTestRequest struct {
+	Binding   string `json:"binding"`
+	UniqueKey string `json:"unique_key"`
+}
+
+func AuthMethodTestOne(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+	var serviceType servicetypes.ServiceType
+	var ok bool
+	var host string
+	var authm authmethods.AuthMethod
+	var binding bindings.Binding
+	var testReq authMethodTestRequest
+	var result authmethods.AuthMethodTestResult
+
+	//context references
+	store := context.Get(r, "stores").(stores.Store)
+	cfg := context.Get(r, "config").(config.Config)
+
+	// url vars
+	vars := mux.Vars(r)
+
+	// check if the service type exists
+	if serviceType, err = servicetypes.FindServiceTypeByName(vars["service-type"], store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// check if the host is associated with the service type
+	if host, ok = serviceType.CanonicalHost(vars["host"]); !ok {
+		err = utils.APIErrNotFound("Host")
+		utils.RespondError(w, err)
+		return
+	}
+
+	// check if the auth method exists
+	if authm, err = authmethods.FindHostAuthMethod(serviceType.UUID, host, r.URL.Query().Get("name"), store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// check the validity of the JSON
+	if err = json.NewDecoder(r.Body).Decode(&testReq); err != nil {
+		err := utils.APIErrBadRequest(err.Error())
+		utils.RespondError(w, err)
+		return
+	}
+
+	switch {
+	case testReq.Binding != "":
+		if binding, err = bindings.FindBindingByUUIDAndName("", testReq.Binding, store); err != nil {
+			utils.RespondError(w, err)
+			return
+		}
+
+		// the binding has to belong to the tested host
+		if binding.ServiceUUID != serviceType.UUID || binding.Host != host {
+			err = utils.APIErrNotFound("Binding")
+			utils.RespondError(w, err)
+			return
+		}
+	case testReq.UniqueKey != "":
+		binding = bindings.Binding{ServiceUUID: serviceType.UUID, Host: host, UniqueKey: testReq.UniqueKey}
+	default:
+		err = utils.APIErrEmptyRequiredField("test request", utils.GenericEmptyRequiredField("binding or unique_key").Error())
+		utils.RespondError(w, err)
+		return
+	}
+
+	if result, err = authmethods.AuthMethodTest(authm, binding, serviceType, &cfg); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// if everything went ok, return the outcome of the dry run
+	utils.RespondOk(w, 200, result)
+}
+
+// supportsAuthMethod checks whether or not the given auth method type is supported by the service
+func supportsAuthMethod(cfg config.Config, amType string) bool {
+
+	for _, am := range cfg.SupportedAuthMethods {
+		if am == amType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// revealTokenHeader carries the token of a caller that may reveal the secrets of the auth methods.
+// It is sent as a header rather than a query parameter, since the access log records the request uri
+const revealTokenHeader = "x-reveal-token"
+
+// revealSecrets checks whether or not the request asks for the secrets of the auth methods in clear text,
+// in which case it returns the name of the caller that the reveal token of the request has been issued to
+func revealSecrets(r *http.Request) (string, error) {
+
+	if r.URL.Query().Get("reveal") != "true" {
+		return "", nil
+	}
+
+	cfg := context.Get(r, "config").(config.Config)
+
+	if token := r.Header.Get(revealTokenHeader); token != "" {
+		for caller, revealToken := range cfg.SecretsRevealTokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(revealToken)) == 1 {
+				return caller, nil
+			}
+		}
+	}
+
+	return "", utils.APIErrForbidden("Revealing the secrets of the auth methods requires a valid reveal token")
+}
+
+// auditSecretsReveal keeps a record of the auth methods whose secrets have been revealed and of the caller they were revealed to
+func auditSecretsReveal(r *http.Request, caller string, ams []authmethods.AuthMethod) {
+
+	var uuids []string
+
+	for _, am := range ams {
+		uuids = append(uuids, am.Basic().UUID)
+	}
+
+	LOGGER.Warnf("AUDIT\tSecrets of auth methods: %v were revealed to: %v(%v), request: %v %v", uuids, caller, r.RemoteAddr, r.Method, r.URL.Path)
+}
@@ -48,10 +48,10 @@ func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodCreate() {
 
 	// unmarshal the response
 	json.Unmarshal([]byte(w.Body.String()), expAm)
-	suite.Equal("uuid1", expAm.ServiceUUID)
-	suite.Equal("host2", expAm.Host)
+	suite.Equal("uuid1", expAm.ServiceUUID())
+	suite.Equal("host2", expAm.Host())
 	suite.Equal(9000, expAm.Port)
-	suite.Equal("api-key", expAm.Type)
+	suite.Equal("api-key", expAm.Type())
 	suite.NotEqual("", expAm.UUID)
 	suite.NotEqual("", expAm.CreatedOn)
 }
@@ -88,11 +88,12 @@ func (suite *AuthMethodsHandlersTestSuite) TestHeadersAuthMethodCreate() {
 
 	// unmarshal the response
 	json.Unmarshal([]byte(w.Body.String()), expAm)
-	suite.Equal("uuid2", expAm.ServiceUUID)
-	suite.Equal("host3", expAm.Host)
+	suite.Equal("uuid2", expAm.ServiceUUID())
+	suite.Equal("host3", expAm.Host())
 	suite.Equal(9000, expAm.Port)
-	suite.Equal("headers", expAm.Type)
-	suite.Equal(map[string]string{"x-api-token": "token-1"}, expAm.Headers)
+	suite.Equal("headers", expAm.Type())
+	// the secrets of the created auth method are masked
+	suite.Equal(map[string]string{"x-api-token": "****"}, expAm.Headers)
 	suite.NotEqual("", expAm.UUID)
 	suite.NotEqual("", expAm.CreatedOn)
 
@@ -130,8 +131,8 @@ func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodCreateOverrideDefaults(
 
 	// unmarshal the response
 	json.Unmarshal([]byte(w.Body.String()), expAm)
-	suite.Equal("uuid1", expAm.ServiceUUID)
-	suite.Equal("host2", expAm.Host)
+	suite.Equal("uuid1", expAm.ServiceUUID())
+	suite.Equal("host2", expAm.Host())
 	suite.Equal(9000, expAm.Port)
 	suite.NotEqual("", expAm.UUID)
 	suite.NotEqual("", expAm.CreatedOn)
@@ -169,14 +170,91 @@ func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodCreateOverrideDefaultsS
 
 	// unmarshal the response
 	json.Unmarshal([]byte(w.Body.String()), expAm)
-	suite.Equal("uuid1", expAm.ServiceUUID) //uuid2 is being ignored
-	suite.Equal("host3", expAm.Host)
+	suite.Equal("uuid1", expAm.ServiceUUID()) //uuid2 is being ignored
+	suite.Equal("host3", expAm.Host())
 	suite.Equal(9000, expAm.Port)
-	suite.Equal("api-key", expAm.Type)
+	suite.Equal("api-key", expAm.Type())
 	suite.NotEqual("", expAm.UUID)
 	suite.NotEqual("", expAm.CreatedOn)
 }
 
+// TestAuthMethodCreateNamedOfOtherType tests the case of creating a named auth method of another supported type next to the host's existing auth method
+func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodCreateNamedOfOtherType() {
+
+	var expAm = &authmethods.HeadersAuthMethod{}
+
+	reqBody := `{
+ "type": "headers",
+ "name": "robots",
+ "priority": 1,
+ "headers": {"x-api-key": "robots-key"},
+ "host": "host1",
+ "port": 9000
+}`
+
+	req, err := http.NewRequest("POST", "http://localhost:8080/service-types/s1/authm", bytes.NewBuffer([]byte(reqBody)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types/{service-type}/authm", WrapConfig(AuthMethodCreate, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(201, w.Code)
+
+	// unmarshal the response
+	json.Unmarshal([]byte(w.Body.String()), expAm)
+	suite.Equal("uuid1", expAm.ServiceUUID())
+	suite.Equal("host1", expAm.Host())
+	suite.Equal("headers", expAm.Type())
+	suite.Equal("robots", expAm.Name)
+	suite.Equal(1, expAm.Priority)
+}
+
+// TestAuthMethodCreateUnsupportedType tests the case of creating an auth method of an unsupported type
+func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodCreateUnsupportedType() {
+
+	reqBody := `{
+ "type": "jwt",
+ "name": "robots",
+ "host": "host1",
+ "port": 9000
+}`
+
+	expRespJSON := `{
+ "error": {
+  "message": "type: jwt is not yet supported.Supported:[api-key headers]",
+  "code": 422,
+  "status": "UNPROCESSABLE ENTITY"
+ }
+}`
+
+	req, err := http.NewRequest("POST", "http://localhost:8080/service-types/s1/authm", bytes.NewBuffer([]byte(reqBody)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types/{service-type}/authm", WrapConfig(AuthMethodCreate, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(422, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
 // TestAuthMethodCreateAlreadyExists tests the case where there is an already existing auth method for the given service type and host
 func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodCreateAlreadyExists() {
 
@@ -356,6 +434,44 @@ func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodCreateEmptyAccessKey()
 	suite.Equal(expRespJSON, w.Body.String())
 }
 
+// TestAuthMethodCreateClientOptionsWithoutVerifySSL tests the case where a server name is provided while verify_ssl is disabled
+func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodCreateClientOptionsWithoutVerifySSL() {
+
+	reqBody := `{
+ "access_key": "key1",
+ "host": "host2",
+ "port": 9000,
+ "client_options": {"server_name": "host2.example.com"}
+}`
+
+	expRespJSON := `{
+ "error": {
+  "message": "Field: client_options.server_name contains invalid data. It can't be used while verify_ssl is disabled",
+  "code": 422,
+  "status": "UNPROCESSABLE ENTITY"
+ }
+}`
+
+	req, err := http.NewRequest("POST", "http://localhost:8080/service-types/s1/authm", bytes.NewBuffer([]byte(reqBody)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+	cfg.VerifySSL = false
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types/{service-type}/authm", WrapConfig(AuthMethodCreate, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(422, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
 // TestAuthMethodCreateEmptyHost tests the case where the request body contains an empty data for field host
 func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodCreateEmptyHost() {
 
@@ -436,7 +552,7 @@ func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodListOne() {
  "type": "api-key",
  "uuid": "am_uuid_1",
  "created_on": "",
- "access_key": "access_key"
+ "access_key": "****_key"
 }`
 
 	req, err := http.NewRequest("GET", "http://localhost:8080/service-types/s1/hosts/host1/authm", nil)
@@ -458,6 +574,117 @@ func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodListOne() {
 	suite.Equal(expRespJSON, w.Body.String())
 }
 
+// TestAuthMethodListOneNotModified tests the case of a conditional request for an auth method that the client already has
+func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodListOneNotModified() {
+
+	req, err := http.NewRequest("GET", "http://localhost:8080/service-types/s1/hosts/host1/authm", nil)
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+	req.Header.Set("If-None-Match", `"2"`)
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+	mockstore.AuthMethods[0].Basic().Revision = 2
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types/{service-type}/hosts/{host}/authm", WrapConfig(AuthMethodListOne, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(304, w.Code)
+	suite.Equal(`"2"`, w.Header().Get("ETag"))
+	suite.Equal("", w.Body.String())
+}
+
+// TestAuthMethodListOneReveal tests the case where the secrets of the auth method are requested in clear text
+func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodListOneReveal() {
+
+	expRespJSON := `{
+ "service_uuid": "uuid1",
+ "port": 9000,
+ "host": "host1",
+ "type": "api-key",
+ "uuid": "am_uuid_1",
+ "created_on": "",
+ "access_key": "access_key"
+}`
+
+	req, err := http.NewRequest("GET", "http://localhost:8080/service-types/s1/hosts/host1/authm?reveal=true", nil)
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+	req.Header.Set("x-reveal-token", "reveal-token")
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+	cfg.SecretsRevealTokens = map[string]string{"operator": "reveal-token"}
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types/{service-type}/hosts/{host}/authm", WrapConfig(AuthMethodListOne, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(200, w.Code)
+	suite.Equal(`"0-revealed"`, w.Header().Get("ETag"))
+	suite.Equal(expRespJSON, w.Body.String())
+
+	// the masked auth method that the client already has is not the revealed one
+	req.Header.Set("If-None-Match", `"0"`)
+	w2 := httptest.NewRecorder()
+	router.ServeHTTP(w2, req)
+	suite.Equal(200, w2.Code)
+	suite.Equal(expRespJSON, w2.Body.String())
+
+	req.Header.Set("If-None-Match", `"0-revealed"`)
+	w3 := httptest.NewRecorder()
+	router.ServeHTTP(w3, req)
+	suite.Equal(304, w3.Code)
+	suite.Equal("", w3.Body.String())
+}
+
+// TestAuthMethodListOneRevealForbidden tests the case where the secrets of the auth method are requested without a valid reveal token
+func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodListOneRevealForbidden() {
+
+	expRespJSON := `{
+ "error": {
+  "message": "Revealing the secrets of the auth methods requires a valid reveal token",
+  "code": 403,
+  "status": "FORBIDDEN"
+ }
+}`
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+	cfg.SecretsRevealTokens = map[string]string{"operator": "reveal-token"}
+
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/service-types/{service-type}/hosts/{host}/authm", WrapConfig(AuthMethodListOne, mockstore, cfg))
+
+	// no reveal token
+	req1, _ := http.NewRequest("GET", "http://localhost:8080/service-types/s1/hosts/host1/authm?reveal=true", nil)
+	w1 := httptest.NewRecorder()
+	router.ServeHTTP(w1, req1)
+
+	// the service token doesn't allow reveals
+	req2, _ := http.NewRequest("GET", "http://localhost:8080/service-types/s1/hosts/host1/authm?reveal=true", nil)
+	req2.Header.Set("x-reveal-token", cfg.ServiceToken)
+	w2 := httptest.NewRecorder()
+	router.ServeHTTP(w2, req2)
+
+	suite.Equal(403, w1.Code)
+	suite.Equal(expRespJSON, w1.Body.String())
+	suite.Equal(403, w2.Code)
+	suite.Equal(expRespJSON, w2.Body.String())
+}
+
 // TestAuthMethodListOneUnknownServiceType tests the case where the provided service type is unknown
 func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodListOneUnknownServiceType() {
 
@@ -560,7 +787,7 @@ func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodListAll() {
    "type": "api-key",
    "uuid": "am_uuid_1",
    "created_on": "",
-   "access_key": "access_key"
+   "access_key": "****_key"
   },
   {
    "service_uuid": "uuid2",
@@ -570,11 +797,12 @@ func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodListAll() {
    "uuid": "am_uuid_2",
    "created_on": "",
    "headers": {
-    "Accept": "application/json",
-    "x-api-key": "key-1"
+    "Accept": "****json",
+    "x-api-key": "****"
    }
   }
- ]
+ ],
+ "totalSize": 2
 }`
 	req, err := http.NewRequest("GET", "http://localhost:8080/authm", nil)
 	if err != nil {
@@ -595,11 +823,111 @@ func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodListAll() {
 	suite.Equal(expRespJSON, w.Body.String())
 }
 
+// TestAuthMethodListAllFiltered tests the case where the auth methods are filtered by their service type and host
+func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodListAllFiltered() {
+
+	expRespJSON := `{
+ "auth_methods": [
+  {
+   "service_uuid": "uuid2",
+   "port": 9000,
+   "host": "host3",
+   "type": "headers",
+   "uuid": "am_uuid_2",
+   "created_on": "",
+   "headers": {
+    "Accept": "****json",
+    "x-api-key": "****"
+   }
+  }
+ ],
+ "totalSize": 1
+}`
+	req, err := http.NewRequest("GET", "http://localhost:8080/authm?service_type=s2&host=host3", nil)
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/authm", WrapConfig(AuthMethodListAll, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(200, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
+// TestAuthMethodListAllUnknownHost tests the case where the auth methods are filtered by a host that the service type doesn't have
+func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodListAllUnknownHost() {
+
+	expRespJSON := `{
+ "error": {
+  "message": "Host was not found",
+  "code": 404,
+  "status": "NOT FOUND"
+ }
+}`
+	req, err := http.NewRequest("GET", "http://localhost:8080/authm?service_type=s1&host=host4", nil)
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/authm", WrapConfig(AuthMethodListAll, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(404, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
+// TestAuthMethodListAllRevealForbidden tests the case where the secrets of the auth methods are requested with a wrong reveal token
+func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodListAllRevealForbidden() {
+
+	expRespJSON := `{
+ "error": {
+  "message": "Revealing the secrets of the auth methods requires a valid reveal token",
+  "code": 403,
+  "status": "FORBIDDEN"
+ }
+}`
+	req, err := http.NewRequest("GET", "http://localhost:8080/authm?reveal=true", nil)
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+	req.Header.Set("x-reveal-token", "wrong-token")
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+	cfg.SecretsRevealTokens = map[string]string{"operator": "reveal-token"}
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/authm", WrapConfig(AuthMethodListAll, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(403, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
 // TestAuthMethodListAllEmptyList tests the normal case where there are no auth methods in the service yet
 func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodListAllEmptyList() {
 
 	expRespJSON := `{
- "auth_methods": []
+ "auth_methods": [],
+ "totalSize": 0
 }`
 	req, err := http.NewRequest("GET", "http://localhost:8080/authm", nil)
 	if err != nil {
@@ -751,7 +1079,9 @@ func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodUpdateOne() {
  "type": "api-key",
  "uuid": "am_uuid_1",
  "created_on": "",
- "access_key": "key1"
+ "retrieval_field": "some_token",
+ "revision": 1,
+ "access_key": "****"
 }`
 
 	req, err := http.NewRequest("POST", "http://localhost:8080/service-types/s1/hosts/host1/authm", bytes.NewBuffer([]byte(reqBody)))
@@ -773,13 +1103,91 @@ func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodUpdateOne() {
 	suite.Equal(expRespJSON, w.Body.String())
 }
 
+// TestAuthMethodUpdateOneMaskedSecret tests the case of sending back the masked secret, which keeps the stored secret and is masked in the response
+func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodUpdateOneMaskedSecret() {
+
+	reqBody := `{
+ "access_key": "****_key",
+ "port": 9001
+}`
+
+	expRespJSON := `{
+ "service_uuid": "uuid1",
+ "port": 9001,
+ "host": "host1",
+ "type": "api-key",
+ "uuid": "am_uuid_1",
+ "created_on": "",
+ "revision": 1,
+ "access_key": "****_key"
+}`
+
+	req, err := http.NewRequest("PUT", "http://localhost:8080/service-types/s1/hosts/host1/authm", bytes.NewBuffer([]byte(reqBody)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types/{service-type}/hosts/{host}/authm", WrapConfig(AuthMethodUpdateOne, mockstore, cfg))
+	router.ServeHTTP(w, req)
+
+	suite.Equal(200, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+	suite.Equal("access_key", mockstore.AuthMethods[0].(*stores.QApiKeyAuthMethod).AccessKey)
+}
+
+// TestAuthMethodUpdateOnePreconditionFailed tests the case of updating an auth method that has been modified since the client retrieved it
+func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodUpdateOnePreconditionFailed() {
+
+	reqBody := `{
+ "port": 9090
+}`
+
+	expRespJSON := `{
+ "error": {
+  "message": "Auth method has been modified since it was retrieved",
+  "code": 412,
+  "status": "PRECONDITION FAILED"
+ }
+}`
+
+	req, err := http.NewRequest("PUT", "http://localhost:8080/service-types/s1/hosts/host1/authm", bytes.NewBuffer([]byte(reqBody)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+	req.Header.Set("If-Match", `"0"`)
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+	mockstore.AuthMethods[0].Basic().Revision = 1
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types/{service-type}/hosts/{host}/authm", WrapConfig(AuthMethodUpdateOne, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(412, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+	suite.Equal(9000, mockstore.AuthMethods[0].Basic().Port)
+}
+
 // TestAuthMethodUpdateOneIllegalFields tests the default case of updating an auth method of type api-key and service type of ams with values to fields that aren't supposed to change
 func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodUpdateOneIllegalFields() {
 
 	reqBody := `{
  "created_on": "some_time",
  "uuid": "some_uuid",
- "type": "some_type"
+ "type": "some_type",
+ "revision": 7
 }`
 
 	expRespJSON := `{
@@ -789,7 +1197,8 @@ func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodUpdateOneIllegalFields(
  "type": "api-key",
  "uuid": "am_uuid_1",
  "created_on": "",
- "access_key": "access_key"
+ "revision": 1,
+ "access_key": "****_key"
 }`
 
 	req, err := http.NewRequest("POST", "http://localhost:8080/service-types/s1/hosts/host1/authm", bytes.NewBuffer([]byte(reqBody)))
@@ -1023,6 +1432,41 @@ func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodUpdateOneEmptyAccessKey
 	suite.Equal(expRespJSON, w.Body.String())
 }
 
+// TestAuthMethodUpdateOneClientOptionsWithoutVerifySSL tests the case of updating an auth method with a ca bundle while verify_ssl is disabled
+func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodUpdateOneClientOptionsWithoutVerifySSL() {
+
+	reqBody := `{
+"client_options": {"ca_bundle": "bundle"}
+}`
+
+	expRespJSON := `{
+ "error": {
+  "message": "Field: client_options.ca_bundle contains invalid data. It can't be used while verify_ssl is disabled",
+  "code": 422,
+  "status": "UNPROCESSABLE ENTITY"
+ }
+}`
+
+	req, err := http.NewRequest("POST", "http://localhost:8080/service-types/s1/hosts/host1/authm", bytes.NewBuffer([]byte(reqBody)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+	cfg.VerifySSL = false
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types/{service-type}/hosts/{host}/authm", WrapConfig(AuthMethodUpdateOne, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(422, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
 // TestAuthMethodUpdateOneInvalidFieldType tests the default case of updating an auth method of type api-key and service type of ams while providing a wrong value for field regarding its type
 func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodUpdateOneInvalidFieldType() {
 
@@ -1147,6 +1591,196 @@ func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodUpdateOneNotFound() {
 	suite.Equal(expRespJSON, w.Body.String())
 }
 
+// TestAuthMethodStageSecret tests the normal case of staging the next access key of an auth method
+func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodStageSecret() {
+
+	reqBody := `{"access_key": "next_access_key"}`
+
+	req, err := http.NewRequest("POST", "http://localhost:8080/service-types/s1/hosts/host1/authm:stageSecret", bytes.NewBuffer([]byte(reqBody)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types/{service-type}/hosts/{host}/authm:stageSecret", WrapConfig(AuthMethodStageSecret, mockstore, cfg))
+	router.ServeHTTP(w, req)
+
+	var status authmethods.SecretStatus
+	_ = json.Unmarshal(w.Body.Bytes(), &status)
+
+	// the next access key has been stored
+	am, _ := authmethods.FindHostAuthMethod("uuid1", "host1", "", mockstore)
+
+	suite.Equal(200, w.Code)
+	suite.Equal("****_key", status.Current)
+	suite.Equal("****_key", status.Next)
+	suite.NotEqual("", status.SecretStagedOn)
+	suite.Equal("next_access_key", am.(*authmethods.ApiKeyAuthMethod).NextAccessKey)
+	suite.Equal("access_key", am.(*authmethods.ApiKeyAuthMethod).AccessKey)
+}
+
+// TestAuthMethodStageSecretEmpty tests the case of staging an empty access key
+func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodStageSecretEmpty() {
+
+	expRespJSON := `{
+ "error": {
+  "message": "secret object contains empty fields. empty value for field: access_key",
+  "code": 422,
+  "status": "UNPROCESSABLE ENTITY"
+ }
+}`
+
+	req, err := http.NewRequest("POST", "http://localhost:8080/service-types/s1/hosts/host1/authm:stageSecret", bytes.NewBuffer([]byte(`{}`)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types/{service-type}/hosts/{host}/authm:stageSecret", WrapConfig(AuthMethodStageSecret, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(422, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
+// TestAuthMethodStageSecretPreconditionFailed tests the case of staging the next access key of an auth method that has been modified since the client retrieved it
+func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodStageSecretPreconditionFailed() {
+
+	expRespJSON := `{
+ "error": {
+  "message": "Auth method has been modified since it was retrieved",
+  "code": 412,
+  "status": "PRECONDITION FAILED"
+ }
+}`
+
+	reqBody := `{"access_key": "next_access_key"}`
+
+	req, err := http.NewRequest("POST", "http://localhost:8080/service-types/s1/hosts/host1/authm:stageSecret", bytes.NewBuffer([]byte(reqBody)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+	req.Header.Set("If-Match", `"0"`)
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+	mockstore.AuthMethods[0].Basic().Revision = 1
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types/{service-type}/hosts/{host}/authm:stageSecret", WrapConfig(AuthMethodStageSecret, mockstore, cfg))
+	router.ServeHTTP(w, req)
+
+	// the next access key has not been stored
+	am, _ := authmethods.FindHostAuthMethod("uuid1", "host1", "", mockstore)
+
+	suite.Equal(412, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+	suite.Equal("", am.(*authmethods.ApiKeyAuthMethod).NextAccessKey)
+}
+
+// TestAuthMethodSecretStatus tests the normal case of reporting the secrets of an auth method without a staged secret
+func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodSecretStatus() {
+
+	expRespJSON := `{
+ "current": "****_key"
+}`
+
+	req, err := http.NewRequest("GET", "http://localhost:8080/service-types/s1/hosts/host1/authm:secretStatus", nil)
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types/{service-type}/hosts/{host}/authm:secretStatus", WrapConfig(AuthMethodSecretStatus, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(200, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
+// TestAuthMethodTestOneEmptyRequest tests the case of testing an auth method without providing a binding or a unique key
+func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodTestOneEmptyRequest() {
+
+	expRespJSON := `{
+ "error": {
+  "message": "test request object contains empty fields. empty value for field: binding or unique_key",
+  "code": 422,
+  "status": "UNPROCESSABLE ENTITY"
+ }
+}`
+
+	req, err := http.NewRequest("POST", "http://localhost:8080/service-types/s1/hosts/host1/authm:test", bytes.NewBuffer([]byte(`{}`)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types/{service-type}/hosts/{host}/authm:test", WrapConfig(AuthMethodTestOne, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(422, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
+// TestAuthMethodTestOneBindingOfOtherHost tests the case of testing an auth method with a binding of another host
+func (suite *AuthMethodsHandlersTestSuite) TestAuthMethodTestOneBindingOfOtherHost() {
+
+	expRespJSON := `{
+ "error": {
+  "message": "Binding was not found",
+  "code": 404,
+  "status": "NOT FOUND"
+ }
+}`
+
+	req, err := http.NewRequest("POST", "http://localhost:8080/service-types/s1/hosts/host1/authm:test", bytes.NewBuffer([]byte(`{"binding": "b3"}`)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types/{service-type}/hosts/{host}/authm:test", WrapConfig(AuthMethodTestOne, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(404, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
 func TestAuthMethodsHandlersTestSuite(t *testing.T) {
 	suite.Run(t, new(AuthMethodsHandlersTestSuite))
 }
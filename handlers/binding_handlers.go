@@ -2,13 +2,18 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/ARGOeu/argo-api-authn/bindings"
+	"github.com/ARGOeu/argo-api-authn/config"
 	"github.com/ARGOeu/argo-api-authn/servicetypes"
 	"github.com/ARGOeu/argo-api-authn/stores"
 	"github.com/ARGOeu/argo-api-authn/utils"
 	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
+	LOGGER "github.com/sirupsen/logrus"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func BindingCreate(w http.ResponseWriter, r *http.Request) {
@@ -38,16 +43,33 @@ func BindingCreate(w http.ResponseWriter, r *http.Request) {
 	utils.RespondOk(w, 201, binding)
 }
 
-// BindingListAll returns a list, containing the existing bindings in the service
+// BindingListAll returns a page of the existing bindings in the service, that match the filters of the request
 func BindingListAll(w http.ResponseWriter, r *http.Request) {
 
 	var err error
+	var opts stores.ListOptions
+	var filter stores.BindingFilter
 	var bindingsList bindings.BindingList
 
 	//context references
 	store := context.Get(r, "stores").(stores.Store)
 
-	if bindingsList, err = bindings.FindAllBindings(store); err != nil {
+	if filter, err = bindingFilter(r); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	if filter.ServiceUUID, filter.Host, err = serviceTypeParam(r, store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	if opts, err = listOptions(r); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	if bindingsList, err = bindings.ListBindings(filter, opts, store); err != nil {
 		utils.RespondError(w, err)
 		return
 	}
@@ -56,11 +78,178 @@ func BindingListAll(w http.ResponseWriter, r *http.Request) {
 
 }
 
-// BindingListAllByServiceTypeAndHost returns a list, containing all the bindings under the specified host and service type
+// BindingListStale reports the bindings that haven't been used for a number of days, grouped by service type and host
+func BindingListStale(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+	var serviceUUID string
+	var host string
+	var report bindings.StaleBindingsReport
+
+	//context references
+	store := context.Get(r, "stores").(stores.Store)
+	cfg := context.Get(r, "config").(config.Config)
+
+	days := bindings.StaleAfter(&cfg)
+	if param := r.URL.Query().Get("days"); param != "" {
+		if days, err = strconv.Atoi(param); err != nil || days <= 0 {
+			err = utils.APIErrInvalidParameter("days", "It should be a positive number")
+			utils.RespondError(w, err)
+			return
+		}
+	}
+
+	if serviceUUID, host, err = serviceTypeParam(r, store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	if report, err = bindings.FindStaleBindings(bindings.DaysBefore(time.Now(), days), serviceUUID, host, store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.RespondOk(w, 200, report)
+}
+
+// BindingCleanup disables, or deletes, the bindings that have been stale for longer than the grace period of the cleanup policy
+func BindingCleanup(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+	var report bindings.CleanupReport
+
+	//context references
+	store := context.Get(r, "stores").(stores.Store)
+	cfg := context.Get(r, "config").(config.Config)
+
+	query := r.URL.Query()
+
+	action := cfg.BindingCleanup.Action
+	if query.Get("action") != "" {
+		action = query.Get("action")
+	}
+
+	if action == "" {
+		err = utils.APIErrInvalidParameter("action", "No cleanup action has been configured, it should be either disable or delete")
+		utils.RespondError(w, err)
+		return
+	}
+
+	dryRun := query.Get("dry_run") == "true"
+
+	if report, err = bindings.CleanupStaleBindings(bindings.CleanupUnusedSince(&cfg, time.Now()), action, dryRun, store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.RespondOk(w, 200, report)
+}
+
+// transferContentTypes are the content types of the formats that bindings are imported and exported in
+var transferContentTypes = map[string]string{
+	bindings.FormatJSONLines: "application/x-ndjson",
+	bindings.FormatCSV:       "text/csv",
+}
+
+// transferFormat returns the format of an import or export, json lines are used by default
+func transferFormat(r *http.Request) string {
+
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+
+	return bindings.FormatJSONLines
+}
+
+// BindingImport creates, or updates, the bindings of the request body, which holds either json lines or csv
+func BindingImport(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+	var report bindings.ImportReport
+
+	//context references
+	store := context.Get(r, "stores").(stores.Store)
+
+	query := r.URL.Query()
+
+	mode := bindings.ImportFail
+	if query.Get("mode") != "" {
+		mode = query.Get("mode")
+	}
+
+	dryRun := query.Get("dry_run") == "true"
+
+	if report, err = bindings.ImportBindings(r.Body, transferFormat(r), mode, dryRun, store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.RespondOk(w, 200, report)
+}
+
+// exportWriter writes the headers of an export along with its first bytes, so that errors that happen before can still be responded.
+// Every write is flushed to the client, so that the bindings are streamed while they are read
+type exportWriter struct {
+	w           http.ResponseWriter
+	contentType string
+	started     bool
+}
+
+func (ew *exportWriter) start() {
+
+	if ew.started {
+		return
+	}
+
+	ew.w.Header().Set("Content-Type", fmt.Sprintf("%s; charset=%s", ew.contentType, utils.Charset))
+	ew.w.WriteHeader(200)
+	ew.started = true
+}
+
+func (ew *exportWriter) Write(p []byte) (int, error) {
+
+	ew.start()
+
+	n, err := ew.w.Write(p)
+
+	if flusher, ok := ew.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	return n, err
+}
+
+// BindingExport streams all the bindings, either as json lines or as csv
+func BindingExport(w http.ResponseWriter, r *http.Request) {
+
+	//context references
+	store := context.Get(r, "stores").(stores.Store)
+
+	format := transferFormat(r)
+	ew := &exportWriter{w: w, contentType: transferContentTypes[format]}
+
+	if err := bindings.ExportBindings(ew, format, store); err != nil {
+		if !ew.started {
+			utils.RespondError(w, err)
+			return
+		}
+		// the response has already started, the client gets a truncated export
+		LOGGER.Errorf("Could not finish the export of the bindings. %v", err.Error())
+		return
+	}
+
+	// an export without any bindings hasn't written anything yet
+	ew.start()
+}
+
+// BindingListAllByServiceTypeAndHost returns a page of the bindings under the specified host and service type
 func BindingListAllByServiceTypeAndHost(w http.ResponseWriter, r *http.Request) {
 
 	var err error
 	var ok bool
+	var host string
+	var opts stores.ListOptions
+	var filter stores.BindingFilter
 	var bindingsList bindings.BindingList
 	var serviceType servicetypes.ServiceType
 
@@ -77,13 +266,26 @@ func BindingListAllByServiceTypeAndHost(w http.ResponseWriter, r *http.Request)
 	}
 
 	// check if the provided host is associated with the given service type
-	if ok = serviceType.HasHost(vars["host"]); ok == false {
+	if host, ok = serviceType.CanonicalHost(vars["host"]); ok == false {
 		err = utils.APIErrNotFound("Host")
 		utils.RespondError(w, err)
 		return
 	}
 
-	if bindingsList, err = bindings.FindBindingsByServiceTypeAndHost(serviceType.UUID, vars["host"], store); err != nil {
+	if filter, err = bindingFilter(r); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	if opts, err = listOptions(r); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	filter.ServiceUUID = serviceType.UUID
+	filter.Host = host
+
+	if bindingsList, err = bindings.ListBindings(filter, opts, store); err != nil {
 		utils.RespondError(w, err)
 		return
 	}
@@ -97,6 +299,7 @@ func BindingListOneByAuthID(w http.ResponseWriter, r *http.Request) {
 
 	var err error
 	var ok bool
+	var host string
 	var serviceType servicetypes.ServiceType
 	var binding bindings.Binding
 
@@ -113,17 +316,22 @@ func BindingListOneByAuthID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// check if the provided host is associated with the given service type
-	if ok = serviceType.HasHost(vars["host"]); ok == false {
+	if host, ok = serviceType.CanonicalHost(vars["host"]); ok == false {
 		err = utils.APIErrNotFound("Host")
 		utils.RespondError(w, err)
 		return
 	}
 
-	if binding, err = bindings.FindBindingByAuthID(vars["dn"], serviceType.UUID, vars["host"], "x509", store); err != nil {
+	if binding, err = bindings.FindBindingByAuthID(vars["dn"], serviceType.UUID, host, "x509", store); err != nil {
 		utils.RespondError(w, err)
 		return
 	}
 
+	if notModified(w, r, etag(binding.Revision)) {
+		return
+	}
+
+	setETag(w, etag(binding.Revision))
 	utils.RespondOk(w, 200, binding)
 
 }
@@ -145,6 +353,11 @@ func BindingListOneByName(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if notModified(w, r, etag(binding.Revision)) {
+		return
+	}
+
+	setETag(w, etag(binding.Revision))
 	utils.RespondOk(w, 200, binding)
 
 }
@@ -168,12 +381,24 @@ func BindingUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the binding might have been modified since the client retrieved it
+	if err = checkIfMatch(r, "Binding", originalBinding.Revision); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
 	// first, fill the temporary binding with the fields of the original binding
 	if err := utils.CopyFields(originalBinding, &tempBinding); err != nil {
 		err = utils.APIGenericInternalError(err.Error())
 		utils.RespondError(w, err)
 	}
 
+	// the decoder writes through the pointers it is given, the original binding keeps its own flag
+	if originalBinding.Enabled != nil {
+		enabled := *originalBinding.Enabled
+		tempBinding.Enabled = &enabled
+	}
+
 	// check the validity of the JSON and updated the provided fields
 	if err = json.NewDecoder(r.Body).Decode(&tempBinding); err != nil {
 		err := utils.APIErrBadRequest(err.Error())
@@ -186,6 +411,7 @@ func BindingUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, etag(updatedBinding.Revision))
 	utils.RespondOk(w, 200, updatedBinding)
 
 }
@@ -208,6 +434,12 @@ func BindingDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the binding might have been modified since the client retrieved it
+	if err = checkIfMatch(r, "Binding", resourceBinding.Revision); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
 	if err = bindings.DeleteBinding(resourceBinding, store); err != nil {
 		utils.RespondError(w, err)
 		return
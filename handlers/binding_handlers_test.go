@@ -11,6 +11,7 @@ import (
 	"encoding/json"
 	"github.com/ARGOeu/argo-api-authn/bindings"
 	"github.com/ARGOeu/argo-api-authn/config"
+	"github.com/ARGOeu/argo-api-authn/utils"
 	"github.com/gorilla/mux"
 	"io/ioutil"
 	"net/http/httptest"
@@ -441,7 +442,8 @@ func (suite *BindingHandlersSuite) TestBindingListAll() {
    "auth_type": "x509",
    "created_on": "2018-05-05T15:04:05Z"
   }
- ]
+ ],
+ "totalSize": 4
 }`
 	req, err := http.NewRequest("GET", "http://localhost:8080/bindings", nil)
 	if err != nil {
@@ -487,7 +489,8 @@ func (suite *BindingHandlersSuite) TestBindingListAllByServiceTypeAndHost() {
    "auth_type": "x509",
    "created_on": "2018-05-05T15:04:05Z"
   }
- ]
+ ],
+ "totalSize": 2
 }`
 	req, err := http.NewRequest("GET", "http://localhost:8080/service-types/s1/hosts/host1/bindings", nil)
 	if err != nil {
@@ -512,7 +515,8 @@ func (suite *BindingHandlersSuite) TestBindingListAllByServiceTypeAndHost() {
 func (suite *BindingHandlersSuite) TestBindingListAllEmpty() {
 
 	expRespJSON := `{
- "bindings": []
+ "bindings": [],
+ "totalSize": 0
 }`
 	req, err := http.NewRequest("GET", "http://localhost:8080/bindings", nil)
 	if err != nil {
@@ -540,7 +544,8 @@ func (suite *BindingHandlersSuite) TestBindingListAllEmpty() {
 func (suite *BindingHandlersSuite) TestBindingListAllByServiceTypeAndHostEmpty() {
 
 	expRespJSON := `{
- "bindings": []
+ "bindings": [],
+ "totalSize": 0
 }`
 	req, err := http.NewRequest("GET", "http://localhost:8080/service-types/s1/hosts/host1/bindings", nil)
 	if err != nil {
@@ -624,6 +629,383 @@ func (suite *BindingHandlersSuite) TestBindingListAllByServiceTypeAndHostUnknown
 	suite.Equal(expRespJSON, w.Body.String())
 }
 
+// TestBindingListAllPaginated tests that the pages of the bindings follow each other
+func (suite *BindingHandlersSuite) TestBindingListAllPaginated() {
+
+	var page1, page2 bindings.BindingList
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/bindings", WrapConfig(BindingListAll, mockstore, cfg))
+
+	req1, _ := http.NewRequest("GET", "http://localhost:8080/bindings?pageSize=3", nil)
+	w1 := httptest.NewRecorder()
+	router.ServeHTTP(w1, req1)
+	suite.Equal(200, w1.Code)
+	suite.Nil(json.Unmarshal(w1.Body.Bytes(), &page1))
+
+	req2, _ := http.NewRequest("GET", "http://localhost:8080/bindings?pageSize=3&pageToken="+page1.NextPageToken, nil)
+	w2 := httptest.NewRecorder()
+	router.ServeHTTP(w2, req2)
+	suite.Equal(200, w2.Code)
+	suite.Nil(json.Unmarshal(w2.Body.Bytes(), &page2))
+
+	suite.Equal(3, len(page1.Bindings))
+	suite.Equal("b1", page1.Bindings[0].Name)
+	suite.Equal("b3", page1.Bindings[2].Name)
+	suite.NotEqual("", page1.NextPageToken)
+	suite.Equal(4, page1.TotalSize)
+	suite.Equal(1, len(page2.Bindings))
+	suite.Equal("b4", page2.Bindings[0].Name)
+	suite.Equal("", page2.NextPageToken)
+	suite.Equal(4, page2.TotalSize)
+}
+
+// TestBindingListAllFiltered tests the case where the bindings are filtered by their service type and auth identifier
+func (suite *BindingHandlersSuite) TestBindingListAllFiltered() {
+
+	expRespJSON := `{
+ "bindings": [
+  {
+   "name": "b1",
+   "service_uuid": "uuid1",
+   "host": "host1",
+   "uuid": "b_uuid1",
+   "auth_identifier": "test_dn_1",
+   "unique_key": "unique_key_1",
+   "auth_type": "x509",
+   "created_on": "2018-05-05T15:04:05Z"
+  }
+ ],
+ "totalSize": 1
+}`
+
+	req, err := http.NewRequest("GET", "http://localhost:8080/bindings?service_type=s1&auth_identifier=dn_1&created_after=2018-05-05T15:04:05Z", nil)
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/bindings", WrapConfig(BindingListAll, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(200, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
+// TestBindingListAllUnknownServiceType tests the case where the bindings are filtered by a service type that doesn't exist
+func (suite *BindingHandlersSuite) TestBindingListAllUnknownServiceType() {
+
+	expRespJSON := `{
+ "error": {
+  "message": "Service-type was not found",
+  "code": 404,
+  "status": "NOT FOUND"
+ }
+}`
+
+	req, err := http.NewRequest("GET", "http://localhost:8080/bindings?service_type=unknown", nil)
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/bindings", WrapConfig(BindingListAll, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(404, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
+// TestBindingListAllInvalidParameters tests the cases of invalid page sizes, orders and times
+func (suite *BindingHandlersSuite) TestBindingListAllInvalidParameters() {
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/bindings", WrapConfig(BindingListAll, mockstore, cfg))
+
+	tests := []struct {
+		query   string
+		code    int
+		message string
+	}{
+		{"pageSize=-1", 400, "Parameter: pageSize contains invalid data. It should be a positive number up to 1000"},
+		{"pageSize=0", 400, "Parameter: pageSize contains invalid data. It should be a positive number up to 1000"},
+		{"pageSize=1001", 400, "Parameter: pageSize contains invalid data. It should be a positive number up to 1000"},
+		{"pageToken=invalid", 400, "Parameter: pageToken contains invalid data. The page token doesn't belong to this listing"},
+		{"order=random", 400, "Parameter: order contains invalid data. It should be either asc or desc"},
+		{"last_auth_after=2018-05-05", 400, "Parameter: last_auth_after contains invalid data. It should be a time in the format of 2006-01-02T15:04:05Z"},
+		{"order_by=unique_key", 422, "order_by: unique_key is not yet supported.Supported:[created_on name last_auth]"},
+	}
+
+	for _, t := range tests {
+
+		var apiErr struct {
+			Error utils.APIError `json:"error"`
+		}
+
+		req, _ := http.NewRequest("GET", "http://localhost:8080/bindings?"+t.query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		suite.Equal(t.code, w.Code, t.query)
+		suite.Nil(json.Unmarshal(w.Body.Bytes(), &apiErr))
+		suite.Equal(t.message, apiErr.Error.Message, t.query)
+	}
+
+	// listings are paginated by default
+	req, _ := http.NewRequest("GET", "http://localhost:8080/bindings", nil)
+	opts, err := listOptions(req)
+
+	suite.Nil(err)
+	suite.Equal(DefaultPageSize, opts.PageSize)
+}
+
+// TestBindingListStale tests the report of the bindings that haven't been used, the bindings of the mock store have never been used
+func (suite *BindingHandlersSuite) TestBindingListStale() {
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+	mockstore.Bindings[1].LastAuth = utils.ZuluTimeNow()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/bindings:stale", WrapConfig(BindingListStale, mockstore, cfg))
+
+	tests := []struct {
+		query  string
+		groups []string
+		names  []string
+	}{
+		{"", []string{"s1/host1", "s1/host2", "s2/host3"}, []string{"b1", "b3", "b4"}},
+		{"days=30&service_type=s1&host=host1", []string{"s1/host1"}, []string{"b1"}},
+		// the bindings were created in 2018
+		{"days=100000", []string{}, []string{}},
+	}
+
+	for _, t := range tests {
+
+		var report bindings.StaleBindingsReport
+
+		groups := []string{}
+		names := []string{}
+
+		req, _ := http.NewRequest("GET", "http://localhost:8080/bindings:stale?"+t.query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		suite.Equal(200, w.Code, t.query)
+		suite.Nil(json.Unmarshal(w.Body.Bytes(), &report))
+
+		for _, group := range report.Groups {
+			groups = append(groups, group.ServiceType+"/"+group.Host)
+			for _, binding := range group.Bindings {
+				names = append(names, binding.Name)
+			}
+		}
+
+		suite.Equal(t.groups, groups, t.query)
+		suite.Equal(t.names, names, t.query)
+		suite.Equal(len(t.names), report.TotalSize, t.query)
+	}
+
+	// invalid number of days
+	req, _ := http.NewRequest("GET", "http://localhost:8080/bindings:stale?days=none", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	suite.Equal(400, w.Code)
+}
+
+// TestBindingCleanup tests the cleanup of the stale bindings through the api
+func (suite *BindingHandlersSuite) TestBindingCleanup() {
+
+	expRespJSON := `{
+ "error": {
+  "message": "Parameter: action contains invalid data. No cleanup action has been configured, it should be either disable or delete",
+  "code": 400,
+  "status": "BAD REQUEST"
+ }
+}`
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/bindings:cleanup", WrapConfig(BindingCleanup, mockstore, cfg))
+
+	// the test configuration has no cleanup action
+	req1, _ := http.NewRequest("POST", "http://localhost:8080/bindings:cleanup", nil)
+	w1 := httptest.NewRecorder()
+	router.ServeHTTP(w1, req1)
+
+	suite.Equal(400, w1.Code)
+	suite.Equal(expRespJSON, w1.Body.String())
+
+	// a dry run reports the bindings without disabling them
+	var report bindings.CleanupReport
+
+	req2, _ := http.NewRequest("POST", "http://localhost:8080/bindings:cleanup?action=disable&dry_run=true", nil)
+	w2 := httptest.NewRecorder()
+	router.ServeHTTP(w2, req2)
+
+	suite.Equal(200, w2.Code)
+	suite.Nil(json.Unmarshal(w2.Body.Bytes(), &report))
+	suite.Equal("disable", report.Action)
+	suite.True(report.DryRun)
+	suite.Equal(4, report.TotalSize)
+	suite.Nil(mockstore.Bindings[0].Enabled)
+
+	// the configured action is used when none is given
+	cfg.BindingCleanup.Action = config.BindingCleanupDisable
+
+	req3, _ := http.NewRequest("POST", "http://localhost:8080/bindings:cleanup", nil)
+	w3 := httptest.NewRecorder()
+	router.ServeHTTP(w3, req3)
+
+	suite.Equal(200, w3.Code)
+	suite.Equal(false, *mockstore.Bindings[0].Enabled)
+	suite.Equal(false, *mockstore.Bindings[3].Enabled)
+}
+
+// TestBindingImport tests the import of bindings as json lines and csv, along with its errors
+func (suite *BindingHandlersSuite) TestBindingImport() {
+
+	expRespJSON := `{
+ "error": {
+  "message": "binding object with name: b1 already exists",
+  "code": 409,
+  "status": "CONFLICT"
+ }
+}`
+
+	postJSONL := `{"name": "b1", "service_uuid": "uuid1", "host": "host1", "auth_identifier": "test_dn_1", "unique_key": "unique_key_updated", "auth_type": "x509"}
+{"name": "b5", "service_uuid": "uuid1", "host": "host1", "auth_identifier": "test_dn_5", "unique_key": "unique_key_5", "auth_type": "x509"}
+`
+
+	postCSV := `name,service_uuid,host,auth_identifier,unique_key,auth_type
+b6,uuid1,host2,test_dn_6,unique_key_6,x509
+`
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/bindings:import", WrapConfig(BindingImport, mockstore, cfg))
+
+	// by default, the import fails on conflicts
+	req1, _ := http.NewRequest("POST", "http://localhost:8080/bindings:import", bytes.NewBuffer([]byte(postJSONL)))
+	w1 := httptest.NewRecorder()
+	router.ServeHTTP(w1, req1)
+
+	suite.Equal(409, w1.Code)
+	suite.Equal(expRespJSON, w1.Body.String())
+
+	// the upsert updates the existing bindings
+	var report1 bindings.ImportReport
+
+	req2, _ := http.NewRequest("POST", "http://localhost:8080/bindings:import?mode=upsert", bytes.NewBuffer([]byte(postJSONL)))
+	w2 := httptest.NewRecorder()
+	router.ServeHTTP(w2, req2)
+
+	suite.Equal(200, w2.Code)
+	suite.Nil(json.Unmarshal(w2.Body.Bytes(), &report1))
+	suite.Equal(1, report1.Created)
+	suite.Equal(1, report1.Updated)
+	suite.Equal("unique_key_updated", mockstore.Bindings[0].UniqueKey)
+
+	// a csv dry run
+	var report2 bindings.ImportReport
+
+	req3, _ := http.NewRequest("POST", "http://localhost:8080/bindings:import?format=csv&dry_run=true", bytes.NewBuffer([]byte(postCSV)))
+	w3 := httptest.NewRecorder()
+	router.ServeHTTP(w3, req3)
+
+	suite.Equal(200, w3.Code)
+	suite.Nil(json.Unmarshal(w3.Body.Bytes(), &report2))
+	suite.True(report2.DryRun)
+	suite.Equal([]bindings.ImportRow{{Row: 1, Name: "b6", Action: bindings.ImportActionCreate}}, report2.Rows)
+
+	// unknown format
+	req4, _ := http.NewRequest("POST", "http://localhost:8080/bindings:import?format=xml", bytes.NewBuffer([]byte(postCSV)))
+	w4 := httptest.NewRecorder()
+	router.ServeHTTP(w4, req4)
+
+	suite.Equal(422, w4.Code)
+}
+
+// TestBindingExport tests the export of the bindings as json lines and csv
+func (suite *BindingHandlersSuite) TestBindingExport() {
+
+	expJSONL := `{"name":"b1","service_uuid":"uuid1","host":"host1","uuid":"b_uuid1","auth_identifier":"test_dn_1","unique_key":"unique_key_1","auth_type":"x509","created_on":"2018-05-05T15:04:05Z"}
+{"name":"b2","service_uuid":"uuid1","host":"host1","uuid":"b_uuid2","auth_identifier":"test_dn_2","unique_key":"unique_key_2","auth_type":"x509","created_on":"2018-05-05T15:04:05Z"}
+{"name":"b3","service_uuid":"uuid1","host":"host2","uuid":"b_uuid3","auth_identifier":"test_dn_3","unique_key":"unique_key_3","auth_type":"x509","created_on":"2018-05-05T15:04:05Z"}
+{"name":"b4","service_uuid":"uuid2","host":"host3","uuid":"b_uuid4","auth_identifier":"test_dn_1","unique_key":"unique_key_1","auth_type":"x509","created_on":"2018-05-05T15:04:05Z"}
+`
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/bindings:export", WrapConfig(BindingExport, mockstore, cfg))
+
+	req1, _ := http.NewRequest("GET", "http://localhost:8080/bindings:export", nil)
+	w1 := httptest.NewRecorder()
+	router.ServeHTTP(w1, req1)
+
+	suite.Equal(200, w1.Code)
+	suite.Equal("application/x-ndjson; charset=utf-8", w1.Header().Get("Content-Type"))
+	suite.Equal(expJSONL, w1.Body.String())
+
+	req2, _ := http.NewRequest("GET", "http://localhost:8080/bindings:export?format=csv", nil)
+	w2 := httptest.NewRecorder()
+	router.ServeHTTP(w2, req2)
+
+	suite.Equal(200, w2.Code)
+	suite.Equal("text/csv; charset=utf-8", w2.Header().Get("Content-Type"))
+	suite.Equal(5, len(bytes.Split(bytes.TrimSpace(w2.Body.Bytes()), []byte("\n"))))
+
+	// unknown format
+	req3, _ := http.NewRequest("GET", "http://localhost:8080/bindings:export?format=xml", nil)
+	w3 := httptest.NewRecorder()
+	router.ServeHTTP(w3, req3)
+
+	suite.Equal(422, w3.Code)
+	suite.Equal("application/json; charset=utf-8", w3.Header().Get("Content-Type"))
+}
+
 // TestBindingListOneByAuthID tests the normal case
 func (suite *BindingHandlersSuite) TestBindingListOneByAuthID() {
 
@@ -858,7 +1240,8 @@ func (suite *BindingHandlersSuite) TestBindingUpdate() {
  "auth_identifier": "test_dn_1",
  "unique_key": "unique_key_1",
  "auth_type": "x509",
- "created_on": "2018-05-05T15:04:05Z"
+ "created_on": "2018-05-05T15:04:05Z",
+ "revision": 1
 }`
 	req, err := http.NewRequest("PUT", "http://localhost:8080/bindings/b1", bytes.NewBuffer([]byte(postJSON)))
 	if err != nil {
@@ -879,6 +1262,84 @@ func (suite *BindingHandlersSuite) TestBindingUpdate() {
 	suite.Equal(expRespJSON, w.Body.String())
 }
 
+// TestBindingUpdateAccessSettings tests the case of suspending a binding and limiting it to a period
+func (suite *BindingHandlersSuite) TestBindingUpdateAccessSettings() {
+
+	postJSON := `{
+	"enabled": false,
+	"suspension_reason": "compromised",
+	"not_before": "2019-01-01T00:00:00Z",
+	"not_after": "2019-02-01T00:00:00Z"
+}`
+
+	expRespJSON := `{
+ "name": "b1",
+ "service_uuid": "uuid1",
+ "host": "host1",
+ "uuid": "b_uuid1",
+ "auth_identifier": "test_dn_1",
+ "unique_key": "unique_key_1",
+ "auth_type": "x509",
+ "created_on": "2018-05-05T15:04:05Z",
+ "revision": 1,
+ "enabled": false,
+ "suspension_reason": "compromised",
+ "not_before": "2019-01-01T00:00:00Z",
+ "not_after": "2019-02-01T00:00:00Z"
+}`
+	req, err := http.NewRequest("PUT", "http://localhost:8080/bindings/b1", bytes.NewBuffer([]byte(postJSON)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/bindings/{name}", WrapConfig(BindingUpdate, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(200, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
+// TestBindingUpdateInvalidPeriod tests the case of updating a binding with a period that ends before it begins
+func (suite *BindingHandlersSuite) TestBindingUpdateInvalidPeriod() {
+
+	postJSON := `{
+	"not_before": "2019-02-01T00:00:00Z",
+	"not_after": "2019-01-01T00:00:00Z"
+}`
+
+	expRespJSON := `{
+ "error": {
+  "message": "Field: not_after contains invalid data. It should be later than not_before",
+  "code": 422,
+  "status": "UNPROCESSABLE ENTITY"
+ }
+}`
+	req, err := http.NewRequest("PUT", "http://localhost:8080/bindings/b1", bytes.NewBuffer([]byte(postJSON)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/bindings/{name}", WrapConfig(BindingUpdate, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(422, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
 // TestBindingUpdateServiceUUIDEmpty tests case of updating a binding's service_uuid into an empty string
 func (suite *BindingHandlersSuite) TestBindingUpdateServiceUUIDEmpty() {
 
@@ -1206,6 +1667,119 @@ func (suite *BindingHandlersSuite) TestBindingUpdateUnknownUUID() {
 	suite.Equal(expRespJSON, w.Body.String())
 }
 
+// TestBindingListOneByNameETag tests that a binding is returned along with the entity tag of its revision
+func (suite *BindingHandlersSuite) TestBindingListOneByNameETag() {
+
+	req, err := http.NewRequest("GET", "http://localhost:8080/bindings/b1", nil)
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+	mockstore.Bindings[0].Revision = 3
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/bindings/{name}", WrapConfig(BindingListOneByName, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(200, w.Code)
+	suite.Equal(`"3"`, w.Header().Get("ETag"))
+	suite.Contains(w.Body.String(), `"revision": 3`)
+}
+
+// TestBindingListOneByNameNotModified tests the case of a conditional request for a binding that the client already has
+func (suite *BindingHandlersSuite) TestBindingListOneByNameNotModified() {
+
+	req, err := http.NewRequest("GET", "http://localhost:8080/bindings/b1", nil)
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+	req.Header.Set("If-None-Match", `"1", W/"0"`)
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/bindings/{name}", WrapConfig(BindingListOneByName, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(304, w.Code)
+	suite.Equal(`"0"`, w.Header().Get("ETag"))
+	suite.Equal("", w.Body.String())
+}
+
+// TestBindingUpdateIfMatch tests the case of updating a binding that hasn't been modified since the client retrieved it
+func (suite *BindingHandlersSuite) TestBindingUpdateIfMatch() {
+
+	postJSON := `{
+	"name": "updated_name"
+}`
+
+	req, err := http.NewRequest("PUT", "http://localhost:8080/bindings/b1", bytes.NewBuffer([]byte(postJSON)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+	req.Header.Set("If-Match", `"0"`)
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/bindings/{name}", WrapConfig(BindingUpdate, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(200, w.Code)
+	suite.Equal(`"1"`, w.Header().Get("ETag"))
+	suite.Equal(int64(1), mockstore.Bindings[0].Revision)
+}
+
+// TestBindingUpdatePreconditionFailed tests the case of updating a binding that has been modified since the client retrieved it
+func (suite *BindingHandlersSuite) TestBindingUpdatePreconditionFailed() {
+
+	postJSON := `{
+	"name": "updated_name"
+}`
+
+	expRespJSON := `{
+ "error": {
+  "message": "Binding has been modified since it was retrieved",
+  "code": 412,
+  "status": "PRECONDITION FAILED"
+ }
+}`
+
+	req, err := http.NewRequest("PUT", "http://localhost:8080/bindings/b1", bytes.NewBuffer([]byte(postJSON)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+	req.Header.Set("If-Match", `"0"`)
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+	mockstore.Bindings[0].Revision = 1
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/bindings/{name}", WrapConfig(BindingUpdate, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(412, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+	suite.Equal("b1", mockstore.Bindings[0].Name)
+}
+
 // TestBindingDelete tests the normal case
 func (suite *BindingHandlersSuite) TestBindingDelete() {
 
@@ -1257,6 +1831,31 @@ func (suite *BindingHandlersSuite) TestBindingDeleteUnknownDN() {
 	suite.Equal(expRespJSON, w.Body.String())
 }
 
+// TestBindingDeletePreconditionFailed tests the case of deleting a binding that has been modified since the client retrieved it
+func (suite *BindingHandlersSuite) TestBindingDeletePreconditionFailed() {
+
+	req, err := http.NewRequest("DELETE", "http://localhost:8080/bindings/b1", nil)
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+	req.Header.Set("If-Match", `W/"0"`)
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/bindings/{name}", WrapConfig(BindingDelete, mockstore, cfg))
+	router.ServeHTTP(w, req)
+
+	// weak entity tags never match the If-Match header
+	suite.Equal(412, w.Code)
+	suite.Equal(4, len(mockstore.Bindings))
+}
+
 func TestBindingHandlersSuite(t *testing.T) {
 	LOGGER.SetOutput(ioutil.Discard)
 	suite.Run(t, new(BindingHandlersSuite))
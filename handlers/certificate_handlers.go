@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/ARGOeu/argo-api-authn/auth"
 	"github.com/ARGOeu/argo-api-authn/authmethods"
@@ -9,6 +11,7 @@ import (
 	"github.com/ARGOeu/argo-api-authn/config"
 	"github.com/ARGOeu/argo-api-authn/servicetypes"
 	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/ARGOeu/argo-api-authn/usage"
 	"github.com/ARGOeu/argo-api-authn/utils"
 	"github.com/gorilla/context"
 	"github.com/gorilla/mux"
@@ -19,10 +22,10 @@ func AuthViaCert(w http.ResponseWriter, r *http.Request) {
 
 	var err error
 	var ok bool
+	var host string
 	var dataRes = make(map[string]interface{})
 	var binding bindings.Binding
 	var serviceType servicetypes.ServiceType
-	var authm authmethods.AuthMethod
 
 	//context references
 	store := context.Get(r, "stores").(stores.Store)
@@ -59,14 +62,15 @@ func AuthViaCert(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// check if the provided host is associated with the given serviceType type
-	if ok = serviceType.HasHost(vars["host"]); ok == false {
+	if host, ok = serviceType.CanonicalHost(vars["host"]); ok == false {
 		err = utils.APIErrNotFound("Host")
 		utils.RespondError(w, err)
 		return
 	}
 
-	// check if the auth method exists
-	if authm, err = authmethods.AuthMethodFinder(serviceType.UUID, vars["host"], serviceType.AuthMethod, store); err != nil {
+	// disabled hosts don't accept authentication requests
+	if !serviceType.HostEnabled(host) {
+		err = utils.APIErrNotFound("Host")
 		utils.RespondError(w, err)
 		return
 	}
@@ -74,18 +78,38 @@ func AuthViaCert(w http.ResponseWriter, r *http.Request) {
 	// Find the binding associated with the provided certificate
 	rdnSequence := auth.ExtractEnhancedRDNSequenceToString(r.TLS.PeerCertificates[0])
 
-	LOGGER.Infof("Certificate request: %v for Service-Type: %v and  Host: %v", rdnSequence, serviceType.Name, vars["host"])
+	LOGGER.Infof("Certificate request: %v for Service-Type: %v and  Host: %v", rdnSequence, serviceType.Name, host)
+
+	if binding, err = bindings.FindBindingByAuthID(rdnSequence, serviceType.UUID, host, "x509", store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
 
-	if binding, err = bindings.FindBindingByAuthID(rdnSequence, serviceType.UUID, vars["host"], "x509", store); err != nil {
+	// suspended bindings, and bindings outside of their period, keep their record but can't be used to authenticate
+	if err = binding.CheckAccess(time.Now()); err != nil {
 		utils.RespondError(w, err)
 		return
 	}
 
-	if dataRes, err = authm.RetrieveAuthResource(binding, serviceType, &cfg); err != nil {
+	// retrieve the auth resource through the host's auth method, or from the cache
+	if dataRes, err = authmethods.RetrieveAuthResource(binding, serviceType, store, &cfg); err != nil {
 		utils.RespondError(w, err)
 		return
 	}
 
+	// the usage of the binding is recorded in the background, so it never delays the response
+	usage.Bindings.Record(binding.UUID, clientIP(r))
+
 	utils.RespondOk(w, 200, dataRes)
 
 }
+
+// clientIP returns the address of the client that made the request, without its port
+func clientIP(r *http.Request) string {
+
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return ip
+	}
+
+	return r.RemoteAddr
+}
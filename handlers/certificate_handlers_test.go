@@ -24,6 +24,11 @@ type CertificateHandlerSuite struct {
 	suite.Suite
 }
 
+func init() {
+	// the mock auth method is registered like any other auth method type
+	authmethods.Register("mock-auth", authmethods.Definition{New: authmethods.NewMockAuthMethod, NewQueryModel: authmethods.NewQMockAuthMethod})
+}
+
 func AuthViaCertSetUp(reqPath string) (*http.Request, *stores.Mockstore, *config.Config, error) {
 
 	var err error
@@ -109,12 +114,11 @@ lBlGGSW4gNfL1IYoakRwJiNiqZ+Gb7+6kHDSVneFeO/qJakXzlByjAA6quPbYzSf
 	cfg = &config.Config{}
 	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
 
-	// add to the auth method types the new mock auth init method, in order for the factory to find,
-	// so the query model converter will work
-	authmethods.AuthMethodsTypes["mock-auth"] = authmethods.NewMockAuthMethod
-
-	// add the new finder so the handler can retrieve it
-	authmethods.QueryAuthMethodFinders["mock-auth"] = authmethods.MockKeyAuthFinder
+	// append the mock auth methods of the hosts
+	qAm := &authmethods.QMockAuthMethod{QBasicAuthMethod: stores.QBasicAuthMethod{ServiceUUID: "uuid_auth_cert", Host: "h1_auth_cert", Type: "mock-auth", RetrievalField: "token"}}
+	qAm2 := &authmethods.QMockAuthMethod{QBasicAuthMethod: stores.QBasicAuthMethod{ServiceUUID: "uuid_auth_cert_incorrect", Host: "h1_auth_cert", Type: "mock-auth", RetrievalField: "token"}}
+	qAm3 := &authmethods.QMockAuthMethod{QBasicAuthMethod: stores.QBasicAuthMethod{ServiceUUID: "uuid_auth_cert_incorrect", Host: "h1_auth_cert_revoked", Type: "mock-auth", RetrievalField: "token"}}
+	mockstore.AuthMethods = append(mockstore.AuthMethods, qAm, qAm2, qAm3)
 
 	return req, mockstore, cfg, err
 }
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/ARGOeu/argo-api-authn/servicetypes"
+	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+)
+
+// HostCreate adds a new host to a service type
+func HostCreate(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+	var serviceType servicetypes.ServiceType
+	var host servicetypes.Host
+
+	// new hosts are enabled, unless stated otherwise
+	var tempHost = servicetypes.TempHost{Enabled: true}
+
+	//context references
+	store := context.Get(r, "stores").(stores.Store)
+
+	// url vars
+	vars := mux.Vars(r)
+
+	if serviceType, err = servicetypes.FindServiceTypeByName(vars["service-type"], store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// check the validity of the JSON, the metadata of the host is optional
+	if err = json.NewDecoder(r.Body).Decode(&tempHost); err != nil && err != io.EOF {
+		err := utils.APIErrBadRequest(err.Error())
+		utils.RespondError(w, err)
+		return
+	}
+
+	if host, err = servicetypes.CreateHost(serviceType, vars["host"], tempHost, store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.RespondOk(w, 201, host)
+}
+
+// HostListAll returns all the hosts of a service type
+func HostListAll(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+	var serviceType servicetypes.ServiceType
+	var hostsList servicetypes.HostsList
+
+	//context references
+	store := context.Get(r, "stores").(stores.Store)
+
+	// url vars
+	vars := mux.Vars(r)
+
+	if serviceType, err = servicetypes.FindServiceTypeByName(vars["service-type"], store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	if hostsList, err = servicetypes.FindAllHosts(serviceType); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.RespondOk(w, 200, hostsList)
+}
+
+// HostListOne returns the host of a service type that the given host or alias refers to
+func HostListOne(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+	var serviceType servicetypes.ServiceType
+	var host servicetypes.Host
+
+	//context references
+	store := context.Get(r, "stores").(stores.Store)
+
+	// url vars
+	vars := mux.Vars(r)
+
+	if serviceType, err = servicetypes.FindServiceTypeByName(vars["service-type"], store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	if host, err = servicetypes.FindHost(serviceType, vars["host"]); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.RespondOk(w, 200, host)
+}
+
+// HostUpdate updates the metadata of a service type's host
+func HostUpdate(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+	var serviceType servicetypes.ServiceType
+	var host servicetypes.Host
+	var tempHost servicetypes.TempHost
+
+	//context references
+	store := context.Get(r, "stores").(stores.Store)
+
+	// url vars
+	vars := mux.Vars(r)
+
+	if serviceType, err = servicetypes.FindServiceTypeByName(vars["service-type"], store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	if host, err = servicetypes.FindHost(serviceType, vars["host"]); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// the hosts are part of the service type, which might have been modified since the client retrieved it
+	if err = checkIfMatch(r, "Service type", serviceType.Revision); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// first, fill the temporary host with the fields of the original host
+	if err = utils.CopyFields(host, &tempHost); err != nil {
+		err = utils.APIGenericInternalError(err.Error())
+		utils.RespondError(w, err)
+		return
+	}
+
+	// check the validity of the JSON and updated the provided fields
+	if err = json.NewDecoder(r.Body).Decode(&tempHost); err != nil {
+		err := utils.APIErrBadRequest(err.Error())
+		utils.RespondError(w, err)
+		return
+	}
+
+	if host, err = servicetypes.UpdateHost(serviceType, host.Name, tempHost, store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.RespondOk(w, 200, host)
+}
+
+// HostDelete removes a host from a service type
+func HostDelete(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+	var serviceType servicetypes.ServiceType
+
+	//context references
+	store := context.Get(r, "stores").(stores.Store)
+
+	// url vars
+	vars := mux.Vars(r)
+
+	if serviceType, err = servicetypes.FindServiceTypeByName(vars["service-type"], store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// the hosts are part of the service type, which might have been modified since the client retrieved it
+	if err = checkIfMatch(r, "Service type", serviceType.Revision); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	if err = servicetypes.DeleteHost(serviceType, vars["host"], cascadeDelete(r), store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	utils.RespondOk(w, 204, nil)
+}
@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"bytes"
+	"github.com/ARGOeu/argo-api-authn/config"
+	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/gorilla/mux"
+	LOGGER "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type HostHandlersSuite struct {
+	suite.Suite
+}
+
+// hostsMockstore returns a mock store, where the first host of the service type s1 has an alias and the second one is disabled
+func hostsMockstore() *stores.Mockstore {
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	mockstore.ServiceTypes[0].HostDetails = []stores.QHost{
+		{Name: "host1", Description: "load balanced", Enabled: true, Aliases: []string{"host1-lb"}, CreatedOn: "2018-05-05T18:04:05Z"},
+		{Name: "host2", Enabled: false},
+	}
+
+	return mockstore
+}
+
+// serveHostRequest serves the given request using the provided host handler
+func serveHostRequest(req *http.Request, path string, handler http.HandlerFunc, mockstore stores.Store) *httptest.ResponseRecorder {
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc(path, WrapConfig(handler, mockstore, cfg))
+	router.ServeHTTP(w, req)
+
+	return w
+}
+
+// TestHostCreate tests the normal case of adding a host to a service type
+func (suite *HostHandlersSuite) TestHostCreate() {
+
+	postJSON := `{
+	"description": "new host",
+	"aliases": ["host4-lb"]
+}`
+
+	req, err := http.NewRequest("POST", "http://localhost:8080/service-types/s1/hosts/host4", bytes.NewBuffer([]byte(postJSON)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := hostsMockstore()
+	w := serveHostRequest(req, "/service-types/{service-type}/hosts/{host}", HostCreate, mockstore)
+
+	qServices, _ := mockstore.QueryServiceTypesByUUID("uuid1")
+
+	suite.Equal(201, w.Code)
+	suite.Contains(w.Body.String(), `"name": "host4"`)
+	suite.Contains(w.Body.String(), `"description": "new host"`)
+	suite.Contains(w.Body.String(), `"enabled": true`)
+	suite.Equal([]string{"host1", "host2", "host3", "host4"}, qServices[0].Hosts)
+	suite.Equal([]string{"host4-lb"}, qServices[0].HostDetails[2].Aliases)
+}
+
+// TestHostCreateEmptyBody tests the case of adding a host without any metadata
+func (suite *HostHandlersSuite) TestHostCreateEmptyBody() {
+
+	req, err := http.NewRequest("POST", "http://localhost:8080/service-types/s1/hosts/host4", bytes.NewBuffer(nil))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := hostsMockstore()
+	w := serveHostRequest(req, "/service-types/{service-type}/hosts/{host}", HostCreate, mockstore)
+
+	suite.Equal(201, w.Code)
+	suite.Contains(w.Body.String(), `"enabled": true`)
+}
+
+// TestHostCreateAlreadyExists tests the case of adding a host that is already an alias of another host
+func (suite *HostHandlersSuite) TestHostCreateAlreadyExists() {
+
+	expRespJSON := `{
+ "error": {
+  "message": "host object with name: host1-lb already exists",
+  "code": 409,
+  "status": "CONFLICT"
+ }
+}`
+
+	req, err := http.NewRequest("POST", "http://localhost:8080/service-types/s1/hosts/host1-lb", bytes.NewBuffer(nil))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	w := serveHostRequest(req, "/service-types/{service-type}/hosts/{host}", HostCreate, hostsMockstore())
+
+	suite.Equal(409, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
+// TestHostListAll tests the normal case of listing the hosts of a service type
+func (suite *HostHandlersSuite) TestHostListAll() {
+
+	expRespJSON := `{
+ "hosts": [
+  {
+   "name": "host1",
+   "description": "load balanced",
+   "enabled": true,
+   "aliases": [
+    "host1-lb"
+   ],
+   "created_on": "2018-05-05T18:04:05Z"
+  },
+  {
+   "name": "host2",
+   "description": "",
+   "enabled": false,
+   "aliases": []
+  },
+  {
+   "name": "host3",
+   "description": "",
+   "enabled": true,
+   "aliases": []
+  }
+ ]
+}`
+
+	req, err := http.NewRequest("GET", "http://localhost:8080/service-types/s1/hosts", nil)
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	w := serveHostRequest(req, "/service-types/{service-type}/hosts", HostListAll, hostsMockstore())
+
+	suite.Equal(200, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
+// TestHostListOneByAlias tests the case of retrieving a host through its alias
+func (suite *HostHandlersSuite) TestHostListOneByAlias() {
+
+	expRespJSON := `{
+ "name": "host1",
+ "description": "load balanced",
+ "enabled": true,
+ "aliases": [
+  "host1-lb"
+ ],
+ "created_on": "2018-05-05T18:04:05Z"
+}`
+
+	req, err := http.NewRequest("GET", "http://localhost:8080/service-types/s1/hosts/host1-lb", nil)
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	w := serveHostRequest(req, "/service-types/{service-type}/hosts/{host}", HostListOne, hostsMockstore())
+
+	suite.Equal(200, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
+// TestHostUpdate tests the normal case of updating the metadata of a host, the fields that aren't provided are kept
+func (suite *HostHandlersSuite) TestHostUpdate() {
+
+	postJSON := `{
+	"enabled": false
+}`
+
+	expRespJSON := `{
+ "name": "host1",
+ "description": "load balanced",
+ "enabled": false,
+ "aliases": [
+  "host1-lb"
+ ],
+ "created_on": "2018-05-05T18:04:05Z"
+}`
+
+	req, err := http.NewRequest("PUT", "http://localhost:8080/service-types/s1/hosts/host1", bytes.NewBuffer([]byte(postJSON)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	w := serveHostRequest(req, "/service-types/{service-type}/hosts/{host}", HostUpdate, hostsMockstore())
+
+	suite.Equal(200, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
+// TestHostUpdatePreconditionFailed tests the case of updating a host of a service type that has been modified since the client retrieved it
+func (suite *HostHandlersSuite) TestHostUpdatePreconditionFailed() {
+
+	postJSON := `{
+	"enabled": false
+}`
+
+	expRespJSON := `{
+ "error": {
+  "message": "Service type has been modified since it was retrieved",
+  "code": 412,
+  "status": "PRECONDITION FAILED"
+ }
+}`
+
+	req, err := http.NewRequest("PUT", "http://localhost:8080/service-types/s1/hosts/host1", bytes.NewBuffer([]byte(postJSON)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+	req.Header.Set("If-Match", `"0"`)
+
+	mockstore := hostsMockstore()
+	mockstore.ServiceTypes[0].Revision = 1
+
+	w := serveHostRequest(req, "/service-types/{service-type}/hosts/{host}", HostUpdate, mockstore)
+
+	suite.Equal(412, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+	suite.True(mockstore.ServiceTypes[0].HostDetails[0].Enabled)
+}
+
+// TestHostDeleteInUse tests the case of removing a host that is still referenced by bindings and auth methods
+func (suite *HostHandlersSuite) TestHostDeleteInUse() {
+
+	expRespJSON := `{
+ "error": {
+  "message": "Hosts are still in use: host1(bindings: [b1 b2], auth_methods: [api-key]). Delete them along with the hosts using cascade=true, or rename the hosts instead",
+  "code": 409,
+  "status": "CONFLICT"
+ }
+}`
+
+	req, err := http.NewRequest("DELETE", "http://localhost:8080/service-types/s1/hosts/host1", nil)
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	w := serveHostRequest(req, "/service-types/{service-type}/hosts/{host}", HostDelete, hostsMockstore())
+
+	suite.Equal(409, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
+// TestHostDeleteCascade tests the case of removing a host along with its bindings and auth methods
+func (suite *HostHandlersSuite) TestHostDeleteCascade() {
+
+	req, err := http.NewRequest("DELETE", "http://localhost:8080/service-types/s1/hosts/host1?cascade=true", nil)
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := hostsMockstore()
+	w := serveHostRequest(req, "/service-types/{service-type}/hosts/{host}", HostDelete, mockstore)
+
+	qServices, _ := mockstore.QueryServiceTypesByUUID("uuid1")
+	qBindings, _ := mockstore.QueryBindings("uuid1", "host1")
+
+	suite.Equal(204, w.Code)
+	suite.Equal([]string{"host2", "host3"}, qServices[0].Hosts)
+	suite.Equal(0, len(qBindings))
+}
+
+// TestHostDeletePreconditionFailed tests the case of removing a host of a service type that has been modified since the client retrieved it
+func (suite *HostHandlersSuite) TestHostDeletePreconditionFailed() {
+
+	expRespJSON := `{
+ "error": {
+  "message": "Service type has been modified since it was retrieved",
+  "code": 412,
+  "status": "PRECONDITION FAILED"
+ }
+}`
+
+	req, err := http.NewRequest("DELETE", "http://localhost:8080/service-types/s1/hosts/host1?cascade=true", nil)
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+	req.Header.Set("If-Match", `"0"`)
+
+	mockstore := hostsMockstore()
+	mockstore.ServiceTypes[0].Revision = 1
+
+	w := serveHostRequest(req, "/service-types/{service-type}/hosts/{host}", HostDelete, mockstore)
+
+	qBindings, _ := mockstore.QueryBindings("uuid1", "host1")
+
+	suite.Equal(412, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+	suite.Equal(2, len(qBindings))
+}
+
+// TestBindingListAllByHostAlias tests the case of listing the bindings of a host through its alias
+func (suite *HostHandlersSuite) TestBindingListAllByHostAlias() {
+
+	req, err := http.NewRequest("GET", "http://localhost:8080/service-types/s1/hosts/host1-lb/bindings", nil)
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	w := serveHostRequest(req, "/service-types/{service-type}/hosts/{host}/bindings", BindingListAllByServiceTypeAndHost, hostsMockstore())
+
+	suite.Equal(200, w.Code)
+	suite.Contains(w.Body.String(), `"name": "b1"`)
+	suite.Contains(w.Body.String(), `"name": "b2"`)
+}
+
+func TestHostHandlersSuite(t *testing.T) {
+	LOGGER.SetOutput(ioutil.Discard)
+	suite.Run(t, new(HostHandlersSuite))
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/ARGOeu/argo-api-authn/servicetypes"
+	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// listOptions reads the pagination and the order of a listing from the query of the request.
+// Listings are always paginated, the unbounded listings of the stores are only used internally
+func listOptions(r *http.Request) (stores.ListOptions, error) {
+
+	query := r.URL.Query()
+
+	opts := stores.ListOptions{
+		PageSize:  DefaultPageSize,
+		PageToken: query.Get("pageToken"),
+		OrderBy:   query.Get("order_by"),
+	}
+
+	if pageSize := query.Get("pageSize"); pageSize != "" {
+		size, err := strconv.Atoi(pageSize)
+		if err != nil || size <= 0 || size > MaxPageSize {
+			return opts, utils.APIErrInvalidParameter("pageSize", fmt.Sprintf("It should be a positive number up to %v", MaxPageSize))
+		}
+		opts.PageSize = size
+	}
+
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		opts.Descending = true
+	default:
+		return opts, utils.APIErrInvalidParameter("order", "It should be either asc or desc")
+	}
+
+	return opts, nil
+}
+
+// timeParam reads a time from the query of the request.
+// Times are given in zulu format, the same way they are stored, so that they can be compared
+func timeParam(r *http.Request, name string) (string, error) {
+
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return "", nil
+	}
+
+	if _, err := time.Parse(utils.ZULU_FORM, value); err != nil {
+		return "", utils.APIErrInvalidParameter(name, fmt.Sprintf("It should be a time in the format of %v", utils.ZULU_FORM))
+	}
+
+	return value, nil
+}
+
+// timeRange reads the start and the end of a time range from the query of the request
+func timeRange(r *http.Request, startParam string, endParam string) (string, string, error) {
+
+	start, err := timeParam(r, startParam)
+	if err != nil {
+		return "", "", err
+	}
+
+	end, err := timeParam(r, endParam)
+
+	return start, end, err
+}
+
+// serviceTypeParam resolves the service type, and the host, that a listing is filtered by.
+// The host is only checked against the service type when both of them are given
+func serviceTypeParam(r *http.Request, store stores.Store) (string, string, error) {
+
+	var ok bool
+
+	query := r.URL.Query()
+	host := query.Get("host")
+
+	if query.Get("service_type") == "" {
+		return "", host, nil
+	}
+
+	serviceType, err := servicetypes.FindServiceTypeByName(query.Get("service_type"), store)
+	if err != nil {
+		return "", "", err
+	}
+
+	if host != "" {
+		if host, ok = serviceType.CanonicalHost(host); !ok {
+			return "", "", utils.APIErrNotFound("Host")
+		}
+	}
+
+	return serviceType.UUID, host, nil
+}
+
+// bindingFilter reads the filters of a bindings listing from the query of the request, apart from the service type and the host
+func bindingFilter(r *http.Request) (stores.BindingFilter, error) {
+
+	var err error
+
+	query := r.URL.Query()
+
+	filter := stores.BindingFilter{
+		AuthType:       query.Get("auth_type"),
+		NamePrefix:     query.Get("name_prefix"),
+		AuthIdentifier: query.Get("auth_identifier"),
+	}
+
+	if filter.CreatedAfter, filter.CreatedBefore, err = timeRange(r, "created_after", "created_before"); err != nil {
+		return filter, err
+	}
+
+	filter.LastAuthAfter, filter.LastAuthBefore, err = timeRange(r, "last_auth_after", "last_auth_before")
+
+	return filter, err
+}
+
+// serviceTypeFilter reads the filters of a service types listing from the query of the request
+func serviceTypeFilter(r *http.Request) (stores.ServiceTypeFilter, error) {
+
+	var err error
+
+	query := r.URL.Query()
+
+	filter := stores.ServiceTypeFilter{
+		NamePrefix: query.Get("name_prefix"),
+		Type:       query.Get("type"),
+	}
+
+	filter.CreatedAfter, filter.CreatedBefore, err = timeRange(r, "created_after", "created_before")
+
+	return filter, err
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"net/http"
+	"strings"
+)
+
+// etag returns the entity tag of a resource at the given revision
+func etag(revision int64) string {
+	return fmt.Sprintf(`"%d"`, revision)
+}
+
+// revealedETag returns the entity tag of an auth method at the given revision with its secrets in clear text,
+// it differs from the one of the masked representation so that a cached copy of the one is never served as the other
+func revealedETag(revision int64) string {
+	return fmt.Sprintf(`"%d-revealed"`, revision)
+}
+
+// setETag declares the entity tag of the returned resource
+func setETag(w http.ResponseWriter, tag string) {
+	w.Header().Set("ETag", tag)
+}
+
+// matchesETag checks whether or not the comma separated entity tags of a conditional header match the given one.
+// Weak entity tags, e.g. W/"1", only match when the comparison is weak
+func matchesETag(header string, etag string, weak bool) bool {
+
+	for _, tag := range strings.Split(header, ",") {
+
+		tag = strings.TrimSpace(tag)
+
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkIfMatch returns an error when the If-Match header of the request doesn't match the revision of the resource,
+// which means that the resource has been modified since the client retrieved it. Requests without the header aren't checked.
+// Both the masked and the revealed representation of an auth method identify its revision
+func checkIfMatch(r *http.Request, resource string, revision int64) error {
+
+	header := r.Header.Get("If-Match")
+	if header == "" || matchesETag(header, etag(revision), false) || matchesETag(header, revealedETag(revision), false) {
+		return nil
+	}
+
+	return utils.APIErrPreconditionFailed(resource)
+}
+
+// notModified responds with 304 when the If-None-Match header of the request matches the entity tag of the resource,
+// in which case the client already has the current version of the resource
+func notModified(w http.ResponseWriter, r *http.Request, tag string) bool {
+
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !matchesETag(header, tag, true) {
+		return false
+	}
+
+	setETag(w, tag)
+	w.WriteHeader(http.StatusNotModified)
+
+	return true
+}
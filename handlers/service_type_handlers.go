@@ -62,20 +62,37 @@ func ServiceTypesListOne(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if notModified(w, r, etag(service.Revision)) {
+		return
+	}
+
 	// if everything went ok, return the service
+	setETag(w, etag(service.Revision))
 	utils.RespondOk(w, 200, service)
 }
 
 func ServiceTypeListAll(w http.ResponseWriter, r *http.Request) {
 
 	var err error
+	var opts stores.ListOptions
+	var filter stores.ServiceTypeFilter
 	var servList servicetypes.ServiceTypesList
 
 	//context references
 	store := context.Get(r, "stores").(stores.Store)
 
-	// find the service
-	if servList, err = servicetypes.FindAllServiceTypes(store); err != nil {
+	if filter, err = serviceTypeFilter(r); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	if opts, err = listOptions(r); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// find the page of service types
+	if servList, err = servicetypes.ListServiceTypes(filter, opts, store); err != nil {
 		utils.RespondError(w, err)
 		return
 	}
@@ -104,12 +121,22 @@ func ServiceTypeUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the service type might have been modified since the client retrieved it
+	if err = checkIfMatch(r, "Service type", originalSt.Revision); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
 	// first, fill the temporary binding with the fields of the original binding
 	if err := utils.CopyFields(originalSt, &tempST); err != nil {
 		err = utils.APIGenericInternalError(err.Error())
 		utils.RespondError(w, err)
 	}
 
+	// decoding reuses the memory of the slices, which still belongs to the original service type
+	tempST.Hosts = append([]string{}, originalSt.Hosts...)
+	tempST.AuthTypes = append([]string{}, originalSt.AuthTypes...)
+
 	// check the validity of the JSON and updated the provided fields
 	if err = json.NewDecoder(r.Body).Decode(&tempST); err != nil {
 		err := utils.APIErrBadRequest(err.Error())
@@ -117,15 +144,50 @@ func ServiceTypeUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if updatedSt, err = servicetypes.UpdateServiceType(originalSt, tempST, store, cfg); err != nil {
+	if updatedSt, err = servicetypes.UpdateServiceType(originalSt, tempST, cascadeDelete(r), store, cfg); err != nil {
 		utils.RespondError(w, err)
 		return
 	}
 
+	setETag(w, etag(updatedSt.Revision))
 	utils.RespondOk(w, 200, updatedSt)
 
 }
 
+// ServiceTypeRenameHost renames a host of a service type, along with the bindings and auth methods that reference it
+func ServiceTypeRenameHost(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+	var serviceType servicetypes.ServiceType
+	var rename servicetypes.HostRename
+
+	//context references
+	store := context.Get(r, "stores").(stores.Store)
+
+	// url vars
+	vars := mux.Vars(r)
+
+	if serviceType, err = servicetypes.FindServiceTypeByName(vars["service-type"], store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	// check the validity of the JSON
+	if err = json.NewDecoder(r.Body).Decode(&rename); err != nil {
+		err := utils.APIErrBadRequest(err.Error())
+		utils.RespondError(w, err)
+		return
+	}
+
+	if serviceType, err = servicetypes.RenameHost(serviceType, vars["host"], rename, store); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
+	setETag(w, etag(serviceType.Revision))
+	utils.RespondOk(w, 200, serviceType)
+}
+
 // ServiceTypeDelete deletes a service type
 func ServiceTypeDeleteOne(w http.ResponseWriter, r *http.Request) {
 
@@ -143,6 +205,12 @@ func ServiceTypeDeleteOne(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the service type might have been modified since the client retrieved it
+	if err = checkIfMatch(r, "Service type", serviceType.Revision); err != nil {
+		utils.RespondError(w, err)
+		return
+	}
+
 	if err = servicetypes.DeleteServiceType(serviceType, store); err != nil {
 		utils.RespondError(w, err)
 		return
@@ -150,3 +218,8 @@ func ServiceTypeDeleteOne(w http.ResponseWriter, r *http.Request) {
 
 	utils.RespondOk(w, 204, nil)
 }
+
+// cascadeDelete checks whether or not the request asks for the entities that depend on the removed ones to be deleted as well
+func cascadeDelete(r *http.Request) bool {
+	return r.URL.Query().Get("cascade") == "true"
+}
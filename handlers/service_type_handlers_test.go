@@ -553,6 +553,24 @@ func (suite *ServiceTypeHandlersSuite) TestServiceTypeListAll() {
 
 	expResJSON := `{
  "service_types": [
+  {
+   "name": "same_name",
+   "hosts": null,
+   "auth_types": null,
+   "auth_method": "",
+   "uuid": "",
+   "created_on": "",
+   "type": ""
+  },
+  {
+   "name": "same_name",
+   "hosts": null,
+   "auth_types": null,
+   "auth_method": "",
+   "uuid": "",
+   "created_on": "",
+   "type": ""
+  },
   {
    "name": "s1",
    "hosts": [
@@ -582,26 +600,9 @@ func (suite *ServiceTypeHandlersSuite) TestServiceTypeListAll() {
    "uuid": "uuid2",
    "created_on": "2018-05-05T18:04:05Z",
    "type": "web-api"
-  },
-  {
-   "name": "same_name",
-   "hosts": null,
-   "auth_types": null,
-   "auth_method": "",
-   "uuid": "",
-   "created_on": "",
-   "type": ""
-  },
-  {
-   "name": "same_name",
-   "hosts": null,
-   "auth_types": null,
-   "auth_method": "",
-   "uuid": "",
-   "created_on": "",
-   "type": ""
   }
- ]
+ ],
+ "totalSize": 4
 }`
 
 	req, err := http.NewRequest("GET", "http://localhost:8080/service-types", nil)
@@ -625,11 +626,56 @@ func (suite *ServiceTypeHandlersSuite) TestServiceTypeListAll() {
 
 }
 
+// TestServiceTypeListAllFiltered tests the case where the service types are filtered by their name and type, in reverse order of their names
+func (suite *ServiceTypeHandlersSuite) TestServiceTypeListAllFiltered() {
+
+	expResJSON := `{
+ "service_types": [
+  {
+   "name": "s2",
+   "hosts": [
+    "host3",
+    "host4"
+   ],
+   "auth_types": [
+    "x509"
+   ],
+   "auth_method": "headers",
+   "uuid": "uuid2",
+   "created_on": "2018-05-05T18:04:05Z",
+   "type": "web-api"
+  }
+ ],
+ "nextPageToken": "eyJvcmRlcl9ieSI6Im5hbWUiLCJkZXNjIjp0cnVlLCJ2YWx1ZSI6InMyIiwidXVpZCI6InV1aWQyIn0",
+ "totalSize": 2
+}`
+
+	req, err := http.NewRequest("GET", "http://localhost:8080/service-types?name_prefix=s&created_after=2018-05-05T00:00:00Z&order_by=name&order=desc&pageSize=1", nil)
+
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types", WrapConfig(ServiceTypeListAll, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(200, w.Code)
+	suite.Equal(expResJSON, w.Body.String())
+}
+
 // TestsServiceListAllEmptyList tests the case of an empty service types list
 func (suite *ServiceTypeHandlersSuite) TestServiceTypeListAllEmptyList() {
 
 	expResJSON := `{
- "service_types": []
+ "service_types": [],
+ "totalSize": 0
 }`
 
 	req, err := http.NewRequest("GET", "http://localhost:8080/service-types", nil)
@@ -676,7 +722,8 @@ func (suite *BindingHandlersSuite) TestServiceTypeUpdate() {
  "auth_method": "api-key",
  "uuid": "uuid1",
  "created_on": "2018-05-05T18:04:05Z",
- "type": "ams"
+ "type": "ams",
+ "revision": 1
 }`
 	req, err := http.NewRequest("PUT", "http://localhost:8080/service-types/s1", bytes.NewBuffer([]byte(postJSON)))
 	if err != nil {
@@ -928,6 +975,150 @@ func (suite *BindingHandlersSuite) TestServiceTypeUpdateNameAlreadyExists() {
 	suite.Equal(expRespJSON, w.Body.String())
 }
 
+// TestServiceTypeUpdateHostsInUse tests the case of removing hosts that are still referenced by bindings and auth methods
+func (suite *ServiceTypeHandlersSuite) TestServiceTypeUpdateHostsInUse() {
+
+	postJSON := `{
+	"hosts": ["host2", "host3"]
+}`
+
+	expRespJSON := `{
+ "error": {
+  "message": "Hosts are still in use: host1(bindings: [b1 b2], auth_methods: [api-key]). Delete them along with the hosts using cascade=true, or rename the hosts instead",
+  "code": 409,
+  "status": "CONFLICT"
+ }
+}`
+	req, err := http.NewRequest("PUT", "http://localhost:8080/service-types/s1", bytes.NewBuffer([]byte(postJSON)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types/{service-type}", WrapConfig(ServiceTypeUpdate, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(409, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
+// TestServiceTypeUpdateHostsCascade tests the case of removing hosts along with their bindings and auth methods
+func (suite *ServiceTypeHandlersSuite) TestServiceTypeUpdateHostsCascade() {
+
+	postJSON := `{
+	"hosts": ["host2", "host3"]
+}`
+
+	req, err := http.NewRequest("PUT", "http://localhost:8080/service-types/s1?cascade=true", bytes.NewBuffer([]byte(postJSON)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types/{service-type}", WrapConfig(ServiceTypeUpdate, mockstore, cfg))
+	router.ServeHTTP(w, req)
+
+	qBindings, _ := mockstore.QueryBindings("uuid1", "host1")
+	qams, _ := mockstore.QueryAuthMethods("", "uuid1", "host1")
+
+	suite.Equal(200, w.Code)
+	suite.Equal(0, len(qBindings))
+	suite.Equal(0, len(qams))
+}
+
+// TestServiceTypeRenameHost tests the normal case of renaming a host
+func (suite *ServiceTypeHandlersSuite) TestServiceTypeRenameHost() {
+
+	postJSON := `{
+	"host": "host5"
+}`
+
+	expRespJSON := `{
+ "name": "s1",
+ "hosts": [
+  "host5",
+  "host2",
+  "host3"
+ ],
+ "auth_types": [
+  "x509",
+  "oidc"
+ ],
+ "auth_method": "api-key",
+ "uuid": "uuid1",
+ "created_on": "2018-05-05T18:04:05Z",
+ "type": "ams",
+ "revision": 1
+}`
+	req, err := http.NewRequest("POST", "http://localhost:8080/service-types/s1/hosts/host1:rename", bytes.NewBuffer([]byte(postJSON)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types/{service-type}/hosts/{host}:rename", WrapConfig(ServiceTypeRenameHost, mockstore, cfg))
+	router.ServeHTTP(w, req)
+
+	qBindings, _ := mockstore.QueryBindings("uuid1", "host5")
+
+	suite.Equal(200, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+	suite.Equal(2, len(qBindings))
+}
+
+// TestServiceTypeRenameHostUnknownHost tests the case of renaming a host that doesn't belong to the service type
+func (suite *ServiceTypeHandlersSuite) TestServiceTypeRenameHostUnknownHost() {
+
+	postJSON := `{
+	"host": "host5"
+}`
+
+	expRespJSON := `{
+ "error": {
+  "message": "Host was not found",
+  "code": 404,
+  "status": "NOT FOUND"
+ }
+}`
+	req, err := http.NewRequest("POST", "http://localhost:8080/service-types/s1/hosts/unknown:rename", bytes.NewBuffer([]byte(postJSON)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types/{service-type}/hosts/{host}:rename", WrapConfig(ServiceTypeRenameHost, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(404, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
 // TestServiceTypeDeleteOe tests the normal case
 func (suite *ServiceTypeHandlersSuite) TestServiceTypeDeleteOne() {
 
@@ -950,6 +1141,90 @@ func (suite *ServiceTypeHandlersSuite) TestServiceTypeDeleteOne() {
 
 }
 
+// TestServiceTypeDeleteOneIfMatch tests the case of deleting a service type with any of its revisions
+func (suite *ServiceTypeHandlersSuite) TestServiceTypeDeleteOneIfMatch() {
+
+	req, err := http.NewRequest("DELETE", "http://localhost:8080/service-types/s1", nil)
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+	req.Header.Set("If-Match", "*")
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+	mockstore.ServiceTypes[0].Revision = 5
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types/{service-type}", WrapConfig(ServiceTypeDeleteOne, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(204, w.Code)
+}
+
+// TestServiceTypeUpdatePreconditionFailed tests the case of updating a service type that has been modified since the client retrieved it
+func (suite *ServiceTypeHandlersSuite) TestServiceTypeUpdatePreconditionFailed() {
+
+	postJSON := `{
+	"name": "updated_name"
+}`
+
+	expRespJSON := `{
+ "error": {
+  "message": "Service type has been modified since it was retrieved",
+  "code": 412,
+  "status": "PRECONDITION FAILED"
+ }
+}`
+
+	req, err := http.NewRequest("PUT", "http://localhost:8080/service-types/s1", bytes.NewBuffer([]byte(postJSON)))
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+	req.Header.Set("If-Match", `"1"`)
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+	mockstore.ServiceTypes[0].Revision = 2
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types/{service-type}", WrapConfig(ServiceTypeUpdate, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(412, w.Code)
+	suite.Equal(expRespJSON, w.Body.String())
+}
+
+// TestServiceTypeListOneModified tests the case of a conditional request for a service type that has been modified
+func (suite *ServiceTypeHandlersSuite) TestServiceTypeListOneModified() {
+
+	req, err := http.NewRequest("GET", "http://localhost:8080/service-types/s1", nil)
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+	req.Header.Set("If-None-Match", `"0"`)
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+	mockstore.ServiceTypes[0].Revision = 1
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/service-types/{service-type}", WrapConfig(ServiceTypesListOne, mockstore, cfg))
+	router.ServeHTTP(w, req)
+	suite.Equal(200, w.Code)
+	suite.Equal(`"1"`, w.Header().Get("ETag"))
+	suite.Contains(w.Body.String(), `"name": "s1"`)
+}
+
 // TestServiceTypeDeleteOneNotFound tests the case where the service doesn't exist
 func (suite *ServiceTypeHandlersSuite) TestServiceTypeDeleteOneNotFound() {
 
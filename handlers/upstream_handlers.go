@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	"github.com/ARGOeu/argo-api-authn/authmethods"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"net/http"
+)
+
+func UpstreamCircuitsListAll(w http.ResponseWriter, r *http.Request) {
+
+	// return the state of the circuits of all the upstream endpoints that have been reached so far
+	utils.RespondOk(w, 200, authmethods.Circuits.States())
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"github.com/ARGOeu/argo-api-authn/authmethods"
+	"github.com/ARGOeu/argo-api-authn/config"
+	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/gorilla/mux"
+	LOGGER "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/suite"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type UpstreamHandlersTestSuite struct {
+	suite.Suite
+}
+
+// TestUpstreamCircuitsListAll tests the default case of listing the circuits of the upstream endpoints
+func (suite *UpstreamHandlersTestSuite) TestUpstreamCircuitsListAll() {
+
+	req, err := http.NewRequest("GET", "http://localhost:8080/upstreams/circuits", nil)
+	if err != nil {
+		LOGGER.Error(err.Error())
+	}
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	authmethods.Circuits = authmethods.NewCircuitBreakerRegistry()
+	authmethods.Circuits.Failure("host1:9000", cfg)
+
+	router := mux.NewRouter().StrictSlash(true)
+	w := httptest.NewRecorder()
+	router.HandleFunc("/upstreams/circuits", WrapConfig(UpstreamCircuitsListAll, mockstore, cfg))
+	router.ServeHTTP(w, req)
+
+	suite.Equal(200, w.Code)
+	suite.Contains(w.Body.String(), `"endpoint": "host1:9000"`)
+	suite.Contains(w.Body.String(), `"state": "closed"`)
+	suite.Contains(w.Body.String(), `"consecutive_failures": 1`)
+}
+
+func TestUpstreamHandlersTestSuite(t *testing.T) {
+	suite.Run(t, new(UpstreamHandlersTestSuite))
+}
@@ -12,9 +12,11 @@ import (
 	"strconv"
 
 	"github.com/ARGOeu/argo-api-authn/auth"
+	"github.com/ARGOeu/argo-api-authn/bindings"
 	"github.com/ARGOeu/argo-api-authn/config"
 	"github.com/ARGOeu/argo-api-authn/routing"
 	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/ARGOeu/argo-api-authn/usage"
 	LOGGER "github.com/sirupsen/logrus"
 )
 
@@ -26,6 +28,7 @@ func main() {
 
 	// Retrieve configuration file location through cmd argument
 	var cfgPath = flag.String("config", "/etc/argo-api-authn/conf.d/argo-api-authn-config.json", "Path for the required configuration file.")
+	var reencryptSecrets = flag.Bool("reencrypt-secrets", false, "Encrypt the secrets of all stored auth methods with the current key and exit.")
 	flag.Parse()
 
 	// initialize the config
@@ -35,15 +38,55 @@ func main() {
 		panic(err.Error())
 	}
 
+	// load the keys that encrypt the secrets of the auth methods
+	keyring, err := stores.LoadKeyring(cfg.SecretsKeyFile)
+	if err != nil {
+		LOGGER.Error(err.Error())
+		panic(err.Error())
+	}
+	stores.Secrets = keyring
+
 	//configure datastore
-	store := &stores.MongoStore{
-		Server:   cfg.MongoHost,
-		Database: cfg.MongoDB,
+	var store stores.Store
+
+	switch cfg.StoreBackend {
+	case config.StoreBackendEmbedded:
+		store = &stores.EmbeddedStore{
+			Path: cfg.EmbeddedStorePath,
+		}
+	case config.StoreBackendPostgres:
+		store = &stores.PostgresStore{
+			DSN: cfg.PostgresDSN,
+		}
+	default:
+		store = &stores.MongoStore{
+			Server:   cfg.MongoHost,
+			Database: cfg.MongoDB,
+		}
 	}
 	store.SetUp()
 
 	defer store.Close()
 
+	if *reencryptSecrets {
+		updated, err := stores.ReencryptAuthMethodSecrets(store)
+		if err != nil {
+			LOGGER.Fatalf("Could not re-encrypt the secrets of the auth methods. %v", err.Error())
+		}
+		LOGGER.Infof("Re-encrypted the secrets of %v auth methods", updated)
+		return
+	}
+
+	// record the usage of the bindings in the background, flushing the pending authentications on shutdown
+	usage.Bindings = usage.FromConfig(store, cfg)
+	usage.Bindings.Start()
+	defer usage.Bindings.Stop()
+
+	// clean up the stale bindings periodically, when a cleanup action has been configured
+	cleaner := bindings.NewCleaner(store, cfg)
+	cleaner.Start()
+	defer cleaner.Stop()
+
 	// configure the TLS config for the server
 	tlsConfig := &tls.Config{
 		MinVersion: tls.VersionTLS10,
@@ -63,7 +106,7 @@ func main() {
 	}
 
 	//Start the server
-	err := server.ListenAndServeTLS(cfg.Certificate, cfg.CertificateKey)
+	err = server.ListenAndServeTLS(cfg.Certificate, cfg.CertificateKey)
 	if err != nil {
 		LOGGER.Fatal("API", "\t", "ListenAndServe:", err)
 	}
@@ -70,17 +70,32 @@ var ApiRoutes = []APIRoute{
 	{"serviceTypes:DeleteOne", "DELETE", "/service-types/{service-type}", handlers.ServiceTypeDeleteOne, true},
 	{"serviceTypes:ListOne", "PUT", "/service-types/{service-type}", handlers.ServiceTypeUpdate, true},
 	{"serviceType:ListAll", "GET", "/service-types", handlers.ServiceTypeListAll, true},
+	{"serviceTypes:RenameHost", "POST", "/service-types/{service-type}/hosts/{host}:rename", handlers.ServiceTypeRenameHost, true},
 	{"authMethod:Create", "POST", "/service-types/{service-type}/authm", handlers.AuthMethodCreate, true},
 	{"authMethod:ListOne", "GET", "/service-types/{service-type}/hosts/{host}/authm", handlers.AuthMethodListOne, true},
 	{"authMethod:Delete", "DELETE", "/service-types/{service-type}/hosts/{host}/authm", handlers.AuthMethodDeleteOne, true},
 	{"authMethod:Delete", "PUT", "/service-types/{service-type}/hosts/{host}/authm", handlers.AuthMethodUpdateOne, true},
+	{"authMethod:StageSecret", "POST", "/service-types/{service-type}/hosts/{host}/authm:stageSecret", handlers.AuthMethodStageSecret, true},
+	{"authMethod:SecretStatus", "GET", "/service-types/{service-type}/hosts/{host}/authm:secretStatus", handlers.AuthMethodSecretStatus, true},
+	{"authMethod:Test", "POST", "/service-types/{service-type}/hosts/{host}/authm:test", handlers.AuthMethodTestOne, true},
 	{"bindings:ListAllByServiceTypeAndHost", "GET", "/service-types/{service-type}/hosts/{host}/bindings", handlers.BindingListAllByServiceTypeAndHost, true},
 	{"bindings:ListOneByDN", "GET", "/service-types/{service-type}/hosts/{host}/bindings/{dn}", handlers.BindingListOneByAuthID, true},
 	{"authMethod:ListAll", "GET", "/authm", handlers.AuthMethodListAll, true},
 	{"bindings:create", "POST", "/bindings/{name}", handlers.BindingCreate, true},
 	{"bindings:ListAll", "GET", "/bindings", handlers.BindingListAll, true},
+	{"bindings:ListStale", "GET", "/bindings:stale", handlers.BindingListStale, true},
+	{"bindings:Cleanup", "POST", "/bindings:cleanup", handlers.BindingCleanup, true},
+	{"bindings:Import", "POST", "/bindings:import", handlers.BindingImport, true},
+	{"bindings:Export", "GET", "/bindings:export", handlers.BindingExport, true},
 	{"bindings:update", "PUT", "/bindings/{name}", handlers.BindingUpdate, true},
 	{"bindings:ListOneByName", "GET", "/bindings/{name}", handlers.BindingListOneByName, true},
 	{"bindings:delete", "DELETE", "/bindings/{name}", handlers.BindingDelete, true},
 	{"auth:dn", "GET", "/service-types/{service-type}/hosts/{host}:authx509", handlers.AuthViaCert, false},
+	// the {host} variable of the following routes would also match the host operations, e.g. {host}:authx509, so they are declared last
+	{"hosts:ListAll", "GET", "/service-types/{service-type}/hosts", handlers.HostListAll, true},
+	{"hosts:create", "POST", "/service-types/{service-type}/hosts/{host}", handlers.HostCreate, true},
+	{"hosts:ListOne", "GET", "/service-types/{service-type}/hosts/{host}", handlers.HostListOne, true},
+	{"hosts:update", "PUT", "/service-types/{service-type}/hosts/{host}", handlers.HostUpdate, true},
+	{"hosts:delete", "DELETE", "/service-types/{service-type}/hosts/{host}", handlers.HostDelete, true},
+	{"upstreams:ListCircuits", "GET", "/upstreams/circuits", handlers.UpstreamCircuitsListAll, true},
 }
@@ -0,0 +1,546 @@
+package servicetypes
+
+import (
+	"fmt"
+	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/ARGOeu/argo-api-authn/tokencache"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"strings"
+)
+
+// Host is a host of a service type along with its metadata
+type Host struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Enabled     bool     `json:"enabled"`
+	Aliases     []string `json:"aliases"`
+	CreatedOn   string   `json:"created_on,omitempty"`
+}
+
+// TempHost is a struct to be used as an intermediate node when creating or updating a host
+// containing only the `allowed to be updated fields`
+type TempHost struct {
+	Description string   `json:"description"`
+	Enabled     bool     `json:"enabled"`
+	Aliases     []string `json:"aliases"`
+}
+
+type HostsList struct {
+	Hosts []Host `json:"hosts"`
+}
+
+// HostRename holds the new name of a service type's host
+type HostRename struct {
+	Host string `json:"host" required:"true"`
+}
+
+// hostDependents holds the bindings and auth methods that reference a host of a service type
+type hostDependents struct {
+	host        string
+	bindings    []stores.QBinding
+	authMethods []stores.QAuthMethod
+}
+
+// findHostDependents returns the bindings and auth methods that reference the given host of the service type
+func findHostDependents(serviceUUID string, host string, store stores.Store) (hostDependents, error) {
+
+	var err error
+	var deps = hostDependents{host: host}
+
+	if deps.bindings, err = store.QueryBindings(serviceUUID, host); err != nil {
+		return deps, err
+	}
+
+	if deps.authMethods, err = store.QueryAuthMethods("", serviceUUID, host); err != nil {
+		return deps, err
+	}
+
+	return deps, err
+}
+
+func (deps hostDependents) isEmpty() bool {
+	return len(deps.bindings) == 0 && len(deps.authMethods) == 0
+}
+
+// String describes the dependents, e.g. host1(bindings: [b1 b2], auth_methods: [api-key])
+func (deps hostDependents) String() string {
+
+	var bNames []string
+	var amNames []string
+
+	for _, qb := range deps.bindings {
+		bNames = append(bNames, qb.Name)
+	}
+
+	// auth methods without a name are referred to by their type
+	for _, qam := range deps.authMethods {
+		name := qam.Basic().Name
+		if name == "" {
+			name = qam.Basic().Type
+		}
+		amNames = append(amNames, name)
+	}
+
+	return fmt.Sprintf("%v(bindings: %v, auth_methods: %v)", deps.host, bNames, amNames)
+}
+
+// delete deletes the bindings and auth methods of the host
+func (deps hostDependents) delete(store stores.Store) error {
+
+	for _, qb := range deps.bindings {
+		if err := store.DeleteBinding(qb); err != nil {
+			return err
+		}
+	}
+
+	for _, qam := range deps.authMethods {
+		if err := store.DeleteAuthMethod(qam); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// move moves the bindings and auth methods of the host to the given one
+func (deps hostDependents) move(host string, store stores.Store) error {
+
+	for _, qb := range deps.bindings {
+		moved := qb
+		moved.Host = host
+		moved.Revision++
+		if _, err := store.UpdateBinding(qb, moved); err != nil {
+			return err
+		}
+	}
+
+	for _, qam := range deps.authMethods {
+
+		// the query models are pointers, so the moved auth method has to be a copy of the stored one,
+		// which is still needed in order to select the auth method and to revert the move of a failed unit of work.
+		// Decrypting makes that copy, the secrets are encrypted again when the moved auth method is stored
+		original, err := stores.DecryptSecrets(qam)
+		if err != nil {
+			return utils.APIGenericInternalError(err.Error())
+		}
+
+		moved, err := stores.DecryptSecrets(qam)
+		if err != nil {
+			return utils.APIGenericInternalError(err.Error())
+		}
+
+		moved.Basic().Host = host
+		moved.Basic().Revision++
+
+		if _, err = store.UpdateAuthMethod(original, moved); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removedHosts returns the hosts of the original service type that the updated one doesn't contain
+func removedHosts(original ServiceType, updated ServiceType) []string {
+
+	var removed []string
+
+	for _, h := range original.Hosts {
+		if !updated.hasHostName(h) {
+			removed = append(removed, h)
+		}
+	}
+
+	return removed
+}
+
+// releaseHosts checks the bindings and auth methods that reference the hosts which are removed from the service type.
+// Unless cascade is set, the hosts can't be removed while they are referenced, otherwise their dependents are deleted
+func releaseHosts(serviceUUID string, hosts []string, cascade bool, store stores.Store) error {
+
+	var inUse []string
+
+	for _, h := range hosts {
+
+		deps, err := findHostDependents(serviceUUID, h, store)
+		if err != nil {
+			return err
+		}
+
+		if deps.isEmpty() {
+			continue
+		}
+
+		if !cascade {
+			inUse = append(inUse, deps.String())
+			continue
+		}
+
+		if err = deps.delete(store); err != nil {
+			return err
+		}
+	}
+
+	if len(inUse) > 0 {
+		return utils.APIErrInUse("Hosts", strings.Join(inUse, ", "),
+			"Delete them along with the hosts using cascade=true, or rename the hosts instead")
+	}
+
+	return nil
+}
+
+// CanonicalHost returns the name of the service type's host that the given host or alias refers to
+func (s *ServiceType) CanonicalHost(host string) (string, bool) {
+
+	for _, h := range s.Hosts {
+		if h == host {
+			return h, true
+		}
+	}
+
+	for _, details := range s.HostDetails {
+		for _, alias := range details.Aliases {
+			if alias == host && s.hasHostName(details.Name) {
+				return details.Name, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// hasHostName returns whether or not the given name is one of the service type's hosts, without looking at their aliases
+func (s *ServiceType) hasHostName(name string) bool {
+
+	for _, h := range s.Hosts {
+		if h == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HostEnabled returns whether or not the given host accepts authentication requests, hosts are enabled unless stated otherwise
+func (s *ServiceType) HostEnabled(host string) bool {
+
+	if details, ok := s.hostDetails(host); ok {
+		return details.Enabled
+	}
+
+	return true
+}
+
+// hostDetails returns the metadata of the given host, if any
+func (s *ServiceType) hostDetails(host string) (stores.QHost, bool) {
+
+	for _, details := range s.HostDetails {
+		if details.Name == host {
+			return details, true
+		}
+	}
+
+	return stores.QHost{}, false
+}
+
+// hasValidHosts checks that every alias is unique and doesn't collide with the names of the hosts
+func (s *ServiceType) hasValidHosts() error {
+
+	var names = make(map[string]bool)
+
+	for _, h := range s.Hosts {
+		names[h] = true
+	}
+
+	for _, details := range s.HostDetails {
+		for _, alias := range details.Aliases {
+
+			if alias == "" {
+				return utils.APIErrInvalidFieldContent("aliases", "Aliases can't be empty")
+			}
+
+			if names[alias] {
+				return utils.APIErrConflict("host", "alias", alias)
+			}
+
+			names[alias] = true
+		}
+	}
+
+	return nil
+}
+
+// dropRemovedHostDetails discards the metadata of the hosts that no longer belong to the service type
+func (s *ServiceType) dropRemovedHostDetails() {
+
+	var kept []stores.QHost
+
+	for _, details := range s.HostDetails {
+		if s.hasHostName(details.Name) {
+			kept = append(kept, details)
+		}
+	}
+
+	s.HostDetails = kept
+}
+
+// copyServiceType returns a copy of the service type that can be modified without affecting the original
+func copyServiceType(serviceType ServiceType) ServiceType {
+
+	var cp = serviceType
+
+	cp.Hosts = append([]string{}, serviceType.Hosts...)
+	cp.AuthTypes = append([]string{}, serviceType.AuthTypes...)
+	cp.HostDetails = nil
+
+	for _, details := range serviceType.HostDetails {
+		details.Aliases = append([]string(nil), details.Aliases...)
+		cp.HostDetails = append(cp.HostDetails, details)
+	}
+
+	return cp
+}
+
+// saveServiceType replaces the original service type with the updated one in the store, as its next revision,
+// and returns the saved service type
+func saveServiceType(original ServiceType, updated ServiceType, store stores.Store) (ServiceType, error) {
+
+	var qOriginalSt stores.QServiceType
+	var qUpdatedSt stores.QServiceType
+
+	updated.Revision = original.Revision + 1
+
+	if err := utils.CopyFields(original, &qOriginalSt); err != nil {
+		return ServiceType{}, utils.APIGenericInternalError(err.Error())
+	}
+
+	if err := utils.CopyFields(updated, &qUpdatedSt); err != nil {
+		return ServiceType{}, utils.APIGenericInternalError(err.Error())
+	}
+
+	if _, err := store.UpdateServiceType(qOriginalSt, qUpdatedSt); err != nil {
+		return ServiceType{}, err
+	}
+
+	return updated, nil
+}
+
+// FindHost returns the host of the service type that the given host or alias refers to
+func FindHost(serviceType ServiceType, host string) (Host, error) {
+
+	var ok bool
+
+	if host, ok = serviceType.CanonicalHost(host); !ok {
+		return Host{}, utils.APIErrNotFound("Host")
+	}
+
+	result := Host{Name: host, Enabled: true, Aliases: []string{}}
+
+	if details, ok := serviceType.hostDetails(host); ok {
+		if err := utils.CopyFields(details, &result); err != nil {
+			return Host{}, utils.APIGenericInternalError(err.Error())
+		}
+		result.Aliases = append([]string{}, details.Aliases...)
+	}
+
+	return result, nil
+}
+
+// FindAllHosts returns all the hosts of the service type
+func FindAllHosts(serviceType ServiceType) (HostsList, error) {
+
+	var hosts = []Host{}
+
+	for _, h := range serviceType.Hosts {
+
+		host, err := FindHost(serviceType, h)
+		if err != nil {
+			return HostsList{Hosts: []Host{}}, err
+		}
+
+		hosts = append(hosts, host)
+	}
+
+	return HostsList{Hosts: hosts}, nil
+}
+
+// CreateHost adds a new host to the service type
+func CreateHost(serviceType ServiceType, host string, tempHost TempHost, store stores.Store) (Host, error) {
+
+	if serviceType.HasHost(host) {
+		return Host{}, utils.APIErrConflict("host", "name", host)
+	}
+
+	updated := copyServiceType(serviceType)
+	updated.Hosts = append(updated.Hosts, host)
+	updated.HostDetails = append(updated.HostDetails, stores.QHost{
+		Name:        host,
+		Description: tempHost.Description,
+		Enabled:     tempHost.Enabled,
+		Aliases:     tempHost.Aliases,
+		CreatedOn:   utils.ZuluTimeNow(),
+	})
+
+	if err := updated.hasValidHosts(); err != nil {
+		return Host{}, err
+	}
+
+	if _, err := saveServiceType(serviceType, updated, store); err != nil {
+		return Host{}, err
+	}
+
+	tokencache.Tokens.InvalidateServiceType(serviceType.UUID)
+
+	return FindHost(updated, host)
+}
+
+// UpdateHost updates the metadata of the host that the given host or alias refers to
+func UpdateHost(serviceType ServiceType, host string, tempHost TempHost, store stores.Store) (Host, error) {
+
+	var ok bool
+	var found bool
+
+	if host, ok = serviceType.CanonicalHost(host); !ok {
+		return Host{}, utils.APIErrNotFound("Host")
+	}
+
+	updated := copyServiceType(serviceType)
+
+	for idx, details := range updated.HostDetails {
+		if details.Name == host {
+			updated.HostDetails[idx].Description = tempHost.Description
+			updated.HostDetails[idx].Enabled = tempHost.Enabled
+			updated.HostDetails[idx].Aliases = tempHost.Aliases
+			found = true
+		}
+	}
+
+	// hosts that have been declared through the service type don't have any metadata yet
+	if !found {
+		updated.HostDetails = append(updated.HostDetails, stores.QHost{
+			Name:        host,
+			Description: tempHost.Description,
+			Enabled:     tempHost.Enabled,
+			Aliases:     tempHost.Aliases,
+		})
+	}
+
+	if err := updated.hasValidHosts(); err != nil {
+		return Host{}, err
+	}
+
+	if _, err := saveServiceType(serviceType, updated, store); err != nil {
+		return Host{}, err
+	}
+
+	// the aliases or the enabled flag of the host might have changed
+	tokencache.Tokens.InvalidateServiceType(serviceType.UUID)
+
+	return FindHost(updated, host)
+}
+
+// DeleteHost removes the host that the given host or alias refers to from the service type.
+// A host that is still referenced by bindings or auth methods can only be removed when cascade is set,
+// in which case its bindings and auth methods are deleted as well
+func DeleteHost(serviceType ServiceType, host string, cascade bool, store stores.Store) error {
+
+	var ok bool
+
+	if host, ok = serviceType.CanonicalHost(host); !ok {
+		return utils.APIErrNotFound("Host")
+	}
+
+	// a service type has at least one host
+	if len(serviceType.Hosts) == 1 {
+		return utils.APIErrEmptyRequiredField("service-type", utils.GenericEmptyRequiredField("hosts").Error())
+	}
+
+	updated := copyServiceType(serviceType)
+	updated.Hosts = nil
+	for _, h := range serviceType.Hosts {
+		if h != host {
+			updated.Hosts = append(updated.Hosts, h)
+		}
+	}
+	updated.dropRemovedHostDetails()
+
+	// the host is removed along with its bindings and auth methods, or not at all
+	err := store.RunInTransaction(func(tx stores.Store) error {
+
+		if err := releaseHosts(serviceType.UUID, []string{host}, cascade, tx); err != nil {
+			return err
+		}
+
+		_, err := saveServiceType(serviceType, updated, tx)
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	tokencache.Tokens.InvalidateServiceType(serviceType.UUID)
+
+	return nil
+}
+
+// RenameHost renames the host that the given host or alias refers to,
+// the bindings and auth methods of the host follow it to its new name
+func RenameHost(serviceType ServiceType, host string, rename HostRename, store stores.Store) (ServiceType, error) {
+
+	var err error
+	var ok bool
+
+	// check if all required field have been provided
+	if err = utils.ValidateRequired(rename); err != nil {
+		err = utils.APIErrEmptyRequiredField("host", err.Error())
+		return ServiceType{}, err
+	}
+
+	if host, ok = serviceType.CanonicalHost(host); !ok {
+		err = utils.APIErrNotFound("Host")
+		return ServiceType{}, err
+	}
+
+	if serviceType.HasHost(rename.Host) {
+		err = utils.APIErrConflict("host", "name", rename.Host)
+		return ServiceType{}, err
+	}
+
+	// the host keeps its position in the service type's hosts, as well as its metadata
+	updated := copyServiceType(serviceType)
+	for idx, h := range updated.Hosts {
+		if h == host {
+			updated.Hosts[idx] = rename.Host
+		}
+	}
+
+	for idx, details := range updated.HostDetails {
+		if details.Name == host {
+			updated.HostDetails[idx].Name = rename.Host
+		}
+	}
+
+	// the host is renamed along with its bindings and auth methods, or not at all
+	err = store.RunInTransaction(func(tx stores.Store) error {
+
+		deps, err := findHostDependents(serviceType.UUID, host, tx)
+		if err != nil {
+			return err
+		}
+
+		if updated, err = saveServiceType(serviceType, updated, tx); err != nil {
+			return err
+		}
+
+		return deps.move(rename.Host, tx)
+	})
+
+	if err != nil {
+		return ServiceType{}, err
+	}
+
+	tokencache.Tokens.InvalidateServiceType(serviceType.UUID)
+
+	return updated, err
+}
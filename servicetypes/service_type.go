@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/ARGOeu/argo-api-authn/config"
 	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/ARGOeu/argo-api-authn/tokencache"
 	"github.com/ARGOeu/argo-api-authn/utils"
 	uuid2 "github.com/satori/go.uuid"
 )
@@ -16,6 +17,10 @@ type ServiceType struct {
 	UUID       string   `json:"uuid"`
 	CreatedOn  string   `json:"created_on"`
 	Type       string   `json:"type" required:"true"`
+	// HostDetails holds the metadata of the hosts, such as their aliases, that is managed through the hosts of the service type
+	HostDetails []stores.QHost `json:"host_details,omitempty"`
+	// Revision is incremented on every update of the service type, it is also returned as the service type's ETag
+	Revision int64 `json:"revision,omitempty"`
 }
 
 // TempServiceType is a struct to be used as an intermediate node when updating a service type
@@ -29,6 +34,10 @@ type TempServiceType struct {
 
 type ServiceTypesList struct {
 	ServiceTypes []ServiceType `json:"service_types"`
+	// NextPageToken is the token of the next page of a paginated listing, it is empty on the last page
+	NextPageToken string `json:"nextPageToken,omitempty"`
+	// TotalSize is the number of all the service types that the listing matches
+	TotalSize int `json:"totalSize"`
 }
 
 // CreateServiceType creates a new service type after validating the service
@@ -95,6 +104,11 @@ func (s *ServiceType) Validate(store stores.Store, cfg config.Config) error {
 		return err
 	}
 
+	// check that the aliases of the hosts are unique
+	if err = s.hasValidHosts(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -194,22 +208,39 @@ func FindAllServiceTypes(store stores.Store) (ServiceTypesList, error) {
 		services = append(services, *_service)
 	}
 
-	return ServiceTypesList{ServiceTypes: services}, err
+	return ServiceTypesList{ServiceTypes: services, TotalSize: len(services)}, err
 
 }
 
-// hsHost returns whether or not a host is associated with a service type
-func (s *ServiceType) HasHost(host string) bool {
+// ListServiceTypes returns a page of the service types that match the filter, in the order of the options
+func ListServiceTypes(filter stores.ServiceTypeFilter, opts stores.ListOptions, store stores.Store) (ServiceTypesList, error) {
 
-	flag := false
-	for _, h := range s.Hosts {
-		if h == host {
-			flag = true
-			break
+	var err error
+	var qPage stores.QServiceTypesPage
+	var services = []ServiceType{}
+
+	if qPage, err = store.ListServiceTypes(filter, opts); err != nil {
+		return ServiceTypesList{ServiceTypes: services}, err
+	}
+
+	for _, qs := range qPage.ServiceTypes {
+		_service := &ServiceType{}
+		if err := utils.CopyFields(qs, _service); err != nil {
+			err = utils.APIGenericInternalError(err.Error())
+			return ServiceTypesList{ServiceTypes: []ServiceType{}}, err
 		}
+		services = append(services, *_service)
 	}
 
-	return flag
+	return ServiceTypesList{ServiceTypes: services, NextPageToken: qPage.NextPageToken, TotalSize: qPage.TotalSize}, err
+}
+
+// hsHost returns whether or not a host, or an alias of a host, is associated with a service type
+func (s *ServiceType) HasHost(host string) bool {
+
+	_, ok := s.CanonicalHost(host)
+
+	return ok
 }
 
 // hasValidAuthTypes checks whether or not the authentication types of a service type are supported
@@ -289,8 +320,10 @@ func (s *ServiceType) IsOfValidType(cfg config.Config) error {
 	return err
 }
 
-//UpdateServiceType updates a binding after validating its fields
-func UpdateServiceType(original ServiceType, tempServiceType TempServiceType, store stores.Store, cfg config.Config) (ServiceType, error) {
+// UpdateServiceType updates a service type after validating its fields.
+// Hosts that are still referenced by bindings or auth methods can only be removed when cascade is set,
+// in which case their bindings and auth methods are deleted as well
+func UpdateServiceType(original ServiceType, tempServiceType TempServiceType, cascade bool, store stores.Store, cfg config.Config) (ServiceType, error) {
 
 	var err error
 	var updated ServiceType
@@ -308,58 +341,84 @@ func UpdateServiceType(original ServiceType, tempServiceType TempServiceType, st
 		return ServiceType{}, err
 	}
 
+	// the hosts might have been replaced, their metadata follows them
+	updated = copyServiceType(updated)
+	updated.dropRemovedHostDetails()
+
 	// validate the updated service type
 	if err = updated.Validate(store, cfg); err != nil {
 		return updated, err
 	}
 
-	// if there is an update happening to the name field, check if its unique
-	if original.Name != tempServiceType.Name {
-		if err = ExistsWithName(tempServiceType.Name, store); err != nil {
-			return ServiceType{}, err
-		}
-	}
-
 	// convert the original service type to a QServiceType
 	if err := utils.CopyFields(original, &qOriginalSt); err != nil {
 		err = utils.APIGenericInternalError(err.Error())
 		return ServiceType{}, err
 	}
 
+	updated.Revision = original.Revision + 1
+
 	// convert the updated service type to a QServiceType
 	if err := utils.CopyFields(updated, &qUpdatedSt); err != nil {
 		err = utils.APIGenericInternalError(err.Error())
 		return ServiceType{}, err
 	}
 
-	// update the service type
-	if _, err = store.UpdateServiceType(qOriginalSt, qUpdatedSt); err != nil {
-		err = &utils.APIError{Status: "INTERNAL SERVER ERROR", Code: 500, Message: err.Error()}
+	// the uniqueness check and the update run as a unit of work,
+	// which also covers the changes that follow the service type's hosts
+	err = store.RunInTransaction(func(tx stores.Store) error {
+
+		// if there is an update happening to the name field, check if its unique
+		if original.Name != tempServiceType.Name {
+			if err := ExistsWithName(tempServiceType.Name, tx); err != nil {
+				return err
+			}
+		}
+
+		// check the dependents of the hosts that are removed
+		if err := releaseHosts(original.UUID, removedHosts(original, updated), cascade, tx); err != nil {
+			return err
+		}
+
+		_, err := tx.UpdateServiceType(qOriginalSt, qUpdatedSt)
+		return err
+	})
+
+	if err != nil {
 		return ServiceType{}, err
 	}
 
+	// the cached auth resources might have been retrieved using the service type's old type or hosts
+	tokencache.Tokens.InvalidateServiceType(original.UUID)
+
 	return updated, err
 }
 
 // DeleteServiceType deletes a service from the datastore as well as all of the other entities that are associated with it
 func DeleteServiceType(serviceType ServiceType, store stores.Store) error {
 
-	var err error
+	// the service type is deleted along with its bindings and auth methods, or not at all
+	err := store.RunInTransaction(func(tx stores.Store) error {
 
-	// first delete all the bindings associated with the service type
-	if err = store.DeleteBindingByServiceUUID(serviceType.UUID); err != nil {
-		return err
-	}
+		// first delete all the bindings associated with the service type
+		if err := tx.DeleteBindingByServiceUUID(serviceType.UUID); err != nil {
+			return err
+		}
 
-	// delete all the auth methods associated with the service type
-	if err = store.DeleteAuthMethodByServiceUUID(serviceType.UUID); err != nil {
-		return err
-	}
+		// delete all the auth methods associated with the service type
+		if err := tx.DeleteAuthMethodByServiceUUID(serviceType.UUID); err != nil {
+			return err
+		}
 
-	// finally delete the service type
-	if err = store.DeleteServiceTypeByUUID(serviceType.UUID); err != nil {
+		// finally delete the service type
+		return tx.DeleteServiceTypeByUUID(serviceType.UUID)
+	})
+
+	if err != nil {
 		return err
 	}
 
+	tokencache.Tokens.InvalidateServiceType(serviceType.UUID)
+
 	return err
 }
@@ -1,9 +1,12 @@
 package servicetypes
 
 import (
+	"encoding/base64"
 	"github.com/ARGOeu/argo-api-authn/config"
 	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/ARGOeu/argo-api-authn/utils"
 	"github.com/stretchr/testify/suite"
+	"strings"
 	"testing"
 )
 
@@ -20,55 +23,55 @@ func (suite *ServiceTestSuite) TestCreateServiceType() {
 	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
 
 	// test the normal case with type ams
-	s1 := ServiceType{"sCr", []string{"host1", "host2"}, []string{"x509", "oidc"}, "api-key", "uuid1", "", "ams"}
+	s1 := ServiceType{Name: "sCr", Hosts: []string{"host1", "host2"}, AuthTypes: []string{"x509", "oidc"}, AuthMethod: "api-key", UUID: "uuid1", CreatedOn: "", Type: "ams"}
 	_, err := CreateServiceType(s1, mockstore, *cfg)
 	res1, _ := mockstore.QueryServiceTypes("sCr")
 
 	// test the normal case with type web-api
 
-	sWb := ServiceType{"sCr_wb", []string{"host1", "host2"}, []string{"x509", "oidc"}, "api-key", "uuid1", "", "web-api"}
+	sWb := ServiceType{Name: "sCr_wb", Hosts: []string{"host1", "host2"}, AuthTypes: []string{"x509", "oidc"}, AuthMethod: "api-key", UUID: "uuid1", CreatedOn: "", Type: "web-api"}
 	_, errWb := CreateServiceType(sWb, mockstore, *cfg)
 	res2, _ := mockstore.QueryServiceTypes("sCr_wb")
 
 	// test the normal case with type custom
-	sCustom := ServiceType{"sCr_custom", []string{"host1", "host2"}, []string{"x509", "oidc"}, "api-key", "uuid1", "token", "custom"}
+	sCustom := ServiceType{Name: "sCr_custom", Hosts: []string{"host1", "host2"}, AuthTypes: []string{"x509", "oidc"}, AuthMethod: "api-key", UUID: "uuid1", CreatedOn: "token", Type: "custom"}
 	_, errCustom := CreateServiceType(sCustom, mockstore, *cfg)
 	res3, _ := mockstore.QueryServiceTypes("sCr_custom")
 
 	// test the case where the name already exists
-	s2 := ServiceType{"s1", []string{"host1", "host2"}, []string{"x509", "oidc"}, "api-key", "some_uuid", "", "ams"}
+	s2 := ServiceType{Name: "s1", Hosts: []string{"host1", "host2"}, AuthTypes: []string{"x509", "oidc"}, AuthMethod: "api-key", UUID: "some_uuid", CreatedOn: "", Type: "ams"}
 	_, err2 := CreateServiceType(s2, mockstore, *cfg)
 
 	// test the case of unsupported auth type
-	s3 := ServiceType{"sCr", []string{"host1", "host2"}, []string{"unsup_type", "oidc"}, "api-key", "some_uuid", "", "ams"}
+	s3 := ServiceType{Name: "sCr", Hosts: []string{"host1", "host2"}, AuthTypes: []string{"unsup_type", "oidc"}, AuthMethod: "api-key", UUID: "some_uuid", CreatedOn: "", Type: "ams"}
 	_, err3 := CreateServiceType(s3, mockstore, *cfg)
 
 	// test the case of empty auth type list
-	s4 := ServiceType{"sCr", []string{"host1", "host2"}, []string{}, "api-key", "some_uuid", "", "ams"}
+	s4 := ServiceType{Name: "sCr", Hosts: []string{"host1", "host2"}, AuthTypes: []string{}, AuthMethod: "api-key", UUID: "some_uuid", CreatedOn: "", Type: "ams"}
 	_, err4 := CreateServiceType(s4, mockstore, *cfg)
 
 	// test the case of unsupported auth method
-	s5 := ServiceType{"sCr", []string{"host1", "host2"}, []string{"x509", "oidc"}, "unsup_method", "some_uuid", "", "ams"}
+	s5 := ServiceType{Name: "sCr", Hosts: []string{"host1", "host2"}, AuthTypes: []string{"x509", "oidc"}, AuthMethod: "unsup_method", UUID: "some_uuid", CreatedOn: "", Type: "ams"}
 	_, err5 := CreateServiceType(s5, mockstore, *cfg)
 
 	// test the case of empty name
-	s6 := ServiceType{"", []string{"host1", "host2"}, []string{"x509", "oidc"}, "api-key", "uuid1", "", "ams"}
+	s6 := ServiceType{Name: "", Hosts: []string{"host1", "host2"}, AuthTypes: []string{"x509", "oidc"}, AuthMethod: "api-key", UUID: "uuid1", CreatedOn: "", Type: "ams"}
 	_, err6 := CreateServiceType(s6, mockstore, *cfg)
 
 	// test the case of empty auth method
-	s8 := ServiceType{"sCr", []string{"host1", "host2"}, []string{"x509", "oidc"}, "", "uuid1", "", "ams"}
+	s8 := ServiceType{Name: "sCr", Hosts: []string{"host1", "host2"}, AuthTypes: []string{"x509", "oidc"}, AuthMethod: "", UUID: "uuid1", CreatedOn: "", Type: "ams"}
 	_, err8 := CreateServiceType(s8, mockstore, *cfg)
 
 	// test the case of empty hosts
-	s9 := ServiceType{"sCr", []string{}, []string{"x509", "oidc"}, "api-key", "uuid1", "", "ams"}
+	s9 := ServiceType{Name: "sCr", Hosts: []string{}, AuthTypes: []string{"x509", "oidc"}, AuthMethod: "api-key", UUID: "uuid1", CreatedOn: "", Type: "ams"}
 	_, err9 := CreateServiceType(s9, mockstore, *cfg)
 
 	// test the case of empty type
-	s10 := ServiceType{"sCr", []string{"host1", "host2"}, []string{"x509", "oidc"}, "api-key", "uuid1", "", ""}
+	s10 := ServiceType{Name: "sCr", Hosts: []string{"host1", "host2"}, AuthTypes: []string{"x509", "oidc"}, AuthMethod: "api-key", UUID: "uuid1", CreatedOn: "", Type: ""}
 	_, err10 := CreateServiceType(s10, mockstore, *cfg)
 
 	// test the case of unsupported type type
-	s11 := ServiceType{"sCr", []string{"host1", "host2"}, []string{"x509", "oidc"}, "api-key", "uuid1", "", "unsup_type"}
+	s11 := ServiceType{Name: "sCr", Hosts: []string{"host1", "host2"}, AuthTypes: []string{"x509", "oidc"}, AuthMethod: "api-key", UUID: "uuid1", CreatedOn: "", Type: "unsup_type"}
 	_, err11 := CreateServiceType(s11, mockstore, *cfg)
 
 	suite.Equal(s1.Name, res1[0].Name)
@@ -107,7 +110,7 @@ func (suite *ServiceTestSuite) TestFindServiceTypeByName() {
 	mockstore.SetUp()
 
 	// normal case
-	expS1 := ServiceType{"s1", []string{"host1", "host2", "host3"}, []string{"x509", "oidc"}, "api-key", "uuid1", "2018-05-05T18:04:05Z", "ams"}
+	expS1 := ServiceType{Name: "s1", Hosts: []string{"host1", "host2", "host3"}, AuthTypes: []string{"x509", "oidc"}, AuthMethod: "api-key", UUID: "uuid1", CreatedOn: "2018-05-05T18:04:05Z", Type: "ams"}
 	ser1, err1 := FindServiceTypeByName("s1", mockstore)
 
 	// not found case
@@ -133,7 +136,7 @@ func (suite *ServiceTestSuite) TestFindServiceTypeByUUID() {
 	mockstore.SetUp()
 
 	// normal case
-	expS1 := ServiceType{"s1", []string{"host1", "host2", "host3"}, []string{"x509", "oidc"}, "api-key", "uuid1", "2018-05-05T18:04:05Z", "ams"}
+	expS1 := ServiceType{Name: "s1", Hosts: []string{"host1", "host2", "host3"}, AuthTypes: []string{"x509", "oidc"}, AuthMethod: "api-key", UUID: "uuid1", CreatedOn: "2018-05-05T18:04:05Z", Type: "ams"}
 	ser1, err1 := FindServiceTypeByUUID("uuid1", mockstore)
 
 	// not found case
@@ -168,7 +171,7 @@ func (suite *ServiceTestSuite) TestFindAllServiceTypes() {
 		{Name: "same_name"},
 		{Name: "same_name"},
 	}
-	expServList := ServiceTypesList{expQServicesAll}
+	expServList := ServiceTypesList{ServiceTypes: expQServicesAll, TotalSize: 4}
 	serAll1, err1 := FindAllServiceTypes(mockstore)
 
 	// normal case outcome - empty list
@@ -183,6 +186,40 @@ func (suite *ServiceTestSuite) TestFindAllServiceTypes() {
 	suite.Nil(err2)
 }
 
+func (suite *ServiceTestSuite) TestListServiceTypes() {
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	expS1 := ServiceType{Name: "s1", Hosts: []string{"host1", "host2", "host3"}, AuthTypes: []string{"x509", "oidc"}, AuthMethod: "api-key", UUID: "uuid1", CreatedOn: "2018-05-05T18:04:05Z", Type: "ams"}
+	expS2 := ServiceType{Name: "s2", Hosts: []string{"host3", "host4"}, AuthTypes: []string{"x509"}, AuthMethod: "headers", UUID: "uuid2", CreatedOn: "2018-05-05T18:04:05Z", Type: "web-api"}
+
+	// the first page of the service types whose name starts with s, sorted by their name
+	list1, err1 := ListServiceTypes(stores.ServiceTypeFilter{NamePrefix: "s"}, stores.ListOptions{PageSize: 2, OrderBy: "name"}, mockstore)
+
+	// the rest of them
+	list2, err2 := ListServiceTypes(stores.ServiceTypeFilter{NamePrefix: "s"}, stores.ListOptions{PageSize: 2, OrderBy: "name", PageToken: list1.NextPageToken}, mockstore)
+
+	// filtered by their type
+	list3, err3 := ListServiceTypes(stores.ServiceTypeFilter{Type: "web-api"}, stores.ListOptions{}, mockstore)
+
+	// unsupported order
+	_, err4 := ListServiceTypes(stores.ServiceTypeFilter{}, stores.ListOptions{OrderBy: "type"}, mockstore)
+
+	suite.Equal([]ServiceType{expS1, expS2}, list1.ServiceTypes)
+	suite.NotEqual("", list1.NextPageToken)
+	suite.Equal(4, list1.TotalSize)
+	suite.Equal(2, len(list2.ServiceTypes))
+	suite.Equal("same_name", list2.ServiceTypes[0].Name)
+	suite.Equal("", list2.NextPageToken)
+	suite.Equal(ServiceTypesList{ServiceTypes: []ServiceType{expS2}, TotalSize: 1}, list3)
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Equal("order_by: type is not yet supported.Supported:[created_on name]", err4.Error())
+}
+
 func (suite *ServiceTestSuite) TestServiceTypeHasHost() {
 
 	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
@@ -218,42 +255,42 @@ func (suite *ServiceTestSuite) TestUpdateService() {
 	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
 
 	// original service type
-	qOriginal := stores.QServiceType{"sCr", []string{"host1", "host2"}, []string{"x509", "oidc"}, "api-key", "uuid1", "", "ams"}
-	original := ServiceType{"sCr", []string{"host1", "host2"}, []string{"x509", "oidc"}, "api-key", "uuid1", "", "ams"}
+	qOriginal := stores.QServiceType{Name: "sCr", Hosts: []string{"host1", "host2"}, AuthTypes: []string{"x509", "oidc"}, AuthMethod: "api-key", UUID: "uuid1", CreatedOn: "", Type: "ams"}
+	original := ServiceType{Name: "sCr", Hosts: []string{"host1", "host2"}, AuthTypes: []string{"x509", "oidc"}, AuthMethod: "api-key", UUID: "uuid1", CreatedOn: "", Type: "ams"}
 	mockstore.ServiceTypes = append(mockstore.ServiceTypes, qOriginal)
 
 	// test the normal case
 	s1 := TempServiceType{"sCr_upd", []string{"host1", "host2"}, []string{"x509", "oidc"}, "api-key"}
-	_, err := UpdateServiceType(original, s1, mockstore, *cfg)
+	_, err := UpdateServiceType(original, s1, false, mockstore, *cfg)
 	res1, _ := mockstore.QueryServiceTypes("sCr_upd")
 
 	// test the case where the name already exists
 	s2 := TempServiceType{"s1", []string{"host1", "host2"}, []string{"x509", "oidc"}, "api-key"}
-	_, err2 := UpdateServiceType(original, s2, mockstore, *cfg)
+	_, err2 := UpdateServiceType(original, s2, false, mockstore, *cfg)
 
 	// test the case of unsupported auth type
 	s3 := TempServiceType{"sCr", []string{"host1", "host2"}, []string{"x509", "unsup_type"}, "api-key"}
-	_, err3 := UpdateServiceType(original, s3, mockstore, *cfg)
+	_, err3 := UpdateServiceType(original, s3, false, mockstore, *cfg)
 
 	// test the case of empty auth type list
 	s4 := TempServiceType{"sCr", []string{"host1", "host2"}, []string{}, "api-key"}
-	_, err4 := UpdateServiceType(original, s4, mockstore, *cfg)
+	_, err4 := UpdateServiceType(original, s4, false, mockstore, *cfg)
 
 	// test the case of unsupported auth method
 	s5 := TempServiceType{"sCr", []string{"host1", "host2"}, []string{"x509", "oidc"}, "unsup_method"}
-	_, err5 := UpdateServiceType(original, s5, mockstore, *cfg)
+	_, err5 := UpdateServiceType(original, s5, false, mockstore, *cfg)
 
 	// test the case of empty name
 	s6 := TempServiceType{"", []string{"host1", "host2"}, []string{"x509", "oidc"}, "api-key"}
-	_, err6 := UpdateServiceType(original, s6, mockstore, *cfg)
+	_, err6 := UpdateServiceType(original, s6, false, mockstore, *cfg)
 
 	// test the case of empty auth method
 	s8 := TempServiceType{"sCr", []string{"host1", "host2"}, []string{"x509", "oidc"}, ""}
-	_, err8 := UpdateServiceType(original, s8, mockstore, *cfg)
+	_, err8 := UpdateServiceType(original, s8, false, mockstore, *cfg)
 
 	// test the case of empty hosts
 	s9 := TempServiceType{"sCr", []string{}, []string{"x509", "oidc"}, "api-key"}
-	_, err9 := UpdateServiceType(original, s9, mockstore, *cfg)
+	_, err9 := UpdateServiceType(original, s9, false, mockstore, *cfg)
 
 	suite.Equal(s1.Name, res1[0].Name)
 	suite.Equal(s1.Hosts, res1[0].Hosts)
@@ -290,6 +327,370 @@ func (suite *ServiceTestSuite) TestDeleteServiceType() {
 	suite.Nil(err1)
 }
 
+func (suite *ServiceTestSuite) TestDeleteServiceTypeRollback() {
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	// the bindings and auth methods of the service type are deleted but the service type itself can't be
+	mockstore.ServiceTypes = mockstore.ServiceTypes[1:]
+	err1 := DeleteServiceType(ServiceType{UUID: "uuid1"}, mockstore)
+
+	// the deleted bindings and auth methods are restored
+	qBindings, _ := mockstore.QueryBindings("uuid1", "host1")
+	qams, _ := mockstore.QueryAuthMethods("", "uuid1", "host1")
+
+	suite.Equal("Database Error: not found", err1.Error())
+	suite.Equal(4, len(mockstore.Bindings))
+	suite.Equal(2, len(qBindings))
+	suite.Equal(2, len(mockstore.AuthMethods))
+	suite.Equal("am_uuid_1", qams[0].Basic().UUID)
+}
+
+func (suite *ServiceTestSuite) TestUpdateServiceTypeRemovedHosts() {
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	original, _ := FindServiceTypeByUUID("uuid1", mockstore)
+
+	// test the case of removing a host that isn't referenced
+	s1 := TempServiceType{"s1", []string{"host1", "host2"}, []string{"x509", "oidc"}, "api-key"}
+	updated1, err1 := UpdateServiceType(original, s1, false, mockstore, *cfg)
+
+	// test the case of removing hosts that are still referenced by bindings and auth methods
+	s2 := TempServiceType{"s1", []string{"host5"}, []string{"x509", "oidc"}, "api-key"}
+	_, err2 := UpdateServiceType(updated1, s2, false, mockstore, *cfg)
+	res2, _ := FindServiceTypeByUUID("uuid1", mockstore)
+	bindings2, _ := mockstore.QueryBindings("uuid1", "host1")
+
+	// test the case of removing the hosts along with their bindings and auth methods
+	updated3, err3 := UpdateServiceType(updated1, s2, true, mockstore, *cfg)
+	res3, _ := FindServiceTypeByUUID("uuid1", mockstore)
+	bindings3a, _ := mockstore.QueryBindings("uuid1", "host1")
+	bindings3b, _ := mockstore.QueryBindings("uuid1", "host2")
+	ams3, _ := mockstore.QueryAuthMethods("", "uuid1", "host1")
+
+	suite.Nil(err1)
+	suite.Equal([]string{"host1", "host2"}, updated1.Hosts)
+
+	suite.Equal("Hosts are still in use: host1(bindings: [b1 b2], auth_methods: [api-key]), host2(bindings: [b3], auth_methods: []). "+
+		"Delete them along with the hosts using cascade=true, or rename the hosts instead", err2.Error())
+	suite.Equal([]string{"host1", "host2"}, res2.Hosts)
+	suite.Equal(2, len(bindings2))
+
+	suite.Nil(err3)
+	suite.Equal([]string{"host5"}, updated3.Hosts)
+	suite.Equal([]string{"host5"}, res3.Hosts)
+	suite.Equal(0, len(bindings3a))
+	suite.Equal(0, len(bindings3b))
+	suite.Equal(0, len(ams3))
+
+	// the bindings and auth methods of the other service types are kept
+	suite.Equal(1, len(mockstore.Bindings))
+	suite.Equal(1, len(mockstore.AuthMethods))
+}
+
+func (suite *ServiceTestSuite) TestRenameHost() {
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	original, _ := FindServiceTypeByUUID("uuid1", mockstore)
+
+	// test the normal case
+	updated1, err1 := RenameHost(original, "host1", HostRename{Host: "host5"}, mockstore)
+	res1, _ := FindServiceTypeByUUID("uuid1", mockstore)
+	bindings1a, _ := mockstore.QueryBindings("uuid1", "host1")
+	bindings1b, _ := mockstore.QueryBindings("uuid1", "host5")
+	ams1, _ := mockstore.QueryAuthMethods("", "uuid1", "host5")
+
+	// test the case of an unknown host
+	_, err2 := RenameHost(updated1, "host1", HostRename{Host: "host6"}, mockstore)
+
+	// test the case of renaming into a host that already exists
+	_, err3 := RenameHost(updated1, "host5", HostRename{Host: "host2"}, mockstore)
+
+	// test the case of an empty host
+	_, err4 := RenameHost(updated1, "host5", HostRename{}, mockstore)
+
+	suite.Nil(err1)
+	suite.Equal([]string{"host5", "host2", "host3"}, updated1.Hosts)
+	suite.Equal([]string{"host5", "host2", "host3"}, res1.Hosts)
+	suite.Equal(0, len(bindings1a))
+	suite.Equal(2, len(bindings1b))
+	suite.Equal("b1", bindings1b[0].Name)
+	suite.Equal("b2", bindings1b[1].Name)
+	suite.Equal(1, len(ams1))
+	suite.Equal("am_uuid_1", ams1[0].Basic().UUID)
+
+	suite.Equal("Host was not found", err2.Error())
+	suite.Equal("host object with name: host2 already exists", err3.Error())
+	suite.Equal("host object contains empty fields. empty value for field: host", err4.Error())
+}
+
+// hostsTestStore returns a mock store, where the first host of the service type s1 has an alias and the second one is disabled
+func hostsTestStore() *stores.Mockstore {
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	mockstore.ServiceTypes[0].HostDetails = []stores.QHost{
+		{Name: "host1", Description: "load balanced", Enabled: true, Aliases: []string{"host1-lb"}, CreatedOn: "2018-05-05T18:04:05Z"},
+		{Name: "host2", Enabled: false},
+	}
+
+	return mockstore
+}
+
+func (suite *ServiceTestSuite) TestCanonicalHost() {
+
+	ser, _ := FindServiceTypeByUUID("uuid1", hostsTestStore())
+
+	host1, ok1 := ser.CanonicalHost("host1")
+	host2, ok2 := ser.CanonicalHost("host1-lb")
+	_, ok3 := ser.CanonicalHost("unknown")
+
+	// aliases of hosts that don't belong to the service type are ignored
+	ser.Hosts = []string{"host2", "host3"}
+	_, ok4 := ser.CanonicalHost("host1-lb")
+
+	suite.Equal("host1", host1)
+	suite.True(ok1)
+	suite.Equal("host1", host2)
+	suite.True(ok2)
+	suite.False(ok3)
+	suite.False(ok4)
+	suite.True(ser.HasHost("host3"))
+	suite.False(ser.HasHost("host1-lb"))
+	suite.False(ser.HostEnabled("host2"))
+	suite.True(ser.HostEnabled("host3"))
+}
+
+func (suite *ServiceTestSuite) TestFindHosts() {
+
+	ser, _ := FindServiceTypeByUUID("uuid1", hostsTestStore())
+
+	hosts1, err1 := FindAllHosts(ser)
+	host2, err2 := FindHost(ser, "host1-lb")
+	_, err3 := FindHost(ser, "unknown")
+
+	expHosts1 := HostsList{Hosts: []Host{
+		{Name: "host1", Description: "load balanced", Enabled: true, Aliases: []string{"host1-lb"}, CreatedOn: "2018-05-05T18:04:05Z"},
+		{Name: "host2", Enabled: false, Aliases: []string{}},
+		{Name: "host3", Enabled: true, Aliases: []string{}},
+	}}
+
+	suite.Nil(err1)
+	suite.Equal(expHosts1, hosts1)
+	suite.Nil(err2)
+	suite.Equal(expHosts1.Hosts[0], host2)
+	suite.Equal("Host was not found", err3.Error())
+}
+
+func (suite *ServiceTestSuite) TestCreateHost() {
+
+	mockstore := hostsTestStore()
+	ser, _ := FindServiceTypeByUUID("uuid1", mockstore)
+
+	// test the normal case
+	host1, err1 := CreateHost(ser, "host4", TempHost{Description: "new", Enabled: true, Aliases: []string{"host4-lb"}}, mockstore)
+	res1, _ := FindServiceTypeByUUID("uuid1", mockstore)
+
+	// test the case of a host that already exists
+	_, err2 := CreateHost(res1, "host4", TempHost{Enabled: true}, mockstore)
+
+	// test the case of a host that is already an alias
+	_, err3 := CreateHost(res1, "host1-lb", TempHost{Enabled: true}, mockstore)
+
+	// test the case of an alias that is already a host
+	_, err4 := CreateHost(res1, "host5", TempHost{Enabled: true, Aliases: []string{"host2"}}, mockstore)
+
+	// test the case of an empty alias
+	_, err5 := CreateHost(res1, "host5", TempHost{Enabled: true, Aliases: []string{""}}, mockstore)
+
+	suite.Nil(err1)
+	suite.Equal("host4", host1.Name)
+	suite.Equal("new", host1.Description)
+	suite.Equal([]string{"host4-lb"}, host1.Aliases)
+	suite.True(host1.Enabled)
+	suite.NotEmpty(host1.CreatedOn)
+	suite.Equal([]string{"host1", "host2", "host3", "host4"}, res1.Hosts)
+	suite.True(res1.HasHost("host4-lb"))
+
+	suite.Equal("host object with name: host4 already exists", err2.Error())
+	suite.Equal("host object with name: host1-lb already exists", err3.Error())
+	suite.Equal("host object with alias: host2 already exists", err4.Error())
+	suite.Equal("Field: aliases contains invalid data. Aliases can't be empty", err5.Error())
+}
+
+func (suite *ServiceTestSuite) TestUpdateHost() {
+
+	mockstore := hostsTestStore()
+	ser, _ := FindServiceTypeByUUID("uuid1", mockstore)
+
+	// test the normal case, using an alias of the host
+	host1, err1 := UpdateHost(ser, "host1-lb", TempHost{Description: "updated", Enabled: false, Aliases: []string{"host1-alt"}}, mockstore)
+	res1, _ := FindServiceTypeByUUID("uuid1", mockstore)
+
+	// test the case of a host without any metadata
+	host2, err2 := UpdateHost(res1, "host3", TempHost{Enabled: true, Aliases: []string{"host3-lb"}}, mockstore)
+	res2, _ := FindServiceTypeByUUID("uuid1", mockstore)
+
+	// test the case of an alias that is already used by another host
+	_, err3 := UpdateHost(res2, "host2", TempHost{Enabled: true, Aliases: []string{"host3-lb"}}, mockstore)
+
+	// test the case of an unknown host
+	_, err4 := UpdateHost(res2, "unknown", TempHost{Enabled: true}, mockstore)
+
+	suite.Nil(err1)
+	suite.Equal(Host{Name: "host1", Description: "updated", Enabled: false, Aliases: []string{"host1-alt"}, CreatedOn: "2018-05-05T18:04:05Z"}, host1)
+	suite.False(res1.HasHost("host1-lb"))
+	suite.True(res1.HasHost("host1-alt"))
+	suite.False(res1.HostEnabled("host1"))
+
+	suite.Nil(err2)
+	suite.Equal(Host{Name: "host3", Enabled: true, Aliases: []string{"host3-lb"}}, host2)
+	suite.Equal(3, len(res2.HostDetails))
+
+	suite.Equal("host object with alias: host3-lb already exists", err3.Error())
+	suite.Equal("Host was not found", err4.Error())
+}
+
+func (suite *ServiceTestSuite) TestDeleteHost() {
+
+	mockstore := hostsTestStore()
+	ser, _ := FindServiceTypeByUUID("uuid1", mockstore)
+
+	// test the case of a host that is still referenced by bindings and auth methods
+	err1 := DeleteHost(ser, "host1-lb", false, mockstore)
+
+	// test the normal case
+	err2 := DeleteHost(ser, "host3", false, mockstore)
+	res2, _ := FindServiceTypeByUUID("uuid1", mockstore)
+
+	// test the case of deleting a host along with its bindings and auth methods
+	err3 := DeleteHost(res2, "host1-lb", true, mockstore)
+	res3, _ := FindServiceTypeByUUID("uuid1", mockstore)
+	qBindings3, _ := mockstore.QueryBindings("uuid1", "host1")
+
+	// test the case of an unknown host
+	err4 := DeleteHost(res3, "host1", false, mockstore)
+
+	// test the case of the last host of the service type
+	s2, _ := FindServiceTypeByUUID("uuid2", mockstore)
+	s2.Hosts = s2.Hosts[:1]
+	err5 := DeleteHost(s2, "host3", true, mockstore)
+
+	suite.Equal("Hosts are still in use: host1(bindings: [b1 b2], auth_methods: [api-key]). "+
+		"Delete them along with the hosts using cascade=true, or rename the hosts instead", err1.Error())
+
+	suite.Nil(err2)
+	suite.Equal([]string{"host1", "host2"}, res2.Hosts)
+
+	suite.Nil(err3)
+	suite.Equal([]string{"host2"}, res3.Hosts)
+	suite.Equal([]stores.QHost{{Name: "host2", Enabled: false}}, res3.HostDetails)
+	suite.Equal(0, len(qBindings3))
+
+	suite.Equal("Host was not found", err4.Error())
+	suite.Equal("service-type object contains empty fields. empty value for field: hosts", err5.Error())
+}
+
+func (suite *ServiceTestSuite) TestDeleteHostEncryptedSecrets() {
+
+	stores.Secrets, _ = stores.ParseKeyring("v1:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32))))
+	defer func() { stores.Secrets = nil }()
+
+	mockstore := hostsTestStore()
+	_, _ = stores.ReencryptAuthMethodSecrets(mockstore)
+	ser, _ := FindServiceTypeByUUID("uuid1", mockstore)
+
+	// the auth methods of the host are deleted in their stored form, with their secrets encrypted
+	err1 := DeleteHost(ser, "host1", true, mockstore)
+	qAms1, _ := mockstore.QueryAuthMethods("", "uuid1", "host1")
+
+	suite.Nil(err1)
+	suite.Equal(0, len(qAms1))
+}
+
+func (suite *ServiceTestSuite) TestRenameHostDetails() {
+
+	mockstore := hostsTestStore()
+	ser, _ := FindServiceTypeByUUID("uuid1", mockstore)
+
+	// test the case of renaming a host using its alias, its metadata follows it
+	updated1, err1 := RenameHost(ser, "host1-lb", HostRename{Host: "host5"}, mockstore)
+	qBindings1, _ := mockstore.QueryBindings("uuid1", "host5")
+
+	// test the case of renaming into an alias of another host
+	_, err2 := RenameHost(updated1, "host2", HostRename{Host: "host1-lb"}, mockstore)
+
+	suite.Nil(err1)
+	suite.Equal([]string{"host5", "host2", "host3"}, updated1.Hosts)
+	suite.Equal("host5", updated1.HostDetails[0].Name)
+	suite.True(updated1.HasHost("host1-lb"))
+	suite.Equal(2, len(qBindings1))
+	suite.Equal("host object with name: host1-lb already exists", err2.Error())
+}
+
+func (suite *ServiceTestSuite) TestUpdateServiceTypeHostDetails() {
+
+	mockstore := hostsTestStore()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	original, _ := FindServiceTypeByUUID("uuid1", mockstore)
+
+	// test the case of removing a host with metadata
+	s1 := TempServiceType{"s1", []string{"host1", "host3"}, []string{"x509", "oidc"}, "api-key"}
+	updated1, err1 := UpdateServiceType(original, s1, true, mockstore, *cfg)
+
+	// test the case of adding a host that is already an alias
+	s2 := TempServiceType{"s1", []string{"host1", "host3", "host1-lb"}, []string{"x509", "oidc"}, "api-key"}
+	_, err2 := UpdateServiceType(updated1, s2, false, mockstore, *cfg)
+
+	suite.Nil(err1)
+	suite.Equal(1, len(updated1.HostDetails))
+	suite.Equal("host1", updated1.HostDetails[0].Name)
+	suite.Equal("host object with alias: host1-lb already exists", err2.Error())
+}
+
+func (suite *ServiceTestSuite) TestUpdateServiceTypeRevision() {
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	cfg := &config.Config{}
+	_ = cfg.ConfigSetUp("../config/configuration-test-files/test-conf.json")
+
+	original, _ := FindServiceTypeByUUID("uuid1", mockstore)
+
+	// test the normal case, the service type moves to its next revision
+	s1 := TempServiceType{"s1_upd", []string{"host1", "host2", "host3"}, []string{"x509", "oidc"}, "api-key"}
+	updated1, err1 := UpdateServiceType(original, s1, false, mockstore, *cfg)
+
+	// test the case of updating the original service type, which has been modified in the meantime
+	s2 := TempServiceType{"s1_stale", []string{"host1", "host2", "host3"}, []string{"x509", "oidc"}, "api-key"}
+	_, err2 := UpdateServiceType(original, s2, false, mockstore, *cfg)
+
+	// test the case of renaming a host, which modifies the service type as well
+	updated3, err3 := RenameHost(updated1, "host3", HostRename{Host: "host5"}, mockstore)
+
+	res, _ := FindServiceTypeByUUID("uuid1", mockstore)
+
+	suite.Nil(err1)
+	suite.Equal(int64(1), updated1.Revision)
+	suite.Equal(utils.APIErrPreconditionFailed("Service type"), err2)
+	suite.Nil(err3)
+	suite.Equal(int64(2), updated3.Revision)
+	suite.Equal(updated3, res)
+}
+
 func TestServiceTestSuite(t *testing.T) {
 	suite.Run(t, new(ServiceTestSuite))
 }
@@ -0,0 +1,262 @@
+package stores
+
+import (
+	LOGGER "github.com/sirupsen/logrus"
+)
+
+// compensatingStore emulates a unit of work on stores that can't run multi-document transactions.
+// Every change is applied to the underlying store right away, while the change that reverts it is recorded,
+// and if the unit of work fails the recorded changes are applied in reverse order.
+// Other requests may observe the intermediate states of the unit of work
+type compensatingStore struct {
+	Store
+	undo []func() error
+}
+
+// runCompensated runs the given function as a unit of work on the given store, reverting its changes if it fails
+func runCompensated(store Store, fn func(tx Store) error) error {
+
+	tx := &compensatingStore{Store: store}
+
+	err := fn(tx)
+	if err != nil {
+		tx.rollback()
+	}
+
+	return err
+}
+
+// rollback reverts the recorded changes, a change that can't be reverted is logged and the rest are still reverted
+func (tx *compensatingStore) rollback() {
+
+	for idx := len(tx.undo) - 1; idx >= 0; idx-- {
+		if err := tx.undo[idx](); err != nil {
+			LOGGER.Error("STORE", "\t", "Could not revert a change of a failed unit of work: ", err.Error())
+		}
+	}
+
+	tx.undo = nil
+}
+
+func (tx *compensatingStore) record(undo func() error) {
+	tx.undo = append(tx.undo, undo)
+}
+
+// Clone returns the unit of work itself, its changes are reverted through the same store
+func (tx *compensatingStore) Clone() Store {
+	return tx
+}
+
+// Close leaves the underlying store open, it belongs to the caller of the unit of work
+func (tx *compensatingStore) Close() {}
+
+func (tx *compensatingStore) RunInTransaction(fn func(tx Store) error) error {
+	return fn(tx)
+}
+
+// restoreServiceType inserts a deleted service type again, along with the metadata of its hosts
+func (tx *compensatingStore) restoreServiceType(qs QServiceType) error {
+
+	inserted, err := tx.Store.InsertServiceType(qs.Name, qs.Hosts, qs.AuthTypes, qs.AuthMethod, qs.UUID, qs.CreatedOn, qs.Type)
+	if err != nil || qs.HostDetails == nil {
+		return err
+	}
+
+	_, err = tx.Store.UpdateServiceType(inserted, qs)
+
+	return err
+}
+
+// restoreBinding inserts a deleted binding again, along with the fields that are set by the store on insert and its usage
+func (tx *compensatingStore) restoreBinding(qb QBinding) error {
+
+	inserted, err := tx.Store.InsertBinding(qb.Name, qb.ServiceUUID, qb.Host, qb.UUID, qb.AuthIdentifier, qb.UniqueKey, qb.AuthType, qb.AuthMethod)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Store.UpdateBinding(inserted, qb); err != nil {
+		return err
+	}
+
+	if qb.AuthCount == 0 && qb.LastAuth == "" {
+		return nil
+	}
+
+	return tx.Store.RecordBindingUsage([]QBindingUsage{{UUID: qb.UUID, Count: qb.AuthCount, LastAuth: qb.LastAuth, ClientIP: qb.LastClientIP}})
+}
+
+func (tx *compensatingStore) InsertServiceType(name string, hosts []string, authTypes []string, authMethod string, uuid string, createdOn string, sType string) (QServiceType, error) {
+
+	qService, err := tx.Store.InsertServiceType(name, hosts, authTypes, authMethod, uuid, createdOn, sType)
+	if err == nil {
+		tx.record(func() error { return tx.Store.DeleteServiceTypeByUUID(uuid) })
+	}
+
+	return qService, err
+}
+
+func (tx *compensatingStore) UpdateServiceType(original QServiceType, updated QServiceType) (QServiceType, error) {
+
+	qService, err := tx.Store.UpdateServiceType(original, updated)
+	if err == nil {
+		tx.record(func() error {
+			_, err := tx.Store.UpdateServiceType(qService, original)
+			return err
+		})
+	}
+
+	return qService, err
+}
+
+func (tx *compensatingStore) DeleteServiceTypeByUUID(uuid string) error {
+
+	qServices, err := tx.Store.QueryServiceTypesByUUID(uuid)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Store.DeleteServiceTypeByUUID(uuid); err == nil && len(qServices) > 0 {
+		qs := qServices[0]
+		tx.record(func() error { return tx.restoreServiceType(qs) })
+	}
+
+	return err
+}
+
+func (tx *compensatingStore) InsertBinding(name string, serviceUUID string, host string, uuid string, authID string, uniqueKey string, authType string, authMethod string) (QBinding, error) {
+
+	qBinding, err := tx.Store.InsertBinding(name, serviceUUID, host, uuid, authID, uniqueKey, authType, authMethod)
+	if err == nil {
+		tx.record(func() error { return tx.Store.DeleteBinding(qBinding) })
+	}
+
+	return qBinding, err
+}
+
+func (tx *compensatingStore) UpdateBinding(original QBinding, updated QBinding) (QBinding, error) {
+
+	qBinding, err := tx.Store.UpdateBinding(original, updated)
+	if err == nil {
+		tx.record(func() error {
+			_, err := tx.Store.UpdateBinding(qBinding, original)
+			return err
+		})
+	}
+
+	return qBinding, err
+}
+
+func (tx *compensatingStore) DeleteBinding(qBinding QBinding) error {
+
+	err := tx.Store.DeleteBinding(qBinding)
+	if err == nil {
+		tx.record(func() error { return tx.restoreBinding(qBinding) })
+	}
+
+	return err
+}
+
+func (tx *compensatingStore) DeleteBindingByServiceUUID(serviceUUID string) error {
+
+	var deleted []QBinding
+
+	qBindings, err := tx.Store.QueryBindings("", "")
+	if err != nil {
+		return err
+	}
+
+	for _, qb := range qBindings {
+		if qb.ServiceUUID == serviceUUID {
+			deleted = append(deleted, qb)
+		}
+	}
+
+	if err = tx.Store.DeleteBindingByServiceUUID(serviceUUID); err == nil {
+		tx.record(func() error {
+			for _, qb := range deleted {
+				if err := tx.restoreBinding(qb); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	return err
+}
+
+func (tx *compensatingStore) InsertAuthMethod(am QAuthMethod) error {
+
+	err := tx.Store.InsertAuthMethod(am)
+	if err == nil {
+		tx.record(func() error { return tx.Store.DeleteAuthMethod(am) })
+	}
+
+	return err
+}
+
+func (tx *compensatingStore) UpdateAuthMethod(original QAuthMethod, updated QAuthMethod) (QAuthMethod, error) {
+
+	qam, err := tx.Store.UpdateAuthMethod(original, updated)
+	if err == nil {
+		tx.record(func() error {
+			_, err := tx.Store.UpdateAuthMethod(updated, original)
+			return err
+		})
+	}
+
+	return qam, err
+}
+
+func (tx *compensatingStore) DeleteAuthMethod(am QAuthMethod) error {
+
+	// the stored form of the auth method, with its secrets encrypted, is kept in order to be inserted again
+	stored := am
+
+	qams, err := tx.Store.QueryAuthMethods(am.Basic().Type, am.Basic().ServiceUUID, am.Basic().Host)
+	if err != nil {
+		return err
+	}
+
+	for _, qam := range qams {
+		if uuid := am.Basic().UUID; uuid != "" && qam.Basic().UUID == uuid {
+			stored = qam
+		}
+	}
+
+	if err = tx.Store.DeleteAuthMethod(am); err == nil {
+		tx.record(func() error { return tx.Store.InsertAuthMethod(stored) })
+	}
+
+	return err
+}
+
+func (tx *compensatingStore) DeleteAuthMethodByServiceUUID(serviceUUID string) error {
+
+	var deleted []QAuthMethod
+
+	qams, err := tx.Store.QueryAuthMethods("", "", "")
+	if err != nil {
+		return err
+	}
+
+	for _, qam := range qams {
+		if qam.Basic().ServiceUUID == serviceUUID {
+			deleted = append(deleted, qam)
+		}
+	}
+
+	if err = tx.Store.DeleteAuthMethodByServiceUUID(serviceUUID); err == nil {
+		tx.record(func() error {
+			for _, qam := range deleted {
+				if err := tx.Store.InsertAuthMethod(qam); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	return err
+}
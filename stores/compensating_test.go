@@ -0,0 +1,120 @@
+package stores
+
+import (
+	"errors"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"github.com/stretchr/testify/suite"
+	"testing"
+)
+
+// faultyStore fails the listed operations of the underlying store, the way a store that loses its connection would
+type faultyStore struct {
+	Store
+	failing map[string]bool
+}
+
+func (f *faultyStore) fault(operation string) error {
+
+	if f.failing[operation] {
+		return utils.APIErrDatabase("connection lost")
+	}
+
+	return nil
+}
+
+func (f *faultyStore) InsertBinding(name string, serviceUUID string, host string, uuid string, authID string, uniqueKey string, authType string, authMethod string) (QBinding, error) {
+
+	if err := f.fault("InsertBinding"); err != nil {
+		return QBinding{}, err
+	}
+
+	return f.Store.InsertBinding(name, serviceUUID, host, uuid, authID, uniqueKey, authType, authMethod)
+}
+
+func (f *faultyStore) DeleteAuthMethodByServiceUUID(serviceUUID string) error {
+
+	if err := f.fault("DeleteAuthMethodByServiceUUID"); err != nil {
+		return err
+	}
+
+	return f.Store.DeleteAuthMethodByServiceUUID(serviceUUID)
+}
+
+type CompensatingTestSuite struct {
+	suite.Suite
+	mockstore *Mockstore
+}
+
+func (suite *CompensatingTestSuite) SetupTest() {
+
+	suite.mockstore = &Mockstore{Server: "localhost", Database: "test_db"}
+	suite.mockstore.SetUp()
+}
+
+// deleteServiceType is the cascading delete of a service type, along with its bindings and auth methods
+func deleteServiceType(tx Store) error {
+
+	if err := tx.DeleteBindingByServiceUUID("uuid1"); err != nil {
+		return err
+	}
+
+	if err := tx.DeleteAuthMethodByServiceUUID("uuid1"); err != nil {
+		return err
+	}
+
+	return tx.DeleteServiceTypeByUUID("uuid1")
+}
+
+func (suite *CompensatingTestSuite) TestFailedOperation() {
+
+	bindings, _ := suite.mockstore.QueryBindings("", "")
+	authMethods, _ := suite.mockstore.QueryAuthMethods("", "", "")
+	serviceTypes, _ := suite.mockstore.QueryServiceTypes("")
+
+	// the store fails partway through the cascade, after the bindings have been deleted
+	store := &faultyStore{Store: suite.mockstore, failing: map[string]bool{"DeleteAuthMethodByServiceUUID": true}}
+	err1 := runCompensated(store, deleteServiceType)
+
+	bindings1, _ := suite.mockstore.QueryBindings("", "")
+	authMethods1, _ := suite.mockstore.QueryAuthMethods("", "", "")
+	serviceTypes1, _ := suite.mockstore.QueryServiceTypes("")
+
+	suite.Equal(utils.APIErrDatabase("connection lost"), err1)
+	suite.ElementsMatch(bindings, bindings1)
+	suite.Equal(authMethods, authMethods1)
+	suite.Equal(serviceTypes, serviceTypes1)
+}
+
+func (suite *CompensatingTestSuite) TestFailedRevert() {
+
+	failure := errors.New("failure")
+
+	authMethods, _ := suite.mockstore.QueryAuthMethods("", "", "")
+	serviceTypes, _ := suite.mockstore.QueryServiceTypes("")
+
+	// the deleted bindings can't be inserted again, the rest of the changes are still reverted
+	store := &faultyStore{Store: suite.mockstore, failing: map[string]bool{"InsertBinding": true}}
+	err1 := runCompensated(store, func(tx Store) error {
+
+		if err := deleteServiceType(tx); err != nil {
+			return err
+		}
+
+		return failure
+	})
+
+	bindings1, _ := suite.mockstore.QueryBindings("", "")
+	authMethods1, _ := suite.mockstore.QueryAuthMethods("", "", "")
+	serviceTypes1, _ := suite.mockstore.QueryServiceTypes("")
+
+	// the unit of work is not atomic, its bindings remain deleted
+	suite.Equal(failure, err1)
+	suite.Equal(1, len(bindings1))
+	suite.Equal("b4", bindings1[0].Name)
+	suite.ElementsMatch(authMethods, authMethods1)
+	suite.ElementsMatch(serviceTypes, serviceTypes1)
+}
+
+func TestCompensatingTestSuite(t *testing.T) {
+	suite.Run(t, new(CompensatingTestSuite))
+}
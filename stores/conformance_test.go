@@ -0,0 +1,156 @@
+package stores_test
+
+import (
+	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/ARGOeu/argo-api-authn/stores/storetest"
+	"gopkg.in/mgo.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// mongoTestHost is the environment variable that holds the mongod the mongo store is tested against, localhost by default.
+// The conformance suite uses, and drops, the database named by mongoTestDatabase
+const mongoTestHost = "ARGO_AUTHN_MONGO_TEST_HOST"
+const mongoTestDatabase = "argo_authn_storetest"
+
+// postgresTestDSN holds the connection string of the database the postgres store is tested against, it is emptied before every test
+const postgresTestDSN = "ARGO_AUTHN_POSTGRES_TEST_DSN"
+
+func TestMockstoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) stores.Store {
+		return &stores.Mockstore{}
+	})
+}
+
+func TestEmbeddedStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) stores.Store {
+
+		dir, err := ioutil.TempDir("", "embedded-store")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.RemoveAll(dir) })
+
+		store := &stores.EmbeddedStore{Path: filepath.Join(dir, "authn.db")}
+		store.SetUp()
+
+		return store
+	})
+}
+
+// TestCompensatedStoreConformance checks the units of work of the mongo store, which revert the changes of the failed ones,
+// on top of the embedded store
+func TestCompensatedStoreConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) stores.Store {
+
+		dir, err := ioutil.TempDir("", "compensated-store")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.RemoveAll(dir) })
+
+		store := &stores.EmbeddedStore{Path: filepath.Join(dir, "authn.db")}
+		store.SetUp()
+
+		return &stores.CompensatedStore{Store: store}
+	})
+}
+
+// mongoTestSession connects to the mongod the mongo store is tested against for the duration of the test,
+// the test is skipped when it isn't available
+func mongoTestSession(t *testing.T) *mgo.Session {
+
+	host := os.Getenv(mongoTestHost)
+	if host == "" {
+		host = "localhost"
+	}
+
+	session, err := mgo.DialWithTimeout(host, 500*time.Millisecond)
+	if err != nil {
+		t.Skipf("no mongod available at %v: %v", host, err)
+	}
+	t.Cleanup(session.Close)
+
+	return session
+}
+
+// mongoTestStore returns a mongo store on an empty database, which is dropped when the test finishes
+func mongoTestStore(t *testing.T, session *mgo.Session) *stores.MongoStore {
+
+	if err := session.DB(mongoTestDatabase).DropDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { session.DB(mongoTestDatabase).DropDatabase() })
+
+	store := &stores.MongoStore{Server: session.LiveServers()[0], Database: mongoTestDatabase}
+	store.SetUp()
+
+	return store
+}
+
+func TestMongoStoreConformance(t *testing.T) {
+
+	session := mongoTestSession(t)
+
+	storetest.Run(t, func(t *testing.T) stores.Store {
+		return mongoTestStore(t, session)
+	})
+}
+
+func TestMongoStoreUniqueIndexes(t *testing.T) {
+
+	session := mongoTestSession(t)
+
+	store := mongoTestStore(t, session)
+	defer store.Close()
+
+	store.InsertServiceType("s1", []string{"host1"}, []string{"x509"}, "api-key", "uuid1", "", "ams")
+	store.InsertBinding("b1", "uuid1", "host1", "b_uuid1", "test_dn_1", "", "x509", "")
+
+	_, err1 := store.InsertServiceType("s1", []string{"host2"}, []string{"x509"}, "api-key", "uuid2", "", "ams")
+	_, err2 := store.InsertBinding("b1", "uuid1", "host1", "b_uuid2", "test_dn_2", "", "x509", "")
+	_, err3 := store.InsertBinding("b2", "uuid1", "host1", "b_uuid2", "test_dn_1", "", "x509", "")
+
+	// the schema is already up to date
+	err4 := store.Migrate()
+
+	if err1 == nil || err1.Error() != "service-type object with name: s1 already exists" {
+		t.Errorf("unexpected error for a duplicate service type name: %v", err1)
+	}
+
+	if err2 == nil || err2.Error() != "binding object with name: b1 already exists" {
+		t.Errorf("unexpected error for a duplicate binding name: %v", err2)
+	}
+
+	if err3 == nil || err3.Error() != "binding object with auth_identifier: test_dn_1 already exists" {
+		t.Errorf("unexpected error for a duplicate auth identifier: %v", err3)
+	}
+
+	if err4 != nil {
+		t.Errorf("unexpected error when migrating an up to date schema: %v", err4)
+	}
+}
+
+func TestPostgresStoreConformance(t *testing.T) {
+
+	dsn := os.Getenv(postgresTestDSN)
+	if dsn == "" {
+		t.Skipf("%v is not set", postgresTestDSN)
+	}
+
+	storetest.Run(t, func(t *testing.T) stores.Store {
+
+		store := &stores.PostgresStore{DSN: dsn}
+		store.SetUp()
+
+		store.DB.Exec("DROP TABLE IF EXISTS schema_migrations, service_type_hosts, service_types, bindings, auth_methods")
+		if err := store.Migrate(); err != nil {
+			t.Fatal(err)
+		}
+
+		return store
+	})
+}
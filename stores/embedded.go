@@ -0,0 +1,773 @@
+package stores
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	LOGGER "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+	"time"
+)
+
+var (
+	serviceTypesBucket = []byte("service_types")
+	bindingsBucket     = []byte("bindings")
+	authMethodsBucket  = []byte("auth_methods")
+	// bindingsAuthIDIndex indexes the bindings by their auth identifier, service uuid, host and auth type
+	bindingsAuthIDIndex = []byte("bindings_by_auth_id")
+)
+
+// errRecordNotFound is returned when the record that should be updated or deleted doesn't exist, the same way mongo reports it
+var errRecordNotFound = errors.New("not found")
+
+// EmbeddedStore keeps the service types, bindings and auth methods in a single local file.
+// Records are stored as json under their insertion sequence, so they are listed in the order they were created,
+// and are indexed by their uuid. Every operation runs in its own transaction, unless it is part of a unit of work
+type EmbeddedStore struct {
+	Path string
+	DB   *bolt.DB
+	// clone is set for the stores returned by Clone, which share the database of the original store
+	clone bool
+	// tx is the read-write transaction of the unit of work the store belongs to, if any
+	tx *bolt.Tx
+}
+
+// uuidIndex returns the name of the bucket that indexes the records of the given bucket by their uuid
+func uuidIndex(bucket []byte) []byte {
+	return append(append([]byte{}, bucket...), "_by_uuid"...)
+}
+
+// SetUp opens the store's file, creating it along with its buckets if it doesn't exist
+func (embedded *EmbeddedStore) SetUp() {
+
+	var err error
+
+	LOGGER.Info("STORE", "\t", "Opening the embedded store: ", embedded.Path)
+
+	if embedded.DB, err = bolt.Open(embedded.Path, 0600, &bolt.Options{Timeout: 5 * time.Second}); err != nil {
+		LOGGER.Fatal("STORE", "\t", err.Error())
+	}
+
+	err = embedded.DB.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{serviceTypesBucket, bindingsBucket, authMethodsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucketIfNotExists(uuidIndex(bucket)); err != nil {
+				return err
+			}
+		}
+		_, err := tx.CreateBucketIfNotExists(bindingsAuthIDIndex)
+		return err
+	})
+
+	if err != nil {
+		LOGGER.Fatal("STORE", "\t", err.Error())
+	}
+
+	LOGGER.Info("STORE", "\t", "Opened the embedded store: ", embedded.Path)
+}
+
+// Clone returns a store that shares the database of the original one, the database handles concurrent use
+func (embedded *EmbeddedStore) Clone() Store {
+
+	return &EmbeddedStore{
+		Path:  embedded.Path,
+		DB:    embedded.DB,
+		clone: true,
+		tx:    embedded.tx,
+	}
+}
+
+// Close closes the store's file, closing a clone leaves the file open
+func (embedded *EmbeddedStore) Close() {
+
+	if embedded.clone {
+		return
+	}
+
+	if err := embedded.DB.Close(); err != nil {
+		LOGGER.Error("STORE", "\t", err.Error())
+	}
+}
+
+// view runs the given function in a read only transaction, or in the transaction of the unit of work
+func (embedded *EmbeddedStore) view(fn func(tx *bolt.Tx) error) error {
+
+	if embedded.tx != nil {
+		return embedded.update(fn)
+	}
+
+	if err := embedded.DB.View(fn); err != nil {
+		LOGGER.Error("STORE", "\t", err.Error())
+		return utils.APIErrDatabase(err.Error())
+	}
+
+	return nil
+}
+
+// update runs the given function in a read-write transaction, its changes are only stored if it succeeds.
+// Within a unit of work the function runs in the transaction of the unit of work, which is committed as a whole
+func (embedded *EmbeddedStore) update(fn func(tx *bolt.Tx) error) error {
+
+	var err error
+
+	if embedded.tx != nil {
+		err = fn(embedded.tx)
+	} else {
+		err = embedded.DB.Update(fn)
+	}
+
+	if err != nil {
+		LOGGER.Error("STORE", "\t", err.Error())
+		// errors that are already api errors, such as revision mismatches, are returned as they are
+		if apiErr, ok := err.(*utils.APIError); ok {
+			return apiErr
+		}
+		return utils.APIErrDatabase(err.Error())
+	}
+
+	return nil
+}
+
+// RunInTransaction runs the given function in a single read-write transaction of the database
+func (embedded *EmbeddedStore) RunInTransaction(fn func(tx Store) error) error {
+
+	if embedded.tx != nil {
+		return fn(embedded)
+	}
+
+	var fnErr error
+
+	err := embedded.DB.Update(func(tx *bolt.Tx) error {
+		fnErr = fn(&EmbeddedStore{Path: embedded.Path, DB: embedded.DB, clone: true, tx: tx})
+		return fnErr
+	})
+
+	// the errors of the function are returned as they are, only the errors of the transaction itself are database errors
+	if fnErr != nil {
+		return fnErr
+	}
+
+	if err != nil {
+		LOGGER.Error("STORE", "\t", err.Error())
+		return utils.APIErrDatabase(err.Error())
+	}
+
+	return nil
+}
+
+// insertRecord stores the json representation of the value under a new key and indexes it by the given uuid
+func insertRecord(tx *bolt.Tx, bucket []byte, uuid string, value interface{}) ([]byte, error) {
+
+	b := tx.Bucket(bucket)
+
+	seq, err := b.NextSequence()
+	if err != nil {
+		return nil, err
+	}
+
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+
+	if err = putRecord(tx, bucket, key, value); err != nil {
+		return nil, err
+	}
+
+	if uuid != "" {
+		if err = tx.Bucket(uuidIndex(bucket)).Put([]byte(uuid), key); err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+// putRecord stores the json representation of the value under the given key
+func putRecord(tx *bolt.Tx, bucket []byte, key []byte, value interface{}) error {
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(bucket).Put(key, data)
+}
+
+// recordKey returns the key of the record with the given uuid, or nil if there is none
+func recordKey(tx *bolt.Tx, bucket []byte, uuid string) []byte {
+
+	if uuid == "" {
+		return nil
+	}
+
+	return tx.Bucket(uuidIndex(bucket)).Get([]byte(uuid))
+}
+
+// checkRevision returns the given error if the revision of the record with the given key isn't the expected one
+func checkRevision(tx *bolt.Tx, bucket []byte, key []byte, revision int64, modified error) error {
+
+	var stored struct {
+		Revision int64 `json:"revision"`
+	}
+
+	if err := json.Unmarshal(tx.Bucket(bucket).Get(key), &stored); err != nil {
+		return err
+	}
+
+	if stored.Revision != revision {
+		return modified
+	}
+
+	return nil
+}
+
+// reindexRecord moves the uuid index entry of a record when its uuid has changed
+func reindexRecord(tx *bolt.Tx, bucket []byte, key []byte, oldUUID string, newUUID string) error {
+
+	if oldUUID == newUUID {
+		return nil
+	}
+
+	idx := tx.Bucket(uuidIndex(bucket))
+
+	if oldUUID != "" {
+		if err := idx.Delete([]byte(oldUUID)); err != nil {
+			return err
+		}
+	}
+
+	if newUUID != "" {
+		return idx.Put([]byte(newUUID), key)
+	}
+
+	return nil
+}
+
+// deleteRecord deletes the record with the given key along with its uuid index entry
+func deleteRecord(tx *bolt.Tx, bucket []byte, key []byte, uuid string) error {
+
+	if uuid != "" {
+		if err := tx.Bucket(uuidIndex(bucket)).Delete([]byte(uuid)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Bucket(bucket).Delete(key)
+}
+
+// bindingAuthIDPrefix returns the prefix of the index keys of the bindings with the given auth identifier, service uuid, host and auth type
+func bindingAuthIDPrefix(authID string, serviceUUID string, host string, authType string) []byte {
+
+	var buf bytes.Buffer
+
+	for _, part := range []string{authID, serviceUUID, host, authType} {
+		buf.WriteString(part)
+		buf.WriteByte(0)
+	}
+
+	return buf.Bytes()
+}
+
+// bindingAuthIDKey returns the index key of the binding stored under the given key
+func bindingAuthIDKey(qBinding QBinding, key []byte) []byte {
+	return append(bindingAuthIDPrefix(qBinding.AuthIdentifier, qBinding.ServiceUUID, qBinding.Host, qBinding.AuthType), key...)
+}
+
+// findServiceTypes returns the service types that the given filter accepts
+func (embedded *EmbeddedStore) findServiceTypes(accept func(QServiceType) bool) ([]QServiceType, error) {
+
+	var qServices []QServiceType
+
+	err := embedded.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(serviceTypesBucket).ForEach(func(k, v []byte) error {
+			var qService QServiceType
+			if err := json.Unmarshal(v, &qService); err != nil {
+				return err
+			}
+			if accept(qService) {
+				qServices = append(qServices, qService)
+			}
+			return nil
+		})
+	})
+
+	if err != nil {
+		return []QServiceType{}, err
+	}
+
+	return qServices, nil
+}
+
+// findBindings returns the bindings that the given filter accepts
+func (embedded *EmbeddedStore) findBindings(accept func(QBinding) bool) ([]QBinding, error) {
+
+	var qBindings []QBinding
+
+	err := embedded.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(bindingsBucket).ForEach(func(k, v []byte) error {
+			var qBinding QBinding
+			if err := json.Unmarshal(v, &qBinding); err != nil {
+				return err
+			}
+			if accept(qBinding) {
+				qBindings = append(qBindings, qBinding)
+			}
+			return nil
+		})
+	})
+
+	if err != nil {
+		return []QBinding{}, err
+	}
+
+	return qBindings, nil
+}
+
+func (embedded *EmbeddedStore) QueryServiceTypes(name string) ([]QServiceType, error) {
+	return embedded.findServiceTypes(func(qService QServiceType) bool {
+		return name == "" || qService.Name == name
+	})
+}
+
+func (embedded *EmbeddedStore) QueryServiceTypesByUUID(uuid string) ([]QServiceType, error) {
+	return embedded.findServiceTypes(func(qService QServiceType) bool {
+		return qService.UUID == uuid
+	})
+}
+
+// QueryAuthMethods returns the auth methods of the given type for the given service type and host.
+// An empty type matches auth methods of any registered type, while if there is no serviceUUID and host provided,
+// the auth methods of all the service types and hosts are returned
+func (embedded *EmbeddedStore) QueryAuthMethods(amType string, serviceUUID string, host string) ([]QAuthMethod, error) {
+
+	var qAuthms = []QAuthMethod{}
+
+	err := embedded.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(authMethodsBucket).ForEach(func(k, v []byte) error {
+
+			qam, err := decodeAuthMethod(v)
+			if err != nil || qam == nil {
+				return err
+			}
+
+			basic := qam.Basic()
+
+			if amType != "" && basic.Type != amType {
+				return nil
+			}
+
+			if (serviceUUID != "" || host != "") && (basic.ServiceUUID != serviceUUID || basic.Host != host) {
+				return nil
+			}
+
+			qAuthms = append(qAuthms, qam)
+			return nil
+		})
+	})
+
+	return qAuthms, err
+}
+
+// QueryBindingsByAuthID uses the auth identifier index, so only the matching bindings are read
+func (embedded *EmbeddedStore) QueryBindingsByAuthID(authID string, serviceUUID string, host string, authType string) ([]QBinding, error) {
+
+	var qBindings []QBinding
+
+	prefix := bindingAuthIDPrefix(authID, serviceUUID, host, authType)
+
+	err := embedded.view(func(tx *bolt.Tx) error {
+
+		b := tx.Bucket(bindingsBucket)
+		c := tx.Bucket(bindingsAuthIDIndex).Cursor()
+
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+
+			var qBinding QBinding
+
+			if err := json.Unmarshal(b.Get(k[len(prefix):]), &qBinding); err != nil {
+				return err
+			}
+
+			qBindings = append(qBindings, qBinding)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return []QBinding{}, err
+	}
+
+	return qBindings, nil
+}
+
+func (embedded *EmbeddedStore) QueryBindingsByUUIDAndName(uuid, name string) ([]QBinding, error) {
+	return embedded.findBindings(func(qBinding QBinding) bool {
+		return (uuid == "" || qBinding.UUID == uuid) && (name == "" || qBinding.Name == name)
+	})
+}
+
+func (embedded *EmbeddedStore) QueryBindings(serviceUUID string, host string) ([]QBinding, error) {
+	return embedded.findBindings(func(qBinding QBinding) bool {
+		return serviceUUID == "" || host == "" || (qBinding.ServiceUUID == serviceUUID && qBinding.Host == host)
+	})
+}
+
+// ListBindings reads the bindings that match the filter and pages them in memory, bolt has no secondary indexes to sort them by
+func (embedded *EmbeddedStore) ListBindings(filter BindingFilter, opts ListOptions) (QBindingsPage, error) {
+
+	qBindings, err := embedded.findBindings(filter.matches)
+	if err != nil {
+		return QBindingsPage{Bindings: []QBinding{}}, err
+	}
+
+	return listBindings(qBindings, filter, opts)
+}
+
+func (embedded *EmbeddedStore) ListServiceTypes(filter ServiceTypeFilter, opts ListOptions) (QServiceTypesPage, error) {
+
+	qServices, err := embedded.findServiceTypes(filter.matches)
+	if err != nil {
+		return QServiceTypesPage{ServiceTypes: []QServiceType{}}, err
+	}
+
+	return listServiceTypes(qServices, filter, opts)
+}
+
+func (embedded *EmbeddedStore) ListAuthMethods(filter AuthMethodFilter, opts ListOptions) (QAuthMethodsPage, error) {
+
+	qAuthms, err := embedded.QueryAuthMethods("", "", "")
+	if err != nil {
+		return QAuthMethodsPage{AuthMethods: []QAuthMethod{}}, err
+	}
+
+	return listAuthMethods(qAuthms, filter, opts)
+}
+
+// InsertServiceType inserts a new service into the datastore
+func (embedded *EmbeddedStore) InsertServiceType(name string, hosts []string, authTypes []string, authMethod string, uuid string, createdOn string, sType string) (QServiceType, error) {
+
+	qService := QServiceType{Name: name, Hosts: hosts, AuthTypes: authTypes, AuthMethod: authMethod, UUID: uuid, CreatedOn: createdOn, Type: sType}
+
+	err := embedded.update(func(tx *bolt.Tx) error {
+		_, err := insertRecord(tx, serviceTypesBucket, uuid, qService)
+		return err
+	})
+
+	if err != nil {
+		return QServiceType{}, err
+	}
+
+	return qService, nil
+}
+
+// InsertBinding inserts a new binding into the datastore
+func (embedded *EmbeddedStore) InsertBinding(name string, serviceUUID string, host string, uuid string, authID string, uniqueKey string, authType string, authMethod string) (QBinding, error) {
+
+	qBinding := QBinding{
+		Name:           name,
+		ServiceUUID:    serviceUUID,
+		Host:           host,
+		UUID:           uuid,
+		AuthIdentifier: authID,
+		UniqueKey:      uniqueKey,
+		AuthType:       authType,
+		CreatedOn:      utils.ZuluTimeNow(),
+		AuthMethod:     authMethod,
+	}
+
+	err := embedded.update(func(tx *bolt.Tx) error {
+
+		key, err := insertRecord(tx, bindingsBucket, uuid, qBinding)
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(bindingsAuthIDIndex).Put(bindingAuthIDKey(qBinding, key), nil)
+	})
+
+	if err != nil {
+		return QBinding{}, err
+	}
+
+	return qBinding, nil
+}
+
+func (embedded *EmbeddedStore) InsertAuthMethod(am QAuthMethod) error {
+
+	var err error
+
+	// secrets are never stored in clear text, when a keyring has been loaded
+	if am, err = EncryptSecrets(am); err != nil {
+		LOGGER.Error("STORE", "\t", err.Error())
+		err = utils.APIGenericInternalError(err.Error())
+		return err
+	}
+
+	return embedded.update(func(tx *bolt.Tx) error {
+		_, err := insertRecord(tx, authMethodsBucket, am.Basic().UUID, am)
+		return err
+	})
+}
+
+// UpdateBinding updates the given binding
+func (embedded *EmbeddedStore) UpdateBinding(original QBinding, updated QBinding) (QBinding, error) {
+
+	err := embedded.update(func(tx *bolt.Tx) error {
+
+		key := recordKey(tx, bindingsBucket, original.UUID)
+		if key == nil {
+			return errRecordNotFound
+		}
+		key = append([]byte{}, key...)
+
+		if err := checkRevision(tx, bindingsBucket, key, original.Revision, errBindingModified); err != nil {
+			return err
+		}
+
+		// the usage of the binding is only changed through RecordBindingUsage
+		var stored QBinding
+		if err := json.Unmarshal(tx.Bucket(bindingsBucket).Get(key), &stored); err != nil {
+			return err
+		}
+		updated = updated.withUsageOf(stored)
+
+		if err := putRecord(tx, bindingsBucket, key, updated); err != nil {
+			return err
+		}
+
+		if err := reindexRecord(tx, bindingsBucket, key, original.UUID, updated.UUID); err != nil {
+			return err
+		}
+
+		idx := tx.Bucket(bindingsAuthIDIndex)
+		if err := idx.Delete(bindingAuthIDKey(original, key)); err != nil {
+			return err
+		}
+
+		return idx.Put(bindingAuthIDKey(updated, key), nil)
+	})
+
+	if err != nil {
+		return QBinding{}, err
+	}
+
+	return updated, nil
+}
+
+// UpdateServiceType updates the given service type
+func (embedded *EmbeddedStore) UpdateServiceType(original QServiceType, updated QServiceType) (QServiceType, error) {
+
+	err := embedded.update(func(tx *bolt.Tx) error {
+
+		key := recordKey(tx, serviceTypesBucket, original.UUID)
+		if key == nil {
+			return errRecordNotFound
+		}
+		key = append([]byte{}, key...)
+
+		if err := checkRevision(tx, serviceTypesBucket, key, original.Revision, errServiceTypeModified); err != nil {
+			return err
+		}
+
+		if err := putRecord(tx, serviceTypesBucket, key, updated); err != nil {
+			return err
+		}
+
+		return reindexRecord(tx, serviceTypesBucket, key, original.UUID, updated.UUID)
+	})
+
+	if err != nil {
+		return QServiceType{}, err
+	}
+
+	return updated, nil
+}
+
+// UpdateAuthMethod updates the given auth method
+func (embedded *EmbeddedStore) UpdateAuthMethod(original QAuthMethod, updated QAuthMethod) (QAuthMethod, error) {
+
+	var err error
+
+	if updated, err = EncryptSecrets(updated); err != nil {
+		LOGGER.Error("STORE", "\t", err.Error())
+		err = utils.APIGenericInternalError(err.Error())
+		return nil, err
+	}
+
+	err = embedded.update(func(tx *bolt.Tx) error {
+
+		key := recordKey(tx, authMethodsBucket, original.Basic().UUID)
+		if key == nil {
+			return errRecordNotFound
+		}
+		key = append([]byte{}, key...)
+
+		if err := checkRevision(tx, authMethodsBucket, key, original.Basic().Revision, errAuthMethodModified); err != nil {
+			return err
+		}
+
+		if err := putRecord(tx, authMethodsBucket, key, updated); err != nil {
+			return err
+		}
+
+		return reindexRecord(tx, authMethodsBucket, key, original.Basic().UUID, updated.Basic().UUID)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func (embedded *EmbeddedStore) DeleteServiceTypeByUUID(uuid string) error {
+
+	return embedded.update(func(tx *bolt.Tx) error {
+
+		key := recordKey(tx, serviceTypesBucket, uuid)
+		if key == nil {
+			return errRecordNotFound
+		}
+
+		return deleteRecord(tx, serviceTypesBucket, append([]byte{}, key...), uuid)
+	})
+}
+
+// deleteBindings deletes the bindings stored under the given keys, along with their index entries
+func deleteBindings(tx *bolt.Tx, keys [][]byte) error {
+
+	b := tx.Bucket(bindingsBucket)
+
+	for _, key := range keys {
+
+		var qBinding QBinding
+
+		if err := json.Unmarshal(b.Get(key), &qBinding); err != nil {
+			return err
+		}
+
+		if err := tx.Bucket(bindingsAuthIDIndex).Delete(bindingAuthIDKey(qBinding, key)); err != nil {
+			return err
+		}
+
+		if err := deleteRecord(tx, bindingsBucket, key, qBinding.UUID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RecordBindingUsage adds the authentications to the usage of the bindings, in a single transaction
+func (embedded *EmbeddedStore) RecordBindingUsage(usages []QBindingUsage) error {
+
+	return embedded.update(func(tx *bolt.Tx) error {
+
+		for _, usage := range usages {
+
+			key := recordKey(tx, bindingsBucket, usage.UUID)
+			if key == nil {
+				continue
+			}
+			key = append([]byte{}, key...)
+
+			var qb QBinding
+			if err := json.Unmarshal(tx.Bucket(bindingsBucket).Get(key), &qb); err != nil {
+				return err
+			}
+
+			if err := putRecord(tx, bindingsBucket, key, qb.withUsage(usage)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// DeleteBinding deletes a binding from the store
+func (embedded *EmbeddedStore) DeleteBinding(qBinding QBinding) error {
+
+	return embedded.update(func(tx *bolt.Tx) error {
+
+		key := recordKey(tx, bindingsBucket, qBinding.UUID)
+		if key == nil {
+			return errRecordNotFound
+		}
+
+		return deleteBindings(tx, [][]byte{append([]byte{}, key...)})
+	})
+}
+
+func (embedded *EmbeddedStore) DeleteBindingByServiceUUID(serviceUUID string) error {
+
+	return embedded.update(func(tx *bolt.Tx) error {
+
+		var keys [][]byte
+
+		err := tx.Bucket(bindingsBucket).ForEach(func(k, v []byte) error {
+			var qBinding QBinding
+			if err := json.Unmarshal(v, &qBinding); err != nil {
+				return err
+			}
+			if qBinding.ServiceUUID == serviceUUID {
+				keys = append(keys, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return deleteBindings(tx, keys)
+	})
+}
+
+func (embedded *EmbeddedStore) DeleteAuthMethod(am QAuthMethod) error {
+
+	return embedded.update(func(tx *bolt.Tx) error {
+
+		key := recordKey(tx, authMethodsBucket, am.Basic().UUID)
+		if key == nil {
+			return errRecordNotFound
+		}
+
+		return deleteRecord(tx, authMethodsBucket, append([]byte{}, key...), am.Basic().UUID)
+	})
+}
+
+func (embedded *EmbeddedStore) DeleteAuthMethodByServiceUUID(serviceUUID string) error {
+
+	return embedded.update(func(tx *bolt.Tx) error {
+
+		var keys [][]byte
+		var uuids []string
+
+		err := tx.Bucket(authMethodsBucket).ForEach(func(k, v []byte) error {
+			var qam QBasicAuthMethod
+			if err := json.Unmarshal(v, &qam); err != nil {
+				return err
+			}
+			if qam.ServiceUUID == serviceUUID {
+				keys = append(keys, append([]byte{}, k...))
+				uuids = append(uuids, qam.UUID)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for idx, key := range keys {
+			if err := deleteRecord(tx, authMethodsBucket, key, uuids[idx]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,219 @@
+package stores
+
+import (
+	"encoding/base64"
+	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type EmbeddedStoreTestSuite struct {
+	suite.Suite
+	dir   string
+	store *EmbeddedStore
+}
+
+// SetupTest opens an embedded store on a new file, populated with the same data as the mock store
+func (suite *EmbeddedStoreTestSuite) SetupTest() {
+
+	suite.dir, _ = ioutil.TempDir("", "embedded-store")
+	suite.store = &EmbeddedStore{Path: filepath.Join(suite.dir, "authn.db")}
+	suite.store.SetUp()
+
+	mockstore := &Mockstore{}
+	mockstore.SetUp()
+
+	for _, qs := range mockstore.ServiceTypes[:2] {
+		suite.store.InsertServiceType(qs.Name, qs.Hosts, qs.AuthTypes, qs.AuthMethod, qs.UUID, qs.CreatedOn, qs.Type)
+	}
+
+	for _, qb := range mockstore.Bindings {
+		suite.store.InsertBinding(qb.Name, qb.ServiceUUID, qb.Host, qb.UUID, qb.AuthIdentifier, qb.UniqueKey, qb.AuthType, qb.AuthMethod)
+	}
+
+	for _, qam := range mockstore.AuthMethods {
+		suite.store.InsertAuthMethod(qam)
+	}
+}
+
+func (suite *EmbeddedStoreTestSuite) TearDownTest() {
+	suite.store.Close()
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *EmbeddedStoreTestSuite) TestQueryServiceTypes() {
+
+	qServices1, err1 := suite.store.QueryServiceTypes("s1")
+	qServices2, err2 := suite.store.QueryServiceTypes("")
+	qServices3, err3 := suite.store.QueryServiceTypesByUUID("uuid2")
+	qServices4, err4 := suite.store.QueryServiceTypes("unknown")
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Nil(err4)
+	suite.Equal(1, len(qServices1))
+	suite.Equal("uuid1", qServices1[0].UUID)
+	suite.Equal([]string{"host1", "host2", "host3"}, qServices1[0].Hosts)
+
+	// service types are listed in the order they were created
+	suite.Equal(2, len(qServices2))
+	suite.Equal("s1", qServices2[0].Name)
+	suite.Equal("s2", qServices2[1].Name)
+	suite.Equal("s2", qServices3[0].Name)
+	suite.Equal(0, len(qServices4))
+}
+
+func (suite *EmbeddedStoreTestSuite) TestQueryBindings() {
+
+	// the auth identifier index
+	qBindings1, err1 := suite.store.QueryBindingsByAuthID("test_dn_1", "uuid1", "host1", "x509")
+	qBindings2, err2 := suite.store.QueryBindingsByAuthID("test_dn_1", "uuid1", "host1", "oidc")
+	qBindings3, err3 := suite.store.QueryBindingsByAuthID("test_dn", "uuid1", "host1", "x509")
+
+	qBindings4, err4 := suite.store.QueryBindingsByUUIDAndName("b_uuid2", "")
+	qBindings5, err5 := suite.store.QueryBindingsByUUIDAndName("", "b3")
+	qBindings6, err6 := suite.store.QueryBindings("uuid1", "host1")
+	qBindings7, err7 := suite.store.QueryBindings("", "")
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Nil(err4)
+	suite.Nil(err5)
+	suite.Nil(err6)
+	suite.Nil(err7)
+	suite.Equal(1, len(qBindings1))
+	suite.Equal("b1", qBindings1[0].Name)
+	suite.Equal("unique_key_1", qBindings1[0].UniqueKey)
+	suite.Equal(0, len(qBindings2))
+	suite.Equal(0, len(qBindings3))
+	suite.Equal("b2", qBindings4[0].Name)
+	suite.Equal("b_uuid3", qBindings5[0].UUID)
+	suite.Equal(2, len(qBindings6))
+	suite.Equal(4, len(qBindings7))
+}
+
+func (suite *EmbeddedStoreTestSuite) TestUpdateAndDeleteBindings() {
+
+	qBindings, _ := suite.store.QueryBindingsByUUIDAndName("b_uuid1", "")
+
+	// the auth identifier index follows the updated binding
+	updated := qBindings[0]
+	updated.AuthIdentifier = "test_dn_updated"
+	_, err1 := suite.store.UpdateBinding(qBindings[0], updated)
+
+	qBindings1, _ := suite.store.QueryBindingsByAuthID("test_dn_1", "uuid1", "host1", "x509")
+	qBindings2, _ := suite.store.QueryBindingsByAuthID("test_dn_updated", "uuid1", "host1", "x509")
+
+	// unknown binding
+	_, err3 := suite.store.UpdateBinding(QBinding{UUID: "unknown"}, updated)
+
+	err4 := suite.store.DeleteBinding(updated)
+	qBindings4, _ := suite.store.QueryBindingsByAuthID("test_dn_updated", "uuid1", "host1", "x509")
+
+	err5 := suite.store.DeleteBindingByServiceUUID("uuid1")
+	qBindings5, _ := suite.store.QueryBindings("", "")
+	qBindings6, _ := suite.store.QueryBindingsByAuthID("test_dn_2", "uuid1", "host1", "x509")
+
+	suite.Nil(err1)
+	suite.Equal(0, len(qBindings1))
+	suite.Equal(updated, qBindings2[0])
+	suite.Equal("Database Error: not found", err3.Error())
+	suite.Nil(err4)
+	suite.Equal(0, len(qBindings4))
+	suite.Nil(err5)
+	suite.Equal(1, len(qBindings5))
+	suite.Equal("b4", qBindings5[0].Name)
+	suite.Equal(0, len(qBindings6))
+}
+
+func (suite *EmbeddedStoreTestSuite) TestUpdateAndDeleteServiceTypes() {
+
+	qServices, _ := suite.store.QueryServiceTypesByUUID("uuid1")
+
+	updated := qServices[0]
+	updated.Hosts = []string{"host1"}
+	_, err1 := suite.store.UpdateServiceType(qServices[0], updated)
+	qServices1, _ := suite.store.QueryServiceTypesByUUID("uuid1")
+
+	err2 := suite.store.DeleteServiceTypeByUUID("uuid1")
+	qServices2, _ := suite.store.QueryServiceTypes("")
+
+	err3 := suite.store.DeleteServiceTypeByUUID("unknown")
+
+	suite.Nil(err1)
+	suite.Equal(updated, qServices1[0])
+	suite.Nil(err2)
+	suite.Equal(1, len(qServices2))
+	suite.Equal("Database Error: not found", err3.Error())
+}
+
+func (suite *EmbeddedStoreTestSuite) TestAuthMethods() {
+
+	Secrets, _ = ParseKeyring("v1:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32))))
+	defer func() { Secrets = nil }()
+
+	qam := &QApiKeyAuthMethod{AccessKey: "access_key_3"}
+	qam.QBasicAuthMethod = QBasicAuthMethod{ServiceUUID: "uuid1", Host: "host2", Port: 9000, Type: "api-key", UUID: "am_uuid_3"}
+	err1 := suite.store.InsertAuthMethod(qam)
+
+	// auth methods are decoded into the query models of their types
+	qams1, _ := suite.store.QueryAuthMethods("", "", "")
+	qams2, _ := suite.store.QueryAuthMethods("headers", "uuid2", "host3")
+	qams3, _ := suite.store.QueryAuthMethods("api-key", "uuid1", "host2")
+
+	// the secrets are stored encrypted
+	stored := qams3[0].(*QApiKeyAuthMethod).AccessKey
+
+	updated := &QApiKeyAuthMethod{AccessKey: "access_key_4", QBasicAuthMethod: qam.QBasicAuthMethod}
+	_, err4 := suite.store.UpdateAuthMethod(qam, updated)
+	qams4, _ := suite.store.QueryAuthMethods("api-key", "uuid1", "host2")
+	decrypted, _ := DecryptSecrets(qams4[0])
+
+	err5 := suite.store.DeleteAuthMethod(updated)
+	err6 := suite.store.DeleteAuthMethodByServiceUUID("uuid2")
+	qams6, _ := suite.store.QueryAuthMethods("", "", "")
+
+	suite.Nil(err1)
+	suite.Equal(3, len(qams1))
+	suite.IsType(&QApiKeyAuthMethod{}, qams1[0])
+	suite.IsType(&QHeadersAuthMethod{}, qams1[1])
+	suite.Equal(map[string]string{"x-api-key": "key-1", "Accept": "application/json"}, qams2[0].(*QHeadersAuthMethod).Headers)
+	suite.True(IsEncrypted(stored))
+	suite.Nil(err4)
+	suite.Equal("access_key_4", decrypted.(*QApiKeyAuthMethod).AccessKey)
+	suite.Nil(err5)
+	suite.Nil(err6)
+	suite.Equal(1, len(qams6))
+	suite.Equal("am_uuid_1", qams6[0].Basic().UUID)
+}
+
+func (suite *EmbeddedStoreTestSuite) TestPersistence() {
+
+	// clones share the store's file, closing them leaves it open
+	clone := suite.store.Clone()
+	clone.Close()
+	_, err1 := suite.store.QueryServiceTypes("")
+
+	// the data is kept when the store is reopened
+	suite.store.Close()
+	suite.store = &EmbeddedStore{Path: suite.store.Path}
+	suite.store.SetUp()
+
+	qServices, _ := suite.store.QueryServiceTypes("")
+	qBindings, _ := suite.store.QueryBindingsByAuthID("test_dn_1", "uuid2", "host3", "x509")
+	qams, _ := suite.store.QueryAuthMethods("", "", "")
+
+	suite.Nil(err1)
+	suite.Equal(2, len(qServices))
+	suite.Equal("b4", qBindings[0].Name)
+	suite.Equal(2, len(qams))
+}
+
+func TestEmbeddedStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(EmbeddedStoreTestSuite))
+}
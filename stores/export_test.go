@@ -0,0 +1,21 @@
+package stores
+
+// the built-in auth method types are registered by the authmethods package, which the stores can't import
+func init() {
+	RegisterQueryModel("api-key", NewQApiKeyAuthMethod)
+	RegisterQueryModel("headers", NewQHeadersAuthMethod)
+}
+
+// CompensatedStore runs its units of work the way the mongo store does, reverting the changes of the ones that fail,
+// so that the compensation can be checked against the conformance suite without a mongod
+type CompensatedStore struct {
+	Store
+}
+
+func (c *CompensatedStore) Clone() Store {
+	return &CompensatedStore{Store: c.Store.Clone()}
+}
+
+func (c *CompensatedStore) RunInTransaction(fn func(tx Store) error) error {
+	return runCompensated(c.Store, fn)
+}
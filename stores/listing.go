@@ -0,0 +1,399 @@
+package stores
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"sort"
+	"strings"
+)
+
+// ListOptions control the order and the pagination of the records that the List methods of the stores return
+type ListOptions struct {
+	// PageSize is the maximum number of records in a page, all the records are returned when it is zero
+	PageSize int
+	// PageToken is the NextPageToken of the previous page, the first page is returned when it is empty
+	PageToken string
+	// OrderBy is the field that the records are sorted by, by default they are sorted by their creation time.
+	// Records with the same value are sorted by their uuid
+	OrderBy string
+	// Descending reverses the order of the records
+	Descending bool
+}
+
+// BindingFilter selects the bindings that ListBindings returns, empty fields match any binding.
+// Time ranges include their start and exclude their end, the last_auth ranges only match bindings that have been used.
+// UnusedSince matches the bindings that haven't been used since the given time, either because their last authentication
+// happened before it or because they have never been used and were created before it
+type BindingFilter struct {
+	ServiceUUID    string
+	Host           string
+	AuthType       string
+	NamePrefix     string
+	AuthIdentifier string
+	CreatedAfter   string
+	CreatedBefore  string
+	LastAuthAfter  string
+	LastAuthBefore string
+	UnusedSince    string
+}
+
+// ServiceTypeFilter selects the service types that ListServiceTypes returns, empty fields match any service type
+type ServiceTypeFilter struct {
+	NamePrefix    string
+	Type          string
+	CreatedAfter  string
+	CreatedBefore string
+}
+
+// AuthMethodFilter selects the auth methods that ListAuthMethods returns, empty fields match any auth method
+type AuthMethodFilter struct {
+	ServiceUUID string
+	Host        string
+	Type        string
+}
+
+// QBindingsPage is a page of bindings, TotalSize counts all the bindings that match the filter
+type QBindingsPage struct {
+	Bindings      []QBinding
+	NextPageToken string
+	TotalSize     int
+}
+
+// QServiceTypesPage is a page of service types, TotalSize counts all the service types that match the filter
+type QServiceTypesPage struct {
+	ServiceTypes  []QServiceType
+	NextPageToken string
+	TotalSize     int
+}
+
+// QAuthMethodsPage is a page of auth methods, TotalSize counts all the auth methods that match the filter
+type QAuthMethodsPage struct {
+	AuthMethods   []QAuthMethod
+	NextPageToken string
+	TotalSize     int
+}
+
+// The fields that each kind of record can be sorted by, the first one is the default
+var (
+	BindingsOrderBy     = []string{"created_on", "name", "last_auth"}
+	ServiceTypesOrderBy = []string{"created_on", "name"}
+	AuthMethodsOrderBy  = []string{"created_on", "host"}
+)
+
+// pageCursor is the position in the order of the records after which the next page starts.
+// Page tokens are its encoded form, so that a page token can only continue the listing it came from
+type pageCursor struct {
+	OrderBy    string `json:"order_by"`
+	Descending bool   `json:"desc"`
+	Value      string `json:"value"`
+	UUID       string `json:"uuid"`
+}
+
+// orderBy returns the field that the records are sorted by, which has to be one of the supported ones
+func (opts ListOptions) orderBy(supported []string) (string, error) {
+
+	if opts.OrderBy == "" {
+		return supported[0], nil
+	}
+
+	for _, field := range supported {
+		if field == opts.OrderBy {
+			return field, nil
+		}
+	}
+
+	return "", utils.APIErrUnsupportedContent("order_by", opts.OrderBy, fmt.Sprintf("Supported:%v", supported))
+}
+
+// cursor decodes the page token of the options, there is no cursor for the first page
+func (opts ListOptions) cursor(orderBy string) (*pageCursor, error) {
+
+	if opts.PageToken == "" {
+		return nil, nil
+	}
+
+	var c pageCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(opts.PageToken)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+
+	if err != nil || c.OrderBy != orderBy || c.Descending != opts.Descending {
+		return nil, utils.APIErrInvalidParameter("pageToken", "The page token doesn't belong to this listing")
+	}
+
+	return &c, nil
+}
+
+// token returns the page token of the page that starts after the record with the given sort value and uuid
+func (opts ListOptions) token(orderBy string, value string, uuid string) string {
+
+	data, _ := json.Marshal(pageCursor{OrderBy: orderBy, Descending: opts.Descending, Value: value, UUID: uuid})
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// sortKey is the position of a record in the order of a listing
+type sortKey struct {
+	Value string
+	UUID  string
+}
+
+// before checks whether or not the record with the key is listed before the record with the other key
+func (k sortKey) before(other sortKey, descending bool) bool {
+
+	if k.Value != other.Value {
+		return (k.Value < other.Value) != descending
+	}
+
+	if k.UUID != other.UUID {
+		return (k.UUID < other.UUID) != descending
+	}
+
+	return false
+}
+
+// pageOf sorts the records with the given keys and returns the positions of the records in the requested page,
+// along with the token of the next page, if there is one
+func pageOf(keys []sortKey, opts ListOptions, orderBy string, cursor *pageCursor) ([]int, string) {
+
+	var page []int
+
+	order := make([]int, len(keys))
+	for idx := range order {
+		order[idx] = idx
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return keys[order[i]].before(keys[order[j]], opts.Descending)
+	})
+
+	for _, idx := range order {
+
+		if cursor != nil && !(sortKey{Value: cursor.Value, UUID: cursor.UUID}).before(keys[idx], opts.Descending) {
+			continue
+		}
+
+		if opts.PageSize > 0 && len(page) == opts.PageSize {
+			last := keys[page[len(page)-1]]
+			return page, opts.token(orderBy, last.Value, last.UUID)
+		}
+
+		page = append(page, idx)
+	}
+
+	return page, ""
+}
+
+// fetchSize is the number of records that the stores fetch for a page, one more than the size of the page,
+// in order to find out whether or not there is a next page. Zero fetches all the records
+func (opts ListOptions) fetchSize() int {
+
+	if opts.PageSize > 0 {
+		return opts.PageSize + 1
+	}
+
+	return 0
+}
+
+// pageEnd returns the number of the fetched records that belong to the page, along with the token of the next page
+func (opts ListOptions) pageEnd(fetched int, orderBy string, key func(idx int) sortKey) (int, string) {
+
+	if opts.PageSize == 0 || fetched <= opts.PageSize {
+		return fetched, ""
+	}
+
+	last := key(opts.PageSize - 1)
+
+	return opts.PageSize, opts.token(orderBy, last.Value, last.UUID)
+}
+
+// inRange checks whether or not a time is within the range of the given start and end, empty limits are ignored
+func inRange(t string, start string, end string) bool {
+	return (start == "" || t >= start) && (end == "" || t < end)
+}
+
+func (f BindingFilter) matches(qb QBinding) bool {
+
+	if (f.ServiceUUID != "" && qb.ServiceUUID != f.ServiceUUID) || (f.Host != "" && qb.Host != f.Host) ||
+		(f.AuthType != "" && qb.AuthType != f.AuthType) {
+		return false
+	}
+
+	if !strings.HasPrefix(qb.Name, f.NamePrefix) || !strings.Contains(qb.AuthIdentifier, f.AuthIdentifier) {
+		return false
+	}
+
+	if (f.LastAuthAfter != "" || f.LastAuthBefore != "") && qb.LastAuth == "" {
+		return false
+	}
+
+	if f.UnusedSince != "" && !unusedSince(qb, f.UnusedSince) {
+		return false
+	}
+
+	return inRange(qb.CreatedOn, f.CreatedAfter, f.CreatedBefore) && inRange(qb.LastAuth, f.LastAuthAfter, f.LastAuthBefore)
+}
+
+// unusedSince checks whether or not the binding hasn't been used since the given time,
+// bindings without a creation time that have never been used never match
+func unusedSince(qb QBinding, since string) bool {
+
+	lastUse := qb.LastAuth
+	if lastUse == "" {
+		lastUse = qb.CreatedOn
+	}
+
+	return lastUse != "" && lastUse < since
+}
+
+func (f ServiceTypeFilter) matches(qs QServiceType) bool {
+	return strings.HasPrefix(qs.Name, f.NamePrefix) && (f.Type == "" || qs.Type == f.Type) &&
+		inRange(qs.CreatedOn, f.CreatedAfter, f.CreatedBefore)
+}
+
+func (f AuthMethodFilter) matches(qam QAuthMethod) bool {
+
+	basic := qam.Basic()
+
+	return (f.ServiceUUID == "" || basic.ServiceUUID == f.ServiceUUID) && (f.Host == "" || basic.Host == f.Host) &&
+		(f.Type == "" || basic.Type == f.Type)
+}
+
+func bindingSortKey(qb QBinding, orderBy string) sortKey {
+
+	switch orderBy {
+	case "name":
+		return sortKey{Value: qb.Name, UUID: qb.UUID}
+	case "last_auth":
+		return sortKey{Value: qb.LastAuth, UUID: qb.UUID}
+	}
+
+	return sortKey{Value: qb.CreatedOn, UUID: qb.UUID}
+}
+
+func serviceTypeSortKey(qs QServiceType, orderBy string) sortKey {
+
+	if orderBy == "name" {
+		return sortKey{Value: qs.Name, UUID: qs.UUID}
+	}
+
+	return sortKey{Value: qs.CreatedOn, UUID: qs.UUID}
+}
+
+func authMethodSortKey(qam QAuthMethod, orderBy string) sortKey {
+
+	if orderBy == "host" {
+		return sortKey{Value: qam.Basic().Host, UUID: qam.Basic().UUID}
+	}
+
+	return sortKey{Value: qam.Basic().CreatedOn, UUID: qam.Basic().UUID}
+}
+
+// listBindings filters, sorts and pages the given bindings in memory, for the stores that can't query them
+func listBindings(all []QBinding, filter BindingFilter, opts ListOptions) (QBindingsPage, error) {
+
+	var keys []sortKey
+	var matched []QBinding
+	var qPage = QBindingsPage{Bindings: []QBinding{}}
+
+	orderBy, err := opts.orderBy(BindingsOrderBy)
+	if err != nil {
+		return qPage, err
+	}
+
+	cursor, err := opts.cursor(orderBy)
+	if err != nil {
+		return qPage, err
+	}
+
+	for _, qb := range all {
+		if filter.matches(qb) {
+			matched = append(matched, qb)
+			keys = append(keys, bindingSortKey(qb, orderBy))
+		}
+	}
+
+	page, next := pageOf(keys, opts, orderBy, cursor)
+	for _, idx := range page {
+		qPage.Bindings = append(qPage.Bindings, matched[idx])
+	}
+
+	qPage.NextPageToken = next
+	qPage.TotalSize = len(matched)
+
+	return qPage, nil
+}
+
+// listServiceTypes filters, sorts and pages the given service types in memory, for the stores that can't query them
+func listServiceTypes(all []QServiceType, filter ServiceTypeFilter, opts ListOptions) (QServiceTypesPage, error) {
+
+	var keys []sortKey
+	var matched []QServiceType
+	var qPage = QServiceTypesPage{ServiceTypes: []QServiceType{}}
+
+	orderBy, err := opts.orderBy(ServiceTypesOrderBy)
+	if err != nil {
+		return qPage, err
+	}
+
+	cursor, err := opts.cursor(orderBy)
+	if err != nil {
+		return qPage, err
+	}
+
+	for _, qs := range all {
+		if filter.matches(qs) {
+			matched = append(matched, qs)
+			keys = append(keys, serviceTypeSortKey(qs, orderBy))
+		}
+	}
+
+	page, next := pageOf(keys, opts, orderBy, cursor)
+	for _, idx := range page {
+		qPage.ServiceTypes = append(qPage.ServiceTypes, matched[idx])
+	}
+
+	qPage.NextPageToken = next
+	qPage.TotalSize = len(matched)
+
+	return qPage, nil
+}
+
+// listAuthMethods filters, sorts and pages the given auth methods in memory, for the stores that can't query them
+func listAuthMethods(all []QAuthMethod, filter AuthMethodFilter, opts ListOptions) (QAuthMethodsPage, error) {
+
+	var keys []sortKey
+	var matched []QAuthMethod
+	var qPage = QAuthMethodsPage{AuthMethods: []QAuthMethod{}}
+
+	orderBy, err := opts.orderBy(AuthMethodsOrderBy)
+	if err != nil {
+		return qPage, err
+	}
+
+	cursor, err := opts.cursor(orderBy)
+	if err != nil {
+		return qPage, err
+	}
+
+	for _, qam := range all {
+		if filter.matches(qam) {
+			matched = append(matched, qam)
+			keys = append(keys, authMethodSortKey(qam, orderBy))
+		}
+	}
+
+	page, next := pageOf(keys, opts, orderBy, cursor)
+	for _, idx := range page {
+		qPage.AuthMethods = append(qPage.AuthMethods, matched[idx])
+	}
+
+	qPage.NextPageToken = next
+	qPage.TotalSize = len(matched)
+
+	return qPage, nil
+}
@@ -5,6 +5,9 @@ import (
 	"reflect"
 )
 
+// errMockNotFound is returned when an update or a delete doesn't match any record, the same way mongo reports it
+var errMockNotFound = utils.APIErrDatabase("not found")
+
 type Mockstore struct {
 	Session      bool
 	Server       string
@@ -73,7 +76,8 @@ func (mock *Mockstore) QueryServiceTypes(name string) ([]QServiceType, error) {
 			}
 		}
 	} else {
-		qServices = mock.ServiceTypes
+		// the service types are copied, the same way a query against a real store returns new instances
+		qServices = append(qServices, mock.ServiceTypes...)
 	}
 
 	return qServices, nil
@@ -92,60 +96,31 @@ func (mock *Mockstore) QueryServiceTypesByUUID(uuid string) ([]QServiceType, err
 	return qServices, nil
 }
 
-func (mock *Mockstore) QueryApiKeyAuthMethods(serviceUUID string, host string) ([]QApiKeyAuthMethod, error) {
-
-	var qAuthms []QApiKeyAuthMethod
-	var err error
-	var ok bool
-	var qAuthm *QApiKeyAuthMethod
+// QueryAuthMethods returns copies of the stored auth methods that match the given type, service type and host
+func (mock *Mockstore) QueryAuthMethods(amType string, serviceUUID string, host string) ([]QAuthMethod, error) {
 
-	if serviceUUID == "" && host == "" {
-		for _, am := range mock.AuthMethods {
-			if qAuthm, ok = am.(*QApiKeyAuthMethod); ok {
-				qAuthms = append(qAuthms, *qAuthm)
-			}
-		}
-		return qAuthms, nil
-	}
+	var qAuthms = []QAuthMethod{}
 
 	for _, am := range mock.AuthMethods {
-		if qAuthm, ok = am.(*QApiKeyAuthMethod); ok {
-			if qAuthm.ServiceUUID == serviceUUID && qAuthm.Host == host {
-				qAuthms = append(qAuthms, *qAuthm)
-			}
-		}
-	}
-
-	return qAuthms, err
-
-}
 
-func (mock *Mockstore) QueryHeadersAuthMethods(serviceUUID string, host string) ([]QHeadersAuthMethod, error) {
+		basic := am.Basic()
 
-	var qAuthms []QHeadersAuthMethod
-	var err error
-	var ok bool
-	var qAuthm *QHeadersAuthMethod
-
-	if serviceUUID == "" && host == "" {
-		for _, am := range mock.AuthMethods {
-			if qAuthm, ok = am.(*QHeadersAuthMethod); ok {
-				qAuthms = append(qAuthms, *qAuthm)
-			}
+		if amType != "" && basic.Type != amType {
+			continue
 		}
-		return qAuthms, nil
-	}
 
-	for _, am := range mock.AuthMethods {
-		if qAuthm, ok = am.(*QHeadersAuthMethod); ok {
-			if qAuthm.ServiceUUID == serviceUUID && qAuthm.Host == host {
-				qAuthms = append(qAuthms, *qAuthm)
-			}
+		if (serviceUUID != "" || host != "") && (basic.ServiceUUID != serviceUUID || basic.Host != host) {
+			continue
 		}
-	}
 
-	return qAuthms, err
+		// the query model is copied, the same way a query against a real store returns new instances
+		cp := reflect.New(reflect.TypeOf(am).Elem())
+		cp.Elem().Set(reflect.ValueOf(am).Elem())
+
+		qAuthms = append(qAuthms, cp.Interface().(QAuthMethod))
+	}
 
+	return qAuthms, nil
 }
 
 func (mock *Mockstore) QueryBindingsByAuthID(authID string, serviceUUID string, host string, authType string) ([]QBinding, error) {
@@ -161,43 +136,27 @@ func (mock *Mockstore) QueryBindingsByAuthID(authID string, serviceUUID string,
 	return qBindings, nil
 }
 
+// QueryBindingsByUUIDAndName returns the bindings that match the given uuid and name, an empty value matches any binding
 func (mock *Mockstore) QueryBindingsByUUIDAndName(uuid, name string) ([]QBinding, error) {
 
 	var qBindings []QBinding
 
-	if uuid != "" && name == "" {
-		for _, qBinding := range mock.Bindings {
-			if qBinding.UUID == uuid {
-				qBindings = append(qBindings, qBinding)
-			}
-		}
-	}
-
-	if uuid == "" && name != "" {
-		for _, qBinding := range mock.Bindings {
-			if qBinding.Name == name {
-				qBindings = append(qBindings, qBinding)
-			}
-		}
-	}
-
-	if uuid != "" && name != "" {
-		for _, qBinding := range mock.Bindings {
-			if qBinding.UUID == uuid && qBinding.Name == name {
-				qBindings = append(qBindings, qBinding)
-			}
+	for _, qBinding := range mock.Bindings {
+		if (uuid == "" || qBinding.UUID == uuid) && (name == "" || qBinding.Name == name) {
+			qBindings = append(qBindings, qBinding)
 		}
 	}
 
 	return qBindings, nil
 }
 
+// QueryBindings returns the bindings of the given service type and host, or all of them if either one is empty
 func (mock *Mockstore) QueryBindings(serviceUUID string, host string) ([]QBinding, error) {
 
 	var qBindings []QBinding
 
-	if serviceUUID == "" && host == "" {
-		qBindings = mock.Bindings
+	if serviceUUID == "" || host == "" {
+		qBindings = append(qBindings, mock.Bindings...)
 		return qBindings, nil
 	}
 
@@ -210,13 +169,63 @@ func (mock *Mockstore) QueryBindings(serviceUUID string, host string) ([]QBindin
 	return qBindings, nil
 }
 
+func (mock *Mockstore) ListBindings(filter BindingFilter, opts ListOptions) (QBindingsPage, error) {
+	return listBindings(mock.Bindings, filter, opts)
+}
+
+func (mock *Mockstore) ListServiceTypes(filter ServiceTypeFilter, opts ListOptions) (QServiceTypesPage, error) {
+	return listServiceTypes(mock.ServiceTypes, filter, opts)
+}
+
+func (mock *Mockstore) ListAuthMethods(filter AuthMethodFilter, opts ListOptions) (QAuthMethodsPage, error) {
+
+	// the auth methods are listed as copies, the same way they are queried
+	qAuthms, _ := mock.QueryAuthMethods("", "", "")
+
+	return listAuthMethods(qAuthms, filter, opts)
+}
+
 func (mock *Mockstore) InsertAuthMethod(am QAuthMethod) error {
 
+	var err error
+
+	if am, err = EncryptSecrets(am); err != nil {
+		return utils.APIGenericInternalError(err.Error())
+	}
+
 	mock.AuthMethods = append(mock.AuthMethods, am)
 
 	return nil
 }
 
+// findAuthMethod returns the index of the given auth method, or -1 if it is not found.
+// Auth methods are matched by their content, after decrypting the stored secrets,
+// or else by their uuid, the same way mongo selects them
+func (mock *Mockstore) findAuthMethod(am QAuthMethod) int {
+
+	for idx, stored := range mock.AuthMethods {
+
+		decrypted, err := DecryptSecrets(stored)
+		if err != nil {
+			continue
+		}
+
+		if reflect.DeepEqual(decrypted, am) {
+			return idx
+		}
+	}
+
+	if uuid := am.Basic().UUID; uuid != "" {
+		for idx, stored := range mock.AuthMethods {
+			if stored.Basic().UUID == uuid {
+				return idx
+			}
+		}
+	}
+
+	return -1
+}
+
 func (mock *Mockstore) InsertServiceType(name string, hosts []string, authTypes []string, authMethod string, uuid string, createdOn string, sType string) (QServiceType, error) {
 
 	qService := QServiceType{Name: name, Hosts: hosts, AuthTypes: authTypes, AuthMethod: authMethod, UUID: uuid, CreatedOn: createdOn, Type: sType}
@@ -226,7 +235,7 @@ func (mock *Mockstore) InsertServiceType(name string, hosts []string, authTypes
 	return qService, nil
 }
 
-func (mock *Mockstore) InsertBinding(name string, serviceUUID string, host string, uuid string, authID string, uniqueKey string, authType string) (QBinding, error) {
+func (mock *Mockstore) InsertBinding(name string, serviceUUID string, host string, uuid string, authID string, uniqueKey string, authType string, authMethod string) (QBinding, error) {
 
 	qBinding := QBinding{
 		Name:           name,
@@ -237,6 +246,7 @@ func (mock *Mockstore) InsertBinding(name string, serviceUUID string, host strin
 		UniqueKey:      uniqueKey,
 		AuthType:       authType,
 		CreatedOn:      utils.ZuluTimeNow(),
+		AuthMethod:     authMethod,
 	}
 
 	mock.Bindings = append(mock.Bindings, qBinding)
@@ -247,15 +257,33 @@ func (mock *Mockstore) InsertBinding(name string, serviceUUID string, host strin
 
 func (mock *Mockstore) UpdateBinding(original QBinding, updated QBinding) (QBinding, error) {
 
-	// find the  binding in the list and replace it
+	// find the  binding in the list and replace it, keeping its usage
 	for idx, qb := range mock.Bindings {
-		if qb == original {
+		if mockSameBinding(qb, original) && qb.Revision == original.Revision {
+			updated = updated.withUsageOf(qb)
 			mock.Bindings[idx] = updated
-			break
+			return updated, nil
 		}
 	}
 
-	return updated, nil
+	for _, qb := range mock.Bindings {
+		if original.UUID != "" && qb.UUID == original.UUID && qb.Revision != original.Revision {
+			return QBinding{}, errBindingModified
+		}
+	}
+
+	return QBinding{}, errMockNotFound
+}
+
+// mockSameBinding matches bindings by their uuid, the usage of a binding may have changed since it was read.
+// Bindings without a uuid are matched by their content
+func mockSameBinding(qb QBinding, other QBinding) bool {
+
+	if other.UUID != "" {
+		return qb.UUID == other.UUID
+	}
+
+	return qb == other
 }
 
 func (mock *Mockstore) UpdateServiceType(original QServiceType, updated QServiceType) (QServiceType, error) {
@@ -264,23 +292,39 @@ func (mock *Mockstore) UpdateServiceType(original QServiceType, updated QService
 	for idx, sv := range mock.ServiceTypes {
 		if reflect.DeepEqual(original, sv) { // requires DeepEqual because structs with []string as fields can't be compared
 			mock.ServiceTypes[idx] = updated
-			break
+			return updated, nil
 		}
 	}
 
-	return updated, nil
+	for _, sv := range mock.ServiceTypes {
+		if original.UUID != "" && sv.UUID == original.UUID && sv.Revision != original.Revision {
+			return QServiceType{}, errServiceTypeModified
+		}
+	}
+
+	return QServiceType{}, errMockNotFound
 }
 
 func (mock *Mockstore) UpdateAuthMethod(original QAuthMethod, updated QAuthMethod) (QAuthMethod, error) {
 
+	var err error
+
+	if updated, err = EncryptSecrets(updated); err != nil {
+		return nil, utils.APIGenericInternalError(err.Error())
+	}
+
 	// find the auth method in the list and replace it
-	for idx, sv := range mock.AuthMethods {
-		if reflect.DeepEqual(original, sv) {
-			mock.AuthMethods[idx] = updated
-			break
-		}
+	idx := mock.findAuthMethod(original)
+	if idx < 0 {
+		return nil, errMockNotFound
 	}
 
+	if mock.AuthMethods[idx].Basic().Revision != original.Basic().Revision {
+		return nil, errAuthMethodModified
+	}
+
+	mock.AuthMethods[idx] = updated
+
 	return updated, nil
 }
 
@@ -289,7 +333,21 @@ func (mock *Mockstore) DeleteServiceTypeByUUID(uuid string) error {
 	for idx, st := range mock.ServiceTypes {
 		if st.UUID == uuid {
 			mock.ServiceTypes = append(mock.ServiceTypes[:idx], mock.ServiceTypes[idx+1:]...)
-			break
+			return nil
+		}
+	}
+
+	return errMockNotFound
+}
+
+// RecordBindingUsage adds the authentications to the usage of the bindings in the slice
+func (mock *Mockstore) RecordBindingUsage(usages []QBindingUsage) error {
+
+	for _, usage := range usages {
+		for idx, qb := range mock.Bindings {
+			if qb.UUID == usage.UUID {
+				mock.Bindings[idx] = qb.withUsage(usage)
+			}
 		}
 	}
 
@@ -299,15 +357,15 @@ func (mock *Mockstore) DeleteServiceTypeByUUID(uuid string) error {
 // DeleteBinding removes the given qBinding from the slice of bindings
 func (mock *Mockstore) DeleteBinding(qBinding QBinding) error {
 
-	// find the  binding in the list and replace it
+	// find the  binding in the list and remove it
 	for idx, qb := range mock.Bindings {
-		if qb == qBinding {
+		if mockSameBinding(qb, qBinding) {
 			mock.Bindings = append(mock.Bindings[:idx], mock.Bindings[idx+1:]...)
-			break
+			return nil
 		}
 	}
 
-	return nil
+	return errMockNotFound
 }
 
 func (mock *Mockstore) DeleteBindingByServiceUUID(serviceUUID string) error {
@@ -327,18 +385,15 @@ func (mock *Mockstore) DeleteBindingByServiceUUID(serviceUUID string) error {
 
 func (mock *Mockstore) DeleteAuthMethod(am QAuthMethod) error {
 
-	// loop through the slice of auth methods
-	// and delete
-
-	for idx, ami := range mock.AuthMethods {
-		if reflect.DeepEqual(ami, am) {
-			mock.AuthMethods = append(mock.AuthMethods[:idx], mock.AuthMethods[idx+1:]...)
-			break
-		}
+	// find the auth method in the list and delete it
+	idx := mock.findAuthMethod(am)
+	if idx < 0 {
+		return errMockNotFound
 	}
 
-	return nil
+	mock.AuthMethods = append(mock.AuthMethods[:idx], mock.AuthMethods[idx+1:]...)
 
+	return nil
 }
 
 func (mock *Mockstore) DeleteAuthMethodByServiceUUID(serviceUUID string) error {
@@ -346,11 +401,15 @@ func (mock *Mockstore) DeleteAuthMethodByServiceUUID(serviceUUID string) error {
 	var remainingQAM []QAuthMethod
 
 	for _, qam := range mock.AuthMethods {
-		i, _ := utils.GetFieldValueByName(qam, "ServiceUUID")
-		if i.(string) != serviceUUID {
+		if qam.Basic().ServiceUUID != serviceUUID {
 			remainingQAM = append(remainingQAM, qam)
 		}
 	}
 	mock.AuthMethods = remainingQAM
 	return nil
 }
+
+// RunInTransaction emulates a unit of work, the changes of a failed one are reverted
+func (mock *Mockstore) RunInTransaction(fn func(tx Store) error) error {
+	return runCompensated(mock, fn)
+}
@@ -1,6 +1,8 @@
 package stores
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/ARGOeu/argo-api-authn/utils"
 	LOGGER "github.com/sirupsen/logrus"
 )
@@ -13,6 +15,19 @@ type QServiceType struct {
 	UUID       string   `json:"uuid" bson:"uuid"`
 	CreatedOn  string   `json:"created_on,omitempty" bson:"created_on,omitempty"`
 	Type       string   `json:"type" bson:"type"`
+	// HostDetails holds the metadata of the service type's hosts, hosts without details are enabled and have no aliases
+	HostDetails []QHost `json:"host_details,omitempty" bson:"host_details,omitempty"`
+	// Revision is incremented on every update, the stores only update a service type whose revision hasn't changed
+	Revision int64 `json:"revision" bson:"revision"`
+}
+
+// QHost holds the metadata of a service type's host
+type QHost struct {
+	Name        string   `json:"name" bson:"name"`
+	Description string   `json:"description,omitempty" bson:"description,omitempty"`
+	Enabled     bool     `json:"enabled" bson:"enabled"`
+	Aliases     []string `json:"aliases,omitempty" bson:"aliases,omitempty"`
+	CreatedOn   string   `json:"created_on,omitempty" bson:"created_on,omitempty"`
 }
 
 type QBinding struct {
@@ -25,27 +40,142 @@ type QBinding struct {
 	UniqueKey      string `json:"unique_key,omitempty"`
 	CreatedOn      string `json:"created_on,omitempty" bson:"created_on,omitempty"`
 	LastAuth       string `json:"last_auth,omitempty" bson:"last_auth,omitempty"`
+	AuthMethod     string `json:"auth_method,omitempty" bson:"auth_method,omitempty"`
+	Revision       int64  `json:"revision" bson:"revision"`
+	// AuthCount and LastClientIP are recorded along with LastAuth, they don't change the revision of the binding
+	AuthCount    int64  `json:"auth_count,omitempty" bson:"auth_count,omitempty"`
+	LastClientIP string `json:"last_client_ip,omitempty" bson:"last_client_ip,omitempty"`
+	// Enabled is only set once a binding has been disabled or re-enabled, bindings without it are enabled
+	Enabled          *bool  `json:"enabled,omitempty" bson:"enabled,omitempty"`
+	SuspensionReason string `json:"suspension_reason,omitempty" bson:"suspension_reason,omitempty"`
+	// NotBefore and NotAfter limit the period that the binding can be used in, empty limits are ignored
+	NotBefore string `json:"not_before,omitempty" bson:"not_before,omitempty"`
+	NotAfter  string `json:"not_after,omitempty" bson:"not_after,omitempty"`
+}
+
+// QBindingUsage holds the successful authentications through a binding that haven't been recorded yet
+type QBindingUsage struct {
+	UUID string
+	// Count is the number of the authentications, it is added to the binding's AuthCount
+	Count int64
+	// LastAuth and ClientIP are the time and the client address of the latest authentication
+	LastAuth string
+	ClientIP string
+}
+
+// withUsage returns the binding with the given authentications added to its usage
+// withUsageOf returns the binding with the usage of the given one, updates of a binding don't change its usage
+func (qb QBinding) withUsageOf(stored QBinding) QBinding {
+
+	qb.AuthCount = stored.AuthCount
+	qb.LastAuth = stored.LastAuth
+	qb.LastClientIP = stored.LastClientIP
+
+	return qb
+}
+
+func (qb QBinding) withUsage(usage QBindingUsage) QBinding {
+
+	qb.AuthCount += usage.Count
+	qb.LastClientIP = usage.ClientIP
+
+	if usage.LastAuth > qb.LastAuth {
+		qb.LastAuth = usage.LastAuth
+	}
+
+	return qb
+}
+
+// QAuthMethod is the query model of an auth method, all query models embed QBasicAuthMethod
+type QAuthMethod interface {
+	// Basic gives access to the fields that are common to all the query auth methods
+	Basic() *QBasicAuthMethod
+}
+
+type QRequestTemplate struct {
+	Method  string            `json:"method,omitempty" bson:"method,omitempty"`
+	Scheme  string            `json:"scheme,omitempty" bson:"scheme,omitempty"`
+	Path    string            `json:"path" bson:"path"`
+	Query   map[string]string `json:"query,omitempty" bson:"query,omitempty"`
+	Headers map[string]string `json:"headers,omitempty" bson:"headers,omitempty"`
+	Body    string            `json:"body,omitempty" bson:"body,omitempty"`
+}
+
+type QResponseField struct {
+	Name string `json:"name" bson:"name"`
+	Path string `json:"path" bson:"path"`
+	Type string `json:"type,omitempty" bson:"type,omitempty"`
 }
 
-type QAuthMethod interface{}
+type QClientOptions struct {
+	Timeout      int    `json:"timeout,omitempty" bson:"timeout,omitempty"`
+	CABundle     string `json:"ca_bundle,omitempty" bson:"ca_bundle,omitempty"`
+	ServerName   string `json:"server_name,omitempty" bson:"server_name,omitempty"`
+	MaxIdleConns int    `json:"max_idle_conns,omitempty" bson:"max_idle_conns,omitempty"`
+	HTTP2        bool   `json:"http2,omitempty" bson:"http2,omitempty"`
+	MaxRetries   *int   `json:"max_retries,omitempty" bson:"max_retries,omitempty"`
+	RetryBackoff int    `json:"retry_backoff,omitempty" bson:"retry_backoff,omitempty"`
+}
 
 type QBasicAuthMethod struct {
-	ServiceUUID string `json:"service_uuid" bson:"service_uuid"`
-	Port        int    `json:"port" bson:"port"`
-	Host        string `json:"host" bson:"host"`
-	Type        string `json:"type" bson:"type"`
-	UUID        string `json:"uuid" bson:"uuid"`
-	CreatedOn   string `json:"created_on" bson:"created_on"`
+	ServiceUUID       string            `json:"service_uuid" bson:"service_uuid"`
+	Port              int               `json:"port" bson:"port"`
+	Host              string            `json:"host" bson:"host"`
+	Type              string            `json:"type" bson:"type"`
+	UUID              string            `json:"uuid" bson:"uuid"`
+	CreatedOn         string            `json:"created_on" bson:"created_on"`
+	RequestTemplate   *QRequestTemplate `json:"request_template,omitempty" bson:"request_template,omitempty"`
+	RetrievalField    string            `json:"retrieval_field,omitempty" bson:"retrieval_field,omitempty"`
+	ResponseMapping   []QResponseField  `json:"response_mapping,omitempty" bson:"response_mapping,omitempty"`
+	ClientOptions     *QClientOptions   `json:"client_options,omitempty" bson:"client_options,omitempty"`
+	FallbackEndpoints []string          `json:"fallback_endpoints,omitempty" bson:"fallback_endpoints,omitempty"`
+	SecretStagedOn    string            `json:"secret_staged_on,omitempty" bson:"secret_staged_on,omitempty"`
+	SecretPromotedOn  string            `json:"secret_promoted_on,omitempty" bson:"secret_promoted_on,omitempty"`
+	Name              string            `json:"name,omitempty" bson:"name,omitempty"`
+	Priority          int               `json:"priority,omitempty" bson:"priority,omitempty"`
+	Revision          int64             `json:"revision" bson:"revision"`
 }
 
 type QApiKeyAuthMethod struct {
 	QBasicAuthMethod `bson:",inline"`
-	AccessKey        string `json:"access_key" bson:"access_key"`
+	AccessKey        string `json:"access_key" bson:"access_key" secret:"true"`
+	NextAccessKey    string `json:"next_access_key,omitempty" bson:"next_access_key,omitempty" secret:"true"`
 }
 
 type QHeadersAuthMethod struct {
 	QBasicAuthMethod `bson:",inline"`
-	Headers          map[string]string `json:"headers" bson:"headers"`
+	Headers          map[string]string `json:"headers" bson:"headers" secret:"true"`
+	NextHeaders      map[string]string `json:"next_headers,omitempty" bson:"next_headers,omitempty" secret:"true"`
+}
+
+func (m *QBasicAuthMethod) Basic() *QBasicAuthMethod {
+	return m
+}
+
+// decodeAuthMethod decodes the json representation of a stored auth method into the query model of its type.
+// It returns nil for auth methods of unregistered types
+func decodeAuthMethod(data []byte) (QAuthMethod, error) {
+
+	var header struct {
+		Type string `json:"type"`
+	}
+
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+
+	qAmInit, ok := QAuthMethodsTypes[header.Type]
+	if !ok {
+		LOGGER.Warning("STORE", "\t", "Skipping an auth method of unregistered type: ", header.Type)
+		return nil, nil
+	}
+
+	qam := qAmInit()
+	if err := json.Unmarshal(data, qam); err != nil {
+		return nil, err
+	}
+
+	return qam, nil
 }
 
 type QAuthMethodFactory struct{}
@@ -68,9 +198,19 @@ func (f *QAuthMethodFactory) Create(amType string) (QAuthMethod, error) {
 
 type QAuthMethodInit func() QAuthMethod
 
-var QAuthMethodsTypes = map[string]QAuthMethodInit{
-	"api-key": NewQApiKeyAuthMethod,
-	"headers": NewQHeadersAuthMethod,
+// QAuthMethodsTypes holds the query models of the registered auth method types,
+// including the built-in ones, which are registered by the authmethods package, see RegisterQueryModel
+var QAuthMethodsTypes = map[string]QAuthMethodInit{}
+
+// RegisterQueryModel declares the query model that the auth methods of the given type are stored as.
+// It is called through authmethods.Register and panics if the type has already been registered
+func RegisterQueryModel(amType string, init QAuthMethodInit) {
+
+	if _, ok := QAuthMethodsTypes[amType]; ok {
+		panic(fmt.Sprintf("stores: RegisterQueryModel called twice for auth method type %v", amType))
+	}
+
+	QAuthMethodsTypes[amType] = init
 }
 
 func NewQApiKeyAuthMethod() QAuthMethod {
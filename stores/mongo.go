@@ -5,6 +5,7 @@ import (
 	LOGGER "github.com/sirupsen/logrus"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
+	"regexp"
 )
 
 type MongoStore struct {
@@ -13,7 +14,7 @@ type MongoStore struct {
 	Session  *mgo.Session
 }
 
-// Initialize initializes the mongo stores struct
+// SetUp connects to mongo and brings the schema of the database up to date
 func (mongo *MongoStore) SetUp() {
 
 	for {
@@ -28,6 +29,10 @@ func (mongo *MongoStore) SetUp() {
 		LOGGER.Info("STORE", "\t", "Connected to Mongo: ", mongo.Server)
 		break
 	}
+
+	if err := mongo.Migrate(); err != nil {
+		LOGGER.Fatal("STORE", "\t", "Could not migrate the mongo schema: ", err.Error())
+	}
 }
 
 func (mongo *MongoStore) Clone() Store {
@@ -84,52 +89,69 @@ func (mongo *MongoStore) QueryServiceTypesByUUID(uuid string) ([]QServiceType, e
 	return qServices, err
 }
 
-func (mongo *MongoStore) QueryApiKeyAuthMethods(serviceUUID string, host string) ([]QApiKeyAuthMethod, error) {
-
-	var err error
-	var qAuthms []QApiKeyAuthMethod
+// QueryAuthMethods returns the auth methods of the given type for the given service type and host.
+// An empty type matches auth methods of any registered type, while if there is no serviceUUID and host provided,
+// the auth methods of all the service types and hosts are returned
+func (mongo *MongoStore) QueryAuthMethods(amType string, serviceUUID string, host string) ([]QAuthMethod, error) {
 
-	var query = bson.M{"service_uuid": serviceUUID, "host": host, "type": "api-key"}
+	var query = bson.M{"service_uuid": serviceUUID, "host": host}
 
-	// if there is no serviceUUID and host provided, return all api key auth methods
 	if serviceUUID == "" && host == "" {
-		query = bson.M{"type": "api-key"}
+		query = bson.M{}
 	}
 
-	c := mongo.Session.DB(mongo.Database).C("auth_methods")
-	err = c.Find(query).All(&qAuthms)
-
-	if err != nil {
-		LOGGER.Error("STORE", "\t", err.Error())
-		err = utils.APIErrDatabase(err.Error())
-		return qAuthms, err
+	if amType != "" {
+		query["type"] = amType
 	}
 
-	return qAuthms, err
+	c := mongo.Session.DB(mongo.Database).C("auth_methods")
+
+	return decodeMongoAuthMethods(c.Find(query).Iter())
 }
 
-func (mongo *MongoStore) QueryHeadersAuthMethods(serviceUUID string, host string) ([]QHeadersAuthMethod, error) {
+// decodeMongoAuthMethods decodes each auth method of the iterator into the query model of its type
+func decodeMongoAuthMethods(iter *mgo.Iter) ([]QAuthMethod, error) {
 
 	var err error
-	var qAuthms []QHeadersAuthMethod
+	var raw bson.Raw
+	var qAuthms = []QAuthMethod{}
 
-	var query = bson.M{"service_uuid": serviceUUID, "host": host, "type": "headers"}
+	for iter.Next(&raw) {
 
-	// if there is no serviceUUID and host provided, return all api key auth methods
-	if serviceUUID == "" && host == "" {
-		query = bson.M{"type": "headers"}
-	}
+		var ok bool
+		var qAmInit QAuthMethodInit
+		var header struct {
+			Type string `bson:"type"`
+		}
 
-	c := mongo.Session.DB(mongo.Database).C("auth_methods")
-	err = c.Find(query).All(&qAuthms)
+		if err = raw.Unmarshal(&header); err != nil {
+			LOGGER.Error("STORE", "\t", err.Error())
+			err = utils.APIErrDatabase(err.Error())
+			return qAuthms, err
+		}
 
-	if err != nil {
+		if qAmInit, ok = QAuthMethodsTypes[header.Type]; !ok {
+			LOGGER.Warning("STORE", "\t", "Skipping an auth method of unregistered type: ", header.Type)
+			continue
+		}
+
+		qam := qAmInit()
+		if err = raw.Unmarshal(qam); err != nil {
+			LOGGER.Error("STORE", "\t", err.Error())
+			err = utils.APIErrDatabase(err.Error())
+			return qAuthms, err
+		}
+
+		qAuthms = append(qAuthms, qam)
+	}
+
+	if err = iter.Close(); err != nil {
 		LOGGER.Error("STORE", "\t", err.Error())
 		err = utils.APIErrDatabase(err.Error())
 		return qAuthms, err
 	}
 
-	return qAuthms, err
+	return qAuthms, nil
 }
 
 func (mongo *MongoStore) InsertAuthMethod(am QAuthMethod) error {
@@ -139,6 +161,13 @@ func (mongo *MongoStore) InsertAuthMethod(am QAuthMethod) error {
 	db := mongo.Session.DB(mongo.Database)
 	c := db.C("auth_methods")
 
+	// secrets are never stored in clear text, when a keyring has been loaded
+	if am, err = EncryptSecrets(am); err != nil {
+		LOGGER.Error("STORE", "\t", err.Error())
+		err = utils.APIGenericInternalError(err.Error())
+		return err
+	}
+
 	if err := c.Insert(am); err != nil {
 		LOGGER.Error("STORE", "\t", err.Error())
 		err = utils.APIErrDatabase(err.Error())
@@ -232,16 +261,15 @@ func (mongo *MongoStore) InsertServiceType(name string, hosts []string, authType
 	c := db.C("service_types")
 
 	if err := c.Insert(qService); err != nil {
-		LOGGER.Error("STORE", "\t", err.Error())
-		err = utils.APIErrDatabase(err.Error())
-		return QServiceType{}, nil
+		err = mongoError(err, map[string]string{"name": name})
+		return QServiceType{}, err
 	}
 
 	return qService, err
 }
 
 //InsertBinding inserts a new binding into the datastore
-func (mongo *MongoStore) InsertBinding(name string, serviceUUID string, host string, uuid string, authID string, uniqueKey string, authType string) (QBinding, error) {
+func (mongo *MongoStore) InsertBinding(name string, serviceUUID string, host string, uuid string, authID string, uniqueKey string, authType string, authMethod string) (QBinding, error) {
 
 	var qBinding QBinding
 	var err error
@@ -255,35 +283,118 @@ func (mongo *MongoStore) InsertBinding(name string, serviceUUID string, host str
 		UniqueKey:      uniqueKey,
 		AuthType:       authType,
 		CreatedOn:      utils.ZuluTimeNow(),
+		AuthMethod:     authMethod,
 	}
 
 	db := mongo.Session.DB(mongo.Database)
 	c := db.C("bindings")
 
 	if err := c.Insert(qBinding); err != nil {
-		LOGGER.Error("STORE", "\t", err.Error())
-		err = utils.APIErrDatabase(err.Error())
-		return QBinding{}, nil
+		err = mongoError(err, map[string]string{"name": name, "auth_identifier": authID})
+		return QBinding{}, err
 	}
 
 	return qBinding, err
 }
 
-//UpdateBinding updates the given binding
+// revisionSelector selects the document with the given uuid, as long as it still has the given revision.
+// Documents without a uuid are matched by their whole content
+func revisionSelector(original interface{}, uuid string, revision int64) interface{} {
+
+	if uuid == "" {
+		return original
+	}
+
+	return bson.M{"uuid": uuid, "revision": revision}
+}
+
+// mongoNotUpdated tells apart a document that doesn't exist from a document whose revision has changed,
+// after an update of the document with the given uuid has matched nothing
+func mongoNotUpdated(c *mgo.Collection, uuid string, modified error) error {
+
+	if uuid == "" {
+		return utils.APIErrDatabase(mgo.ErrNotFound.Error())
+	}
+
+	n, err := c.Find(bson.M{"uuid": uuid}).Count()
+	if err != nil {
+		return mongoError(err, nil)
+	}
+
+	if n > 0 {
+		return modified
+	}
+
+	return utils.APIErrDatabase(mgo.ErrNotFound.Error())
+}
+
+// mongoBindingUsageFields are only changed through RecordBindingUsage, updates of bindings leave them as they are
+var mongoBindingUsageFields = []string{"auth_count", "last_auth", "last_client_ip"}
+
+// mongoBindingOptionalFields are left out of the stored binding when they are empty, so updates that empty them unset them
+var mongoBindingOptionalFields = []string{"created_on", "auth_method", "enabled", "suspension_reason", "not_before", "not_after"}
+
+// mongoBindingUpdate returns the update that sets the fields of the given binding, apart from its usage
+func mongoBindingUpdate(qBinding QBinding) (bson.M, error) {
+
+	var set bson.M
+
+	b, err := bson.Marshal(qBinding)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = bson.Unmarshal(b, &set); err != nil {
+		return nil, err
+	}
+
+	for _, field := range mongoBindingUsageFields {
+		delete(set, field)
+	}
+
+	update := bson.M{"$set": set}
+
+	unset := bson.M{}
+	for _, field := range mongoBindingOptionalFields {
+		if _, ok := set[field]; !ok {
+			unset[field] = ""
+		}
+	}
+
+	// mongo rejects empty update operators
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	return update, nil
+}
+
+//UpdateBinding updates the given binding, apart from its usage which is recorded in the background, and returns it as stored
 func (mongo *MongoStore) UpdateBinding(original QBinding, updated QBinding) (QBinding, error) {
 
 	var err error
+	var update bson.M
+	var stored QBinding
 
 	db := mongo.Session.DB(mongo.Database)
 	c := db.C("bindings")
 
-	if err := c.Update(original, updated); err != nil {
+	if update, err = mongoBindingUpdate(updated); err != nil {
 		LOGGER.Error("STORE", "\t", err.Error())
-		err = utils.APIErrDatabase(err.Error())
+		return QBinding{}, utils.APIErrDatabase(err.Error())
+	}
+
+	change := mgo.Change{Update: update, ReturnNew: true}
+
+	if _, err := c.Find(revisionSelector(original, original.UUID, original.Revision)).Apply(change, &stored); err != nil {
+		if err == mgo.ErrNotFound {
+			return QBinding{}, mongoNotUpdated(c, original.UUID, errBindingModified)
+		}
+		err = mongoError(err, map[string]string{"name": updated.Name, "auth_identifier": updated.AuthIdentifier})
 		return QBinding{}, err
 	}
 
-	return updated, err
+	return stored, err
 }
 
 //UpdateServiceType updates the given binding
@@ -294,9 +405,11 @@ func (mongo *MongoStore) UpdateServiceType(original QServiceType, updated QServi
 	db := mongo.Session.DB(mongo.Database)
 	c := db.C("service_types")
 
-	if err := c.Update(original, updated); err != nil {
-		LOGGER.Error("STORE", "\t", err.Error())
-		err = utils.APIErrDatabase(err.Error())
+	if err := c.Update(revisionSelector(original, original.UUID, original.Revision), updated); err != nil {
+		if err == mgo.ErrNotFound {
+			return QServiceType{}, mongoNotUpdated(c, original.UUID, errServiceTypeModified)
+		}
+		err = mongoError(err, map[string]string{"name": updated.Name})
 		return QServiceType{}, err
 	}
 
@@ -311,7 +424,19 @@ func (mongo *MongoStore) UpdateAuthMethod(original QAuthMethod, updated QAuthMet
 	db := mongo.Session.DB(mongo.Database)
 	c := db.C("auth_methods")
 
-	if err := c.Update(original, updated); err != nil {
+	// the stored secrets are encrypted, so the auth method can't be matched by its content
+	selector := revisionSelector(original, original.Basic().UUID, original.Basic().Revision)
+
+	if updated, err = EncryptSecrets(updated); err != nil {
+		LOGGER.Error("STORE", "\t", err.Error())
+		err = utils.APIGenericInternalError(err.Error())
+		return nil, err
+	}
+
+	if err := c.Update(selector, updated); err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, mongoNotUpdated(c, original.Basic().UUID, errAuthMethodModified)
+		}
 		LOGGER.Error("STORE", "\t", err.Error())
 		err = utils.APIErrDatabase(err.Error())
 		return nil, err
@@ -338,6 +463,35 @@ func (mongo *MongoStore) DeleteServiceTypeByUUID(uuid string) error {
 	return err
 }
 
+// RecordBindingUsage adds the authentications to the usage of the bindings through a single bulk write
+func (mongo *MongoStore) RecordBindingUsage(usages []QBindingUsage) error {
+
+	if len(usages) == 0 {
+		return nil
+	}
+
+	db := mongo.Session.DB(mongo.Database)
+	c := db.C("bindings")
+
+	bulk := c.Bulk()
+	bulk.Unordered()
+
+	for _, usage := range usages {
+		bulk.Update(bson.M{"uuid": usage.UUID}, bson.M{
+			"$inc": bson.M{"auth_count": usage.Count},
+			"$max": bson.M{"last_auth": usage.LastAuth},
+			"$set": bson.M{"last_client_ip": usage.ClientIP},
+		})
+	}
+
+	if _, err := bulk.Run(); err != nil {
+		LOGGER.Error("STORE", "\t", err.Error())
+		return utils.APIErrDatabase(err.Error())
+	}
+
+	return nil
+}
+
 // Delete binding deletes a binding from the store
 func (mongo *MongoStore) DeleteBinding(qBinding QBinding) error {
 
@@ -346,7 +500,13 @@ func (mongo *MongoStore) DeleteBinding(qBinding QBinding) error {
 	db := mongo.Session.DB(mongo.Database)
 	c := db.C("bindings")
 
-	if err := c.Remove(qBinding); err != nil {
+	// the usage of the binding might have been recorded since it was read, so it is matched by its uuid rather than its content
+	selector := interface{}(qBinding)
+	if qBinding.UUID != "" {
+		selector = bson.M{"uuid": qBinding.UUID}
+	}
+
+	if err := c.Remove(selector); err != nil {
 		LOGGER.Error("STORE", "\t", err.Error())
 		err = utils.APIErrDatabase(err.Error())
 		return err
@@ -376,10 +536,17 @@ func (mongo *MongoStore) DeleteAuthMethod(am QAuthMethod) error {
 
 	var err error
 
+	var selector interface{} = am
+
 	db := mongo.Session.DB(mongo.Database)
 	c := db.C("auth_methods")
 
-	if err := c.Remove(am); err != nil {
+	// the stored secrets are encrypted, so the auth method can't be matched by its content
+	if uuid := am.Basic().UUID; uuid != "" {
+		selector = bson.M{"uuid": uuid}
+	}
+
+	if err := c.Remove(selector); err != nil {
 		LOGGER.Error("STORE", "\t", err.Error())
 		err = utils.APIErrDatabase(err.Error())
 		return err
@@ -406,3 +573,258 @@ func (mongo *MongoStore) DeleteAuthMethodByServiceUUID(serviceUUID string) error
 	return err
 
 }
+
+// RunInTransaction runs the given function as a unit of work.
+// The mgo driver doesn't support the multi-document transactions of mongo, so units of work are emulated
+// by reverting the changes of the ones that fail. They are not atomic, a revert that fails leaves its change applied
+func (mongo *MongoStore) RunInTransaction(fn func(tx Store) error) error {
+	return runCompensated(mongo, fn)
+}
+
+// mongoBefore matches the documents whose field is listed before the given value, documents without the field
+// are listed the same way as the ones with an empty value
+func mongoBefore(field string, value string) bson.M {
+
+	if value == "" {
+		return bson.M{field: bson.M{"$lt": ""}}
+	}
+
+	return bson.M{"$or": []bson.M{{field: bson.M{"$lt": value}}, {field: nil}}}
+}
+
+// mongoEqual matches the documents whose field has the given value, documents without the field have an empty value
+func mongoEqual(field string, value string) bson.M {
+
+	if value == "" {
+		return bson.M{field: bson.M{"$in": []interface{}{nil, ""}}}
+	}
+
+	return bson.M{field: value}
+}
+
+// mongoAfterCursor matches the documents that are listed after the cursor, in the order of the given field and the uuid
+func mongoAfterCursor(field string, cursor *pageCursor) bson.M {
+
+	if cursor.Descending {
+		return bson.M{"$or": []bson.M{
+			mongoBefore(field, cursor.Value),
+			{"$and": []bson.M{mongoEqual(field, cursor.Value), {"uuid": bson.M{"$lt": cursor.UUID}}}},
+		}}
+	}
+
+	return bson.M{"$or": []bson.M{
+		{field: bson.M{"$gt": cursor.Value}},
+		{"$and": []bson.M{mongoEqual(field, cursor.Value), {"uuid": bson.M{"$gt": cursor.UUID}}}},
+	}}
+}
+
+// mongoRange matches the documents whose field is within the range of the given start and end, empty limits are ignored
+func mongoRange(field string, start string, end string) []bson.M {
+
+	var conditions []bson.M
+
+	if start != "" {
+		conditions = append(conditions, bson.M{field: bson.M{"$gte": start}})
+	}
+
+	if end != "" {
+		conditions = append(conditions, bson.M{field: bson.M{"$lt": end}})
+	}
+
+	return conditions
+}
+
+// mongoPage counts the documents of the collection that match the conditions
+// and returns the query of the requested page
+func mongoPage(c *mgo.Collection, conditions []bson.M, orderBy string, opts ListOptions, cursor *pageCursor) (*mgo.Query, int, error) {
+
+	var query = bson.M{}
+
+	if len(conditions) > 0 {
+		query = bson.M{"$and": conditions}
+	}
+
+	total, err := c.Find(query).Count()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if cursor != nil {
+		query = bson.M{"$and": append(conditions, mongoAfterCursor(orderBy, cursor))}
+	}
+
+	sortBy := []string{orderBy, "uuid"}
+	if opts.Descending {
+		sortBy = []string{"-" + orderBy, "-uuid"}
+	}
+
+	return c.Find(query).Sort(sortBy...).Limit(opts.fetchSize()), total, nil
+}
+
+func (f BindingFilter) mongoConditions() []bson.M {
+
+	var conditions []bson.M
+
+	for field, value := range map[string]string{"service_uuid": f.ServiceUUID, "host": f.Host, "auth_type": f.AuthType} {
+		if value != "" {
+			conditions = append(conditions, bson.M{field: value})
+		}
+	}
+
+	if f.NamePrefix != "" {
+		conditions = append(conditions, bson.M{"name": bson.RegEx{Pattern: "^" + regexp.QuoteMeta(f.NamePrefix)}})
+	}
+
+	if f.AuthIdentifier != "" {
+		conditions = append(conditions, bson.M{"auth_identifier": bson.RegEx{Pattern: regexp.QuoteMeta(f.AuthIdentifier)}})
+	}
+
+	// bindings that haven't been used have no last_auth, so they never match its ranges
+	conditions = append(conditions, mongoRange("created_on", f.CreatedAfter, f.CreatedBefore)...)
+	conditions = append(conditions, mongoRange("last_auth", f.LastAuthAfter, f.LastAuthBefore)...)
+
+	if f.UnusedSince != "" {
+		conditions = append(conditions, bson.M{"$or": []bson.M{
+			{"last_auth": bson.M{"$gt": "", "$lt": f.UnusedSince}},
+			{"last_auth": bson.M{"$in": []interface{}{nil, ""}}, "created_on": bson.M{"$gt": "", "$lt": f.UnusedSince}},
+		}})
+	}
+
+	return conditions
+}
+
+func (f ServiceTypeFilter) mongoConditions() []bson.M {
+
+	var conditions []bson.M
+
+	if f.NamePrefix != "" {
+		conditions = append(conditions, bson.M{"name": bson.RegEx{Pattern: "^" + regexp.QuoteMeta(f.NamePrefix)}})
+	}
+
+	if f.Type != "" {
+		conditions = append(conditions, bson.M{"type": f.Type})
+	}
+
+	return append(conditions, mongoRange("created_on", f.CreatedAfter, f.CreatedBefore)...)
+}
+
+func (f AuthMethodFilter) mongoConditions() []bson.M {
+
+	var conditions []bson.M
+
+	for field, value := range map[string]string{"service_uuid": f.ServiceUUID, "host": f.Host, "type": f.Type} {
+		if value != "" {
+			conditions = append(conditions, bson.M{field: value})
+		}
+	}
+
+	return conditions
+}
+
+func (mongo *MongoStore) ListBindings(filter BindingFilter, opts ListOptions) (QBindingsPage, error) {
+
+	var qBindings []QBinding
+	var qPage = QBindingsPage{Bindings: []QBinding{}}
+
+	orderBy, err := opts.orderBy(BindingsOrderBy)
+	if err != nil {
+		return qPage, err
+	}
+
+	cursor, err := opts.cursor(orderBy)
+	if err != nil {
+		return qPage, err
+	}
+
+	c := mongo.Session.DB(mongo.Database).C("bindings")
+
+	query, total, err := mongoPage(c, filter.mongoConditions(), orderBy, opts, cursor)
+	if err == nil {
+		err = query.All(&qBindings)
+	}
+
+	if err != nil {
+		LOGGER.Error("STORE", "\t", err.Error())
+		return qPage, utils.APIErrDatabase(err.Error())
+	}
+
+	end, next := opts.pageEnd(len(qBindings), orderBy, func(idx int) sortKey { return bindingSortKey(qBindings[idx], orderBy) })
+
+	qPage.Bindings = append(qPage.Bindings, qBindings[:end]...)
+	qPage.NextPageToken = next
+	qPage.TotalSize = total
+
+	return qPage, nil
+}
+
+func (mongo *MongoStore) ListServiceTypes(filter ServiceTypeFilter, opts ListOptions) (QServiceTypesPage, error) {
+
+	var qServices []QServiceType
+	var qPage = QServiceTypesPage{ServiceTypes: []QServiceType{}}
+
+	orderBy, err := opts.orderBy(ServiceTypesOrderBy)
+	if err != nil {
+		return qPage, err
+	}
+
+	cursor, err := opts.cursor(orderBy)
+	if err != nil {
+		return qPage, err
+	}
+
+	c := mongo.Session.DB(mongo.Database).C("service_types")
+
+	query, total, err := mongoPage(c, filter.mongoConditions(), orderBy, opts, cursor)
+	if err == nil {
+		err = query.All(&qServices)
+	}
+
+	if err != nil {
+		LOGGER.Error("STORE", "\t", err.Error())
+		return qPage, utils.APIErrDatabase(err.Error())
+	}
+
+	end, next := opts.pageEnd(len(qServices), orderBy, func(idx int) sortKey { return serviceTypeSortKey(qServices[idx], orderBy) })
+
+	qPage.ServiceTypes = append(qPage.ServiceTypes, qServices[:end]...)
+	qPage.NextPageToken = next
+	qPage.TotalSize = total
+
+	return qPage, nil
+}
+
+func (mongo *MongoStore) ListAuthMethods(filter AuthMethodFilter, opts ListOptions) (QAuthMethodsPage, error) {
+
+	var qPage = QAuthMethodsPage{AuthMethods: []QAuthMethod{}}
+
+	orderBy, err := opts.orderBy(AuthMethodsOrderBy)
+	if err != nil {
+		return qPage, err
+	}
+
+	cursor, err := opts.cursor(orderBy)
+	if err != nil {
+		return qPage, err
+	}
+
+	c := mongo.Session.DB(mongo.Database).C("auth_methods")
+
+	query, total, err := mongoPage(c, filter.mongoConditions(), orderBy, opts, cursor)
+	if err != nil {
+		LOGGER.Error("STORE", "\t", err.Error())
+		return qPage, utils.APIErrDatabase(err.Error())
+	}
+
+	qAuthms, err := decodeMongoAuthMethods(query.Iter())
+	if err != nil {
+		return qPage, err
+	}
+
+	end, next := opts.pageEnd(len(qAuthms), orderBy, func(idx int) sortKey { return authMethodSortKey(qAuthms[idx], orderBy) })
+
+	qPage.AuthMethods = append(qPage.AuthMethods, qAuthms[:end]...)
+	qPage.NextPageToken = next
+	qPage.TotalSize = total
+
+	return qPage, nil
+}
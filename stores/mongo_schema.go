@@ -0,0 +1,186 @@
+package stores
+
+import (
+	"fmt"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	LOGGER "github.com/sirupsen/logrus"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"regexp"
+)
+
+// mongoSchemaVersionID is the id of the document, in the schema_version collection, that holds the version of the schema
+const mongoSchemaVersionID = "schema"
+
+type mongoSchemaVersion struct {
+	ID        string `bson:"_id"`
+	Version   int    `bson:"version"`
+	UpdatedOn string `bson:"updated_on"`
+}
+
+// mongoMigration changes the database from the previous version of the schema to the next one.
+// Migrations have to be idempotent, since instances of the service that start at the same time may run them concurrently
+type mongoMigration struct {
+	Description string
+	Migrate     func(db *mgo.Database) error
+}
+
+// mongoUniqueIndex is a unique index, along with the resource and the field that its violations are reported for
+type mongoUniqueIndex struct {
+	Collection string
+	Resource   string
+	Field      string
+	Index      mgo.Index
+}
+
+// mongoUniqueIndexes follow the checks that take place when service types and bindings are created,
+// so that concurrent requests can't create the same resource twice
+var mongoUniqueIndexes = []mongoUniqueIndex{
+	{
+		Collection: "service_types",
+		Resource:   "service-type",
+		Field:      "name",
+		Index:      mgo.Index{Name: "service_types_name", Key: []string{"name"}, Unique: true},
+	},
+	{
+		Collection: "bindings",
+		Resource:   "binding",
+		Field:      "name",
+		Index:      mgo.Index{Name: "bindings_name", Key: []string{"name"}, Unique: true},
+	},
+	{
+		Collection: "bindings",
+		Resource:   "binding",
+		Field:      "auth_identifier",
+		Index:      mgo.Index{Name: "bindings_auth_identifier", Key: []string{"auth_identifier", "service_uuid", "host", "auth_type"}, Unique: true},
+	},
+}
+
+// mongoLookupIndexes back the queries of the store
+var mongoLookupIndexes = map[string][]mgo.Index{
+	"service_types": {
+		{Name: "service_types_uuid", Key: []string{"uuid"}},
+	},
+	"bindings": {
+		{Name: "bindings_uuid", Key: []string{"uuid"}},
+		{Name: "bindings_service_uuid_host", Key: []string{"service_uuid", "host"}},
+	},
+	"auth_methods": {
+		{Name: "auth_methods_uuid", Key: []string{"uuid"}},
+		{Name: "auth_methods_service_uuid_host_type", Key: []string{"service_uuid", "host", "type"}},
+	},
+}
+
+// mongoListingIndexes back the orders that the bindings are listed in
+var mongoListingIndexes = []mgo.Index{
+	{Name: "bindings_created_on_uuid", Key: []string{"created_on", "uuid"}},
+	{Name: "bindings_name_uuid", Key: []string{"name", "uuid"}},
+	{Name: "bindings_last_auth_uuid", Key: []string{"last_auth", "uuid"}},
+}
+
+// mongoMigrations are applied in order, the version of the schema is the number of the applied migrations.
+// Existing migrations should never be modified, schema changes are appended as new migrations
+var mongoMigrations = []mongoMigration{
+	{
+		Description: "unique and lookup indexes for service types, bindings and auth methods",
+		Migrate: func(db *mgo.Database) error {
+
+			for _, ui := range mongoUniqueIndexes {
+				if err := db.C(ui.Collection).EnsureIndex(ui.Index); err != nil {
+					return fmt.Errorf("could not create the unique index %v, check for %v with the same %v: %v",
+						ui.Index.Name, ui.Collection, ui.Field, err.Error())
+				}
+			}
+
+			for collection, indexes := range mongoLookupIndexes {
+				for _, index := range indexes {
+					if err := db.C(collection).EnsureIndex(index); err != nil {
+						return err
+					}
+				}
+			}
+
+			return nil
+		},
+	},
+	{
+		Description: "revisions of service types, bindings and auth methods",
+		Migrate: func(db *mgo.Database) error {
+
+			// the updates select the documents by their revision, so documents without one are set to the first revision
+			for _, collection := range []string{"service_types", "bindings", "auth_methods"} {
+				if _, err := db.C(collection).UpdateAll(bson.M{"revision": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"revision": 0}}); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	},
+	{
+		Description: "indexes of the bindings listings",
+		Migrate: func(db *mgo.Database) error {
+
+			for _, index := range mongoListingIndexes {
+				if err := db.C("bindings").EnsureIndex(index); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	},
+}
+
+// Migrate applies the migrations that haven't been applied yet to the database and records the new version of its schema
+func (mongo *MongoStore) Migrate() error {
+
+	var err error
+	var schema mongoSchemaVersion
+
+	db := mongo.Session.DB(mongo.Database)
+	c := db.C("schema_version")
+
+	if err = c.FindId(mongoSchemaVersionID).One(&schema); err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+
+	for idx := schema.Version; idx < len(mongoMigrations); idx++ {
+
+		if err = mongoMigrations[idx].Migrate(db); err != nil {
+			return err
+		}
+
+		update := bson.M{"$set": bson.M{"version": idx + 1, "updated_on": utils.ZuluTimeNow()}}
+		if _, err = c.UpsertId(mongoSchemaVersionID, update); err != nil {
+			return err
+		}
+
+		LOGGER.Infof("STORE\tApplied the mongo schema migration %v: %v", idx+1, mongoMigrations[idx].Description)
+	}
+
+	return nil
+}
+
+// duplicateKeyIndex extracts the name of the violated index from a duplicate key error
+var duplicateKeyIndex = regexp.MustCompile(`index: (\S+) dup key`)
+
+// mongoError logs and converts an error of the database to an api error.
+// Violations of the unique indexes are reported as conflicts, using the given values of the resource's fields,
+// the same way the checks that precede the inserts and updates do
+func mongoError(err error, values map[string]string) error {
+
+	LOGGER.Error("STORE", "\t", err.Error())
+
+	if mgo.IsDup(err) {
+		if m := duplicateKeyIndex.FindStringSubmatch(err.Error()); m != nil {
+			for _, ui := range mongoUniqueIndexes {
+				if ui.Index.Name == m[1] {
+					return utils.APIErrConflict(ui.Resource, ui.Field, values[ui.Field])
+				}
+			}
+		}
+	}
+
+	return utils.APIErrDatabase(err.Error())
+}
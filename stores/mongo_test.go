@@ -0,0 +1,49 @@
+package stores
+
+import (
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/mgo.v2"
+	"testing"
+)
+
+type MongoStoreTestSuite struct {
+	suite.Suite
+}
+
+func (suite *MongoStoreTestSuite) TestMongoError() {
+
+	values := map[string]string{"name": "b1", "auth_identifier": "test_dn_1"}
+
+	// duplicate keys of the unique indexes are reported as conflicts
+	err1 := mongoError(&mgo.LastError{Code: 11000, Err: `E11000 duplicate key error collection: authn.bindings index: bindings_name dup key: { : "b1" }`}, values)
+	err2 := mongoError(&mgo.LastError{Code: 11000, Err: `E11000 duplicate key error collection: authn.bindings index: bindings_auth_identifier dup key: { auth_identifier: "test_dn_1" }`}, values)
+	err3 := mongoError(&mgo.LastError{Code: 11000, Err: `E11000 duplicate key error collection: authn.service_types index: service_types_name dup key: { : "s1" }`}, map[string]string{"name": "s1"})
+
+	// any other error is a database error
+	err4 := mongoError(&mgo.LastError{Code: 11000, Err: `E11000 duplicate key error collection: authn.bindings index: _id_ dup key: { : 1 }`}, values)
+	err5 := mongoError(mgo.ErrNotFound, values)
+
+	suite.Equal(utils.APIErrConflict("binding", "name", "b1"), err1)
+	suite.Equal(utils.APIErrConflict("binding", "auth_identifier", "test_dn_1"), err2)
+	suite.Equal(utils.APIErrConflict("service-type", "name", "s1"), err3)
+	suite.Equal(`Database Error: E11000 duplicate key error collection: authn.bindings index: _id_ dup key: { : 1 }`, err4.Error())
+	suite.Equal("Database Error: not found", err5.Error())
+}
+
+func (suite *MongoStoreTestSuite) TestMongoUniqueIndexes() {
+
+	// every unique index is named, so that its violations can be reported
+	names := map[string]bool{}
+
+	for _, ui := range mongoUniqueIndexes {
+		suite.NotEqual("", ui.Index.Name)
+		suite.True(ui.Index.Unique)
+		suite.False(names[ui.Index.Name])
+		names[ui.Index.Name] = true
+	}
+}
+
+func TestMongoStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(MongoStoreTestSuite))
+}
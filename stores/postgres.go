@@ -0,0 +1,1027 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"github.com/lib/pq"
+	LOGGER "github.com/sirupsen/logrus"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// postgresMigrations holds the schema of the postgres store, each migration is applied once and in order.
+// Existing migrations should never be modified, schema changes are appended as new migrations
+var postgresMigrations = []string{
+	// 1: service types, their hosts, bindings and auth methods.
+	// The unique constraints follow the checks that take place when service types, bindings and auth methods are created
+	`CREATE TABLE service_types (
+		seq         BIGSERIAL,
+		uuid        TEXT PRIMARY KEY,
+		name        TEXT NOT NULL UNIQUE,
+		auth_types  JSONB NOT NULL DEFAULT '[]',
+		auth_method TEXT NOT NULL DEFAULT '',
+		type        TEXT NOT NULL DEFAULT '',
+		created_on  TEXT NOT NULL DEFAULT ''
+	);
+
+	CREATE TABLE service_type_hosts (
+		service_uuid TEXT NOT NULL REFERENCES service_types (uuid) ON UPDATE CASCADE ON DELETE CASCADE,
+		host         TEXT NOT NULL,
+		position     INTEGER NOT NULL,
+		PRIMARY KEY (service_uuid, host)
+	);
+
+	CREATE TABLE bindings (
+		seq             BIGSERIAL,
+		uuid            TEXT PRIMARY KEY,
+		name            TEXT NOT NULL UNIQUE,
+		service_uuid    TEXT NOT NULL,
+		host            TEXT NOT NULL,
+		auth_identifier TEXT NOT NULL,
+		auth_type       TEXT NOT NULL,
+		unique_key      TEXT NOT NULL DEFAULT '',
+		created_on      TEXT NOT NULL DEFAULT '',
+		last_auth       TEXT NOT NULL DEFAULT '',
+		auth_method     TEXT NOT NULL DEFAULT '',
+		UNIQUE (auth_identifier, service_uuid, host, auth_type)
+	);
+
+	CREATE INDEX bindings_service_host_idx ON bindings (service_uuid, host);
+
+	CREATE TABLE auth_methods (
+		seq          BIGSERIAL,
+		uuid         TEXT PRIMARY KEY,
+		service_uuid TEXT NOT NULL,
+		host         TEXT NOT NULL,
+		type         TEXT NOT NULL,
+		name         TEXT NOT NULL DEFAULT '',
+		payload      JSONB NOT NULL,
+		UNIQUE (service_uuid, host, name)
+	);`,
+	// 2: the metadata of the service types' hosts
+	`ALTER TABLE service_types ADD COLUMN host_details JSONB NOT NULL DEFAULT '[]';`,
+	// 3: the revisions that the updates of service types, bindings and auth methods are checked against.
+	// The revision of an auth method is also part of its payload
+	`ALTER TABLE service_types ADD COLUMN revision BIGINT NOT NULL DEFAULT 0;
+	ALTER TABLE bindings ADD COLUMN revision BIGINT NOT NULL DEFAULT 0;
+	ALTER TABLE auth_methods ADD COLUMN revision BIGINT NOT NULL DEFAULT 0;`,
+	// 4: the orders that the bindings are listed in, their columns are compared byte by byte
+	`CREATE INDEX bindings_created_on_idx ON bindings (created_on COLLATE "C", uuid COLLATE "C");
+	CREATE INDEX bindings_name_idx ON bindings (name COLLATE "C", uuid COLLATE "C");
+	CREATE INDEX bindings_last_auth_idx ON bindings (last_auth COLLATE "C", uuid COLLATE "C");`,
+	// 5: the usage of the bindings, recorded along with their last_auth
+	`ALTER TABLE bindings ADD COLUMN auth_count BIGINT NOT NULL DEFAULT 0;
+	ALTER TABLE bindings ADD COLUMN last_client_ip TEXT NOT NULL DEFAULT '';`,
+	// 6: the bindings that have been disabled, enabled is NULL for the bindings that have never been disabled or re-enabled
+	`ALTER TABLE bindings ADD COLUMN enabled BOOLEAN;
+	ALTER TABLE bindings ADD COLUMN suspension_reason TEXT NOT NULL DEFAULT '';`,
+	// 7: the period that the bindings can be used in
+	`ALTER TABLE bindings ADD COLUMN not_before TEXT NOT NULL DEFAULT '';
+	ALTER TABLE bindings ADD COLUMN not_after TEXT NOT NULL DEFAULT '';`,
+}
+
+// postgresMigrationsLock is the advisory lock that serializes the migrations of instances starting at the same time
+const postgresMigrationsLock = 7340521
+
+// PostgresStore keeps the service types, their hosts, bindings and auth methods in PostgreSQL.
+// Auth methods are stored as a json payload of their query model, next to the columns they are looked up by
+type PostgresStore struct {
+	DSN string
+	DB  *sql.DB
+	// clone is set for the stores returned by Clone, which share the connection pool of the original store
+	clone bool
+	// tx is the transaction of the unit of work the store belongs to, if any
+	tx *sql.Tx
+}
+
+// postgresExecutor runs the statements of the store, either on the connection pool or in the transaction of a unit of work
+type postgresExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func (postgres *PostgresStore) db() postgresExecutor {
+
+	if postgres.tx != nil {
+		return postgres.tx
+	}
+
+	return postgres.DB
+}
+
+// SetUp connects to the database and brings its schema up to date
+func (postgres *PostgresStore) SetUp() {
+
+	var err error
+
+	for {
+		LOGGER.Info("STORE", "\t", "Trying to connect to postgres")
+
+		if postgres.DB, err = sql.Open("postgres", postgres.DSN); err == nil {
+			err = postgres.DB.Ping()
+		}
+
+		if err != nil {
+			LOGGER.Error("STORE", "\t", err.Error())
+			time.Sleep(time.Second)
+			continue
+		}
+
+		LOGGER.Info("STORE", "\t", "Connected to postgres")
+		break
+	}
+
+	if err = postgres.Migrate(); err != nil {
+		LOGGER.Fatal("STORE", "\t", "Could not migrate the postgres schema: ", err.Error())
+	}
+}
+
+// Migrate applies the schema migrations that haven't been applied yet, each one in its own transaction
+func (postgres *PostgresStore) Migrate() error {
+
+	var err error
+	var version int
+
+	conn, err := postgres.DB.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(context.Background(), "SELECT pg_advisory_lock($1)", postgresMigrationsLock); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", postgresMigrationsLock)
+
+	if _, err = conn.ExecContext(context.Background(), `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_on TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`); err != nil {
+		return err
+	}
+
+	if err = conn.QueryRowContext(context.Background(), "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return err
+	}
+
+	for idx := version; idx < len(postgresMigrations); idx++ {
+
+		tx, err := conn.BeginTx(context.Background(), nil)
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.Exec(postgresMigrations[idx]); err == nil {
+			_, err = tx.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", idx+1)
+		}
+
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+
+		LOGGER.Infof("STORE\tApplied the postgres schema migration: %v", idx+1)
+	}
+
+	return nil
+}
+
+// Clone returns a store that shares the connection pool of the original one
+func (postgres *PostgresStore) Clone() Store {
+
+	return &PostgresStore{
+		DSN:   postgres.DSN,
+		DB:    postgres.DB,
+		clone: true,
+		tx:    postgres.tx,
+	}
+}
+
+// Close closes the connection pool, closing a clone leaves it open
+func (postgres *PostgresStore) Close() {
+
+	if postgres.clone {
+		return
+	}
+
+	if err := postgres.DB.Close(); err != nil {
+		LOGGER.Error("STORE", "\t", err.Error())
+	}
+}
+
+// postgresResources maps the tables of the schema to the resource names that the conflict errors of the api use
+var postgresResources = map[string]string{
+	"service_types": "service-type",
+	"bindings":      "binding",
+	"auth_methods":  "Auth method",
+}
+
+// uniqueViolationDetail extracts the conflicting columns and values from the detail of a unique violation,
+// e.g. Key (name)=(b1) already exists.
+var uniqueViolationDetail = regexp.MustCompile(`^Key \((.*)\)=\((.*)\) already exists`)
+
+// databaseError logs and converts an error of the database to an api error.
+// Violations of the unique constraints are reported as conflicts, the same way the checks that precede the inserts do
+func databaseError(err error) error {
+
+	LOGGER.Error("STORE", "\t", err.Error())
+
+	// errors that are already api errors, such as revision mismatches, are returned as they are
+	if apiErr, ok := err.(*utils.APIError); ok {
+		return apiErr
+	}
+
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		if m := uniqueViolationDetail.FindStringSubmatch(pqErr.Detail); m != nil {
+			resource, ok := postgresResources[pqErr.Table]
+			if !ok {
+				resource = pqErr.Table
+			}
+			return utils.APIErrConflict(resource, m[1], m[2])
+		}
+	}
+
+	return utils.APIErrDatabase(err.Error())
+}
+
+// affectedOne checks that a statement has modified a record, the same way mongo reports missing records
+func affectedOne(res sql.Result) error {
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return errRecordNotFound
+	}
+
+	return nil
+}
+
+// notUpdated tells apart a record that doesn't exist from a record whose revision has changed,
+// after an update of the record with the given uuid has modified nothing
+func notUpdated(db postgresExecutor, table string, uuid string, modified error) error {
+
+	var exists bool
+
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM "+table+" WHERE uuid = $1)", uuid).Scan(&exists); err != nil {
+		return err
+	}
+
+	if exists {
+		return modified
+	}
+
+	return errRecordNotFound
+}
+
+// inTx runs the given function in a transaction, which is committed only if the function succeeds.
+// Within a unit of work the function runs in the transaction of the unit of work
+func (postgres *PostgresStore) inTx(fn func(tx *sql.Tx) error) error {
+
+	if postgres.tx != nil {
+		if err := fn(postgres.tx); err != nil {
+			return databaseError(err)
+		}
+		return nil
+	}
+
+	tx, err := postgres.DB.Begin()
+	if err != nil {
+		return databaseError(err)
+	}
+
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return databaseError(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return databaseError(err)
+	}
+
+	return nil
+}
+
+// RunInTransaction runs the given function in a single database transaction.
+// A statement that fails aborts the transaction, so the function should return as soon as a store operation fails
+func (postgres *PostgresStore) RunInTransaction(fn func(tx Store) error) error {
+
+	if postgres.tx != nil {
+		return fn(postgres)
+	}
+
+	tx, err := postgres.DB.Begin()
+	if err != nil {
+		return databaseError(err)
+	}
+
+	if err = fn(&PostgresStore{DSN: postgres.DSN, DB: postgres.DB, clone: true, tx: tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return databaseError(err)
+	}
+
+	return nil
+}
+
+const serviceTypesQuery = `SELECT s.uuid, s.name, s.auth_types, s.auth_method, s.type, s.created_on, s.host_details, s.revision,
+	COALESCE(json_agg(h.host ORDER BY h.position) FILTER (WHERE h.host IS NOT NULL), '[]')
+	FROM service_types s LEFT JOIN service_type_hosts h ON h.service_uuid = s.uuid `
+
+// queryServiceTypes returns the service types that match the given condition, in the given order
+func (postgres *PostgresStore) queryServiceTypes(condition string, order string, args ...interface{}) ([]QServiceType, error) {
+
+	var qServices []QServiceType
+
+	rows, err := postgres.db().Query(serviceTypesQuery+condition+" GROUP BY s.uuid ORDER BY "+order, args...)
+	if err != nil {
+		return []QServiceType{}, databaseError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+
+		var qService QServiceType
+		var authTypes, hostDetails, hosts []byte
+
+		if err = rows.Scan(&qService.UUID, &qService.Name, &authTypes, &qService.AuthMethod, &qService.Type, &qService.CreatedOn, &hostDetails, &qService.Revision, &hosts); err != nil {
+			return []QServiceType{}, databaseError(err)
+		}
+
+		if err = json.Unmarshal(hostDetails, &qService.HostDetails); err != nil {
+			return []QServiceType{}, databaseError(err)
+		}
+
+		// service types without any host metadata are returned the same way they were stored
+		if len(qService.HostDetails) == 0 {
+			qService.HostDetails = nil
+		}
+
+		if err = json.Unmarshal(authTypes, &qService.AuthTypes); err != nil {
+			return []QServiceType{}, databaseError(err)
+		}
+
+		if err = json.Unmarshal(hosts, &qService.Hosts); err != nil {
+			return []QServiceType{}, databaseError(err)
+		}
+
+		qServices = append(qServices, qService)
+	}
+
+	if err = rows.Err(); err != nil {
+		return []QServiceType{}, databaseError(err)
+	}
+
+	return qServices, nil
+}
+
+func (postgres *PostgresStore) QueryServiceTypes(name string) ([]QServiceType, error) {
+
+	if name == "" {
+		return postgres.queryServiceTypes("", "s.seq")
+	}
+
+	return postgres.queryServiceTypes("WHERE s.name = $1", "s.seq", name)
+}
+
+func (postgres *PostgresStore) QueryServiceTypesByUUID(uuid string) ([]QServiceType, error) {
+	return postgres.queryServiceTypes("WHERE s.uuid = $1", "s.seq", uuid)
+}
+
+// QueryAuthMethods returns the auth methods of the given type for the given service type and host.
+// An empty type matches auth methods of any registered type, while if there is no serviceUUID and host provided,
+// the auth methods of all the service types and hosts are returned
+func (postgres *PostgresStore) QueryAuthMethods(amType string, serviceUUID string, host string) ([]QAuthMethod, error) {
+	return postgres.queryAuthMethods("WHERE ($1 = '' OR type = $1) AND (($2 = '' AND $3 = '') OR (service_uuid = $2 AND host = $3))",
+		"seq", amType, serviceUUID, host)
+}
+
+// queryAuthMethods returns the auth methods of the registered types that match the given condition, in the given order
+func (postgres *PostgresStore) queryAuthMethods(condition string, order string, args ...interface{}) ([]QAuthMethod, error) {
+
+	var qAuthms = []QAuthMethod{}
+
+	rows, err := postgres.db().Query("SELECT payload FROM auth_methods "+condition+" ORDER BY "+order, args...)
+	if err != nil {
+		return qAuthms, databaseError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+
+		var payload []byte
+
+		if err = rows.Scan(&payload); err != nil {
+			return qAuthms, databaseError(err)
+		}
+
+		qam, err := decodeAuthMethod(payload)
+		if err != nil {
+			return qAuthms, databaseError(err)
+		}
+
+		if qam != nil {
+			qAuthms = append(qAuthms, qam)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return qAuthms, databaseError(err)
+	}
+
+	return qAuthms, nil
+}
+
+const bindingsQuery = `SELECT name, service_uuid, host, auth_identifier, uuid, auth_type, unique_key, created_on, last_auth, auth_method, revision, auth_count, last_client_ip, enabled, suspension_reason, not_before, not_after FROM bindings `
+
+// queryBindings returns the bindings that match the given condition, in the given order
+func (postgres *PostgresStore) queryBindings(condition string, order string, args ...interface{}) ([]QBinding, error) {
+
+	var qBindings []QBinding
+
+	rows, err := postgres.db().Query(bindingsQuery+condition+" ORDER BY "+order, args...)
+	if err != nil {
+		return []QBinding{}, databaseError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+
+		var qb QBinding
+
+		if err = rows.Scan(&qb.Name, &qb.ServiceUUID, &qb.Host, &qb.AuthIdentifier, &qb.UUID, &qb.AuthType, &qb.UniqueKey, &qb.CreatedOn, &qb.LastAuth, &qb.AuthMethod, &qb.Revision, &qb.AuthCount, &qb.LastClientIP, &qb.Enabled, &qb.SuspensionReason, &qb.NotBefore, &qb.NotAfter); err != nil {
+			return []QBinding{}, databaseError(err)
+		}
+
+		qBindings = append(qBindings, qb)
+	}
+
+	if err = rows.Err(); err != nil {
+		return []QBinding{}, databaseError(err)
+	}
+
+	return qBindings, nil
+}
+
+func (postgres *PostgresStore) QueryBindingsByAuthID(authID string, serviceUUID string, host string, authType string) ([]QBinding, error) {
+	return postgres.queryBindings("WHERE auth_identifier = $1 AND service_uuid = $2 AND host = $3 AND auth_type = $4", "seq", authID, serviceUUID, host, authType)
+}
+
+func (postgres *PostgresStore) QueryBindingsByUUIDAndName(uuid, name string) ([]QBinding, error) {
+	return postgres.queryBindings("WHERE ($1 = '' OR uuid = $1) AND ($2 = '' OR name = $2)", "seq", uuid, name)
+}
+
+func (postgres *PostgresStore) QueryBindings(serviceUUID string, host string) ([]QBinding, error) {
+
+	if serviceUUID != "" && host != "" {
+		return postgres.queryBindings("WHERE service_uuid = $1 AND host = $2", "seq", serviceUUID, host)
+	}
+
+	return postgres.queryBindings("", "seq")
+}
+
+// putServiceTypeHosts replaces the hosts of the given service type
+func putServiceTypeHosts(tx *sql.Tx, serviceUUID string, hosts []string) error {
+
+	if _, err := tx.Exec("DELETE FROM service_type_hosts WHERE service_uuid = $1", serviceUUID); err != nil {
+		return err
+	}
+
+	for idx, host := range hosts {
+		if _, err := tx.Exec("INSERT INTO service_type_hosts (service_uuid, host, position) VALUES ($1, $2, $3)", serviceUUID, host, idx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// InsertServiceType inserts a new service into the datastore
+func (postgres *PostgresStore) InsertServiceType(name string, hosts []string, authTypes []string, authMethod string, uuid string, createdOn string, sType string) (QServiceType, error) {
+
+	qService := QServiceType{Name: name, Hosts: hosts, AuthTypes: authTypes, AuthMethod: authMethod, UUID: uuid, CreatedOn: createdOn, Type: sType}
+
+	err := postgres.inTx(func(tx *sql.Tx) error {
+
+		authTypesJSON, err := json.Marshal(authTypes)
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.Exec("INSERT INTO service_types (uuid, name, auth_types, auth_method, type, created_on) VALUES ($1, $2, $3, $4, $5, $6)",
+			uuid, name, string(authTypesJSON), authMethod, sType, createdOn); err != nil {
+			return err
+		}
+
+		return putServiceTypeHosts(tx, uuid, hosts)
+	})
+
+	if err != nil {
+		return QServiceType{}, err
+	}
+
+	return qService, nil
+}
+
+// InsertBinding inserts a new binding into the datastore
+func (postgres *PostgresStore) InsertBinding(name string, serviceUUID string, host string, uuid string, authID string, uniqueKey string, authType string, authMethod string) (QBinding, error) {
+
+	qBinding := QBinding{
+		Name:           name,
+		ServiceUUID:    serviceUUID,
+		Host:           host,
+		UUID:           uuid,
+		AuthIdentifier: authID,
+		UniqueKey:      uniqueKey,
+		AuthType:       authType,
+		CreatedOn:      utils.ZuluTimeNow(),
+		AuthMethod:     authMethod,
+	}
+
+	if _, err := postgres.db().Exec(`INSERT INTO bindings (uuid, name, service_uuid, host, auth_identifier, auth_type, unique_key, created_on, last_auth, auth_method)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		qBinding.UUID, qBinding.Name, qBinding.ServiceUUID, qBinding.Host, qBinding.AuthIdentifier, qBinding.AuthType,
+		qBinding.UniqueKey, qBinding.CreatedOn, qBinding.LastAuth, qBinding.AuthMethod); err != nil {
+		return QBinding{}, databaseError(err)
+	}
+
+	return qBinding, nil
+}
+
+func (postgres *PostgresStore) InsertAuthMethod(am QAuthMethod) error {
+
+	var err error
+	var payload []byte
+
+	// secrets are never stored in clear text, when a keyring has been loaded
+	if am, err = EncryptSecrets(am); err != nil {
+		LOGGER.Error("STORE", "\t", err.Error())
+		err = utils.APIGenericInternalError(err.Error())
+		return err
+	}
+
+	if payload, err = json.Marshal(am); err != nil {
+		return databaseError(err)
+	}
+
+	basic := am.Basic()
+
+	if _, err = postgres.db().Exec("INSERT INTO auth_methods (uuid, service_uuid, host, type, name, payload, revision) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		basic.UUID, basic.ServiceUUID, basic.Host, basic.Type, basic.Name, string(payload), basic.Revision); err != nil {
+		return databaseError(err)
+	}
+
+	return nil
+}
+
+// UpdateBinding updates the given binding, apart from its usage which is recorded in the background, and returns it as stored
+func (postgres *PostgresStore) UpdateBinding(original QBinding, updated QBinding) (QBinding, error) {
+
+	err := postgres.db().QueryRow(`UPDATE bindings SET uuid = $2, name = $3, service_uuid = $4, host = $5, auth_identifier = $6,
+		auth_type = $7, unique_key = $8, created_on = $9, auth_method = $10, revision = $11, enabled = $13, suspension_reason = $14, not_before = $15, not_after = $16
+		WHERE uuid = $1 AND revision = $12 RETURNING auth_count, last_auth, last_client_ip`,
+		original.UUID, updated.UUID, updated.Name, updated.ServiceUUID, updated.Host, updated.AuthIdentifier,
+		updated.AuthType, updated.UniqueKey, updated.CreatedOn, updated.AuthMethod, updated.Revision, original.Revision,
+		updated.Enabled, updated.SuspensionReason, updated.NotBefore, updated.NotAfter).Scan(&updated.AuthCount, &updated.LastAuth, &updated.LastClientIP)
+
+	if err == sql.ErrNoRows {
+		err = notUpdated(postgres.db(), "bindings", original.UUID, errBindingModified)
+	}
+
+	if err != nil {
+		return QBinding{}, databaseError(err)
+	}
+
+	return updated, nil
+}
+
+// UpdateServiceType updates the given service type
+func (postgres *PostgresStore) UpdateServiceType(original QServiceType, updated QServiceType) (QServiceType, error) {
+
+	err := postgres.inTx(func(tx *sql.Tx) error {
+
+		authTypesJSON, err := json.Marshal(updated.AuthTypes)
+		if err != nil {
+			return err
+		}
+
+		hostDetailsJSON, err := json.Marshal(updated.HostDetails)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.Exec(`UPDATE service_types SET uuid = $2, name = $3, auth_types = $4, auth_method = $5, type = $6, created_on = $7,
+			host_details = $8, revision = $9 WHERE uuid = $1 AND revision = $10`,
+			original.UUID, updated.UUID, updated.Name, string(authTypesJSON), updated.AuthMethod, updated.Type, updated.CreatedOn,
+			string(hostDetailsJSON), updated.Revision, original.Revision)
+		if err != nil {
+			return err
+		}
+
+		if err = affectedOne(res); err == errRecordNotFound {
+			return notUpdated(tx, "service_types", original.UUID, errServiceTypeModified)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return putServiceTypeHosts(tx, updated.UUID, updated.Hosts)
+	})
+
+	if err != nil {
+		return QServiceType{}, err
+	}
+
+	return updated, nil
+}
+
+// UpdateAuthMethod updates the given auth method
+func (postgres *PostgresStore) UpdateAuthMethod(original QAuthMethod, updated QAuthMethod) (QAuthMethod, error) {
+
+	var err error
+	var payload []byte
+	var res sql.Result
+
+	if updated, err = EncryptSecrets(updated); err != nil {
+		LOGGER.Error("STORE", "\t", err.Error())
+		err = utils.APIGenericInternalError(err.Error())
+		return nil, err
+	}
+
+	if payload, err = json.Marshal(updated); err != nil {
+		return nil, databaseError(err)
+	}
+
+	basic := updated.Basic()
+
+	res, err = postgres.db().Exec(`UPDATE auth_methods SET uuid = $2, service_uuid = $3, host = $4, type = $5, name = $6, payload = $7, revision = $8
+		WHERE uuid = $1 AND revision = $9`,
+		original.Basic().UUID, basic.UUID, basic.ServiceUUID, basic.Host, basic.Type, basic.Name, string(payload), basic.Revision, original.Basic().Revision)
+
+	if err == nil {
+		err = affectedOne(res)
+	}
+
+	if err == errRecordNotFound {
+		err = notUpdated(postgres.db(), "auth_methods", original.Basic().UUID, errAuthMethodModified)
+	}
+
+	if err != nil {
+		return nil, databaseError(err)
+	}
+
+	return updated, nil
+}
+
+func (postgres *PostgresStore) DeleteServiceTypeByUUID(uuid string) error {
+
+	res, err := postgres.db().Exec("DELETE FROM service_types WHERE uuid = $1", uuid)
+
+	if err == nil {
+		err = affectedOne(res)
+	}
+
+	if err != nil {
+		return databaseError(err)
+	}
+
+	return nil
+}
+
+// RecordBindingUsage adds the authentications to the usage of the bindings, in a single transaction
+func (postgres *PostgresStore) RecordBindingUsage(usages []QBindingUsage) error {
+
+	if len(usages) == 0 {
+		return nil
+	}
+
+	return postgres.RunInTransaction(func(tx Store) error {
+
+		for _, usage := range usages {
+			if _, err := tx.(*PostgresStore).db().Exec(`UPDATE bindings SET auth_count = auth_count + $2,
+				last_auth = GREATEST(last_auth, $3), last_client_ip = $4 WHERE uuid = $1`,
+				usage.UUID, usage.Count, usage.LastAuth, usage.ClientIP); err != nil {
+				return databaseError(err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// DeleteBinding deletes a binding from the store
+func (postgres *PostgresStore) DeleteBinding(qBinding QBinding) error {
+
+	res, err := postgres.db().Exec("DELETE FROM bindings WHERE uuid = $1", qBinding.UUID)
+
+	if err == nil {
+		err = affectedOne(res)
+	}
+
+	if err != nil {
+		return databaseError(err)
+	}
+
+	return nil
+}
+
+func (postgres *PostgresStore) DeleteBindingByServiceUUID(serviceUUID string) error {
+
+	if _, err := postgres.db().Exec("DELETE FROM bindings WHERE service_uuid = $1", serviceUUID); err != nil {
+		return databaseError(err)
+	}
+
+	return nil
+}
+
+func (postgres *PostgresStore) DeleteAuthMethod(am QAuthMethod) error {
+
+	res, err := postgres.db().Exec("DELETE FROM auth_methods WHERE uuid = $1", am.Basic().UUID)
+
+	if err == nil {
+		err = affectedOne(res)
+	}
+
+	if err != nil {
+		return databaseError(err)
+	}
+
+	return nil
+}
+
+func (postgres *PostgresStore) DeleteAuthMethodByServiceUUID(serviceUUID string) error {
+
+	if _, err := postgres.db().Exec("DELETE FROM auth_methods WHERE service_uuid = $1", serviceUUID); err != nil {
+		return databaseError(err)
+	}
+
+	return nil
+}
+
+// postgresConditions builds the WHERE clause of a listing, along with its arguments
+type postgresConditions struct {
+	clauses []string
+	args    []interface{}
+}
+
+// arg adds an argument to the query and returns its placeholder
+func (pc *postgresConditions) arg(value interface{}) string {
+	pc.args = append(pc.args, value)
+	return fmt.Sprintf("$%d", len(pc.args))
+}
+
+func (pc *postgresConditions) where() string {
+
+	if len(pc.clauses) == 0 {
+		return ""
+	}
+
+	return "WHERE " + strings.Join(pc.clauses, " AND ")
+}
+
+func (pc *postgresConditions) equal(column string, value string) {
+	if value != "" {
+		pc.clauses = append(pc.clauses, column+" = "+pc.arg(value))
+	}
+}
+
+// likeEscaper escapes the wildcards of the LIKE patterns
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (pc *postgresConditions) prefix(column string, prefix string) {
+	if prefix != "" {
+		pc.clauses = append(pc.clauses, column+" LIKE "+pc.arg(likeEscaper.Replace(prefix)+"%"))
+	}
+}
+
+func (pc *postgresConditions) contains(column string, value string) {
+	if value != "" {
+		pc.clauses = append(pc.clauses, "position("+pc.arg(value)+" in "+column+") > 0")
+	}
+}
+
+// inRange matches the records whose column is within the range of the given start and end, empty limits are ignored.
+// When skipEmpty is set, records with an empty column never match the range
+func (pc *postgresConditions) inRange(column string, start string, end string, skipEmpty bool) {
+
+	if start == "" && end == "" {
+		return
+	}
+
+	if skipEmpty {
+		pc.clauses = append(pc.clauses, column+" <> ''")
+	}
+
+	if start != "" {
+		pc.clauses = append(pc.clauses, column+` COLLATE "C" >= `+pc.arg(start))
+	}
+
+	if end != "" {
+		pc.clauses = append(pc.clauses, column+` COLLATE "C" < `+pc.arg(end))
+	}
+}
+
+// afterCursor matches the records that are listed after the cursor, in the order of the given column and the uuid.
+// Columns are compared byte by byte, the same way the other stores compare them
+func (pc *postgresConditions) afterCursor(column string, uuidColumn string, cursor *pageCursor) {
+
+	op := ">"
+	if cursor.Descending {
+		op = "<"
+	}
+
+	value, uuid := pc.arg(cursor.Value), pc.arg(cursor.UUID)
+
+	pc.clauses = append(pc.clauses, fmt.Sprintf(`(%v COLLATE "C" %v %v OR (%v = %v AND %v COLLATE "C" %v %v))`,
+		column, op, value, column, value, uuidColumn, op, uuid))
+}
+
+// unusedSince matches the bindings that haven't been used since the given time, when it isn't empty
+func (pc *postgresConditions) unusedSince(since string) {
+
+	if since == "" {
+		return
+	}
+
+	value := pc.arg(since)
+
+	pc.clauses = append(pc.clauses, fmt.Sprintf(`((last_auth <> '' AND last_auth COLLATE "C" < %v) OR
+		(last_auth = '' AND created_on <> '' AND created_on COLLATE "C" < %v))`, value, value))
+}
+
+// postgresOrder returns the order, and the limit, of the requested page
+func postgresOrder(column string, uuidColumn string, opts ListOptions) string {
+
+	direction := "ASC"
+	if opts.Descending {
+		direction = "DESC"
+	}
+
+	order := fmt.Sprintf(`%v COLLATE "C" %v, %v COLLATE "C" %v`, column, direction, uuidColumn, direction)
+
+	if opts.PageSize > 0 {
+		order += fmt.Sprintf(" LIMIT %d", opts.fetchSize())
+	}
+
+	return order
+}
+
+// count returns the number of the records of the table that match the conditions
+func (pc *postgresConditions) count(db postgresExecutor, table string) (int, error) {
+
+	var total int
+
+	err := db.QueryRow("SELECT COUNT(*) FROM "+table+" "+pc.where(), pc.args...).Scan(&total)
+
+	return total, err
+}
+
+// The columns of the fields that the records are sorted by, the creation time of an auth method is part of its payload
+var (
+	postgresBindingsColumns     = map[string]string{"created_on": "created_on", "name": "name", "last_auth": "last_auth"}
+	postgresServiceTypesColumns = map[string]string{"created_on": "s.created_on", "name": "s.name"}
+	postgresAuthMethodsColumns  = map[string]string{"created_on": "COALESCE(payload->>'created_on', '')", "host": "host"}
+)
+
+func (postgres *PostgresStore) ListBindings(filter BindingFilter, opts ListOptions) (QBindingsPage, error) {
+
+	var pc postgresConditions
+	var qPage = QBindingsPage{Bindings: []QBinding{}}
+
+	orderBy, err := opts.orderBy(BindingsOrderBy)
+	if err != nil {
+		return qPage, err
+	}
+
+	cursor, err := opts.cursor(orderBy)
+	if err != nil {
+		return qPage, err
+	}
+
+	pc.equal("service_uuid", filter.ServiceUUID)
+	pc.equal("host", filter.Host)
+	pc.equal("auth_type", filter.AuthType)
+	pc.prefix("name", filter.NamePrefix)
+	pc.contains("auth_identifier", filter.AuthIdentifier)
+	pc.inRange("created_on", filter.CreatedAfter, filter.CreatedBefore, false)
+	pc.inRange("last_auth", filter.LastAuthAfter, filter.LastAuthBefore, true)
+	pc.unusedSince(filter.UnusedSince)
+
+	if qPage.TotalSize, err = pc.count(postgres.db(), "bindings"); err != nil {
+		return qPage, databaseError(err)
+	}
+
+	column := postgresBindingsColumns[orderBy]
+	if cursor != nil {
+		pc.afterCursor(column, "uuid", cursor)
+	}
+
+	qBindings, err := postgres.queryBindings(pc.where(), postgresOrder(column, "uuid", opts), pc.args...)
+	if err != nil {
+		return qPage, err
+	}
+
+	end, next := opts.pageEnd(len(qBindings), orderBy, func(idx int) sortKey { return bindingSortKey(qBindings[idx], orderBy) })
+
+	qPage.Bindings = append(qPage.Bindings, qBindings[:end]...)
+	qPage.NextPageToken = next
+
+	return qPage, nil
+}
+
+func (postgres *PostgresStore) ListServiceTypes(filter ServiceTypeFilter, opts ListOptions) (QServiceTypesPage, error) {
+
+	var pc postgresConditions
+	var qPage = QServiceTypesPage{ServiceTypes: []QServiceType{}}
+
+	orderBy, err := opts.orderBy(ServiceTypesOrderBy)
+	if err != nil {
+		return qPage, err
+	}
+
+	cursor, err := opts.cursor(orderBy)
+	if err != nil {
+		return qPage, err
+	}
+
+	pc.prefix("s.name", filter.NamePrefix)
+	pc.equal("s.type", filter.Type)
+	pc.inRange("s.created_on", filter.CreatedAfter, filter.CreatedBefore, false)
+
+	if qPage.TotalSize, err = pc.count(postgres.db(), "service_types s"); err != nil {
+		return qPage, databaseError(err)
+	}
+
+	column := postgresServiceTypesColumns[orderBy]
+	if cursor != nil {
+		pc.afterCursor(column, "s.uuid", cursor)
+	}
+
+	qServices, err := postgres.queryServiceTypes(pc.where(), postgresOrder(column, "s.uuid", opts), pc.args...)
+	if err != nil {
+		return qPage, err
+	}
+
+	end, next := opts.pageEnd(len(qServices), orderBy, func(idx int) sortKey { return serviceTypeSortKey(qServices[idx], orderBy) })
+
+	qPage.ServiceTypes = append(qPage.ServiceTypes, qServices[:end]...)
+	qPage.NextPageToken = next
+
+	return qPage, nil
+}
+
+func (postgres *PostgresStore) ListAuthMethods(filter AuthMethodFilter, opts ListOptions) (QAuthMethodsPage, error) {
+
+	var pc postgresConditions
+	var qPage = QAuthMethodsPage{AuthMethods: []QAuthMethod{}}
+
+	orderBy, err := opts.orderBy(AuthMethodsOrderBy)
+	if err != nil {
+		return qPage, err
+	}
+
+	cursor, err := opts.cursor(orderBy)
+	if err != nil {
+		return qPage, err
+	}
+
+	pc.equal("service_uuid", filter.ServiceUUID)
+	pc.equal("host", filter.Host)
+	pc.equal("type", filter.Type)
+
+	if qPage.TotalSize, err = pc.count(postgres.db(), "auth_methods"); err != nil {
+		return qPage, databaseError(err)
+	}
+
+	column := postgresAuthMethodsColumns[orderBy]
+	if cursor != nil {
+		pc.afterCursor(column, "uuid", cursor)
+	}
+
+	qAuthms, err := postgres.queryAuthMethods(pc.where(), postgresOrder(column, "uuid", opts), pc.args...)
+	if err != nil {
+		return qPage, err
+	}
+
+	end, next := opts.pageEnd(len(qAuthms), orderBy, func(idx int) sortKey { return authMethodSortKey(qAuthms[idx], orderBy) })
+
+	qPage.AuthMethods = append(qPage.AuthMethods, qAuthms[:end]...)
+	qPage.NextPageToken = next
+
+	return qPage, nil
+}
@@ -0,0 +1,239 @@
+package stores
+
+import (
+	"encoding/base64"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/suite"
+	"os"
+	"strings"
+	"testing"
+)
+
+// postgresTestDSN is the environment variable that holds the connection string of the database the postgres store is tested against.
+// The database is emptied before every test
+const postgresTestDSN = "ARGO_AUTHN_POSTGRES_TEST_DSN"
+
+type PostgresStoreTestSuite struct {
+	suite.Suite
+	store *PostgresStore
+}
+
+// SetupTest migrates an empty schema and populates it with the same data as the mock store
+func (suite *PostgresStoreTestSuite) SetupTest() {
+
+	dsn := os.Getenv(postgresTestDSN)
+	if dsn == "" {
+		suite.T().Skipf("%v is not set", postgresTestDSN)
+	}
+
+	suite.store = &PostgresStore{DSN: dsn}
+	suite.store.SetUp()
+
+	suite.store.DB.Exec("DROP TABLE IF EXISTS schema_migrations, service_type_hosts, service_types, bindings, auth_methods")
+	if err := suite.store.Migrate(); err != nil {
+		suite.T().Fatal(err)
+	}
+
+	mockstore := &Mockstore{}
+	mockstore.SetUp()
+
+	for _, qs := range mockstore.ServiceTypes[:2] {
+		suite.store.InsertServiceType(qs.Name, qs.Hosts, qs.AuthTypes, qs.AuthMethod, qs.UUID, qs.CreatedOn, qs.Type)
+	}
+
+	for _, qb := range mockstore.Bindings {
+		suite.store.InsertBinding(qb.Name, qb.ServiceUUID, qb.Host, qb.UUID, qb.AuthIdentifier, qb.UniqueKey, qb.AuthType, qb.AuthMethod)
+	}
+
+	for _, qam := range mockstore.AuthMethods {
+		suite.store.InsertAuthMethod(qam)
+	}
+}
+
+func (suite *PostgresStoreTestSuite) TearDownTest() {
+	if suite.store != nil && suite.store.DB != nil {
+		suite.store.Close()
+	}
+}
+
+func (suite *PostgresStoreTestSuite) TestMigrate() {
+
+	var version int
+
+	// applying the migrations again is a no-op
+	err1 := suite.store.Migrate()
+	suite.store.DB.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version)
+
+	suite.Nil(err1)
+	suite.Equal(len(postgresMigrations), version)
+}
+
+func (suite *PostgresStoreTestSuite) TestQueryServiceTypes() {
+
+	qServices1, err1 := suite.store.QueryServiceTypes("s1")
+	qServices2, err2 := suite.store.QueryServiceTypes("")
+	qServices3, err3 := suite.store.QueryServiceTypesByUUID("uuid2")
+	qServices4, err4 := suite.store.QueryServiceTypes("unknown")
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Nil(err4)
+	suite.Equal(1, len(qServices1))
+	suite.Equal("uuid1", qServices1[0].UUID)
+	suite.Equal([]string{"host1", "host2", "host3"}, qServices1[0].Hosts)
+	suite.Equal([]string{"x509", "oidc"}, qServices1[0].AuthTypes)
+
+	// service types are listed in the order they were created
+	suite.Equal(2, len(qServices2))
+	suite.Equal("s1", qServices2[0].Name)
+	suite.Equal("s2", qServices2[1].Name)
+	suite.Equal("s2", qServices3[0].Name)
+	suite.Equal(0, len(qServices4))
+}
+
+func (suite *PostgresStoreTestSuite) TestQueryBindings() {
+
+	qBindings1, err1 := suite.store.QueryBindingsByAuthID("test_dn_1", "uuid1", "host1", "x509")
+	qBindings2, err2 := suite.store.QueryBindingsByAuthID("test_dn_1", "uuid1", "host1", "oidc")
+	qBindings3, err3 := suite.store.QueryBindingsByUUIDAndName("b_uuid2", "")
+	qBindings4, err4 := suite.store.QueryBindingsByUUIDAndName("", "b3")
+	qBindings5, err5 := suite.store.QueryBindings("uuid1", "host1")
+	qBindings6, err6 := suite.store.QueryBindings("", "")
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Nil(err4)
+	suite.Nil(err5)
+	suite.Nil(err6)
+	suite.Equal("b1", qBindings1[0].Name)
+	suite.Equal("unique_key_1", qBindings1[0].UniqueKey)
+	suite.Equal(0, len(qBindings2))
+	suite.Equal("b2", qBindings3[0].Name)
+	suite.Equal("b_uuid3", qBindings4[0].UUID)
+	suite.Equal(2, len(qBindings5))
+	suite.Equal(4, len(qBindings6))
+}
+
+func (suite *PostgresStoreTestSuite) TestUniqueConstraints() {
+
+	// same name
+	_, err1 := suite.store.InsertBinding("b1", "uuid1", "host1", "b_uuid_new", "test_dn_new", "", "x509", "")
+	// same auth identifier for the same service type, host and auth type
+	_, err2 := suite.store.InsertBinding("b_new", "uuid1", "host1", "b_uuid_new", "test_dn_1", "", "x509", "")
+	// same service type name
+	_, err3 := suite.store.InsertServiceType("s1", []string{"host1"}, []string{"x509"}, "api-key", "uuid_new", "", "ams")
+
+	// a second unnamed auth method for the same host
+	qam := &QApiKeyAuthMethod{AccessKey: "access_key_new"}
+	qam.QBasicAuthMethod = QBasicAuthMethod{ServiceUUID: "uuid1", Host: "host1", Port: 9000, Type: "api-key", UUID: "am_uuid_new"}
+	err4 := suite.store.InsertAuthMethod(qam)
+
+	suite.Equal(utils.APIErrConflict("binding", "name", "b1"), err1)
+	suite.Equal(utils.APIErrConflict("binding", "auth_identifier, service_uuid, host, auth_type", "test_dn_1, uuid1, host1, x509"), err2)
+	suite.Equal(utils.APIErrConflict("service-type", "name", "s1"), err3)
+	suite.Equal(utils.APIErrConflict("Auth method", "service_uuid, host, name", "uuid1, host1, "), err4)
+}
+
+func (suite *PostgresStoreTestSuite) TestUpdateAndDelete() {
+
+	qBindings, _ := suite.store.QueryBindingsByUUIDAndName("b_uuid1", "")
+	updatedBinding := qBindings[0]
+	updatedBinding.AuthIdentifier = "test_dn_updated"
+	_, err1 := suite.store.UpdateBinding(qBindings[0], updatedBinding)
+	qBindings1, _ := suite.store.QueryBindingsByAuthID("test_dn_updated", "uuid1", "host1", "x509")
+	_, err2 := suite.store.UpdateBinding(QBinding{UUID: "unknown"}, updatedBinding)
+
+	qServices, _ := suite.store.QueryServiceTypesByUUID("uuid1")
+	updatedService := qServices[0]
+	updatedService.Hosts = []string{"host3", "host1"}
+	_, err3 := suite.store.UpdateServiceType(qServices[0], updatedService)
+	qServices3, _ := suite.store.QueryServiceTypesByUUID("uuid1")
+
+	err4 := suite.store.DeleteBindingByServiceUUID("uuid1")
+	err5 := suite.store.DeleteServiceTypeByUUID("uuid1")
+	err6 := suite.store.DeleteServiceTypeByUUID("uuid1")
+	qServices6, _ := suite.store.QueryServiceTypes("")
+	qBindings6, _ := suite.store.QueryBindings("", "")
+
+	suite.Nil(err1)
+	suite.Equal(updatedBinding, qBindings1[0])
+	suite.Equal("Database Error: not found", err2.Error())
+	suite.Nil(err3)
+	suite.Equal([]string{"host3", "host1"}, qServices3[0].Hosts)
+	suite.Nil(err4)
+	suite.Nil(err5)
+	suite.Equal("Database Error: not found", err6.Error())
+	suite.Equal(1, len(qServices6))
+	suite.Equal(1, len(qBindings6))
+}
+
+func (suite *PostgresStoreTestSuite) TestAuthMethods() {
+
+	Secrets, _ = ParseKeyring("v1:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32))))
+	defer func() { Secrets = nil }()
+
+	qam := &QApiKeyAuthMethod{AccessKey: "access_key_3"}
+	qam.QBasicAuthMethod = QBasicAuthMethod{ServiceUUID: "uuid1", Host: "host2", Port: 9000, Type: "api-key", UUID: "am_uuid_3"}
+	err1 := suite.store.InsertAuthMethod(qam)
+
+	// auth methods are decoded into the query models of their types
+	qams1, _ := suite.store.QueryAuthMethods("", "", "")
+	qams2, _ := suite.store.QueryAuthMethods("headers", "uuid2", "host3")
+	qams3, _ := suite.store.QueryAuthMethods("api-key", "uuid1", "host2")
+
+	// the secrets are stored encrypted
+	stored := qams3[0].(*QApiKeyAuthMethod).AccessKey
+
+	updated := &QApiKeyAuthMethod{AccessKey: "access_key_4", QBasicAuthMethod: qam.QBasicAuthMethod}
+	_, err4 := suite.store.UpdateAuthMethod(qam, updated)
+	qams4, _ := suite.store.QueryAuthMethods("api-key", "uuid1", "host2")
+	decrypted, _ := DecryptSecrets(qams4[0])
+
+	err5 := suite.store.DeleteAuthMethod(updated)
+	err6 := suite.store.DeleteAuthMethodByServiceUUID("uuid2")
+	err7 := suite.store.DeleteAuthMethod(updated)
+	qams7, _ := suite.store.QueryAuthMethods("", "", "")
+
+	suite.Nil(err1)
+	suite.Equal(3, len(qams1))
+	suite.IsType(&QApiKeyAuthMethod{}, qams1[0])
+	suite.IsType(&QHeadersAuthMethod{}, qams1[1])
+	suite.Equal(map[string]string{"x-api-key": "key-1", "Accept": "application/json"}, qams2[0].(*QHeadersAuthMethod).Headers)
+	suite.True(IsEncrypted(stored))
+	suite.Nil(err4)
+	suite.Equal("access_key_4", decrypted.(*QApiKeyAuthMethod).AccessKey)
+	suite.Nil(err5)
+	suite.Nil(err6)
+	suite.Equal("Database Error: not found", err7.Error())
+	suite.Equal(1, len(qams7))
+	suite.Equal("am_uuid_1", qams7[0].Basic().UUID)
+}
+
+func TestPostgresStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(PostgresStoreTestSuite))
+}
+
+type PostgresErrorsTestSuite struct {
+	suite.Suite
+}
+
+func (suite *PostgresErrorsTestSuite) TestDatabaseError() {
+
+	// unique violations are reported as conflicts of the resource the table holds
+	err1 := databaseError(&pq.Error{Code: "23505", Table: "bindings", Detail: "Key (name)=(b1) already exists."})
+	err2 := databaseError(&pq.Error{Code: "23505", Table: "service_types", Detail: "Key (name)=(s1) already exists."})
+
+	// any other error is a database error
+	err3 := databaseError(&pq.Error{Code: "42P01", Message: `relation "bindings" does not exist`})
+
+	suite.Equal(utils.APIErrConflict("binding", "name", "b1"), err1)
+	suite.Equal(utils.APIErrConflict("service-type", "name", "s1"), err2)
+	suite.Equal(`Database Error: pq: relation "bindings" does not exist`, err3.Error())
+}
+
+func TestPostgresErrorsTestSuite(t *testing.T) {
+	suite.Run(t, new(PostgresErrorsTestSuite))
+}
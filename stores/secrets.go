@@ -0,0 +1,318 @@
+package stores
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// SecretsKeysEnv is the environment variable that holds the master keys, when no key file has been configured
+const SecretsKeysEnv = "ARGO_AUTHN_SECRETS_KEYS"
+
+// encryptedPrefix marks the values that have been encrypted,
+// an encrypted value has the form of enc:<key version>:<wrapped data key>:<ciphertext>
+const encryptedPrefix = "enc:"
+
+// Keyring holds the versioned master keys that wrap the data keys of the encrypted secrets.
+// New secrets are always encrypted with the current key, older keys are kept in order to decrypt existing secrets
+type Keyring struct {
+	current string
+	keys    map[string][]byte
+}
+
+// Secrets is the keyring used to encrypt the secret fields of the auth methods,
+// when it is nil secrets are stored in clear text
+var Secrets *Keyring
+
+// LoadKeyring loads the master keys from the given key file, or from the SecretsKeysEnv environment variable.
+// Keys are declared as version:base64 encoded 32 byte key, separated by new lines or commas,
+// the last declared key is the current one. A nil keyring is returned if no keys have been declared
+func LoadKeyring(keyFile string) (*Keyring, error) {
+
+	var data string
+
+	if keyFile != "" {
+		b, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		data = string(b)
+	} else {
+		data = os.Getenv(SecretsKeysEnv)
+	}
+
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+
+	return ParseKeyring(data)
+}
+
+// ParseKeyring parses master keys declared as version:base64 encoded 32 byte key, separated by new lines or commas
+func ParseKeyring(data string) (*Keyring, error) {
+
+	k := &Keyring{keys: make(map[string][]byte)}
+
+	entries := strings.FieldsFunc(data, func(r rune) bool {
+		return r == '\n' || r == ','
+	})
+
+	for _, entry := range entries {
+
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.New("Invalid key entry, it should be in the form of version:base64 encoded key")
+		}
+
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("Key %v is not base64 encoded. %v", parts[0], err.Error())
+		}
+
+		if len(key) != 32 {
+			return nil, fmt.Errorf("Key %v should be 32 bytes long", parts[0])
+		}
+
+		if _, ok := k.keys[parts[0]]; ok {
+			return nil, fmt.Errorf("Key %v has been declared more than once", parts[0])
+		}
+
+		k.keys[parts[0]] = key
+		k.current = parts[0]
+	}
+
+	if k.current == "" {
+		return nil, errors.New("No keys have been declared")
+	}
+
+	return k, nil
+}
+
+// CurrentVersion returns the version of the key that new secrets are encrypted with
+func (k *Keyring) CurrentVersion() string {
+	return k.current
+}
+
+func seal(key []byte, plaintext []byte) ([]byte, error) {
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key []byte, sealed []byte) ([]byte, error) {
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("Encrypted value is too short")
+	}
+
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
+
+// IsEncrypted checks whether or not a value has been encrypted
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// encryptedVersion returns the version of the key that wrapped the value's data key
+func encryptedVersion(value string) string {
+	return strings.SplitN(strings.TrimPrefix(value, encryptedPrefix), ":", 2)[0]
+}
+
+// Encrypt encrypts a value with a fresh data key, which is then wrapped with the current master key
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", err
+	}
+
+	ciphertext, err := seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	wrappedKey, err := seal(k.keys[k.current], dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%v%v:%v:%v",
+		encryptedPrefix,
+		k.current,
+		base64.StdEncoding.EncodeToString(wrappedKey),
+		base64.StdEncoding.EncodeToString(ciphertext)), nil
+}
+
+// Decrypt decrypts a value, values that have not been encrypted are returned as they are
+func (k *Keyring) Decrypt(value string) (string, error) {
+
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	if k == nil {
+		return "", errors.New("Encrypted secret found but no keys have been declared")
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("Encrypted secret is malformed")
+	}
+
+	masterKey, ok := k.keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("Encrypted secret uses unknown key version: %v", parts[0])
+	}
+
+	wrappedKey, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", err
+	}
+
+	dataKey, err := open(masterKey, wrappedKey)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := open(dataKey, ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// reencrypt makes sure that a value is encrypted with the current master key,
+// values that have already been encrypted with it are returned as they are
+func (k *Keyring) reencrypt(value string) (string, error) {
+
+	if IsEncrypted(value) {
+		if encryptedVersion(value) == k.current {
+			return value, nil
+		}
+
+		plaintext, err := k.Decrypt(value)
+		if err != nil {
+			return "", err
+		}
+
+		value = plaintext
+	}
+
+	return k.Encrypt(value)
+}
+
+// transformSecrets returns a copy of the given query model, where the values of the fields tagged with `secret:"true"`
+// have been transformed by the given function
+// Empty values, e.g. secrets that have not been staged, are kept empty
+func transformSecrets(qam QAuthMethod, transform func(string) (string, error)) (QAuthMethod, error) {
+
+	transformed, err := utils.TransformTaggedFields(qam, "secret", func(value string) (string, error) {
+		if value == "" {
+			return value, nil
+		}
+		return transform(value)
+	})
+	if err != nil {
+		return qam, err
+	}
+
+	return transformed.(QAuthMethod), nil
+}
+
+// EncryptSecrets returns a copy of the query model with its secret fields encrypted using the current master key.
+// The model is returned as it is when no keyring has been loaded
+func EncryptSecrets(qam QAuthMethod) (QAuthMethod, error) {
+
+	if Secrets == nil {
+		return qam, nil
+	}
+
+	return transformSecrets(qam, Secrets.reencrypt)
+}
+
+// DecryptSecrets returns a copy of the query model with its secret fields decrypted
+func DecryptSecrets(qam QAuthMethod) (QAuthMethod, error) {
+	return transformSecrets(qam, Secrets.Decrypt)
+}
+
+// ReencryptAuthMethodSecrets encrypts the secret fields of all the stored auth methods with the current master key,
+// auth methods that are stored in clear text or with older keys are updated. It returns the amount of updated auth methods
+func ReencryptAuthMethodSecrets(store Store) (int, error) {
+
+	var updated int
+
+	if Secrets == nil {
+		return 0, errors.New("No keys have been declared")
+	}
+
+	qams, err := store.QueryAuthMethods("", "", "")
+	if err != nil {
+		return 0, err
+	}
+
+	for _, qam := range qams {
+
+		encrypted, err := EncryptSecrets(qam)
+		if err != nil {
+			return updated, err
+		}
+
+		// skip the auth methods that are already encrypted with the current key
+		if reflect.DeepEqual(encrypted, qam) {
+			continue
+		}
+
+		// the stored auth method is selected by its uuid and revision, its secrets don't have to be decrypted
+		if _, err = store.UpdateAuthMethod(qam, encrypted); err != nil {
+			return updated, err
+		}
+
+		updated++
+	}
+
+	return updated, nil
+}
@@ -0,0 +1,151 @@
+package stores
+
+import (
+	"encoding/base64"
+	"github.com/stretchr/testify/suite"
+	"strings"
+	"testing"
+)
+
+type SecretsTestSuite struct {
+	suite.Suite
+}
+
+var (
+	testKey1 = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32)))
+	testKey2 = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("b", 32)))
+)
+
+func (suite *SecretsTestSuite) TearDownTest() {
+	Secrets = nil
+}
+
+func (suite *SecretsTestSuite) TestParseKeyring() {
+
+	// normal case, the last key is the current one
+	k1, err1 := ParseKeyring("v1:" + testKey1 + "\nv2:" + testKey2 + "\n")
+
+	// comma separated keys
+	k2, err2 := ParseKeyring("v1:" + testKey1 + ",v2:" + testKey2)
+
+	// missing version
+	_, err3 := ParseKeyring(testKey1)
+
+	// wrong key size
+	_, err4 := ParseKeyring("v1:" + base64.StdEncoding.EncodeToString([]byte("short")))
+
+	// duplicate version
+	_, err5 := ParseKeyring("v1:" + testKey1 + ",v1:" + testKey2)
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Equal("v2", k1.CurrentVersion())
+	suite.Equal("v2", k2.CurrentVersion())
+	suite.Equal("Invalid key entry, it should be in the form of version:base64 encoded key", err3.Error())
+	suite.Equal("Key v1 should be 32 bytes long", err4.Error())
+	suite.Equal("Key v1 has been declared more than once", err5.Error())
+}
+
+func (suite *SecretsTestSuite) TestEncryptDecrypt() {
+
+	k1, _ := ParseKeyring("v1:" + testKey1)
+	k2, _ := ParseKeyring("v1:" + testKey1 + ",v2:" + testKey2)
+	k3, _ := ParseKeyring("v2:" + testKey2)
+
+	enc1, err1 := k1.Encrypt("access_key")
+	enc2, _ := k1.Encrypt("access_key")
+
+	// a rotated keyring can decrypt values of older keys
+	dec1, err2 := k2.Decrypt(enc1)
+
+	// a keyring without the key can't
+	_, err3 := k3.Decrypt(enc1)
+
+	// values in clear text are returned as they are
+	dec4, err4 := k1.Decrypt("access_key")
+
+	// tampered values are rejected
+	_, err5 := k1.Decrypt(enc1[:len(enc1)-4] + "AAA=")
+
+	suite.Nil(err1)
+	suite.True(strings.HasPrefix(enc1, "enc:v1:"))
+	suite.NotEqual(enc1, enc2)
+	suite.Nil(err2)
+	suite.Equal("access_key", dec1)
+	suite.Equal("Encrypted secret uses unknown key version: v1", err3.Error())
+	suite.Nil(err4)
+	suite.Equal("access_key", dec4)
+	suite.NotNil(err5)
+}
+
+func (suite *SecretsTestSuite) TestEncryptSecrets() {
+
+	Secrets, _ = ParseKeyring("v1:" + testKey1)
+
+	am1 := &QApiKeyAuthMethod{AccessKey: "access_key"}
+	am1.QBasicAuthMethod = QBasicAuthMethod{ServiceUUID: "uuid1", Host: "host1", Port: 9000, Type: "api-key", UUID: "am_uuid_1"}
+
+	am2 := &QHeadersAuthMethod{Headers: map[string]string{"x-api-key": "key-1"}}
+	am2.QBasicAuthMethod = QBasicAuthMethod{ServiceUUID: "uuid2", Host: "host3", Port: 9000, Type: "headers", UUID: "am_uuid_2"}
+
+	enc1, err1 := EncryptSecrets(am1)
+	enc2, err2 := EncryptSecrets(am2)
+
+	dec1, err3 := DecryptSecrets(enc1)
+	dec2, err4 := DecryptSecrets(enc2)
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Nil(err4)
+
+	// the given models are not modified
+	suite.Equal("access_key", am1.AccessKey)
+	suite.Equal("key-1", am2.Headers["x-api-key"])
+
+	// only the secret fields are encrypted
+	suite.True(IsEncrypted(enc1.(*QApiKeyAuthMethod).AccessKey))
+	suite.True(IsEncrypted(enc2.(*QHeadersAuthMethod).Headers["x-api-key"]))
+	suite.Equal("host1", enc1.(*QApiKeyAuthMethod).Host)
+
+	suite.Equal(am1, dec1)
+	suite.Equal(am2, dec2)
+
+	// values that have been encrypted with the current key are kept as they are
+	enc3, _ := EncryptSecrets(enc1)
+	suite.Equal(enc1, enc3)
+}
+
+func (suite *SecretsTestSuite) TestReencryptAuthMethodSecrets() {
+
+	mockstore := &Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	// encrypt the clear text secrets of the mock store
+	Secrets, _ = ParseKeyring("v1:" + testKey1)
+	updated1, err1 := ReencryptAuthMethodSecrets(mockstore)
+
+	// nothing changes when the secrets are already encrypted with the current key
+	updated2, err2 := ReencryptAuthMethodSecrets(mockstore)
+
+	// rotate the keys
+	Secrets, _ = ParseKeyring("v1:" + testKey1 + ",v2:" + testKey2)
+	updated3, err3 := ReencryptAuthMethodSecrets(mockstore)
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Equal(2, updated1)
+	suite.Equal(0, updated2)
+	suite.Equal(2, updated3)
+
+	qApiAms, _ := mockstore.QueryAuthMethods("api-key", "uuid1", "host1")
+	suite.True(strings.HasPrefix(qApiAms[0].(*QApiKeyAuthMethod).AccessKey, "enc:v2:"))
+
+	dec, _ := DecryptSecrets(qApiAms[0])
+	suite.Equal("access_key", dec.(*QApiKeyAuthMethod).AccessKey)
+}
+
+func TestSecretsTestSuite(t *testing.T) {
+	suite.Run(t, new(SecretsTestSuite))
+}
@@ -1,25 +1,57 @@
 package stores
 
+import (
+	"github.com/ARGOeu/argo-api-authn/utils"
+)
+
+// The errors that are returned when the record that should be updated has been modified since the original one was retrieved
+var (
+	errServiceTypeModified = utils.APIErrPreconditionFailed("Service type")
+	errBindingModified     = utils.APIErrPreconditionFailed("Binding")
+	errAuthMethodModified  = utils.APIErrPreconditionFailed("Auth method")
+)
+
 type Store interface {
 	SetUp()
 	Close()
 	Clone() Store
 	QueryServiceTypes(name string) ([]QServiceType, error)
 	QueryServiceTypesByUUID(uuid string) ([]QServiceType, error)
-	QueryApiKeyAuthMethods(serviceUUID string, host string) ([]QApiKeyAuthMethod, error)
-	QueryHeadersAuthMethods(serviceUUID string, host string) ([]QHeadersAuthMethod, error)
+	QueryAuthMethods(amType string, serviceUUID string, host string) ([]QAuthMethod, error)
 	QueryBindingsByAuthID(authID string, serviceUUID string, host string, authType string) ([]QBinding, error)
 	QueryBindingsByUUIDAndName(uuid, name string) ([]QBinding, error)
 	QueryBindings(serviceUUID string, host string) ([]QBinding, error)
+	// ListBindings, ListServiceTypes and ListAuthMethods return a page of the records that match the filter,
+	// in the order of the options
+	ListBindings(filter BindingFilter, opts ListOptions) (QBindingsPage, error)
+	ListServiceTypes(filter ServiceTypeFilter, opts ListOptions) (QServiceTypesPage, error)
+	ListAuthMethods(filter AuthMethodFilter, opts ListOptions) (QAuthMethodsPage, error)
 	InsertServiceType(name string, hosts []string, authTypes []string, authMethod string, uuid string, createdOn string, sType string) (QServiceType, error)
 	DeleteServiceTypeByUUID(uuid string) error
 	InsertAuthMethod(am QAuthMethod) error
 	DeleteAuthMethod(am QAuthMethod) error
 	DeleteAuthMethodByServiceUUID(serviceUUID string) error
-	InsertBinding(name string, serviceUUID string, host string, uuid string, authID string, uniqueKey string, authType string) (QBinding, error)
+	InsertBinding(name string, serviceUUID string, host string, uuid string, authID string, uniqueKey string, authType string, authMethod string) (QBinding, error)
+	// UpdateBinding, UpdateServiceType and UpdateAuthMethod replace the original record with the updated one,
+	// as long as the stored record still has the revision of the original one.
+	// The updated record is stored as it is, callers increment its revision.
+	// The usage of a binding, its auth_count, last_auth and last_client_ip, is only changed through RecordBindingUsage,
+	// UpdateBinding keeps the stored usage and returns the binding along with it
 	UpdateBinding(original QBinding, updated QBinding) (QBinding, error)
 	UpdateServiceType(original QServiceType, updated QServiceType) (QServiceType, error)
 	UpdateAuthMethod(original QAuthMethod, updated QAuthMethod) (QAuthMethod, error)
+	// RecordBindingUsage adds the given authentications to the usage of the bindings, without changing their revisions.
+	// The latest authentication time of a binding never moves backwards, bindings that no longer exist are skipped
+	RecordBindingUsage(usages []QBindingUsage) error
+	// DeleteBinding deletes the binding with the uuid of the given one, regardless of the usage recorded since it was read
 	DeleteBinding(qBinding QBinding) error
 	DeleteBindingByServiceUUID(serviceUUID string) error
+	// RunInTransaction runs the given function as a unit of work through the provided store.
+	// On the embedded and the postgres store it is a transaction, its changes are either all kept, when it succeeds,
+	// or all discarded, when it returns an error, and other requests don't observe them in the meantime.
+	// On the mongo store it is neither isolated nor atomic, every change is applied right away and the applied changes
+	// of a failed unit of work are reverted afterwards on a best effort basis, so they might be observed, or even kept
+	// when a revert fails as well. Checks that have to hold across concurrent requests should rely on the unique indexes.
+	// Running a unit of work through the provided store joins the enclosing one
+	RunInTransaction(fn func(tx Store) error) error
 }
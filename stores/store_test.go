@@ -19,6 +19,24 @@ func (suite *StoreTestSuite) SetUpStoreTestSuite() {
 	suite.Mockstore = mockstore
 }
 
+// TestRegisterQueryModel tests that the query model of an auth method type can only be registered once
+func (suite *StoreTestSuite) TestRegisterQueryModel() {
+
+	RegisterQueryModel("token", NewQApiKeyAuthMethod)
+	defer delete(QAuthMethodsTypes, "token")
+
+	qam, err := new(QAuthMethodFactory).Create("token")
+
+	suite.Nil(err)
+	suite.IsType(&QApiKeyAuthMethod{}, qam)
+	suite.Panics(func() {
+		RegisterQueryModel("token", NewQHeadersAuthMethod)
+	})
+	suite.Panics(func() {
+		RegisterQueryModel("api-key", NewQApiKeyAuthMethod)
+	})
+}
+
 // TestSetUp tests if the mockstore setup has been completed successfully
 func (suite *StoreTestSuite) TestSetUp() {
 
@@ -137,56 +155,49 @@ func (suite *StoreTestSuite) TestQueryServiceTypesByUUID() {
 
 }
 
-func (suite *StoreTestSuite) TestQueryApiKeyAuthMethods() {
+func (suite *StoreTestSuite) TestQueryAuthMethods() {
 
 	suite.SetUpStoreTestSuite()
 
-	// normal case
-	var expApiAms []QApiKeyAuthMethod
 	amb1 := QBasicAuthMethod{ServiceUUID: "uuid1", Host: "host1", Port: 9000, Type: "api-key", UUID: "am_uuid_1", CreatedOn: ""}
-	qapi := QApiKeyAuthMethod{amb1, "access_key"}
-	expApiAms = append(expApiAms, qapi)
-	apiAms, err1 := suite.Mockstore.QueryApiKeyAuthMethods("uuid1", "host1")
-
-	// not found - empty list
-	apiAms2, err2 := suite.Mockstore.QueryApiKeyAuthMethods("unknown", "unknown")
+	qapi := &QApiKeyAuthMethod{QBasicAuthMethod: amb1, AccessKey: "access_key"}
 
-	// query all
-	apiAms3, err3 := suite.Mockstore.QueryApiKeyAuthMethods("", "")
-
-	suite.Equal(expApiAms, apiAms)
-	suite.Equal(0, len(apiAms2))
-	suite.Equal(expApiAms, apiAms3)
+	amb2 := QBasicAuthMethod{ServiceUUID: "uuid2", Host: "host3", Port: 9000, Type: "headers", UUID: "am_uuid_2", CreatedOn: ""}
+	qheaders := &QHeadersAuthMethod{QBasicAuthMethod: amb2, Headers: map[string]string{"x-api-key": "key-1", "Accept": "application/json"}}
 
-	suite.Nil(err1)
-	suite.Nil(err2)
-	suite.Nil(err3)
-}
+	// normal case
+	apiAms, err1 := suite.Mockstore.QueryAuthMethods("api-key", "uuid1", "host1")
+	headersAms, err2 := suite.Mockstore.QueryAuthMethods("headers", "uuid2", "host3")
 
-func (suite *StoreTestSuite) TestQueryHeadersMethods() {
+	// the type doesn't match the host's auth method
+	apiAms3, err3 := suite.Mockstore.QueryAuthMethods("headers", "uuid1", "host1")
 
-	suite.SetUpStoreTestSuite()
+	// not found - empty list
+	apiAms4, err4 := suite.Mockstore.QueryAuthMethods("api-key", "unknown", "unknown")
 
-	// normal case
-	var expApiAms []QHeadersAuthMethod
-	amb2 := QBasicAuthMethod{ServiceUUID: "uuid2", Host: "host3", Port: 9000, Type: "headers", UUID: "am_uuid_2", CreatedOn: ""}
-	am2 := QHeadersAuthMethod{QBasicAuthMethod: amb2, Headers: map[string]string{"x-api-key": "key-1", "Accept": "application/json"}}
-	expApiAms = append(expApiAms, am2)
-	apiAms, err1 := suite.Mockstore.QueryHeadersAuthMethods("uuid2", "host3")
+	// query all of a type
+	apiAms5, err5 := suite.Mockstore.QueryAuthMethods("api-key", "", "")
 
-	// not found - empty list
-	apiAms2, err2 := suite.Mockstore.QueryHeadersAuthMethods("unknown", "unknown")
+	// query all of any type
+	apiAms6, err6 := suite.Mockstore.QueryAuthMethods("", "", "")
 
-	// query all
-	apiAms3, err3 := suite.Mockstore.QueryHeadersAuthMethods("", "")
+	suite.Equal([]QAuthMethod{qapi}, apiAms)
+	suite.Equal([]QAuthMethod{qheaders}, headersAms)
+	suite.Equal(0, len(apiAms3))
+	suite.Equal(0, len(apiAms4))
+	suite.Equal([]QAuthMethod{qapi}, apiAms5)
+	suite.Equal([]QAuthMethod{qapi, qheaders}, apiAms6)
 
-	suite.Equal(expApiAms, apiAms)
-	suite.Equal(0, len(apiAms2))
-	suite.Equal(expApiAms, apiAms3)
+	// the returned query models are copies of the stored ones
+	apiAms[0].Basic().Host = "modified"
+	suite.Equal("host1", suite.Mockstore.AuthMethods[0].Basic().Host)
 
 	suite.Nil(err1)
 	suite.Nil(err2)
 	suite.Nil(err3)
+	suite.Nil(err4)
+	suite.Nil(err5)
+	suite.Nil(err6)
 }
 
 func (suite *StoreTestSuite) TestQueryBindingsByDN() {
@@ -277,12 +288,12 @@ func (suite *StoreTestSuite) TestInsertAuthMethod() {
 
 	// insert an QApiKeyAuthMethod and then query the datastore to see if it was inserted
 	amb1 := QBasicAuthMethod{ServiceUUID: "uuid1", Host: "host2", Port: 9000, UUID: "am_uuid_1", CreatedOn: ""}
-	expApiAms := []QApiKeyAuthMethod{{amb1, "access_key"}}
+	expApiAms := []QAuthMethod{&QApiKeyAuthMethod{QBasicAuthMethod: amb1, AccessKey: "access_key"}}
 
-	amIns := &QApiKeyAuthMethod{amb1, "access_key"}
+	amIns := &QApiKeyAuthMethod{QBasicAuthMethod: amb1, AccessKey: "access_key"}
 	errIns := suite.Mockstore.InsertAuthMethod(amIns)
 
-	apiAms, _ := suite.Mockstore.QueryApiKeyAuthMethods("uuid1", "host2")
+	apiAms, _ := suite.Mockstore.QueryAuthMethods("", "uuid1", "host2")
 
 	suite.Equal(expApiAms, apiAms)
 
@@ -308,7 +319,7 @@ func (suite *StoreTestSuite) TestInsertBinding() {
 	suite.SetUpStoreTestSuite()
 
 	var expBinding1 QBinding
-	_, err1 := suite.Mockstore.InsertBinding("bIns", "uuid1", "host1", "b_uuid", "test_dn_ins", "unique_key_ins", "x509")
+	_, err1 := suite.Mockstore.InsertBinding("bIns", "uuid1", "host1", "b_uuid", "test_dn_ins", "unique_key_ins", "x509", "")
 	// check if the new binding can be found
 	expBindings, _ := suite.Mockstore.QueryBindingsByAuthID("test_dn_ins", "uuid1", "host1", "x509")
 	expBinding1 = expBindings[0]
@@ -370,9 +381,9 @@ func (suite *StoreTestSuite) TestUpdateAuthMethod() {
 	uqam1, err1 := suite.Mockstore.UpdateAuthMethod(original, updated)
 
 	// query the datastore to see if the update was successful
-	apiAms, _ := suite.Mockstore.QueryApiKeyAuthMethods("uuid1", "host1")
+	apiAms, _ := suite.Mockstore.QueryAuthMethods("api-key", "uuid1", "host1")
 	ambExp := QBasicAuthMethod{ServiceUUID: "uuid1", Host: "host1", Port: 9000, Type: "api-key", UUID: "am_uuid_1", CreatedOn: ""}
-	expApiAms := []QApiKeyAuthMethod{{ambExp, "access_key_2"}}
+	expApiAms := []QAuthMethod{&QApiKeyAuthMethod{QBasicAuthMethod: ambExp, AccessKey: "access_key_2"}}
 
 	suite.Equal(uqam1, updated)
 	suite.Equal(expApiAms, apiAms)
@@ -451,7 +462,7 @@ func (suite *StoreTestSuite) TestDeleteAuthMethod() {
 	err1 := suite.Mockstore.DeleteAuthMethod(&am1)
 
 	amb := QBasicAuthMethod{ServiceUUID: "uuid1", Host: "host1", Port: 9000, Type: "api-key", UUID: "am_uuid_1", CreatedOn: ""}
-	expApiAms := &QApiKeyAuthMethod{amb, "access_key"}
+	expApiAms := &QApiKeyAuthMethod{QBasicAuthMethod: amb, AccessKey: "access_key"}
 	amb2 := QBasicAuthMethod{ServiceUUID: "uuid2", Host: "host3", Port: 9000, Type: "headers", UUID: "am_uuid_2", CreatedOn: ""}
 	expHeaderam := &QHeadersAuthMethod{QBasicAuthMethod: amb2, Headers: map[string]string{"x-api-key": "key-1", "Accept": "application/json"}}
 	expAMS = append(expAMS, expApiAms, expHeaderam)
@@ -0,0 +1,900 @@
+// Package storetest provides the conformance suite that every stores.Store implementation is expected to pass.
+// It checks the semantics of the store methods, their errors and their edge cases against a store that starts out empty,
+// so a new backend can be verified by calling Run from its tests with a factory that creates such a store.
+package storetest
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"github.com/stretchr/testify/suite"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Factory returns a new, empty and set up store for the given test.
+// Any resources the store needs should be released through t.Cleanup, while t.Skip can be used when the backend is not available
+type Factory func(t *testing.T) stores.Store
+
+// Run runs the conformance suite against the stores returned by the factory, one store per test
+func Run(t *testing.T, newStore Factory) {
+	suite.Run(t, &conformanceSuite{newStore: newStore})
+}
+
+type conformanceSuite struct {
+	suite.Suite
+	newStore Factory
+	store    stores.Store
+}
+
+// SetupTest creates a new store and populates it with two service types, four bindings and two auth methods
+func (suite *conformanceSuite) SetupTest() {
+
+	suite.store = suite.newStore(suite.T())
+
+	suite.store.InsertServiceType("s1", []string{"host1", "host2", "host3"}, []string{"x509", "oidc"}, "api-key", "uuid1", "2018-05-05T18:04:05Z", "ams")
+	suite.store.InsertServiceType("s2", []string{"host3", "host4"}, []string{"x509"}, "headers", "uuid2", "2018-05-05T18:04:05Z", "web-api")
+
+	suite.store.InsertBinding("b1", "uuid1", "host1", "b_uuid1", "test_dn_1", "unique_key_1", "x509", "")
+	suite.store.InsertBinding("b2", "uuid1", "host1", "b_uuid2", "test_dn_2", "unique_key_2", "x509", "")
+	suite.store.InsertBinding("b3", "uuid1", "host2", "b_uuid3", "test_dn_3", "unique_key_3", "x509", "")
+	suite.store.InsertBinding("b4", "uuid2", "host3", "b_uuid4", "test_dn_1", "unique_key_1", "x509", "")
+
+	suite.store.InsertAuthMethod(apiKeyAuthMethod("am_uuid_1", "uuid1", "host1", "access_key"))
+	suite.store.InsertAuthMethod(headersAuthMethod("am_uuid_2", "uuid2", "host3"))
+}
+
+func (suite *conformanceSuite) TearDownTest() {
+	if suite.store != nil {
+		suite.store.Close()
+	}
+}
+
+func apiKeyAuthMethod(uuid, serviceUUID, host, accessKey string) *stores.QApiKeyAuthMethod {
+
+	qam := &stores.QApiKeyAuthMethod{AccessKey: accessKey}
+	qam.QBasicAuthMethod = stores.QBasicAuthMethod{ServiceUUID: serviceUUID, Host: host, Port: 9000, Type: "api-key", UUID: uuid}
+
+	return qam
+}
+
+func headersAuthMethod(uuid, serviceUUID, host string) *stores.QHeadersAuthMethod {
+
+	qam := &stores.QHeadersAuthMethod{Headers: map[string]string{"x-api-key": "key-1", "Accept": "application/json"}}
+	qam.QBasicAuthMethod = stores.QBasicAuthMethod{ServiceUUID: serviceUUID, Host: host, Port: 9000, Type: "headers", UUID: uuid}
+
+	return qam
+}
+
+func bindingNames(qBindings []stores.QBinding) []string {
+
+	names := []string{}
+
+	for _, qb := range qBindings {
+		names = append(names, qb.Name)
+	}
+
+	return names
+}
+
+// storeState holds the contents of a store, sorted so that stores can be compared regardless of the order of their records
+type storeState struct {
+	ServiceTypes []stores.QServiceType
+	Bindings     []stores.QBinding
+	AuthMethods  []stores.QAuthMethod
+}
+
+func (suite *conformanceSuite) state() storeState {
+
+	var state storeState
+
+	state.ServiceTypes, _ = suite.store.QueryServiceTypes("")
+	state.Bindings, _ = suite.store.QueryBindings("", "")
+	state.AuthMethods, _ = suite.store.QueryAuthMethods("", "", "")
+
+	sort.Slice(state.ServiceTypes, func(i, j int) bool { return state.ServiceTypes[i].UUID < state.ServiceTypes[j].UUID })
+	sort.Slice(state.Bindings, func(i, j int) bool { return state.Bindings[i].UUID < state.Bindings[j].UUID })
+	sort.Slice(state.AuthMethods, func(i, j int) bool { return state.AuthMethods[i].Basic().UUID < state.AuthMethods[j].Basic().UUID })
+
+	return state
+}
+
+func (suite *conformanceSuite) TestQueryServiceTypes() {
+
+	qServices1, err1 := suite.store.QueryServiceTypes("s1")
+	qServices2, err2 := suite.store.QueryServiceTypes("")
+	qServices3, err3 := suite.store.QueryServiceTypes("unknown")
+	qServices4, err4 := suite.store.QueryServiceTypesByUUID("uuid2")
+	qServices5, err5 := suite.store.QueryServiceTypesByUUID("unknown")
+
+	expService1 := stores.QServiceType{Name: "s1", Hosts: []string{"host1", "host2", "host3"}, AuthTypes: []string{"x509", "oidc"}, AuthMethod: "api-key", UUID: "uuid1", CreatedOn: "2018-05-05T18:04:05Z", Type: "ams"}
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Nil(err4)
+	suite.Nil(err5)
+	suite.Equal([]stores.QServiceType{expService1}, qServices1)
+
+	// an empty name matches all the service types, in the order they were created
+	suite.Equal(2, len(qServices2))
+	suite.Equal("s1", qServices2[0].Name)
+	suite.Equal("s2", qServices2[1].Name)
+
+	suite.Empty(qServices3)
+	suite.Equal(1, len(qServices4))
+	suite.Equal("s2", qServices4[0].Name)
+	suite.Equal([]string{"host3", "host4"}, qServices4[0].Hosts)
+	suite.Empty(qServices5)
+}
+
+func (suite *conformanceSuite) TestInsertServiceType() {
+
+	qService, err1 := suite.store.InsertServiceType("s3", []string{"host5"}, []string{"x509"}, "api-key", "uuid3", "2019-05-05T18:04:05Z", "ams")
+	qServices, err2 := suite.store.QueryServiceTypesByUUID("uuid3")
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Equal(stores.QServiceType{Name: "s3", Hosts: []string{"host5"}, AuthTypes: []string{"x509"}, AuthMethod: "api-key", UUID: "uuid3", CreatedOn: "2019-05-05T18:04:05Z", Type: "ams"}, qService)
+	suite.Equal([]stores.QServiceType{qService}, qServices)
+}
+
+func (suite *conformanceSuite) TestUpdateServiceType() {
+
+	qServices, _ := suite.store.QueryServiceTypesByUUID("uuid1")
+
+	updated := qServices[0]
+	updated.Name = "s1_updated"
+	updated.Hosts = []string{"host3", "host1"}
+	updated.AuthTypes = []string{"x509"}
+
+	qService1, err1 := suite.store.UpdateServiceType(qServices[0], updated)
+	qServices1, _ := suite.store.QueryServiceTypesByUUID("uuid1")
+	qServices2, _ := suite.store.QueryServiceTypes("s1")
+
+	// unknown service type
+	_, err3 := suite.store.UpdateServiceType(stores.QServiceType{Name: "unknown", UUID: "unknown"}, updated)
+
+	suite.Nil(err1)
+	suite.Equal(updated, qService1)
+	suite.Equal([]stores.QServiceType{updated}, qServices1)
+	suite.Empty(qServices2)
+	suite.Equal(utils.APIErrDatabase("not found"), err3)
+}
+
+func (suite *conformanceSuite) TestUpdateServiceTypeHostDetails() {
+
+	qServices, _ := suite.store.QueryServiceTypesByUUID("uuid1")
+
+	updated := qServices[0]
+	updated.HostDetails = []stores.QHost{
+		{Name: "host1", Description: "load balanced", Enabled: true, Aliases: []string{"host1-lb", "host1-alt"}, CreatedOn: "2019-05-05T18:04:05Z"},
+		{Name: "host2", Enabled: false},
+	}
+
+	_, err1 := suite.store.UpdateServiceType(qServices[0], updated)
+	qServices1, _ := suite.store.QueryServiceTypesByUUID("uuid1")
+
+	// the service type can be matched along with the metadata of its hosts
+	removed := updated
+	removed.HostDetails = nil
+	_, err2 := suite.store.UpdateServiceType(updated, removed)
+	qServices2, _ := suite.store.QueryServiceTypesByUUID("uuid1")
+
+	suite.Nil(err1)
+	suite.Equal([]stores.QServiceType{updated}, qServices1)
+	suite.Nil(err2)
+	suite.Equal([]stores.QServiceType{removed}, qServices2)
+}
+
+func (suite *conformanceSuite) TestDeleteServiceTypeByUUID() {
+
+	err1 := suite.store.DeleteServiceTypeByUUID("uuid1")
+	qServices1, _ := suite.store.QueryServiceTypes("")
+
+	// the service type has already been deleted
+	err2 := suite.store.DeleteServiceTypeByUUID("uuid1")
+
+	// the bindings and auth methods of a service type are deleted separately
+	qBindings, _ := suite.store.QueryBindings("uuid1", "host1")
+	qams, _ := suite.store.QueryAuthMethods("", "uuid1", "host1")
+
+	suite.Nil(err1)
+	suite.Equal(1, len(qServices1))
+	suite.Equal("s2", qServices1[0].Name)
+	suite.Equal(utils.APIErrDatabase("not found"), err2)
+	suite.Equal(2, len(qBindings))
+	suite.Equal(1, len(qams))
+}
+
+func (suite *conformanceSuite) TestQueryBindingsByAuthID() {
+
+	qBindings1, err1 := suite.store.QueryBindingsByAuthID("test_dn_1", "uuid1", "host1", "x509")
+
+	// every one of the fields has to match
+	qBindings2, err2 := suite.store.QueryBindingsByAuthID("test_dn_1", "uuid1", "host1", "oidc")
+	qBindings3, err3 := suite.store.QueryBindingsByAuthID("test_dn_1", "uuid1", "host2", "x509")
+	qBindings4, err4 := suite.store.QueryBindingsByAuthID("test_dn_1", "uuid2", "host1", "x509")
+	qBindings5, err5 := suite.store.QueryBindingsByAuthID("test_dn", "uuid1", "host1", "x509")
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Nil(err4)
+	suite.Nil(err5)
+	suite.Equal(1, len(qBindings1))
+	suite.Equal("b1", qBindings1[0].Name)
+	suite.Equal("b_uuid1", qBindings1[0].UUID)
+	suite.Equal("unique_key_1", qBindings1[0].UniqueKey)
+	suite.Empty(qBindings2)
+	suite.Empty(qBindings3)
+	suite.Empty(qBindings4)
+	suite.Empty(qBindings5)
+}
+
+func (suite *conformanceSuite) TestQueryBindingsByUUIDAndName() {
+
+	qBindings1, err1 := suite.store.QueryBindingsByUUIDAndName("b_uuid2", "")
+	qBindings2, err2 := suite.store.QueryBindingsByUUIDAndName("", "b3")
+	qBindings3, err3 := suite.store.QueryBindingsByUUIDAndName("b_uuid4", "b4")
+
+	// both of them have to match
+	qBindings4, err4 := suite.store.QueryBindingsByUUIDAndName("b_uuid4", "b1")
+	qBindings5, err5 := suite.store.QueryBindingsByUUIDAndName("unknown", "")
+
+	// empty values match every binding
+	qBindings6, err6 := suite.store.QueryBindingsByUUIDAndName("", "")
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Nil(err4)
+	suite.Nil(err5)
+	suite.Nil(err6)
+	suite.Equal([]string{"b2"}, bindingNames(qBindings1))
+	suite.Equal([]string{"b3"}, bindingNames(qBindings2))
+	suite.Equal([]string{"b4"}, bindingNames(qBindings3))
+	suite.Empty(qBindings4)
+	suite.Empty(qBindings5)
+	suite.Equal(4, len(qBindings6))
+}
+
+func (suite *conformanceSuite) TestQueryBindings() {
+
+	qBindings1, err1 := suite.store.QueryBindings("uuid1", "host1")
+	qBindings2, err2 := suite.store.QueryBindings("uuid1", "host4")
+
+	// all the bindings are returned, in the order they were created, unless both the service type and the host are given
+	qBindings3, err3 := suite.store.QueryBindings("", "")
+	qBindings4, err4 := suite.store.QueryBindings("uuid1", "")
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Nil(err4)
+	suite.Equal([]string{"b1", "b2"}, bindingNames(qBindings1))
+	suite.Empty(qBindings2)
+	suite.Equal([]string{"b1", "b2", "b3", "b4"}, bindingNames(qBindings3))
+	suite.Equal(4, len(qBindings4))
+}
+
+func (suite *conformanceSuite) TestInsertBinding() {
+
+	qBinding, err1 := suite.store.InsertBinding("b5", "uuid2", "host4", "b_uuid5", "test_dn_5", "unique_key_5", "x509", "am_uuid_2")
+	qBindings, err2 := suite.store.QueryBindingsByAuthID("test_dn_5", "uuid2", "host4", "x509")
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Equal("b5", qBinding.Name)
+	suite.Equal("b_uuid5", qBinding.UUID)
+	suite.Equal("am_uuid_2", qBinding.AuthMethod)
+	suite.Equal("", qBinding.LastAuth)
+
+	// the creation time is set by the store
+	suite.NotEqual("", qBinding.CreatedOn)
+	suite.Equal([]stores.QBinding{qBinding}, qBindings)
+}
+
+func (suite *conformanceSuite) TestUpdateBinding() {
+
+	qBindings, _ := suite.store.QueryBindingsByUUIDAndName("b_uuid1", "")
+
+	disabled := false
+
+	updated := qBindings[0]
+	updated.AuthIdentifier = "test_dn_updated"
+	updated.Enabled = &disabled
+	updated.SuspensionReason = "compromised certificate"
+	updated.NotBefore = "2019-01-01T00:00:00Z"
+	updated.NotAfter = "2019-02-01T00:00:00Z"
+
+	qBinding1, err1 := suite.store.UpdateBinding(qBindings[0], updated)
+	qBindings1, _ := suite.store.QueryBindingsByAuthID("test_dn_updated", "uuid1", "host1", "x509")
+	qBindings2, _ := suite.store.QueryBindingsByAuthID("test_dn_1", "uuid1", "host1", "x509")
+
+	// unknown binding
+	_, err3 := suite.store.UpdateBinding(stores.QBinding{Name: "unknown", UUID: "unknown"}, updated)
+
+	suite.Nil(err1)
+	suite.Equal(updated, qBinding1)
+	suite.Equal([]stores.QBinding{updated}, qBindings1)
+	suite.Empty(qBindings2)
+	suite.Equal(utils.APIErrDatabase("not found"), err3)
+}
+
+func (suite *conformanceSuite) TestUpdateBindingKeepsUsage() {
+
+	qBindings, _ := suite.store.QueryBindingsByUUIDAndName("b_uuid1", "")
+
+	// the usage of the binding is recorded after it has been read
+	err1 := suite.store.RecordBindingUsage([]stores.QBindingUsage{{UUID: "b_uuid1", Count: 3, LastAuth: "2019-05-05T15:04:05Z", ClientIP: "10.0.0.1"}})
+
+	updated := qBindings[0]
+	updated.UniqueKey = "unique_key_updated"
+	updated.LastAuth = "2018-01-01T00:00:00Z"
+	updated.Revision++
+
+	qBinding2, err2 := suite.store.UpdateBinding(qBindings[0], updated)
+	qBindings2, _ := suite.store.QueryBindingsByUUIDAndName("b_uuid1", "")
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Equal(qBindings2[0], qBinding2)
+	suite.Equal("unique_key_updated", qBinding2.UniqueKey)
+	suite.Equal(int64(3), qBinding2.AuthCount)
+	suite.Equal("2019-05-05T15:04:05Z", qBinding2.LastAuth)
+	suite.Equal("10.0.0.1", qBinding2.LastClientIP)
+}
+
+func (suite *conformanceSuite) TestDeleteBindingAfterUsage() {
+
+	qBindings, _ := suite.store.QueryBindingsByUUIDAndName("b_uuid1", "")
+
+	// the usage of the binding is recorded after it has been read
+	err1 := suite.store.RecordBindingUsage([]stores.QBindingUsage{{UUID: "b_uuid1", Count: 1, LastAuth: "2019-05-05T15:04:05Z", ClientIP: "10.0.0.1"}})
+	err2 := suite.store.DeleteBinding(qBindings[0])
+	qBindings2, _ := suite.store.QueryBindingsByUUIDAndName("b_uuid1", "")
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Empty(qBindings2)
+}
+
+func (suite *conformanceSuite) TestRecordBindingUsage() {
+
+	suite.setBindingTimes("b_uuid2", "2018-02-01T00:00:00Z", "2019-01-01T00:00:00Z")
+
+	err1 := suite.store.RecordBindingUsage([]stores.QBindingUsage{
+		{UUID: "b_uuid1", Count: 3, LastAuth: "2019-05-05T15:04:05Z", ClientIP: "10.0.0.1"},
+		// the last authentication time never moves backwards
+		{UUID: "b_uuid2", Count: 1, LastAuth: "2018-05-05T15:04:05Z", ClientIP: "10.0.0.2"},
+		// unknown bindings are skipped
+		{UUID: "unknown", Count: 1, LastAuth: "2019-05-05T15:04:05Z", ClientIP: "10.0.0.3"},
+	})
+	err2 := suite.store.RecordBindingUsage([]stores.QBindingUsage{
+		{UUID: "b_uuid1", Count: 2, LastAuth: "2019-06-05T15:04:05Z", ClientIP: "10.0.0.4"},
+	})
+	err3 := suite.store.RecordBindingUsage(nil)
+
+	qBindings1, _ := suite.store.QueryBindingsByUUIDAndName("b_uuid1", "")
+	qBindings2, _ := suite.store.QueryBindingsByUUIDAndName("b_uuid2", "")
+	qBindings3, _ := suite.store.QueryBindingsByUUIDAndName("b_uuid3", "")
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Equal(int64(5), qBindings1[0].AuthCount)
+	suite.Equal("2019-06-05T15:04:05Z", qBindings1[0].LastAuth)
+	suite.Equal("10.0.0.4", qBindings1[0].LastClientIP)
+	suite.Equal(int64(1), qBindings2[0].AuthCount)
+	suite.Equal("2019-01-01T00:00:00Z", qBindings2[0].LastAuth)
+	suite.Equal("10.0.0.2", qBindings2[0].LastClientIP)
+	suite.Equal(int64(0), qBindings3[0].AuthCount)
+
+	// recording the usage doesn't change the revision of the binding
+	suite.Equal(int64(0), qBindings1[0].Revision)
+	suite.Equal(int64(1), qBindings2[0].Revision)
+}
+
+func (suite *conformanceSuite) TestDeleteBinding() {
+
+	qBindings, _ := suite.store.QueryBindingsByUUIDAndName("b_uuid2", "")
+
+	err1 := suite.store.DeleteBinding(qBindings[0])
+	qBindings1, _ := suite.store.QueryBindings("", "")
+
+	// the binding has already been deleted
+	err2 := suite.store.DeleteBinding(qBindings[0])
+
+	suite.Nil(err1)
+	suite.Equal([]string{"b1", "b3", "b4"}, bindingNames(qBindings1))
+	suite.Equal(utils.APIErrDatabase("not found"), err2)
+}
+
+func (suite *conformanceSuite) TestDeleteBindingByServiceUUID() {
+
+	err1 := suite.store.DeleteBindingByServiceUUID("uuid1")
+	qBindings1, _ := suite.store.QueryBindings("", "")
+
+	// a service type without bindings is not an error
+	err2 := suite.store.DeleteBindingByServiceUUID("uuid1")
+	err3 := suite.store.DeleteBindingByServiceUUID("unknown")
+
+	suite.Nil(err1)
+	suite.Equal([]string{"b4"}, bindingNames(qBindings1))
+	suite.Nil(err2)
+	suite.Nil(err3)
+}
+
+func (suite *conformanceSuite) TestQueryAuthMethods() {
+
+	qams1, err1 := suite.store.QueryAuthMethods("", "", "")
+	qams2, err2 := suite.store.QueryAuthMethods("api-key", "", "")
+	qams3, err3 := suite.store.QueryAuthMethods("headers", "uuid2", "host3")
+	qams4, err4 := suite.store.QueryAuthMethods("", "uuid1", "host1")
+
+	// both the service type and the host have to match, as well as the type when given
+	qams5, err5 := suite.store.QueryAuthMethods("headers", "uuid1", "host1")
+	qams6, err6 := suite.store.QueryAuthMethods("", "uuid1", "host3")
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Nil(err4)
+	suite.Nil(err5)
+	suite.Nil(err6)
+
+	// auth methods are decoded into the query models of their types
+	suite.Equal([]stores.QAuthMethod{apiKeyAuthMethod("am_uuid_1", "uuid1", "host1", "access_key"), headersAuthMethod("am_uuid_2", "uuid2", "host3")}, qams1)
+	suite.Equal([]stores.QAuthMethod{apiKeyAuthMethod("am_uuid_1", "uuid1", "host1", "access_key")}, qams2)
+	suite.Equal([]stores.QAuthMethod{headersAuthMethod("am_uuid_2", "uuid2", "host3")}, qams3)
+	suite.Equal(1, len(qams4))
+	suite.Empty(qams5)
+	suite.Empty(qams6)
+
+	// the returned auth methods are copies, modifying them doesn't affect the store
+	qams4[0].Basic().Port = 1
+	qams7, _ := suite.store.QueryAuthMethods("", "uuid1", "host1")
+	suite.Equal(9000, qams7[0].Basic().Port)
+}
+
+func (suite *conformanceSuite) TestUpdateAuthMethod() {
+
+	original := apiKeyAuthMethod("am_uuid_1", "uuid1", "host1", "access_key")
+	updated := apiKeyAuthMethod("am_uuid_1", "uuid1", "host2", "access_key_updated")
+
+	qam1, err1 := suite.store.UpdateAuthMethod(original, updated)
+	qams1, _ := suite.store.QueryAuthMethods("api-key", "uuid1", "host2")
+	qams2, _ := suite.store.QueryAuthMethods("api-key", "uuid1", "host1")
+
+	// unknown auth method
+	_, err3 := suite.store.UpdateAuthMethod(apiKeyAuthMethod("unknown", "uuid1", "host1", "access_key"), updated)
+
+	suite.Nil(err1)
+	suite.Equal(updated, qam1)
+	suite.Equal([]stores.QAuthMethod{updated}, qams1)
+	suite.Empty(qams2)
+	suite.Equal(utils.APIErrDatabase("not found"), err3)
+}
+
+// TestUpdateRevisions checks that the updates only take place as long as the stored records have the revision of the original ones
+func (suite *conformanceSuite) TestUpdateRevisions() {
+
+	qServices, _ := suite.store.QueryServiceTypesByUUID("uuid1")
+	qBindings, _ := suite.store.QueryBindingsByUUIDAndName("b_uuid1", "")
+	originalAm := apiKeyAuthMethod("am_uuid_1", "uuid1", "host1", "access_key")
+
+	updatedService := qServices[0]
+	updatedService.Name = "s1_updated"
+	updatedService.Revision++
+
+	updatedBinding := qBindings[0]
+	updatedBinding.AuthIdentifier = "test_dn_updated"
+	updatedBinding.Revision++
+
+	updatedAm := apiKeyAuthMethod("am_uuid_1", "uuid1", "host1", "access_key_updated")
+	updatedAm.Revision++
+
+	_, err1 := suite.store.UpdateServiceType(qServices[0], updatedService)
+	_, err2 := suite.store.UpdateBinding(qBindings[0], updatedBinding)
+	_, err3 := suite.store.UpdateAuthMethod(originalAm, updatedAm)
+
+	// the original records are stale now, their revisions have changed
+	staleService := qServices[0]
+	staleService.Name = "s1_stale"
+	staleService.Revision++
+
+	staleBinding := qBindings[0]
+	staleBinding.AuthIdentifier = "test_dn_stale"
+	staleBinding.Revision++
+
+	staleAm := apiKeyAuthMethod("am_uuid_1", "uuid1", "host1", "access_key_stale")
+	staleAm.Revision++
+
+	_, err4 := suite.store.UpdateServiceType(qServices[0], staleService)
+	_, err5 := suite.store.UpdateBinding(qBindings[0], staleBinding)
+	_, err6 := suite.store.UpdateAuthMethod(originalAm, staleAm)
+
+	qServices1, _ := suite.store.QueryServiceTypesByUUID("uuid1")
+	qBindings1, _ := suite.store.QueryBindingsByUUIDAndName("b_uuid1", "")
+	qams1, _ := suite.store.QueryAuthMethods("api-key", "uuid1", "host1")
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Equal(utils.APIErrPreconditionFailed("Service type"), err4)
+	suite.Equal(utils.APIErrPreconditionFailed("Binding"), err5)
+	suite.Equal(utils.APIErrPreconditionFailed("Auth method"), err6)
+	suite.Equal([]stores.QServiceType{updatedService}, qServices1)
+	suite.Equal([]stores.QBinding{updatedBinding}, qBindings1)
+	suite.Equal([]stores.QAuthMethod{updatedAm}, qams1)
+}
+
+func (suite *conformanceSuite) TestDeleteAuthMethod() {
+
+	err1 := suite.store.DeleteAuthMethod(apiKeyAuthMethod("am_uuid_1", "uuid1", "host1", "access_key"))
+	qams1, _ := suite.store.QueryAuthMethods("", "", "")
+
+	// the auth method has already been deleted
+	err2 := suite.store.DeleteAuthMethod(apiKeyAuthMethod("am_uuid_1", "uuid1", "host1", "access_key"))
+
+	suite.Nil(err1)
+	suite.Equal([]stores.QAuthMethod{headersAuthMethod("am_uuid_2", "uuid2", "host3")}, qams1)
+	suite.Equal(utils.APIErrDatabase("not found"), err2)
+}
+
+func (suite *conformanceSuite) TestDeleteAuthMethodByServiceUUID() {
+
+	err1 := suite.store.DeleteAuthMethodByServiceUUID("uuid2")
+	qams1, _ := suite.store.QueryAuthMethods("", "", "")
+
+	// a service type without auth methods is not an error
+	err2 := suite.store.DeleteAuthMethodByServiceUUID("uuid2")
+
+	suite.Nil(err1)
+	suite.Equal([]stores.QAuthMethod{apiKeyAuthMethod("am_uuid_1", "uuid1", "host1", "access_key")}, qams1)
+	suite.Nil(err2)
+}
+
+func (suite *conformanceSuite) TestAuthMethodSecrets() {
+
+	stores.Secrets, _ = stores.ParseKeyring("v1:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32))))
+	defer func() { stores.Secrets = nil }()
+
+	original := apiKeyAuthMethod("am_uuid_3", "uuid1", "host2", "access_key_3")
+	err1 := suite.store.InsertAuthMethod(original)
+
+	// the secrets are stored encrypted
+	qams1, _ := suite.store.QueryAuthMethods("api-key", "uuid1", "host2")
+	decrypted1, _ := stores.DecryptSecrets(qams1[0])
+
+	// auth methods are updated and deleted through their decrypted form
+	updated := apiKeyAuthMethod("am_uuid_3", "uuid1", "host2", "access_key_4")
+	_, err2 := suite.store.UpdateAuthMethod(original, updated)
+	qams2, _ := suite.store.QueryAuthMethods("api-key", "uuid1", "host2")
+	decrypted2, _ := stores.DecryptSecrets(qams2[0])
+
+	err3 := suite.store.DeleteAuthMethod(updated)
+	qams3, _ := suite.store.QueryAuthMethods("api-key", "uuid1", "host2")
+
+	suite.Nil(err1)
+	suite.True(stores.IsEncrypted(qams1[0].(*stores.QApiKeyAuthMethod).AccessKey))
+	suite.Equal(original, decrypted1)
+	suite.Nil(err2)
+	suite.True(stores.IsEncrypted(qams2[0].(*stores.QApiKeyAuthMethod).AccessKey))
+	suite.Equal(updated, decrypted2)
+	suite.Nil(err3)
+	suite.Empty(qams3)
+}
+
+// setBindingTimes sets the creation and the last authentication times of the binding with the given uuid
+func (suite *conformanceSuite) setBindingTimes(uuid string, createdOn string, lastAuth string) {
+
+	qBindings, _ := suite.store.QueryBindingsByUUIDAndName(uuid, "")
+
+	updated := qBindings[0]
+	updated.CreatedOn = createdOn
+	updated.Revision++
+
+	_, err := suite.store.UpdateBinding(qBindings[0], updated)
+	suite.Require().Nil(err)
+
+	// the last authentication time is only set through the usage of the binding
+	if lastAuth != "" {
+		err = suite.store.RecordBindingUsage([]stores.QBindingUsage{{UUID: uuid, LastAuth: lastAuth}})
+		suite.Require().Nil(err)
+	}
+}
+
+func (suite *conformanceSuite) TestListBindings() {
+
+	suite.setBindingTimes("b_uuid1", "2018-01-01T00:00:00Z", "2018-06-01T00:00:00Z")
+	suite.setBindingTimes("b_uuid2", "2018-02-01T00:00:00Z", "")
+	suite.setBindingTimes("b_uuid3", "2018-03-01T00:00:00Z", "2018-05-01T00:00:00Z")
+	suite.setBindingTimes("b_uuid4", "2018-04-01T00:00:00Z", "")
+
+	// the pages follow each other until there is no next page
+	page1, err1 := suite.store.ListBindings(stores.BindingFilter{}, stores.ListOptions{PageSize: 3})
+	page2, err2 := suite.store.ListBindings(stores.BindingFilter{}, stores.ListOptions{PageSize: 3, PageToken: page1.NextPageToken})
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Equal([]string{"b1", "b2", "b3"}, bindingNames(page1.Bindings))
+	suite.NotEqual("", page1.NextPageToken)
+	suite.Equal(4, page1.TotalSize)
+	suite.Equal([]string{"b4"}, bindingNames(page2.Bindings))
+	suite.Equal("", page2.NextPageToken)
+	suite.Equal(4, page2.TotalSize)
+
+	// a page that ends with the last binding has no next page
+	page3, err3 := suite.store.ListBindings(stores.BindingFilter{}, stores.ListOptions{PageSize: 4})
+	suite.Nil(err3)
+	suite.Equal(4, len(page3.Bindings))
+	suite.Equal("", page3.NextPageToken)
+
+	// bindings that haven't been used come first when sorted by their last authentication
+	page4, err4 := suite.store.ListBindings(stores.BindingFilter{}, stores.ListOptions{PageSize: 2, OrderBy: "last_auth"})
+	page5, err5 := suite.store.ListBindings(stores.BindingFilter{}, stores.ListOptions{PageSize: 2, OrderBy: "last_auth", PageToken: page4.NextPageToken})
+	suite.Nil(err4)
+	suite.Nil(err5)
+	suite.Equal([]string{"b2", "b4"}, bindingNames(page4.Bindings))
+	suite.Equal([]string{"b3", "b1"}, bindingNames(page5.Bindings))
+
+	page6, err6 := suite.store.ListBindings(stores.BindingFilter{}, stores.ListOptions{PageSize: 3, OrderBy: "name", Descending: true})
+	page7, err7 := suite.store.ListBindings(stores.BindingFilter{}, stores.ListOptions{PageSize: 3, OrderBy: "name", Descending: true, PageToken: page6.NextPageToken})
+	suite.Nil(err6)
+	suite.Nil(err7)
+	suite.Equal([]string{"b4", "b3", "b2"}, bindingNames(page6.Bindings))
+	suite.Equal([]string{"b1"}, bindingNames(page7.Bindings))
+
+	filters := []struct {
+		filter stores.BindingFilter
+		names  []string
+	}{
+		{stores.BindingFilter{ServiceUUID: "uuid1", Host: "host1"}, []string{"b1", "b2"}},
+		{stores.BindingFilter{Host: "host3"}, []string{"b4"}},
+		{stores.BindingFilter{AuthType: "oidc"}, []string{}},
+		{stores.BindingFilter{NamePrefix: "b"}, []string{"b1", "b2", "b3", "b4"}},
+		{stores.BindingFilter{NamePrefix: "b%"}, []string{}},
+		{stores.BindingFilter{AuthIdentifier: "dn_1"}, []string{"b1", "b4"}},
+		{stores.BindingFilter{CreatedAfter: "2018-02-01T00:00:00Z", CreatedBefore: "2018-04-01T00:00:00Z"}, []string{"b2", "b3"}},
+		{stores.BindingFilter{LastAuthBefore: "2018-06-01T00:00:00Z"}, []string{"b3"}},
+		{stores.BindingFilter{LastAuthAfter: "2018-05-01T00:00:00Z"}, []string{"b1", "b3"}},
+		{stores.BindingFilter{UnusedSince: "2018-03-15T00:00:00Z"}, []string{"b2"}},
+		{stores.BindingFilter{UnusedSince: "2018-05-15T00:00:00Z"}, []string{"b2", "b3", "b4"}},
+	}
+
+	for _, f := range filters {
+		page, err := suite.store.ListBindings(f.filter, stores.ListOptions{})
+		suite.Nil(err)
+		suite.Equal(f.names, bindingNames(page.Bindings), "%+v", f.filter)
+		suite.Equal(len(f.names), page.TotalSize, "%+v", f.filter)
+	}
+}
+
+func (suite *conformanceSuite) TestListBindingsInvalidOptions() {
+
+	page, _ := suite.store.ListBindings(stores.BindingFilter{}, stores.ListOptions{PageSize: 1})
+
+	_, err1 := suite.store.ListBindings(stores.BindingFilter{}, stores.ListOptions{OrderBy: "unique_key"})
+	_, err2 := suite.store.ListBindings(stores.BindingFilter{}, stores.ListOptions{PageToken: "unknown"})
+
+	// a page token only continues the listing it came from
+	_, err3 := suite.store.ListBindings(stores.BindingFilter{}, stores.ListOptions{PageToken: page.NextPageToken, OrderBy: "name"})
+	_, err4 := suite.store.ListBindings(stores.BindingFilter{}, stores.ListOptions{PageToken: page.NextPageToken, Descending: true})
+
+	suite.Equal(utils.APIErrUnsupportedContent("order_by", "unique_key", "Supported:[created_on name last_auth]"), err1)
+	suite.Equal(utils.APIErrInvalidParameter("pageToken", "The page token doesn't belong to this listing"), err2)
+	suite.Equal(utils.APIErrInvalidParameter("pageToken", "The page token doesn't belong to this listing"), err3)
+	suite.Equal(utils.APIErrInvalidParameter("pageToken", "The page token doesn't belong to this listing"), err4)
+}
+
+func (suite *conformanceSuite) TestListServiceTypes() {
+
+	page1, err1 := suite.store.ListServiceTypes(stores.ServiceTypeFilter{}, stores.ListOptions{PageSize: 1})
+	page2, err2 := suite.store.ListServiceTypes(stores.ServiceTypeFilter{}, stores.ListOptions{PageSize: 1, PageToken: page1.NextPageToken})
+	page3, err3 := suite.store.ListServiceTypes(stores.ServiceTypeFilter{}, stores.ListOptions{OrderBy: "name", Descending: true})
+	page4, err4 := suite.store.ListServiceTypes(stores.ServiceTypeFilter{NamePrefix: "s", Type: "ams"}, stores.ListOptions{})
+	page5, err5 := suite.store.ListServiceTypes(stores.ServiceTypeFilter{CreatedBefore: "2018-05-05T18:04:05Z"}, stores.ListOptions{})
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Nil(err4)
+	suite.Nil(err5)
+
+	// service types created at the same time are sorted by their uuid
+	suite.Equal(1, len(page1.ServiceTypes))
+	suite.Equal("s1", page1.ServiceTypes[0].Name)
+	suite.Equal([]string{"host1", "host2", "host3"}, page1.ServiceTypes[0].Hosts)
+	suite.Equal(2, page1.TotalSize)
+	suite.Equal(1, len(page2.ServiceTypes))
+	suite.Equal("s2", page2.ServiceTypes[0].Name)
+	suite.Equal("", page2.NextPageToken)
+
+	suite.Equal(2, len(page3.ServiceTypes))
+	suite.Equal("s2", page3.ServiceTypes[0].Name)
+	suite.Equal("s1", page3.ServiceTypes[1].Name)
+	suite.Equal(1, len(page4.ServiceTypes))
+	suite.Equal("s1", page4.ServiceTypes[0].Name)
+	suite.Equal(1, page4.TotalSize)
+	suite.Equal([]stores.QServiceType{}, page5.ServiceTypes)
+	suite.Equal(0, page5.TotalSize)
+}
+
+func (suite *conformanceSuite) TestListAuthMethods() {
+
+	page1, err1 := suite.store.ListAuthMethods(stores.AuthMethodFilter{}, stores.ListOptions{PageSize: 1, OrderBy: "host", Descending: true})
+	page2, err2 := suite.store.ListAuthMethods(stores.AuthMethodFilter{}, stores.ListOptions{PageSize: 1, OrderBy: "host", Descending: true, PageToken: page1.NextPageToken})
+	page3, err3 := suite.store.ListAuthMethods(stores.AuthMethodFilter{ServiceUUID: "uuid1", Type: "api-key"}, stores.ListOptions{})
+	page4, err4 := suite.store.ListAuthMethods(stores.AuthMethodFilter{Host: "host1", Type: "headers"}, stores.ListOptions{})
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Nil(err4)
+	suite.Equal(1, len(page1.AuthMethods))
+	suite.Equal("am_uuid_2", page1.AuthMethods[0].Basic().UUID)
+	suite.Equal(2, page1.TotalSize)
+	suite.Equal(1, len(page2.AuthMethods))
+	suite.Equal("am_uuid_1", page2.AuthMethods[0].Basic().UUID)
+	suite.Equal("", page2.NextPageToken)
+
+	// listed auth methods are decoded into the query model of their type
+	suite.Equal([]stores.QAuthMethod{apiKeyAuthMethod("am_uuid_1", "uuid1", "host1", "access_key")}, page3.AuthMethods)
+	suite.Equal([]stores.QAuthMethod{}, page4.AuthMethods)
+}
+
+func (suite *conformanceSuite) TestClone() {
+
+	// a clone queries the same data, closing it leaves the original store usable
+	clone := suite.store.Clone()
+	qServices1, err1 := clone.QueryServiceTypes("")
+	clone.Close()
+
+	qServices2, err2 := suite.store.QueryServiceTypes("")
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Equal(2, len(qServices1))
+	suite.Equal(qServices1, qServices2)
+}
+
+func (suite *conformanceSuite) TestRunInTransaction() {
+
+	err1 := suite.store.RunInTransaction(func(tx stores.Store) error {
+
+		if _, err := tx.InsertServiceType("s3", []string{"host5"}, []string{"x509"}, "api-key", "uuid3", "", "ams"); err != nil {
+			return err
+		}
+
+		if _, err := tx.InsertBinding("b5", "uuid3", "host5", "b_uuid5", "test_dn_5", "", "x509", ""); err != nil {
+			return err
+		}
+
+		if err := tx.InsertAuthMethod(apiKeyAuthMethod("am_uuid_3", "uuid3", "host5", "access_key_3")); err != nil {
+			return err
+		}
+
+		// the changes are visible within the unit of work
+		qBindings, err := tx.QueryBindings("uuid3", "host5")
+		if err != nil || len(qBindings) != 1 {
+			return errors.New("the inserted binding was not found")
+		}
+
+		return tx.DeleteBindingByServiceUUID("uuid2")
+	})
+
+	qServices1, _ := suite.store.QueryServiceTypesByUUID("uuid3")
+	qBindings1, _ := suite.store.QueryBindings("", "")
+	qams1, _ := suite.store.QueryAuthMethods("", "uuid3", "host5")
+
+	suite.Nil(err1)
+	suite.Equal(1, len(qServices1))
+	suite.Equal([]string{"b1", "b2", "b3", "b5"}, bindingNames(qBindings1))
+	suite.Equal(1, len(qams1))
+}
+
+func (suite *conformanceSuite) TestRunInTransactionRollback() {
+
+	// the usage of the deleted bindings is restored along with them
+	suite.store.RecordBindingUsage([]stores.QBindingUsage{{UUID: "b_uuid2", Count: 2, LastAuth: "2019-05-05T15:04:05Z", ClientIP: "10.0.0.1"}})
+
+	before := suite.state()
+	failure := errors.New("failure")
+
+	qServices, _ := suite.store.QueryServiceTypesByUUID("uuid2")
+	qBindings, _ := suite.store.QueryBindingsByUUIDAndName("b_uuid1", "")
+
+	err1 := suite.store.RunInTransaction(func(tx stores.Store) error {
+
+		if _, err := tx.InsertServiceType("s3", []string{"host5"}, []string{"x509"}, "api-key", "uuid3", "", "ams"); err != nil {
+			return err
+		}
+
+		updatedService := qServices[0]
+		updatedService.Hosts = []string{"host4"}
+		if _, err := tx.UpdateServiceType(qServices[0], updatedService); err != nil {
+			return err
+		}
+
+		updatedBinding := qBindings[0]
+		updatedBinding.Host = "host3"
+		if _, err := tx.UpdateBinding(qBindings[0], updatedBinding); err != nil {
+			return err
+		}
+
+		if _, err := tx.InsertBinding("b5", "uuid2", "host4", "b_uuid5", "test_dn_5", "", "x509", ""); err != nil {
+			return err
+		}
+
+		if _, err := tx.UpdateAuthMethod(headersAuthMethod("am_uuid_2", "uuid2", "host3"), headersAuthMethod("am_uuid_2", "uuid2", "host4")); err != nil {
+			return err
+		}
+
+		if err := tx.InsertAuthMethod(apiKeyAuthMethod("am_uuid_3", "uuid1", "host2", "access_key_3")); err != nil {
+			return err
+		}
+
+		// the cascading delete of a service type
+		if err := tx.DeleteBindingByServiceUUID("uuid1"); err != nil {
+			return err
+		}
+
+		if err := tx.DeleteAuthMethodByServiceUUID("uuid1"); err != nil {
+			return err
+		}
+
+		if err := tx.DeleteServiceTypeByUUID("uuid1"); err != nil {
+			return err
+		}
+
+		return failure
+	})
+
+	// the error of the unit of work is returned as it is and none of its changes are kept
+	suite.Equal(failure, err1)
+	suite.Equal(before, suite.state())
+}
+
+func (suite *conformanceSuite) TestRunInTransactionFailedOperation() {
+
+	before := suite.state()
+
+	// the unit of work fails on an operation of the store
+	err1 := suite.store.RunInTransaction(func(tx stores.Store) error {
+
+		if err := tx.DeleteBindingByServiceUUID("uuid1"); err != nil {
+			return err
+		}
+
+		return tx.DeleteServiceTypeByUUID("unknown")
+	})
+
+	suite.Equal(utils.APIErrDatabase("not found"), err1)
+	suite.Equal(before, suite.state())
+}
+
+func (suite *conformanceSuite) TestRunInTransactionNested() {
+
+	before := suite.state()
+	failure := errors.New("failure")
+
+	// a nested unit of work joins the enclosing one, its changes are discarded along with the enclosing one's
+	err1 := suite.store.RunInTransaction(func(tx stores.Store) error {
+
+		err := tx.RunInTransaction(func(nested stores.Store) error {
+			return nested.DeleteBindingByServiceUUID("uuid1")
+		})
+		if err != nil {
+			return err
+		}
+
+		return failure
+	})
+
+	suite.Equal(failure, err1)
+	suite.Equal(before, suite.state())
+}
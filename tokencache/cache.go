@@ -0,0 +1,154 @@
+package tokencache
+
+import (
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"sync"
+	"time"
+)
+
+// Entry identifies a cached auth resource, along with the service type and host it was retrieved for,
+// so it can be invalidated when any of the entities that produced it changes
+type Entry struct {
+	BindingUUID string
+	ServiceUUID string
+	Host        string
+}
+
+type cachedResource struct {
+	Entry
+	resource map[string]interface{}
+	expires  time.Time
+}
+
+// call is an in-flight retrieval that concurrent identical requests wait on
+type call struct {
+	wg       sync.WaitGroup
+	resource map[string]interface{}
+	err      error
+}
+
+// Cache holds the auth resources that have been retrieved for bindings, for a limited amount of time
+type Cache struct {
+	mutex     sync.Mutex
+	resources map[string]cachedResource
+	calls     map[string]*call
+	// generation changes on every invalidation, so retrievals that started before it are not cached
+	generation uint64
+	now        func() time.Time
+}
+
+// Tokens is the cache used for the auth resources retrieved through the auth methods
+var Tokens = New()
+
+func New() *Cache {
+	return &Cache{
+		resources: make(map[string]cachedResource),
+		calls:     make(map[string]*call),
+		now:       time.Now,
+	}
+}
+
+// Get returns the cached auth resource of the entry's binding, or retrieves it using the given function and caches it for ttl.
+// Concurrent requests for the same binding share a single retrieval. A ttl of zero disables caching
+func (c *Cache) Get(entry Entry, ttl time.Duration, retrieve func() (map[string]interface{}, error)) (map[string]interface{}, error) {
+
+	if ttl <= 0 {
+		return retrieve()
+	}
+
+	c.mutex.Lock()
+
+	if cr, ok := c.resources[entry.BindingUUID]; ok {
+		if c.now().Before(cr.expires) {
+			c.mutex.Unlock()
+			return copyResource(cr.resource), nil
+		}
+		delete(c.resources, entry.BindingUUID)
+	}
+
+	// another request is already retrieving the resource, wait for its result
+	if cl, ok := c.calls[entry.BindingUUID]; ok {
+		c.mutex.Unlock()
+		cl.wg.Wait()
+		return copyResource(cl.resource), cl.err
+	}
+
+	cl := &call{}
+	cl.wg.Add(1)
+	c.calls[entry.BindingUUID] = cl
+	generation := c.generation
+	c.mutex.Unlock()
+
+	// the waiting requests are released even if the retrieval panics, in which case they get an internal error
+	cl.err = utils.APIGenericInternalError("The retrieval of the auth resource was interrupted")
+	defer c.release(entry, ttl, generation, cl)
+
+	cl.resource, cl.err = retrieve()
+
+	return copyResource(cl.resource), cl.err
+}
+
+// release stores the result of a finished retrieval and releases the requests that wait on it
+func (c *Cache) release(entry Entry, ttl time.Duration, generation uint64, cl *call) {
+
+	cl.wg.Done()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.calls, entry.BindingUUID)
+	if cl.err == nil && generation == c.generation {
+		c.resources[entry.BindingUUID] = cachedResource{Entry: entry, resource: cl.resource, expires: c.now().Add(ttl)}
+	}
+}
+
+// invalidate removes the entries that match the given filter
+func (c *Cache) invalidate(match func(e Entry) bool) {
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generation++
+
+	for k, cr := range c.resources {
+		if match(cr.Entry) {
+			delete(c.resources, k)
+		}
+	}
+}
+
+// InvalidateBinding removes the cached auth resource of a binding
+func (c *Cache) InvalidateBinding(bindingUUID string) {
+	c.invalidate(func(e Entry) bool {
+		return e.BindingUUID == bindingUUID
+	})
+}
+
+// InvalidateHost removes the cached auth resources that were retrieved through the auth method of a service type's host
+func (c *Cache) InvalidateHost(serviceUUID string, host string) {
+	c.invalidate(func(e Entry) bool {
+		return e.ServiceUUID == serviceUUID && e.Host == host
+	})
+}
+
+// InvalidateServiceType removes all the cached auth resources of a service type
+func (c *Cache) InvalidateServiceType(serviceUUID string) {
+	c.invalidate(func(e Entry) bool {
+		return e.ServiceUUID == serviceUUID
+	})
+}
+
+// copyResource returns a shallow copy of an auth resource, so callers can't modify the cached one
+func copyResource(resource map[string]interface{}) map[string]interface{} {
+
+	if resource == nil {
+		return map[string]interface{}{}
+	}
+
+	cp := make(map[string]interface{}, len(resource))
+	for k, v := range resource {
+		cp[k] = v
+	}
+
+	return cp
+}
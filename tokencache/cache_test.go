@@ -0,0 +1,183 @@
+package tokencache
+
+import (
+	"errors"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	"github.com/stretchr/testify/suite"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type CacheTestSuite struct {
+	suite.Suite
+}
+
+func (suite *CacheTestSuite) TestGet() {
+
+	var calls int32
+
+	c := New()
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	retrieve := func() (map[string]interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return map[string]interface{}{"token": "some-value"}, nil
+	}
+
+	e1 := Entry{BindingUUID: "b_uuid_1", ServiceUUID: "uuid1", Host: "host1"}
+
+	// the first request retrieves the resource and the second one is served from the cache
+	res1, err1 := c.Get(e1, time.Minute, retrieve)
+	res2, err2 := c.Get(e1, time.Minute, retrieve)
+
+	// modifying a returned resource doesn't affect the cached one
+	res2["token"] = "modified"
+	res3, _ := c.Get(e1, time.Minute, retrieve)
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Equal(map[string]interface{}{"token": "some-value"}, res1)
+	suite.Equal(map[string]interface{}{"token": "some-value"}, res3)
+	suite.Equal(int32(1), atomic.LoadInt32(&calls))
+
+	// expired resources are retrieved again
+	now = now.Add(2 * time.Minute)
+	c.Get(e1, time.Minute, retrieve)
+	suite.Equal(int32(2), atomic.LoadInt32(&calls))
+
+	// a zero ttl disables caching
+	c.Get(Entry{BindingUUID: "b_uuid_2"}, 0, retrieve)
+	c.Get(Entry{BindingUUID: "b_uuid_2"}, 0, retrieve)
+	suite.Equal(int32(4), atomic.LoadInt32(&calls))
+
+	// errors are not cached
+	_, err4 := c.Get(Entry{BindingUUID: "b_uuid_3"}, time.Minute, func() (map[string]interface{}, error) {
+		return nil, errors.New("upstream error")
+	})
+	c.Get(Entry{BindingUUID: "b_uuid_3"}, time.Minute, retrieve)
+	suite.Equal("upstream error", err4.Error())
+	suite.Equal(int32(5), atomic.LoadInt32(&calls))
+}
+
+func (suite *CacheTestSuite) TestGetCoalescing() {
+
+	var calls int32
+	var wg sync.WaitGroup
+
+	c := New()
+	release := make(chan struct{})
+
+	retrieve := func() (map[string]interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return map[string]interface{}{"token": "some-value"}, nil
+	}
+
+	results := make([]map[string]interface{}, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = c.Get(Entry{BindingUUID: "b_uuid_1"}, time.Minute, retrieve)
+		}(i)
+	}
+
+	// let the concurrent requests reach the cache before the retrieval finishes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	suite.Equal(int32(1), atomic.LoadInt32(&calls))
+	for _, r := range results {
+		suite.Equal(map[string]interface{}{"token": "some-value"}, r)
+	}
+}
+
+func (suite *CacheTestSuite) TestGetPanic() {
+
+	c := New()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	waited := make(chan error)
+
+	retrieve := func() (map[string]interface{}, error) {
+		close(started)
+		<-release
+		panic("retrieval failed")
+	}
+
+	go func() {
+		defer func() { recover() }()
+		c.Get(Entry{BindingUUID: "b_uuid_1"}, time.Minute, retrieve)
+	}()
+
+	// a request that waits on the retrieval that panics
+	<-started
+	go func() {
+		_, err := c.Get(Entry{BindingUUID: "b_uuid_1"}, time.Minute, func() (map[string]interface{}, error) {
+			return nil, errors.New("not shared")
+		})
+		waited <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	select {
+	case err := <-waited:
+		suite.Equal(utils.APIGenericInternalError("The retrieval of the auth resource was interrupted"), err)
+	case <-time.After(time.Second):
+		suite.Fail("the waiting request was not released")
+	}
+
+	// nothing was cached and the next request retrieves the resource again
+	res, err := c.Get(Entry{BindingUUID: "b_uuid_1"}, time.Minute, func() (map[string]interface{}, error) {
+		return map[string]interface{}{"token": "some-value"}, nil
+	})
+
+	suite.Nil(err)
+	suite.Equal(map[string]interface{}{"token": "some-value"}, res)
+}
+
+func (suite *CacheTestSuite) TestInvalidate() {
+
+	var calls int32
+
+	c := New()
+
+	retrieve := func() (map[string]interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return map[string]interface{}{"token": "some-value"}, nil
+	}
+
+	e1 := Entry{BindingUUID: "b_uuid_1", ServiceUUID: "uuid1", Host: "host1"}
+	e2 := Entry{BindingUUID: "b_uuid_2", ServiceUUID: "uuid1", Host: "host2"}
+	e3 := Entry{BindingUUID: "b_uuid_3", ServiceUUID: "uuid2", Host: "host3"}
+
+	for _, e := range []Entry{e1, e2, e3} {
+		c.Get(e, time.Minute, retrieve)
+	}
+
+	c.InvalidateBinding("b_uuid_1")
+	suite.Equal(2, len(c.resources))
+
+	c.InvalidateHost("uuid1", "host2")
+	suite.Equal(1, len(c.resources))
+
+	c.InvalidateServiceType("uuid2")
+	suite.Equal(0, len(c.resources))
+
+	// a retrieval that was in flight during an invalidation is not cached
+	c.Get(e1, time.Minute, func() (map[string]interface{}, error) {
+		c.InvalidateBinding("b_uuid_1")
+		return retrieve()
+	})
+	suite.Equal(0, len(c.resources))
+}
+
+func TestCacheTestSuite(t *testing.T) {
+	suite.Run(t, new(CacheTestSuite))
+}
@@ -0,0 +1,182 @@
+package usage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ARGOeu/argo-api-authn/config"
+	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/ARGOeu/argo-api-authn/utils"
+	LOGGER "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultFlushInterval = 10
+	DefaultBatchSize     = 500
+)
+
+// Recorder collects the successful authentications through the bindings and records them in batches,
+// so that an authentication never waits for a write to the store
+type Recorder struct {
+	mutex     sync.Mutex
+	pending   map[string]stores.QBindingUsage
+	store     stores.Store
+	interval  time.Duration
+	batchSize int
+	// flushes asks the running recorder to flush before its next tick, when a batch is full
+	flushes chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	now     func() time.Time
+}
+
+// Bindings is the recorder of the authentications through the bindings, nothing is recorded while it is nil
+var Bindings *Recorder
+
+// New creates a recorder that records the authentications to the given store every interval,
+// or as soon as the authentications of batchSize bindings are pending. A batch size of zero only flushes on every interval
+func New(store stores.Store, interval time.Duration, batchSize int) *Recorder {
+	return &Recorder{
+		pending:   make(map[string]stores.QBindingUsage),
+		store:     store,
+		interval:  interval,
+		batchSize: batchSize,
+		flushes:   make(chan struct{}, 1),
+		now:       time.Now,
+	}
+}
+
+// FromConfig creates the recorder that the configuration describes, there is none when recording is disabled
+func FromConfig(store stores.Store, cfg *config.Config) *Recorder {
+
+	if cfg.BindingUsage.Disabled {
+		return nil
+	}
+
+	interval := cfg.BindingUsage.FlushInterval
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+
+	batchSize := cfg.BindingUsage.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	return New(store, time.Duration(interval)*time.Second, batchSize)
+}
+
+// Record adds a successful authentication through the binding to the pending ones
+func (r *Recorder) Record(bindingUUID string, clientIP string) {
+
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+
+	usage := r.pending[bindingUUID]
+	usage.UUID = bindingUUID
+	usage.Count++
+	usage.LastAuth = r.now().UTC().Format(utils.ZULU_FORM)
+	usage.ClientIP = clientIP
+	r.pending[bindingUUID] = usage
+
+	full := r.batchSize > 0 && len(r.pending) >= r.batchSize
+
+	r.mutex.Unlock()
+
+	if full {
+		select {
+		case r.flushes <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Flush records the pending authentications.
+// When the store fails they are kept, along with the ones that arrive in the meantime, for the next flush
+func (r *Recorder) Flush() error {
+
+	r.mutex.Lock()
+
+	if len(r.pending) == 0 {
+		r.mutex.Unlock()
+		return nil
+	}
+
+	usages := make([]stores.QBindingUsage, 0, len(r.pending))
+	for _, usage := range r.pending {
+		usages = append(usages, usage)
+	}
+	r.pending = make(map[string]stores.QBindingUsage)
+
+	r.mutex.Unlock()
+
+	store := r.store.Clone()
+	defer store.Close()
+
+	if err := store.RecordBindingUsage(usages); err != nil {
+		LOGGER.Errorf("Could not record the usage of %v bindings. %v", len(usages), err.Error())
+		r.restore(usages)
+		return err
+	}
+
+	return nil
+}
+
+// restore merges the authentications that couldn't be recorded with the ones that arrived after them
+func (r *Recorder) restore(usages []stores.QBindingUsage) {
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, usage := range usages {
+		if newer, ok := r.pending[usage.UUID]; ok {
+			newer.Count += usage.Count
+			usage = newer
+		}
+		r.pending[usage.UUID] = usage
+	}
+}
+
+// Start flushes the pending authentications in the background, until the recorder is stopped
+func (r *Recorder) Start() {
+
+	if r == nil {
+		return
+	}
+
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+
+	go func() {
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		defer close(r.done)
+
+		for {
+			select {
+			case <-ticker.C:
+				r.Flush()
+			case <-r.flushes:
+				r.Flush()
+			case <-r.stop:
+				r.Flush()
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the started recorder, after flushing the pending authentications
+func (r *Recorder) Stop() {
+
+	if r == nil || r.stop == nil {
+		return
+	}
+
+	close(r.stop)
+	<-r.done
+}
@@ -0,0 +1,160 @@
+package usage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ARGOeu/argo-api-authn/config"
+	"github.com/ARGOeu/argo-api-authn/stores"
+	"github.com/stretchr/testify/suite"
+)
+
+type RecorderTestSuite struct {
+	suite.Suite
+}
+
+// failingStore fails to record the usage of the bindings while failing is set
+type failingStore struct {
+	*stores.Mockstore
+	failing bool
+}
+
+func (f *failingStore) Clone() stores.Store {
+	return f
+}
+
+func (f *failingStore) Close() {}
+
+func (f *failingStore) RecordBindingUsage(usages []stores.QBindingUsage) error {
+
+	if f.failing {
+		return errors.New("store is down")
+	}
+
+	return f.Mockstore.RecordBindingUsage(usages)
+}
+
+func (suite *RecorderTestSuite) binding(store *stores.Mockstore, uuid string) stores.QBinding {
+
+	qBindings, _ := store.QueryBindingsByUUIDAndName(uuid, "")
+	suite.Require().Len(qBindings, 1)
+
+	return qBindings[0]
+}
+
+func (suite *RecorderTestSuite) TestRecordAndFlush() {
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	r := New(mockstore, time.Minute, 0)
+	now := time.Date(2019, 5, 5, 15, 4, 5, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	r.Record("b_uuid1", "10.0.0.1")
+	now = now.Add(time.Minute)
+	r.Record("b_uuid1", "10.0.0.2")
+	r.Record("b_uuid3", "10.0.0.3")
+
+	// nothing is written until the authentications are flushed
+	suite.Equal(int64(0), suite.binding(mockstore, "b_uuid1").AuthCount)
+
+	suite.Nil(r.Flush())
+
+	b1 := suite.binding(mockstore, "b_uuid1")
+	suite.Equal(int64(2), b1.AuthCount)
+	suite.Equal("2019-05-05T15:05:05Z", b1.LastAuth)
+	suite.Equal("10.0.0.2", b1.LastClientIP)
+	suite.Equal(int64(1), suite.binding(mockstore, "b_uuid3").AuthCount)
+	suite.Equal(int64(0), suite.binding(mockstore, "b_uuid2").AuthCount)
+
+	// flushed authentications are not written again
+	suite.Nil(r.Flush())
+	suite.Equal(int64(2), suite.binding(mockstore, "b_uuid1").AuthCount)
+}
+
+func (suite *RecorderTestSuite) TestFlushFailure() {
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+	store := &failingStore{Mockstore: mockstore, failing: true}
+
+	r := New(store, time.Minute, 0)
+
+	r.Record("b_uuid1", "10.0.0.1")
+	err1 := r.Flush()
+
+	// the authentications that couldn't be written are kept along with the newer ones
+	r.Record("b_uuid1", "10.0.0.2")
+	store.failing = false
+	err2 := r.Flush()
+
+	b1 := suite.binding(mockstore, "b_uuid1")
+
+	suite.Equal("store is down", err1.Error())
+	suite.Nil(err2)
+	suite.Equal(int64(2), b1.AuthCount)
+	suite.Equal("10.0.0.2", b1.LastClientIP)
+}
+
+func (suite *RecorderTestSuite) TestStartStop() {
+
+	mockstore := &stores.Mockstore{Server: "localhost", Database: "test_db"}
+	mockstore.SetUp()
+
+	// a full batch is flushed before the interval ends
+	r := New(mockstore, time.Hour, 2)
+	r.Start()
+
+	r.Record("b_uuid1", "10.0.0.1")
+	r.Record("b_uuid2", "10.0.0.1")
+
+	pending := func() int {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		return len(r.pending)
+	}
+
+	for i := 0; i < 100 && pending() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	suite.Equal(0, pending())
+
+	// stopping the recorder flushes the pending authentications
+	r.Record("b_uuid3", "10.0.0.1")
+	r.Stop()
+
+	suite.Equal(int64(1), suite.binding(mockstore, "b_uuid1").AuthCount)
+	suite.Equal(int64(1), suite.binding(mockstore, "b_uuid2").AuthCount)
+	suite.Equal(int64(1), suite.binding(mockstore, "b_uuid3").AuthCount)
+}
+
+func (suite *RecorderTestSuite) TestNilRecorder() {
+
+	var r *Recorder
+
+	// a nil recorder, the one of a disabled configuration, ignores the authentications
+	r.Start()
+	r.Record("b_uuid1", "10.0.0.1")
+	r.Stop()
+}
+
+func (suite *RecorderTestSuite) TestFromConfig() {
+
+	mockstore := &stores.Mockstore{}
+
+	r1 := FromConfig(mockstore, &config.Config{})
+	r2 := FromConfig(mockstore, &config.Config{BindingUsage: config.BindingUsage{FlushInterval: 5, BatchSize: 20}})
+	r3 := FromConfig(mockstore, &config.Config{BindingUsage: config.BindingUsage{Disabled: true}})
+
+	suite.Equal(DefaultFlushInterval*time.Second, r1.interval)
+	suite.Equal(DefaultBatchSize, r1.batchSize)
+	suite.Equal(5*time.Second, r2.interval)
+	suite.Equal(20, r2.batchSize)
+	suite.Nil(r3)
+}
+
+func TestRecorderTestSuite(t *testing.T) {
+	suite.Run(t, new(RecorderTestSuite))
+}
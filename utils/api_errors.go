@@ -9,49 +9,96 @@ import (
 
 var APIErrBadRequest = func(msg string) *APIError {
 	msg = fmt.Sprintf("Poorly formatted JSON. %v", msg)
-	return &APIError{msg, 400, "BAD REQUEST"}
+	return &APIError{Message: msg, Code: 400, Status: "BAD REQUEST"}
+}
+
+var APIErrInvalidParameter = func(param string, reason string) *APIError {
+	msg := fmt.Sprintf("Parameter: %v contains invalid data. %v", param, reason)
+	return &APIError{Message: msg, Code: 400, Status: "BAD REQUEST"}
 }
 
 var APIErrUnauthorized = func(msg string) *APIError {
-	return &APIError{msg, 401, "UNAUTHORIZED"}
+	return &APIError{Message: msg, Code: 401, Status: "UNAUTHORIZED"}
+}
+
+var APIErrForbidden = func(msg string) *APIError {
+	return &APIError{Message: msg, Code: 403, Status: "FORBIDDEN"}
 }
 
 var APIErrNotFound = func(resource string) *APIError {
 	msg := fmt.Sprintf("%v was not found", resource)
-	return &APIError{msg, 404, "NOT FOUND"}
+	return &APIError{Message: msg, Code: 404, Status: "NOT FOUND"}
+}
+
+var APIErrBindingSuspended = func(reason string) *APIError {
+	msg := "Binding has been suspended"
+	if reason != "" {
+		msg = fmt.Sprintf("%v. %v", msg, reason)
+	}
+	return &APIError{Message: msg, Code: 403, Status: "FORBIDDEN"}
+}
+
+var APIErrBindingNotYetValid = func(notBefore string) *APIError {
+	msg := fmt.Sprintf("Binding is not valid before %v", notBefore)
+	return &APIError{Message: msg, Code: 403, Status: "FORBIDDEN"}
+}
+
+var APIErrBindingExpired = func(notAfter string) *APIError {
+	msg := fmt.Sprintf("Binding expired on %v", notAfter)
+	return &APIError{Message: msg, Code: 403, Status: "FORBIDDEN"}
+}
+
+var APIErrAuthMethodNameRequired = func() *APIError {
+	msg := "More than one auth methods are registered for the host, the name of the auth method should be provided"
+	return &APIError{Message: msg, Code: 422, Status: "UNPROCESSABLE ENTITY"}
 }
 
 var APIErrConflict = func(resource string, field string, value string) *APIError {
 	msg := fmt.Sprintf("%v object with %v: %v already exists", resource, field, value)
-	return &APIError{msg, 409, "CONFLICT"}
+	return &APIError{Message: msg, Code: 409, Status: "CONFLICT"}
+}
+
+var APIErrInUse = func(resource string, dependents string, hint string) *APIError {
+	msg := fmt.Sprintf("%v are still in use: %v. %v", resource, dependents, hint)
+	return &APIError{Message: msg, Code: 409, Status: "CONFLICT"}
+}
+
+var APIErrPreconditionFailed = func(resource string) *APIError {
+	msg := fmt.Sprintf("%v has been modified since it was retrieved", resource)
+	return &APIError{Message: msg, Code: 412, Status: "PRECONDITION FAILED"}
 }
 
 var APIErrEmptyRequiredField = func(resource string, msg string) *APIError {
-	return &APIError{fmt.Sprintf("%v object contains empty fields. %v", resource, msg), 422, "UNPROCESSABLE ENTITY"}
+	return &APIError{Message: fmt.Sprintf("%v object contains empty fields. %v", resource, msg), Code: 422, Status: "UNPROCESSABLE ENTITY"}
 }
 
 var APIErrInvalidFieldContent = func(field string, reason string) *APIError {
 	msg := fmt.Sprintf("Field: %v contains invalid data. %v", field, reason)
-	return &APIError{msg, 422, "UNPROCESSABLE ENTITY"}
+	return &APIError{Message: msg, Code: 422, Status: "UNPROCESSABLE ENTITY"}
 }
 
 var APIErrUnsupportedContentNonVerbose = func(place, content string) *APIError {
 	msg := fmt.Sprintf("%v: %v is not yet supported", place, content)
-	return &APIError{msg, 422, "UNPROCESSABLE ENTITY"}
+	return &APIError{Message: msg, Code: 422, Status: "UNPROCESSABLE ENTITY"}
 }
 
 var APIErrUnsupportedContent = func(place, content string, supported string) *APIError {
 	msg := fmt.Sprintf("%v: %v is not yet supported.%v", place, content, supported)
-	return &APIError{msg, 422, "UNPROCESSABLE ENTITY"}
+	return &APIError{Message: msg, Code: 422, Status: "UNPROCESSABLE ENTITY"}
 }
 
 var APIErrDatabase = func(msg string) *APIError {
 	msg = fmt.Sprintf("Database Error: %v", msg)
-	return &APIError{msg, 500, "INTERNAL SERVER ERROR"}
+	return &APIError{Message: msg, Code: 500, Status: "INTERNAL SERVER ERROR"}
+}
+
+var APIErrBadGateway = func(msg string) *APIError {
+	msg = fmt.Sprintf("Bad Gateway: %v", msg)
+	return &APIError{Message: msg, Code: 502, Status: "BAD GATEWAY"}
 }
 
 var APIGenericInternalError = func(msg string) error {
-	return &APIError{"Internal Error: " + msg, 500, "INTERNAL SERVER ERROR"}
+	return &APIError{Message: "Internal Error: " + msg, Code: 500, Status: "INTERNAL SERVER ERROR"}
 }
 
 // Generic Errors
@@ -14,25 +14,45 @@ func (suite *APIErrorsTestSuite) TestAllErrors() {
 	testMsg := "errMsg"
 	testPlc := "errPlace"
 
-	errBadRequest := &APIError{"Poorly formatted JSON. errMsg", 400, "BAD REQUEST"}
-	errUnauthorized := &APIError{"errMsg", 401, "UNAUTHORIZED"}
-	errNotFound := &APIError{"errMsg was not found", 404, "NOT FOUND"}
-	errConflict := &APIError{"errMsg object with errMsg: errMsg already exists", 409, "CONFLICT"}
-	errMissingRequired := &APIError{"errMsg object contains empty fields. empty value for field some_field", 422, "UNPROCESSABLE ENTITY"}
-	errInvalidField := &APIError{"Field: errMsg contains invalid data. reason", 422, "UNPROCESSABLE ENTITY"}
-	errUnsupportedContent := &APIError{"errPlace: errMsg is not yet supported.Supported: err", 422, "UNPROCESSABLE ENTITY"}
-	errDatabase := &APIError{"Database Error: errMsg", 500, "INTERNAL SERVER ERROR"}
+	errBadRequest := &APIError{Message: "Poorly formatted JSON. errMsg", Code: 400, Status: "BAD REQUEST"}
+	errInvalidParameter := &APIError{Message: "Parameter: errMsg contains invalid data. reason", Code: 400, Status: "BAD REQUEST"}
+	errUnauthorized := &APIError{Message: "errMsg", Code: 401, Status: "UNAUTHORIZED"}
+	errForbidden := &APIError{Message: "errMsg", Code: 403, Status: "FORBIDDEN"}
+	errNotFound := &APIError{Message: "errMsg was not found", Code: 404, Status: "NOT FOUND"}
+	errBindingSuspended := &APIError{Message: "Binding has been suspended. errMsg", Code: 403, Status: "FORBIDDEN"}
+	errBindingSuspendedNoReason := &APIError{Message: "Binding has been suspended", Code: 403, Status: "FORBIDDEN"}
+	errBindingNotYetValid := &APIError{Message: "Binding is not valid before errMsg", Code: 403, Status: "FORBIDDEN"}
+	errBindingExpired := &APIError{Message: "Binding expired on errMsg", Code: 403, Status: "FORBIDDEN"}
+	errAuthMethodNameRequired := &APIError{Message: "More than one auth methods are registered for the host, the name of the auth method should be provided", Code: 422, Status: "UNPROCESSABLE ENTITY"}
+	errConflict := &APIError{Message: "errMsg object with errMsg: errMsg already exists", Code: 409, Status: "CONFLICT"}
+	errInUse := &APIError{Message: "errPlace are still in use: errMsg. hint", Code: 409, Status: "CONFLICT"}
+	errPreconditionFailed := &APIError{Message: "errMsg has been modified since it was retrieved", Code: 412, Status: "PRECONDITION FAILED"}
+	errMissingRequired := &APIError{Message: "errMsg object contains empty fields. empty value for field some_field", Code: 422, Status: "UNPROCESSABLE ENTITY"}
+	errInvalidField := &APIError{Message: "Field: errMsg contains invalid data. reason", Code: 422, Status: "UNPROCESSABLE ENTITY"}
+	errUnsupportedContent := &APIError{Message: "errPlace: errMsg is not yet supported.Supported: err", Code: 422, Status: "UNPROCESSABLE ENTITY"}
+	errDatabase := &APIError{Message: "Database Error: errMsg", Code: 500, Status: "INTERNAL SERVER ERROR"}
+	errBadGateway := &APIError{Message: "Bad Gateway: errMsg", Code: 502, Status: "BAD GATEWAY"}
 	errGenericMissing := "empty value for field: errMsg"
-	errGenericInternal := &APIError{"Internal Error: errMsg", 500, "INTERNAL SERVER ERROR"}
+	errGenericInternal := &APIError{Message: "Internal Error: errMsg", Code: 500, Status: "INTERNAL SERVER ERROR"}
 
 	suite.Equal(errBadRequest, APIErrBadRequest(testMsg))
+	suite.Equal(errInvalidParameter, APIErrInvalidParameter(testMsg, "reason"))
 	suite.Equal(errUnauthorized, APIErrUnauthorized(testMsg))
+	suite.Equal(errForbidden, APIErrForbidden(testMsg))
 	suite.Equal(errNotFound, APIErrNotFound(testMsg))
+	suite.Equal(errBindingSuspended, APIErrBindingSuspended(testMsg))
+	suite.Equal(errBindingSuspendedNoReason, APIErrBindingSuspended(""))
+	suite.Equal(errBindingNotYetValid, APIErrBindingNotYetValid(testMsg))
+	suite.Equal(errBindingExpired, APIErrBindingExpired(testMsg))
+	suite.Equal(errAuthMethodNameRequired, APIErrAuthMethodNameRequired())
 	suite.Equal(errConflict, APIErrConflict(testMsg, testMsg, testMsg))
+	suite.Equal(errInUse, APIErrInUse(testPlc, testMsg, "hint"))
+	suite.Equal(errPreconditionFailed, APIErrPreconditionFailed(testMsg))
 	suite.Equal(errMissingRequired, APIErrEmptyRequiredField(testMsg, "empty value for field some_field"))
 	suite.Equal(errInvalidField, APIErrInvalidFieldContent(testMsg, "reason"))
 	suite.Equal(errUnsupportedContent, APIErrUnsupportedContent(testPlc, testMsg, "Supported: err"))
 	suite.Equal(errDatabase, APIErrDatabase(testMsg))
+	suite.Equal(errBadGateway, APIErrBadGateway(testMsg))
 	suite.Equal(errGenericMissing, GenericEmptyRequiredField("errMsg").Error())
 	suite.Equal(errGenericInternal, APIGenericInternalError(testMsg))
 }
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSONPathStep represents a single step of a json path expression, either a key of an object or an index of an array
+type JSONPathStep struct {
+	Key     string
+	Index   int
+	IsIndex bool
+}
+
+// ParseJSONPath parses expressions like `$.data[0].api_key`, `data[0].api_key`, `$['data'][-1]` or plain `token`
+// into a slice of steps
+func ParseJSONPath(expr string) ([]JSONPathStep, error) {
+
+	var steps []JSONPathStep
+
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return steps, errors.New("empty json path expression")
+	}
+
+	// the root symbol is optional
+	expr = strings.TrimPrefix(expr, "$")
+	expr = strings.TrimPrefix(expr, ".")
+
+	i := 0
+	for i < len(expr) {
+		switch expr[i] {
+		case '.':
+			i++
+			if i == len(expr) || expr[i] == '.' || expr[i] == '[' {
+				return steps, fmt.Errorf("invalid json path expression: %v", expr)
+			}
+		case '[':
+			end := strings.Index(expr[i:], "]")
+			if end == -1 {
+				return steps, fmt.Errorf("unclosed bracket in json path expression: %v", expr)
+			}
+			inner := strings.TrimSpace(expr[i+1 : i+end])
+			i += end + 1
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				steps = append(steps, JSONPathStep{Key: inner[1 : len(inner)-1]})
+				continue
+			}
+			idx, err := strconv.Atoi(inner)
+			if err != nil {
+				return steps, fmt.Errorf("invalid array index: %v in json path expression: %v", inner, expr)
+			}
+			steps = append(steps, JSONPathStep{Index: idx, IsIndex: true})
+		default:
+			end := strings.IndexAny(expr[i:], ".[")
+			if end == -1 {
+				end = len(expr) - i
+			}
+			steps = append(steps, JSONPathStep{Key: expr[i : i+end]})
+			i += end
+		}
+	}
+
+	return steps, nil
+}
+
+// JSONPathLookup resolves the given json path expression against a decoded json document
+func JSONPathLookup(doc interface{}, expr string) (interface{}, error) {
+
+	var err error
+	var steps []JSONPathStep
+
+	if steps, err = ParseJSONPath(expr); err != nil {
+		return nil, err
+	}
+
+	current := doc
+	for _, step := range steps {
+		if step.IsIndex {
+			arr, ok := current.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("`%v` does not resolve, value is not an array", expr)
+			}
+			idx := step.Index
+			// negative indexes count from the end of the array
+			if idx < 0 {
+				idx += len(arr)
+			}
+			if idx < 0 || idx >= len(arr) {
+				return nil, fmt.Errorf("`%v` does not resolve, index %v is out of range", expr, step.Index)
+			}
+			current = arr[idx]
+			continue
+		}
+
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("`%v` does not resolve, value is not an object", expr)
+		}
+		if current, ok = obj[step.Key]; !ok {
+			return nil, fmt.Errorf("`%v` does not resolve, key `%v` is missing", expr, step.Key)
+		}
+	}
+
+	return current, nil
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type JSONPathTestSuite struct {
+	suite.Suite
+}
+
+func (suite *JSONPathTestSuite) TestParseJSONPath() {
+
+	steps1, err1 := ParseJSONPath("$.data[0].api_key")
+	steps2, err2 := ParseJSONPath("token")
+	steps3, err3 := ParseJSONPath("$['data'][-1]")
+	_, err4 := ParseJSONPath("")
+	_, err5 := ParseJSONPath("data[0")
+	_, err6 := ParseJSONPath("data[x]")
+	_, err7 := ParseJSONPath("data..key")
+
+	suite.Equal([]JSONPathStep{{Key: "data"}, {Index: 0, IsIndex: true}, {Key: "api_key"}}, steps1)
+	suite.Equal([]JSONPathStep{{Key: "token"}}, steps2)
+	suite.Equal([]JSONPathStep{{Key: "data"}, {Index: -1, IsIndex: true}}, steps3)
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Equal("empty json path expression", err4.Error())
+	suite.Equal("unclosed bracket in json path expression: data[0", err5.Error())
+	suite.Equal("invalid array index: x in json path expression: data[x]", err6.Error())
+	suite.Equal("invalid json path expression: data..key", err7.Error())
+}
+
+func (suite *JSONPathTestSuite) TestJSONPathLookup() {
+
+	var doc interface{}
+	json.Unmarshal([]byte(`{"token": "t1", "data": [{"api_key": "k1", "roles": ["admin"]}, {"api_key": "k2"}]}`), &doc)
+
+	v1, err1 := JSONPathLookup(doc, "token")
+	v2, err2 := JSONPathLookup(doc, "$.data[0].api_key")
+	v3, err3 := JSONPathLookup(doc, "data[-1].api_key")
+	v4, err4 := JSONPathLookup(doc, "data[0].roles")
+	_, err5 := JSONPathLookup(doc, "data[5].api_key")
+	_, err6 := JSONPathLookup(doc, "token[0]")
+	_, err7 := JSONPathLookup(doc, "data.api_key")
+	_, err8 := JSONPathLookup(doc, "missing")
+
+	suite.Equal("t1", v1)
+	suite.Equal("k1", v2)
+	suite.Equal("k2", v3)
+	suite.Equal([]interface{}{"admin"}, v4)
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Nil(err3)
+	suite.Nil(err4)
+	suite.Equal("`data[5].api_key` does not resolve, index 5 is out of range", err5.Error())
+	suite.Equal("`token[0]` does not resolve, value is not an array", err6.Error())
+	suite.Equal("`data.api_key` does not resolve, value is not an object", err7.Error())
+	suite.Equal("`missing` does not resolve, key `missing` is missing", err8.Error())
+}
+
+func TestJSONPathTestSuite(t *testing.T) {
+	suite.Run(t, new(JSONPathTestSuite))
+}
@@ -17,9 +17,15 @@ type ErrResp struct {
 }
 
 type APIError struct {
-	Message string `json:"message"`
-	Code    int    `json:"code"`
-	Status  string `json:"status"`
+	Message       string `json:"message"`
+	Code          int    `json:"code"`
+	Status        string `json:"status"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// UpstreamCode is the status code of the service type's response that caused the error, if any
+	UpstreamCode int `json:"-"`
+	// UpstreamUnavailable marks errors caused by the service type not being able to serve the request,
+	// either because it couldn't be reached, it failed with a 5xx or its circuits were open
+	UpstreamUnavailable bool `json:"-"`
 }
 
 func (e *APIError) Error() string {
@@ -167,6 +167,77 @@ func CopyFields(from interface{}, to interface{}) error {
 	return nil
 }
 
+// TransformTaggedFields returns a copy of the given struct, or pointer to struct, where the values of the fields
+// that have the given tag set to "true" have been transformed by the given function.
+// Tagged fields can either be strings or maps of strings, fields of embedded structs are also transformed.
+// The given instance is never modified
+func TransformTaggedFields(instance interface{}, tag string, transform func(string) (string, error)) (interface{}, error) {
+
+	v := reflect.Indirect(reflect.ValueOf(instance))
+	if v.Kind() != reflect.Struct {
+		return instance, nil
+	}
+
+	cp := reflect.New(v.Type())
+	cp.Elem().Set(v)
+
+	if err := transformTaggedFields(cp.Elem(), tag, transform); err != nil {
+		return instance, err
+	}
+
+	// keep the kind of the given instance
+	if reflect.ValueOf(instance).Kind() != reflect.Ptr {
+		return cp.Elem().Interface(), nil
+	}
+
+	return cp.Interface(), nil
+}
+
+func transformTaggedFields(v reflect.Value, tag string, transform func(string) (string, error)) error {
+
+	for i := 0; i < v.NumField(); i++ {
+
+		fl := v.Type().Field(i)
+		fv := v.Field(i)
+
+		if fl.Anonymous && fv.Kind() == reflect.Struct {
+			if err := transformTaggedFields(fv, tag, transform); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if fl.Tag.Get(tag) != "true" || fl.PkgPath != "" {
+			continue
+		}
+
+		switch fv.Kind() {
+		case reflect.String:
+			s, err := transform(fv.String())
+			if err != nil {
+				return err
+			}
+			fv.SetString(s)
+		case reflect.Map:
+			if fv.IsNil() || fv.Type().Elem().Kind() != reflect.String {
+				continue
+			}
+			// build a new map, so the map of the given instance is not modified
+			m := reflect.MakeMapWithSize(fv.Type(), fv.Len())
+			for _, mk := range fv.MapKeys() {
+				s, err := transform(fv.MapIndex(mk).String())
+				if err != nil {
+					return err
+				}
+				m.SetMapIndex(mk, reflect.ValueOf(s).Convert(fv.Type().Elem()))
+			}
+			fv.Set(m)
+		}
+	}
+
+	return nil
+}
+
 // ZuluTimeNow returns the current UTC time in zulu format
 func ZuluTimeNow() string {
 	return time.Now().UTC().Format(ZULU_FORM)
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"errors"
+	"strings"
 
 	"github.com/stretchr/testify/suite"
 )
@@ -172,6 +173,46 @@ func (suite *UtilsTestSuite) TestCopyFields() {
 
 }
 
+func (suite *UtilsTestSuite) TestTransformTaggedFields() {
+
+	type Embedded struct {
+		Token string `secret:"true"`
+	}
+
+	type Tagged struct {
+		Embedded
+		Name    string
+		Key     string            `secret:"true"`
+		Headers map[string]string `secret:"true"`
+	}
+
+	upper := func(s string) (string, error) {
+		return strings.ToUpper(s), nil
+	}
+
+	t1 := &Tagged{Embedded: Embedded{Token: "token"}, Name: "name", Key: "key", Headers: map[string]string{"h": "value"}}
+
+	// pointer to struct
+	r1, err1 := TransformTaggedFields(t1, "secret", upper)
+
+	// struct
+	r2, err2 := TransformTaggedFields(*t1, "secret", upper)
+
+	// failed transformation
+	_, err3 := TransformTaggedFields(t1, "secret", func(s string) (string, error) {
+		return "", errors.New("failed")
+	})
+
+	suite.Nil(err1)
+	suite.Nil(err2)
+	suite.Equal(&Tagged{Embedded: Embedded{Token: "TOKEN"}, Name: "name", Key: "KEY", Headers: map[string]string{"h": "VALUE"}}, r1)
+	suite.Equal(Tagged{Embedded: Embedded{Token: "TOKEN"}, Name: "name", Key: "KEY", Headers: map[string]string{"h": "VALUE"}}, r2)
+	suite.Equal("failed", err3.Error())
+
+	// the given instance is not modified
+	suite.Equal(&Tagged{Embedded: Embedded{Token: "token"}, Name: "name", Key: "key", Headers: map[string]string{"h": "value"}}, t1)
+}
+
 func TestUtilsTestSuite(t *testing.T) {
 	utilsTestSuite := new(UtilsTestSuite)
 	utilsTestSuite.SetUpUtilsTestSuite()